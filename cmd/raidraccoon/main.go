@@ -6,16 +6,22 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"raidraccoon/internal/config"
+	"raidraccoon/internal/devd"
+	"raidraccoon/internal/drives"
 	"raidraccoon/internal/httpd"
 	"raidraccoon/internal/rsync"
+	"raidraccoon/internal/window"
 	"raidraccoon/internal/zfs"
 )
 
@@ -37,6 +43,18 @@ func main() {
 		runReplicate(os.Args[2:])
 	case "rsync":
 		runRsync(os.Args[2:])
+	case "trim":
+		runTrim(os.Args[2:])
+	case "smarttest":
+		runSMARTTest(os.Args[2:])
+	case "bootenv":
+		runBootEnv(os.Args[2:])
+	case "stream-export":
+		runStreamExport(os.Args[2:])
+	case "stream-import":
+		runStreamImport(os.Args[2:])
+	case "devd-replay":
+		runDevdReplay(os.Args[2:])
 	default:
 		runServe(os.Args[1:])
 	}
@@ -163,6 +181,8 @@ func runSnapshot(args []string) {
 	dataset := fs.String("dataset", "", "dataset name")
 	retention := fs.Int("retention", 7, "retention count")
 	prefix := fs.String("prefix", "", "snapshot prefix")
+	template := fs.String("template", "", "snapshot name template, e.g. %p-%Y%m%d-%H%M%S")
+	utc := fs.Bool("utc", false, "use UTC timestamps in snapshot names")
 	recursive := fs.Bool("recursive", false, "snapshot recursively")
 	_ = fs.Parse(args)
 
@@ -183,13 +203,18 @@ func runSnapshot(args []string) {
 	if snapPrefix == "" {
 		snapPrefix = cfg.ZFS.SnapshotPrefix
 	}
-	name := zfs.BuildSnapshotName(snapPrefix, time.Now())
+	naming := zfs.NameTemplate{Pattern: *template, Prefix: snapPrefix, UTC: *utc}
+	if err := naming.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid template: %v\n", err)
+		os.Exit(1)
+	}
+	name := naming.Format(time.Now())
 	res, err := zfs.CreateSnapshot(context.Background(), cfg, *dataset, name, *recursive)
 	if err != nil || res.ExitCode != 0 {
 		fmt.Fprintf(os.Stderr, "snapshot failed: %s\n", res.Stderr)
 		os.Exit(1)
 	}
-	_, err = zfs.EnforceRetention(context.Background(), cfg, *dataset, snapPrefix, *retention)
+	_, err = zfs.EnforceRetention(context.Background(), cfg, *dataset, naming, *retention)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "retention cleanup failed: %v\n", err)
 		os.Exit(1)
@@ -203,9 +228,27 @@ func runReplicate(args []string) {
 	source := fs.String("source", "", "source dataset")
 	target := fs.String("target", "", "target dataset")
 	prefix := fs.String("prefix", "", "snapshot prefix")
+	template := fs.String("template", "", "snapshot name template, e.g. %p-%Y%m%d-%H%M%S")
+	utc := fs.Bool("utc", false, "use UTC timestamps in snapshot names")
 	retention := fs.Int("retention", 0, "retention count")
 	recursive := fs.Bool("recursive", false, "replicate recursively")
 	force := fs.Bool("force", false, "force rollback on target")
+	reseed := fs.Bool("reseed", false, "destroy and resend the target when it shares no snapshot with the source")
+	raw := fs.Bool("raw", false, "send raw encrypted streams (zfs send -w)")
+	compressed := fs.Bool("compressed", false, "send compressed blocks as-is (zfs send -c)")
+	largeBlock := fs.Bool("large-block", false, "allow blocks larger than 128K (zfs send -L)")
+	embedded := fs.Bool("embedded", false, "send embedded data blocks (zfs send -e)")
+	sendProps := fs.Bool("send-props", false, "include dataset properties (zfs send -p)")
+	recvExclude := fs.String("recv-exclude", "", "comma-separated properties to exclude on receive (zfs recv -x)")
+	recvProps := fs.String("recv-props", "", "comma-separated name=value overrides on receive (zfs recv -o)")
+	bwlimit := fs.Int64("bwlimit", 0, "limit the send stream to KiB/s (0 = unlimited)")
+	windowSpec := fs.String("window", "", "allowed time windows, e.g. 22:00-06:00,12:00-13:00")
+	windowStart := fs.String("window-start", window.BeforeWait, "outside the window at start: wait or skip")
+	windowClose := fs.String("window-close", window.ClosePause, "when the window closes mid-run: pause or cancel")
+	sshPort := fs.Int("ssh-port", 0, "ssh port for remote targets")
+	cipher := fs.String("cipher", "", "ssh cipher for remote targets")
+	compress := fs.Bool("compress", false, "enable ssh compression")
+	remoteSudo := fs.Bool("remote-sudo", false, "run zfs recv via sudo on the remote host")
 	_ = fs.Parse(args)
 
 	cfg, err := config.Load(*configPath)
@@ -221,7 +264,7 @@ func runReplicate(args []string) {
 		fmt.Fprintln(os.Stderr, "invalid source dataset")
 		os.Exit(1)
 	}
-	if !zfs.ValidDatasetName(*target) || !zfs.ValidateDataset(cfg, *target) {
+	if !zfs.ValidReplicationTarget(*target) {
 		fmt.Fprintln(os.Stderr, "invalid target dataset")
 		os.Exit(1)
 	}
@@ -229,12 +272,65 @@ func runReplicate(args []string) {
 		fmt.Fprintln(os.Stderr, "invalid prefix")
 		os.Exit(1)
 	}
-	res, err := zfs.ReplicateDataset(context.Background(), cfg, *source, *target, *prefix, *retention, *recursive, *force)
+	if err := (zfs.NameTemplate{Pattern: *template, Prefix: *prefix, UTC: *utc}).Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid template: %v\n", err)
+		os.Exit(1)
+	}
+	if *cipher != "" && !zfs.ValidSSHCipher(*cipher) {
+		fmt.Fprintln(os.Stderr, "invalid cipher")
+		os.Exit(1)
+	}
+	policy, err := window.ParsePolicy(*windowSpec, *windowStart, *windowClose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid window: %v\n", err)
+		os.Exit(1)
+	}
+	if *bwlimit < 0 {
+		fmt.Fprintln(os.Stderr, "--bwlimit must be >= 0")
+		os.Exit(1)
+	}
+	excludes := zfs.SplitPropertyList(*recvExclude)
+	overrides := zfs.SplitPropertyList(*recvProps)
+	if err := zfs.ValidateRecvOverrides(excludes, overrides); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	opts := zfs.ReplicationOptions{
+		Prefix:         *prefix,
+		Template:       *template,
+		UTC:            *utc,
+		Retention:      *retention,
+		Recursive:      *recursive,
+		Force:          *force,
+		Reseed:         *reseed,
+		Raw:            *raw,
+		Compressed:     *compressed,
+		LargeBlock:     *largeBlock,
+		Embedded:       *embedded,
+		SendProps:      *sendProps,
+		RecvExclude:    excludes,
+		RecvProps:      overrides,
+		BandwidthLimit: *bwlimit,
+		Window:         policy,
+		SSH: zfs.SSHOptions{
+			Port:       *sshPort,
+			Cipher:     *cipher,
+			Compress:   *compress,
+			RemoteSudo: *remoteSudo,
+		},
+	}
+	var last zfs.TransferProgress
+	opts.Progress = func(p zfs.TransferProgress) { last = p }
+	res, err := zfs.ReplicateDataset(context.Background(), cfg, *source, *target, opts)
+	if errors.Is(err, window.ErrSkipped) {
+		fmt.Printf("Replication skipped: %s -> %s is outside its time window\n", *source, *target)
+		return
+	}
 	if err != nil || res.ExitCode != 0 {
 		fmt.Fprintf(os.Stderr, "replication failed: %s\n", res.Stderr)
 		os.Exit(1)
 	}
-	fmt.Printf("Replication completed: %s -> %s\n", *source, *target)
+	fmt.Printf("Replication completed: %s -> %s (%d bytes in %.0fs)\n", *source, *target, last.Bytes, last.Elapsed)
 }
 
 func runRsync(args []string) {
@@ -243,6 +339,10 @@ func runRsync(args []string) {
 	source := fs.String("source", "", "source path")
 	target := fs.String("target", "", "target path")
 	flagsRaw := fs.String("flags", "", "comma-separated rsync flags")
+	bwlimit := fs.Int64("bwlimit", 0, "limit rsync bandwidth to KiB/s (0 = unlimited)")
+	windowSpec := fs.String("window", "", "allowed time windows, e.g. 22:00-06:00,12:00-13:00")
+	windowStart := fs.String("window-start", window.BeforeWait, "outside the window at start: wait or skip")
+	windowClose := fs.String("window-close", window.ClosePause, "when the window closes mid-run: pause or cancel")
 	_ = fs.Parse(args)
 
 	cfg, err := config.Load(*configPath)
@@ -254,11 +354,248 @@ func runRsync(args []string) {
 		fmt.Fprintln(os.Stderr, "--source and --target are required")
 		os.Exit(1)
 	}
+	policy, err := window.ParsePolicy(*windowSpec, *windowStart, *windowClose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid window: %v\n", err)
+		os.Exit(1)
+	}
 	flags := rsync.SplitFlags(*flagsRaw)
-	res, err := rsync.Run(context.Background(), cfg, *source, *target, flags)
+	if flag := rsync.BandwidthFlag(*bwlimit); flag != "" {
+		flags = append(flags, flag)
+	}
+	res, err := rsync.RunWindowed(context.Background(), cfg, *source, *target, flags, policy)
+	if errors.Is(err, window.ErrSkipped) {
+		fmt.Printf("Rsync skipped: %s -> %s is outside its time window\n", *source, *target)
+		return
+	}
 	if err != nil || res.ExitCode != 0 {
 		fmt.Fprintf(os.Stderr, "rsync failed: %s\n", res.Stderr)
 		os.Exit(1)
 	}
 	fmt.Printf("Rsync completed: %s -> %s\n", *source, *target)
 }
+
+func runTrim(args []string) {
+	fs := flag.NewFlagSet("trim", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(false), "config path")
+	pool := fs.String("pool", "", "pool name")
+	rate := fs.String("rate", "", "trim rate per device (e.g. 100M)")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *pool == "" {
+		fmt.Fprintln(os.Stderr, "--pool is required")
+		os.Exit(1)
+	}
+	if !zfs.ValidPoolName(*pool) {
+		fmt.Fprintln(os.Stderr, "invalid pool name")
+		os.Exit(1)
+	}
+	if *rate != "" && !zfs.ValidTrimRate(*rate) {
+		fmt.Fprintln(os.Stderr, "invalid rate (use e.g. 100M)")
+		os.Exit(1)
+	}
+	res, err := zfs.TrimPool(context.Background(), cfg, *pool, "start", nil, *rate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trim failed: %v\n", err)
+		os.Exit(1)
+	}
+	if res.ExitCode != 0 {
+		fmt.Fprintf(os.Stderr, "trim failed: %s\n", res.Stderr)
+		os.Exit(1)
+	}
+	fmt.Printf("Trim started: %s\n", *pool)
+}
+
+// runSMARTTest runs SMART self-tests from cron, waits for them to finish and records
+// the results in the self-test history.
+func runSMARTTest(args []string) {
+	fs := flag.NewFlagSet("smarttest", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(false), "config path")
+	test := fs.String("test", "short", "self-test to run: short or long")
+	devices := fs.String("devices", "", "comma-separated disks (default: all)")
+	noWait := fs.Bool("no-wait", false, "start the tests and exit without recording results")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if !drives.ValidSelfTest(*test) {
+		fmt.Fprintln(os.Stderr, "--test must be short or long")
+		os.Exit(1)
+	}
+	var names []string
+	for _, name := range strings.Split(*devices, ",") {
+		name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "/dev/"))
+		if name == "" {
+			continue
+		}
+		if !drives.ValidDiskName(name) {
+			fmt.Fprintf(os.Stderr, "invalid disk name %q\n", name)
+			os.Exit(1)
+		}
+		names = append(names, name)
+	}
+	recorded, err := drives.RunSelfTests(context.Background(), cfg, drives.SelfTestOptions{
+		Devices: names,
+		Test:    *test,
+		Wait:    !*noWait,
+		Log:     func(line string) { fmt.Println(line) },
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smarttest failed: %v\n", err)
+		os.Exit(1)
+	}
+	failed := 0
+	for _, rec := range recorded {
+		if rec.Result == drives.SelfTestFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "smarttest: %d self-test(s) failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Printf("SMART %s self-tests done: %d result(s) recorded\n", *test, len(recorded))
+}
+
+// runBootEnv creates a boot environment clone of the running system, meant to be run
+// right before freebsd-update or pkg upgrades.
+func runBootEnv(args []string) {
+	fs := flag.NewFlagSet("bootenv", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(false), "config path")
+	prefix := fs.String("prefix", "preupgrade", "boot environment name prefix")
+	keep := fs.Int("keep", 3, "boot environments with this prefix to keep (0 = all)")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *keep < 0 {
+		fmt.Fprintln(os.Stderr, "--keep must be >= 0")
+		os.Exit(1)
+	}
+	name, pruned, err := zfs.CreatePreUpgradeBootEnvironment(context.Background(), cfg, zfs.PreUpgradeOptions{Prefix: *prefix, Keep: *keep})
+	if name != "" {
+		fmt.Printf("Boot environment created: %s\n", name)
+	}
+	for _, be := range pruned {
+		fmt.Printf("Boot environment destroyed: %s\n", be)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bootenv failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runStreamExport(args []string) {
+	fs := flag.NewFlagSet("stream-export", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(false), "config path")
+	snapshot := fs.String("snapshot", "", "snapshot to send (pool/ds@snap)")
+	base := fs.String("base", "", "earlier snapshot for an incremental stream (zfs send -I)")
+	dir := fs.String("dir", "", "directory for the stream file and manifest")
+	raw := fs.Bool("raw", false, "send raw encrypted streams (zfs send -w)")
+	compressed := fs.Bool("compressed", false, "send compressed blocks as-is (zfs send -c)")
+	recursive := fs.Bool("recursive", false, "include child datasets (zfs send -R)")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *snapshot == "" || *dir == "" {
+		fmt.Fprintln(os.Stderr, "--snapshot and --dir are required")
+		os.Exit(1)
+	}
+	*dir, _ = filepath.Abs(*dir)
+	entry, err := zfs.ExportStream(context.Background(), cfg, zfs.StreamExportOptions{
+		Snapshot:  *snapshot,
+		Base:      *base,
+		Dir:       *dir,
+		Raw:       *raw,
+		Compress:  *compressed,
+		Recursive: *recursive,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stream export failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Stream written: %s (%d bytes, sha256 %s)\n", entry.File, entry.Size, entry.SHA256)
+}
+
+func runStreamImport(args []string) {
+	fs := flag.NewFlagSet("stream-import", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(false), "config path")
+	manifest := fs.String("manifest", "", "manifest written by stream-export")
+	target := fs.String("target", "", "dataset to receive into (default: the manifest dataset)")
+	force := fs.Bool("force", false, "roll back the target before receiving (zfs recv -F)")
+	verify := fs.Bool("verify", false, "only check sizes and checksums")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *manifest == "" {
+		fmt.Fprintln(os.Stderr, "--manifest is required")
+		os.Exit(1)
+	}
+	*manifest, _ = filepath.Abs(*manifest)
+	received, err := zfs.ImportStreams(context.Background(), cfg, zfs.StreamImportOptions{
+		Manifest:   *manifest,
+		Target:     *target,
+		Force:      *force,
+		VerifyOnly: *verify,
+		Log:        func(line string) { fmt.Println(line) },
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stream import failed: %v\n", err)
+		os.Exit(1)
+	}
+	if *verify {
+		fmt.Println("All streams match the manifest")
+		return
+	}
+	fmt.Printf("Streams received: %d\n", len(received))
+}
+
+// runDevdReplay stands in for devd: it serves recorded devd lines on a local seqpacket
+// socket so that `serve` with devd.socket pointed at it sees them as live events.
+func runDevdReplay(args []string) {
+	fs := flag.NewFlagSet("devd-replay", flag.ExitOnError)
+	socket := fs.String("socket", "", "socket path to listen on")
+	events := fs.String("events", "", "file of recorded devd lines (# comments allowed)")
+	interval := fs.Duration("interval", time.Second, "delay between events")
+	_ = fs.Parse(args)
+
+	if *socket == "" || *events == "" {
+		fmt.Fprintln(os.Stderr, "--socket and --events are required")
+		os.Exit(1)
+	}
+	if filepath.Clean(*socket) == devd.DefaultSocket {
+		fmt.Fprintln(os.Stderr, "refusing to replace the devd socket; choose another path")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(*events)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read events: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Printf("Replaying %s on %s (Ctrl-C to stop)\n", *events, *socket)
+	if err := devd.Serve(ctx, *socket, strings.Split(string(data), "\n"), *interval); err != nil {
+		fmt.Fprintf(os.Stderr, "devd replay failed: %v\n", err)
+		os.Exit(1)
+	}
+}
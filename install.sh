@@ -369,7 +369,7 @@ if [ "${INSTALL_SUDOERS}" -eq 1 ]; then
 # RaidRaccoon Deluxe sudoers (required for web UI actions)
 Defaults:${USER_NAME} secure_path="/sbin:/bin:/usr/sbin:/usr/bin:/usr/local/sbin:/usr/local/bin"
 # Allow only the system commands the UI needs
-${USER_NAME} ALL=(ALL) NOPASSWD: /sbin/zfs, /sbin/zpool, /sbin/geom, /sbin/sysctl, /usr/sbin/service, /usr/local/bin/smbpasswd, /usr/local/bin/pdbedit, /usr/local/bin/testparm, /usr/local/bin/rsync, /usr/sbin/sysrc, /sbin/shutdown, /usr/bin/install
+${USER_NAME} ALL=(ALL) NOPASSWD: /sbin/zfs, /sbin/zpool, /sbin/geom, /sbin/sysctl, /usr/sbin/service, /usr/local/bin/smbpasswd, /usr/local/bin/pdbedit, /usr/local/bin/testparm, /usr/local/bin/rsync, /usr/sbin/sysrc, /sbin/shutdown, /usr/bin/install, /sbin/bectl, /usr/local/sbin/smartctl, /sbin/gpart, /sbin/geli
 SUDO_EOF
   /usr/bin/install -m 0440 "$SUDOERS_TMP" /usr/local/etc/sudoers.d/raidraccoon
   /bin/rm -f "$SUDOERS_TMP"
@@ -387,6 +387,38 @@ fi
 /usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$AUDIT_LOG"
 /bin/chmod 0640 "$AUDIT_LOG"
 
+# Configuration directory: the GELI boot attach registry (service user) and the
+# root-only GELI keyfile directory
+CONF_DIR="/usr/local/etc/raidraccoon"
+/bin/mkdir -p "$CONF_DIR"
+/usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$CONF_DIR"
+/bin/chmod 0750 "$CONF_DIR"
+GELI_KEY_DIR="$CONF_DIR/geli"
+/bin/mkdir -p "$GELI_KEY_DIR"
+/usr/sbin/chown root:wheel "$GELI_KEY_DIR"
+/bin/chmod 0700 "$GELI_KEY_DIR"
+
+# State directory for replication history and other runtime data
+STATE_DIR="/var/db/raidraccoon"
+/bin/mkdir -p "$STATE_DIR"
+/usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$STATE_DIR"
+/bin/chmod 0750 "$STATE_DIR"
+REPL_HISTORY="$STATE_DIR/replication-history.jsonl"
+if [ ! -f "$REPL_HISTORY" ]; then
+  /usr/bin/touch "$REPL_HISTORY"
+fi
+/usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$REPL_HISTORY"
+/bin/chmod 0644 "$REPL_HISTORY"
+# ssh and ssh-keygen run as the service user with the managed replication key
+SSH_DIR="$STATE_DIR/ssh"
+/bin/mkdir -p "$SSH_DIR"
+/usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$SSH_DIR"
+/bin/chmod 0700 "$SSH_DIR"
+STATS_DIR="$STATE_DIR/stats"
+/bin/mkdir -p "$STATS_DIR"
+/usr/sbin/chown "$USER_NAME":"$GROUP_NAME" "$STATS_DIR"
+/bin/chmod 0750 "$STATS_DIR"
+
 # Set admin password only for a newly created config
 if [ "${CONFIG_CREATED}" -eq 1 ] && [ "${SET_PASSWORD}" -eq 1 ]; then
   if [ -n "$PASSWORD_VALUE" ]; then
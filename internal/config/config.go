@@ -6,8 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -32,6 +30,15 @@ type Paths struct {
 	Sysrc     string `json:"sysrc"`
 	Shutdown  string `json:"shutdown"`
 	Rsync     string `json:"rsync"`
+	SSH       string `json:"ssh"`
+	SSHKeygen string `json:"ssh_keygen"`
+	Bectl     string `json:"bectl"`
+	Smartctl  string `json:"smartctl"`
+	Gpart     string `json:"gpart"`
+	Mount     string `json:"mount"`
+	GELI      string `json:"geli"`
+	SwapCtl   string `json:"swapctl"`
+	Install   string `json:"install"`
 }
 
 type SambaConfig struct {
@@ -44,6 +51,33 @@ type ZFSConfig struct {
 	SnapshotPrefix string `json:"snapshot_prefix"`
 }
 
+// ReplicationConfig holds SSH settings shared by remote replication jobs and the
+// run history file.
+type ReplicationConfig struct {
+	KeyFile        string `json:"key_file"`
+	KnownHostsFile string `json:"known_hosts_file"`
+	RemoteZFS      string `json:"remote_zfs"`
+	HistoryFile    string `json:"history_file"`
+}
+
+// StatsConfig controls the background I/O statistics collector and its on-disk store.
+type StatsConfig struct {
+	DataDir         string `json:"data_dir"`
+	IntervalSeconds int    `json:"interval_seconds"`
+}
+
+// GELIConfig points at the root-only directory holding GELI keyfiles. Keyfiles are
+// referenced by name and read by geli itself, never by raidraccoon.
+type GELIConfig struct {
+	KeyDir string `json:"key_dir"`
+}
+
+// DevdConfig points at devd's seqpacket socket, used to follow disk attach/detach and
+// ZFS events instead of polling.
+type DevdConfig struct {
+	Socket string `json:"socket"`
+}
+
 type CronConfig struct {
 	CronFile string `json:"cron_file"`
 	CronUser string `json:"cron_user"`
@@ -79,20 +113,24 @@ type DashboardConfig struct {
 }
 
 type Config struct {
-	Server      ServerConfig    `json:"server"`
-	Auth        AuthConfig      `json:"auth"`
-	Paths       Paths           `json:"paths"`
-	Samba       SambaConfig     `json:"samba"`
-	ZFS         ZFSConfig       `json:"zfs"`
-	Cron        CronConfig      `json:"cron"`
-	Terminal    TerminalConfig  `json:"terminal"`
-	Dashboard   DashboardConfig `json:"dashboard"`
-	Limits      Limits          `json:"limits"`
-	Audit       AuditConfig     `json:"audit"`
-	AllowedCmds []string        `json:"allowed_cmds"`
-	BinaryPath  string          `json:"binary_path"`
-	ConfigPath  string          `json:"-"`
-	Unsafe      bool            `json:"-"`
+	Server      ServerConfig      `json:"server"`
+	Auth        AuthConfig        `json:"auth"`
+	Paths       Paths             `json:"paths"`
+	Samba       SambaConfig       `json:"samba"`
+	ZFS         ZFSConfig         `json:"zfs"`
+	Replication ReplicationConfig `json:"replication"`
+	Stats       StatsConfig       `json:"stats"`
+	GELI        GELIConfig        `json:"geli"`
+	Devd        DevdConfig        `json:"devd"`
+	Cron        CronConfig        `json:"cron"`
+	Terminal    TerminalConfig    `json:"terminal"`
+	Dashboard   DashboardConfig   `json:"dashboard"`
+	Limits      Limits            `json:"limits"`
+	Audit       AuditConfig       `json:"audit"`
+	AllowedCmds []string          `json:"allowed_cmds"`
+	BinaryPath  string            `json:"binary_path"`
+	ConfigPath  string            `json:"-"`
+	Unsafe      bool              `json:"-"`
 }
 
 // DefaultConfig returns a safe baseline configuration suitable for FreeBSD.
@@ -116,6 +154,15 @@ func DefaultConfig() Config {
 			Sysrc:     "/usr/sbin/sysrc",
 			Shutdown:  "/sbin/shutdown",
 			Rsync:     "/usr/local/bin/rsync",
+			SSH:       "/usr/bin/ssh",
+			SSHKeygen: "/usr/bin/ssh-keygen",
+			Bectl:     "/sbin/bectl",
+			Smartctl:  "/usr/local/sbin/smartctl",
+			Gpart:     "/sbin/gpart",
+			Mount:     "/sbin/mount",
+			GELI:      "/sbin/geli",
+			SwapCtl:   "/sbin/swapctl",
+			Install:   "/usr/bin/install",
 		},
 		Samba: SambaConfig{
 			IncludeFile:  "/usr/local/etc/smb4.conf",
@@ -125,6 +172,18 @@ func DefaultConfig() Config {
 		ZFS: ZFSConfig{
 			SnapshotPrefix: "raidraccoon",
 		},
+		Replication: ReplicationConfig{
+			KeyFile:        "/var/db/raidraccoon/ssh/id_ed25519",
+			KnownHostsFile: "/var/db/raidraccoon/ssh/known_hosts",
+			RemoteZFS:      "/sbin/zfs",
+			HistoryFile:    "/var/db/raidraccoon/replication-history.jsonl",
+		},
+		Stats: StatsConfig{
+			DataDir:         "/var/db/raidraccoon/stats",
+			IntervalSeconds: 60,
+		},
+		GELI: GELIConfig{KeyDir: "/usr/local/etc/raidraccoon/geli"},
+		Devd: DevdConfig{Socket: "/var/run/devd.seqpacket.pipe"},
 		Cron: CronConfig{
 			CronFile: "/etc/crontab",
 			CronUser: "root",
@@ -271,6 +330,33 @@ func applyDefaults(cfg *Config) {
 	if cfg.Paths.Rsync == "" {
 		cfg.Paths.Rsync = def.Paths.Rsync
 	}
+	if cfg.Paths.SSH == "" {
+		cfg.Paths.SSH = def.Paths.SSH
+	}
+	if cfg.Paths.SSHKeygen == "" {
+		cfg.Paths.SSHKeygen = def.Paths.SSHKeygen
+	}
+	if cfg.Paths.Bectl == "" {
+		cfg.Paths.Bectl = def.Paths.Bectl
+	}
+	if cfg.Paths.Smartctl == "" {
+		cfg.Paths.Smartctl = def.Paths.Smartctl
+	}
+	if cfg.Paths.Gpart == "" {
+		cfg.Paths.Gpart = def.Paths.Gpart
+	}
+	if cfg.Paths.Mount == "" {
+		cfg.Paths.Mount = def.Paths.Mount
+	}
+	if cfg.Paths.GELI == "" {
+		cfg.Paths.GELI = def.Paths.GELI
+	}
+	if cfg.Paths.SwapCtl == "" {
+		cfg.Paths.SwapCtl = def.Paths.SwapCtl
+	}
+	if cfg.Paths.Install == "" {
+		cfg.Paths.Install = def.Paths.Install
+	}
 	if cfg.Samba.IncludeFile == "" {
 		cfg.Samba.IncludeFile = def.Samba.IncludeFile
 	}
@@ -283,6 +369,30 @@ func applyDefaults(cfg *Config) {
 	if cfg.ZFS.SnapshotPrefix == "" {
 		cfg.ZFS.SnapshotPrefix = def.ZFS.SnapshotPrefix
 	}
+	if cfg.Replication.KeyFile == "" {
+		cfg.Replication.KeyFile = def.Replication.KeyFile
+	}
+	if cfg.Replication.KnownHostsFile == "" {
+		cfg.Replication.KnownHostsFile = def.Replication.KnownHostsFile
+	}
+	if cfg.Replication.RemoteZFS == "" {
+		cfg.Replication.RemoteZFS = def.Replication.RemoteZFS
+	}
+	if cfg.Replication.HistoryFile == "" {
+		cfg.Replication.HistoryFile = def.Replication.HistoryFile
+	}
+	if cfg.Stats.DataDir == "" {
+		cfg.Stats.DataDir = def.Stats.DataDir
+	}
+	if cfg.Stats.IntervalSeconds <= 0 {
+		cfg.Stats.IntervalSeconds = def.Stats.IntervalSeconds
+	}
+	if cfg.GELI.KeyDir == "" {
+		cfg.GELI.KeyDir = def.GELI.KeyDir
+	}
+	if cfg.Devd.Socket == "" {
+		cfg.Devd.Socket = def.Devd.Socket
+	}
 	if cfg.Cron.CronFile == "" {
 		cfg.Cron.CronFile = def.Cron.CronFile
 	}
@@ -336,7 +446,11 @@ func DefaultDashboardWidgets() []DashboardWidget {
 func defaultDashboardWidgets() []DashboardWidget {
 	return []DashboardWidget{
 		{ID: "pools", Enabled: true},
+		{ID: "drives", Enabled: true},
+		{ID: "geli", Enabled: true},
 		{ID: "cache", Enabled: true},
+		{ID: "iostat", Enabled: true},
+		{ID: "capacity", Enabled: true},
 		{ID: "datasets", Enabled: true},
 		{ID: "snapshots", Enabled: true},
 		{ID: "schedules", Enabled: true},
@@ -375,35 +489,6 @@ func EnsureDir(path string) error {
 	return os.MkdirAll(dir, 0o755)
 }
 
-// ReadAllLimited reads up to limit bytes and reports whether output was truncated.
-func ReadAllLimited(r io.Reader, limit int64) ([]byte, bool, error) {
-	if limit <= 0 {
-		limit = 1 << 20
-	}
-	var out []byte
-	buf := make([]byte, 4096)
-	var total int64
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			if total+int64(n) > limit {
-				n = int(limit - total)
-				out = append(out, buf[:n]...)
-				return out, true, nil
-			}
-			out = append(out, buf[:n]...)
-			total += int64(n)
-		}
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return out, false, err
-		}
-	}
-	return out, false, nil
-}
-
 // NowTimestamp returns an RFC3339 UTC timestamp.
 func NowTimestamp() string {
 	return time.Now().UTC().Format(time.RFC3339)
@@ -300,6 +300,17 @@ func parseUnmanaged(line, cronUser string) (Schedule, bool) {
 	if dataset == "" {
 		return Schedule{}, false
 	}
+	meta := map[string]string{"source": "cron", "type": "snapshot"}
+	for i, arg := range args {
+		switch {
+		case arg == "--template" && i+1 < len(args):
+			meta["template"] = strings.ReplaceAll(args[i+1], `\%`, "%")
+		case strings.HasPrefix(arg, "--template="):
+			meta["template"] = strings.ReplaceAll(strings.TrimPrefix(arg, "--template="), `\%`, "%")
+		case arg == "--utc":
+			meta["utc"] = "1"
+		}
+	}
 	if !retentionSet {
 		retention = 7
 	}
@@ -313,7 +324,7 @@ func parseUnmanaged(line, cronUser string) (Schedule, bool) {
 		Enabled:   enabled,
 		Cron:      spec,
 		RawCron:   rawCron,
-		Meta:      map[string]string{"source": "cron", "type": "snapshot"},
+		Meta:      meta,
 	}
 	return item, true
 }
@@ -458,6 +469,19 @@ func metaString(item Schedule, kind string) string {
 	return strings.Join(parts, " ")
 }
 
+// namingFields renders the snapshot naming template flags. cron turns a bare % into a
+// newline, so template directives are escaped.
+func namingFields(meta map[string]string) []string {
+	var fields []string
+	if template := meta["template"]; template != "" {
+		fields = append(fields, "--template", strings.ReplaceAll(template, "%", `\%`))
+	}
+	if meta["utc"] == "1" {
+		fields = append(fields, "--utc")
+	}
+	return fields
+}
+
 func buildCommandFields(item Schedule, kind, binaryPath string) []string {
 	switch kind {
 	case "snapshot":
@@ -483,7 +507,7 @@ func buildCommandFields(item Schedule, kind, binaryPath string) []string {
 		if prefix != "" {
 			fields = append(fields, "--prefix", prefix)
 		}
-		return fields
+		return append(fields, namingFields(item.Meta)...)
 	case "replication":
 		meta := item.Meta
 		if meta == nil {
@@ -502,6 +526,7 @@ func buildCommandFields(item Schedule, kind, binaryPath string) []string {
 		if prefix != "" {
 			fields = append(fields, "--prefix", prefix)
 		}
+		fields = append(fields, namingFields(meta)...)
 		retention := atoi(meta["retention"], 0)
 		if retention == 0 {
 			retention = item.Retention
@@ -515,6 +540,39 @@ func buildCommandFields(item Schedule, kind, binaryPath string) []string {
 		if meta["force"] == "1" {
 			fields = append(fields, "--force")
 		}
+		if meta["reseed"] == "1" {
+			fields = append(fields, "--reseed")
+		}
+		for _, flag := range []struct{ key, arg string }{
+			{"raw", "--raw"},
+			{"compressed", "--compressed"},
+			{"large_block", "--large-block"},
+			{"embedded", "--embedded"},
+			{"send_props", "--send-props"},
+		} {
+			if meta[flag.key] == "1" {
+				fields = append(fields, flag.arg)
+			}
+		}
+		if exclude := meta["recv_exclude"]; exclude != "" {
+			fields = append(fields, "--recv-exclude", exclude)
+		}
+		if props := meta["recv_props"]; props != "" {
+			fields = append(fields, "--recv-props", props)
+		}
+		fields = append(fields, transferLimitFields(meta)...)
+		if port := atoi(meta["ssh_port"], 0); port > 0 {
+			fields = append(fields, "--ssh-port", fmt.Sprintf("%d", port))
+		}
+		if cipher := meta["cipher"]; cipher != "" {
+			fields = append(fields, "--cipher", cipher)
+		}
+		if meta["compress"] == "1" {
+			fields = append(fields, "--compress")
+		}
+		if meta["remote_sudo"] == "1" {
+			fields = append(fields, "--remote-sudo")
+		}
 		return fields
 	case "rsync":
 		meta := item.Meta
@@ -530,8 +588,54 @@ func buildCommandFields(item Schedule, kind, binaryPath string) []string {
 		if flags := meta["flags"]; flags != "" {
 			fields = append(fields, "--flags", flags)
 		}
+		fields = append(fields, transferLimitFields(meta)...)
+		return fields
+	case "trim":
+		pool := ""
+		if item.Meta != nil {
+			pool = item.Meta["pool"]
+		}
+		if pool == "" {
+			return nil
+		}
+		fields := []string{binaryPath, "trim", "--pool", pool}
+		if rate := item.Meta["rate"]; rate != "" {
+			fields = append(fields, "--rate", rate)
+		}
+		return fields
+	case "smarttest":
+		test := ""
+		if item.Meta != nil {
+			test = item.Meta["test"]
+		}
+		if test == "" {
+			return nil
+		}
+		fields := []string{binaryPath, "smarttest", "--test", test}
+		if devices := item.Meta["devices"]; devices != "" {
+			fields = append(fields, "--devices", devices)
+		}
 		return fields
 	default:
 		return nil
 	}
 }
+
+// transferLimitFields maps bandwidth and time-window metadata shared by replication and
+// rsync jobs to CLI flags.
+func transferLimitFields(meta map[string]string) []string {
+	var fields []string
+	if limit := atoi(meta["bwlimit"], 0); limit > 0 {
+		fields = append(fields, "--bwlimit", fmt.Sprintf("%d", limit))
+	}
+	if spec := meta["window"]; spec != "" {
+		fields = append(fields, "--window", spec)
+		if start := meta["window_start"]; start != "" {
+			fields = append(fields, "--window-start", start)
+		}
+		if onClose := meta["window_close"]; onClose != "" {
+			fields = append(fields, "--window-close", onClose)
+		}
+	}
+	return fields
+}
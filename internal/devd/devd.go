@@ -0,0 +1,228 @@
+// Package devd follows devd(8) events on its seqpacket socket and parses the disk
+// attach/detach and ZFS notifications raidraccoon reacts to. Serve replays recorded
+// events on a stand-in socket for testing without hardware.
+package devd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where devd accepts seqpacket subscribers.
+const DefaultSocket = "/var/run/devd.seqpacket.pipe"
+
+// Event kinds raidraccoon reacts to. Other devd notifications parse with an empty Kind.
+const (
+	KindDiskAttach = "disk-attach"
+	KindDiskDetach = "disk-detach"
+	KindVdevState  = "vdev-state"
+	KindChecksum   = "checksum"
+	KindIOError    = "io-error"
+	KindZFS        = "zfs"
+)
+
+// Event is one parsed devd notification.
+type Event struct {
+	Time      time.Time         `json:"time"`
+	Kind      string            `json:"kind"`
+	System    string            `json:"system,omitempty"`
+	Subsystem string            `json:"subsystem,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Device    string            `json:"device,omitempty"`
+	Pool      string            `json:"pool,omitempty"`
+	Vdev      string            `json:"vdev,omitempty"`
+	State     string            `json:"state,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+	Raw       string            `json:"raw"`
+}
+
+var wholeDiskPattern = regexp.MustCompile(`^(ada|da|nvd|nda|vtbd|mmcsd|md)[0-9]+$`)
+
+// Parse parses one devd line:
+//
+//	!system=DEVFS subsystem=CDEV type=CREATE cdev=da3
+//	!system=ZFS subsystem=ZFS type=resource.fs.zfs.statechange pool_name=tank vdev_path=/dev/da3 vdev_state=REMOVED
+//	+umass0 at bus=0 ... on uhub0
+//
+// Lines that are not notifications, or notifications raidraccoon ignores, return an
+// Event with an empty Kind.
+func Parse(line string, now time.Time) Event {
+	line = strings.TrimSpace(line)
+	ev := Event{Time: now, Raw: line}
+	if line == "" {
+		return ev
+	}
+	switch line[0] {
+	case '!':
+		ev.Attrs = parseAttrs(line[1:])
+	case '+', '-':
+		// Newbus attach/detach: "+name at ... on parent". Whole disks show up here only
+		// for some drivers; CAM disks arrive as DEVFS notifications instead.
+		name, _, _ := strings.Cut(line[1:], " ")
+		if wholeDiskPattern.MatchString(name) {
+			ev.Device = name
+			ev.Kind = KindDiskAttach
+			if line[0] == '-' {
+				ev.Kind = KindDiskDetach
+			}
+		}
+		return ev
+	default:
+		return ev
+	}
+	ev.System = ev.Attrs["system"]
+	ev.Subsystem = ev.Attrs["subsystem"]
+	ev.Type = ev.Attrs["type"]
+	switch ev.System {
+	case "DEVFS":
+		cdev := ev.Attrs["cdev"]
+		if ev.Subsystem != "CDEV" || !wholeDiskPattern.MatchString(cdev) {
+			return ev
+		}
+		ev.Device = cdev
+		switch ev.Type {
+		case "CREATE":
+			ev.Kind = KindDiskAttach
+		case "DESTROY":
+			ev.Kind = KindDiskDetach
+		}
+	case "ZFS":
+		ev.Pool = firstAttr(ev.Attrs, "pool_name", "pool")
+		ev.Vdev = strings.TrimPrefix(ev.Attrs["vdev_path"], "/dev/")
+		ev.State = firstAttr(ev.Attrs, "vdev_state_str", "vdev_state")
+		switch {
+		case strings.HasSuffix(ev.Type, ".statechange") || strings.HasSuffix(ev.Type, ".removed") || strings.HasSuffix(ev.Type, "vdev_remove"):
+			ev.Kind = KindVdevState
+		case strings.HasSuffix(ev.Type, ".checksum"):
+			ev.Kind = KindChecksum
+		case strings.HasSuffix(ev.Type, ".io"):
+			ev.Kind = KindIOError
+		default:
+			ev.Kind = KindZFS
+		}
+	}
+	return ev
+}
+
+func firstAttr(attrs map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := attrs[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseAttrs splits key=value pairs; values may be double-quoted and contain spaces.
+func parseAttrs(text string) map[string]string {
+	out := map[string]string{}
+	for len(text) > 0 {
+		text = strings.TrimLeft(text, " \t")
+		eq := strings.IndexByte(text, '=')
+		if eq <= 0 {
+			break
+		}
+		key := text[:eq]
+		if strings.ContainsAny(key, " \t") {
+			// A stray word without a value; skip it.
+			_, rest, _ := strings.Cut(text, " ")
+			text = rest
+			continue
+		}
+		text = text[eq+1:]
+		value := ""
+		if strings.HasPrefix(text, `"`) {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				value, text = text[1:], ""
+			} else {
+				value, text = text[1:end+1], text[end+2:]
+			}
+		} else {
+			value, text, _ = strings.Cut(text, " ")
+		}
+		out[key] = value
+	}
+	return out
+}
+
+// Dial connects to the devd seqpacket socket at path.
+func Dial(ctx context.Context, path string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unixpacket", path)
+}
+
+// Follow reads notifications from conn and calls fn for every line until ctx is done or
+// the connection fails; it closes conn and returns nil only when ctx ends.
+func Follow(ctx context.Context, conn net.Conn, fn func(Event)) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	buf := make([]byte, 8192)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("devd connection lost: %w", err)
+		}
+		now := time.Now()
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fn(Parse(line, now))
+		}
+	}
+}
+
+// Serve listens on a seqpacket socket at path, standing in for devd: every subscriber
+// receives lines (blank lines and # comments skipped) one packet each, interval apart,
+// and stays connected until ctx is done.
+func Serve(ctx context.Context, path string, lines []string, interval time.Duration) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "unixpacket", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			for _, line := range lines {
+				line = strings.TrimSpace(line)
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				if _, err := conn.Write([]byte(line + "\n")); err != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+			<-ctx.Done()
+		}(conn)
+	}
+}
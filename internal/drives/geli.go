@@ -0,0 +1,230 @@
+// Package drives initializes, attaches and detaches GELI providers. Passphrases are
+// passed to geli on stdin and keyfiles are referenced inside geli.key_dir, so neither
+// appears in argv or the audit log.
+package drives
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// GELIProvider is one row of `geli status`: Name is the .eli provider, Component the
+// partition or disk under it.
+type GELIProvider struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Component string `json:"component"`
+}
+
+// GELIInitOptions describes `geli init`. At least one of Passphrase and Keyfile is
+// required; Keyfile is a file name inside geli.key_dir.
+type GELIInitOptions struct {
+	Provider   string
+	Passphrase []byte
+	Keyfile    string
+	Cipher     string
+	KeyLength  int
+	SectorSize int
+}
+
+// GELIBootEntry registers a provider to be attached when raidraccoon starts. Entries
+// with Passphrase set wait for an unlock from the UI; Pool is imported once all of its
+// providers are attached.
+type GELIBootEntry struct {
+	Provider   string `json:"provider"`
+	Keyfile    string `json:"keyfile,omitempty"`
+	Passphrase bool   `json:"passphrase"`
+	Pool       string `json:"pool,omitempty"`
+}
+
+var (
+	geliKeyfilePattern  = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,63}$`)
+	geliProviderPattern = regexp.MustCompile(`^(?:gpt/|gptid/|diskid/)?[A-Za-z0-9._-]{1,64}$`)
+)
+
+// GELICiphers are the encryption algorithms offered for new providers.
+var GELICiphers = []string{"AES-XTS", "AES-CBC", "Camellia-CBC"}
+
+// ValidGELIProvider accepts a partition or disk name, optionally behind a GEOM label.
+func ValidGELIProvider(name string) bool {
+	return geliProviderPattern.MatchString(name) && !strings.Contains(name, "..") && !strings.HasSuffix(name, ".eli")
+}
+
+// ValidKeyfileName accepts a plain file name (no path) for a keyfile in geli.key_dir.
+func ValidKeyfileName(name string) bool {
+	return geliKeyfilePattern.MatchString(name)
+}
+
+// KeyfilePath joins a validated keyfile name with geli.key_dir.
+func KeyfilePath(cfg config.Config, name string) (string, error) {
+	if !ValidKeyfileName(name) {
+		return "", fmt.Errorf("invalid keyfile name")
+	}
+	return filepath.Join(cfg.GELI.KeyDir, name), nil
+}
+
+// GELIStatus parses `geli status -s`. A kernel without the ELI class loaded has no
+// providers.
+func GELIStatus(ctx context.Context, cfg config.Config) ([]GELIProvider, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.GELI, []string{"status", "-s"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		if strings.Contains(res.Stderr, "not found") {
+			return []GELIProvider{}, nil
+		}
+		return nil, fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+	}
+	return parseGELIStatus(res.Stdout), nil
+}
+
+// parseGELIStatus parses lines of `geli status -s`:
+//
+//	ada1p1.eli  ACTIVE  ada1p1
+func parseGELIStatus(output string) []GELIProvider {
+	out := []GELIProvider{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+		out = append(out, GELIProvider{Name: fields[0], Status: fields[1], Component: fields[2]})
+	}
+	return out
+}
+
+// InitGELI runs `geli init`, reading the passphrase from stdin (-J -) or disabling it
+// (-P) when only a keyfile is used. This destroys data on the provider.
+func InitGELI(ctx context.Context, cfg config.Config, opts GELIInitOptions) (execwrap.Result, error) {
+	if !ValidGELIProvider(opts.Provider) {
+		return execwrap.Result{}, fmt.Errorf("invalid provider")
+	}
+	if len(opts.Passphrase) == 0 && opts.Keyfile == "" {
+		return execwrap.Result{}, fmt.Errorf("passphrase or keyfile required")
+	}
+	if opts.Cipher == "" {
+		opts.Cipher = "AES-XTS"
+	}
+	valid := false
+	for _, c := range GELICiphers {
+		valid = valid || c == opts.Cipher
+	}
+	if !valid {
+		return execwrap.Result{}, fmt.Errorf("unsupported cipher %q", opts.Cipher)
+	}
+	if opts.KeyLength == 0 {
+		opts.KeyLength = 256
+	}
+	if opts.KeyLength != 128 && opts.KeyLength != 256 {
+		return execwrap.Result{}, fmt.Errorf("key length must be 128 or 256")
+	}
+	if opts.SectorSize == 0 {
+		opts.SectorSize = 4096
+	}
+	if opts.SectorSize < 512 || opts.SectorSize > 65536 || opts.SectorSize&(opts.SectorSize-1) != 0 {
+		return execwrap.Result{}, fmt.Errorf("sector size must be a power of two between 512 and 65536")
+	}
+	args := []string{"init", "-e", opts.Cipher, "-l", fmt.Sprint(opts.KeyLength), "-s", fmt.Sprint(opts.SectorSize)}
+	var stdin []byte
+	if len(opts.Passphrase) > 0 {
+		args = append(args, "-J", "-")
+		stdin = opts.Passphrase
+	} else {
+		args = append(args, "-P")
+	}
+	if opts.Keyfile != "" {
+		path, err := KeyfilePath(cfg, opts.Keyfile)
+		if err != nil {
+			return execwrap.Result{}, err
+		}
+		args = append(args, "-K", path)
+	}
+	return execwrap.Run(ctx, cfg.Paths.GELI, append(args, opts.Provider), stdin, cfg.Limits)
+}
+
+// AttachGELI runs `geli attach` with the passphrase on stdin (-j -) or, for keyfile-only
+// providers, -p.
+func AttachGELI(ctx context.Context, cfg config.Config, provider string, passphrase []byte, keyfile string) (execwrap.Result, error) {
+	if !ValidGELIProvider(provider) {
+		return execwrap.Result{}, fmt.Errorf("invalid provider")
+	}
+	if len(passphrase) == 0 && keyfile == "" {
+		return execwrap.Result{}, fmt.Errorf("passphrase or keyfile required")
+	}
+	args := []string{"attach"}
+	var stdin []byte
+	if len(passphrase) > 0 {
+		args = append(args, "-j", "-")
+		stdin = passphrase
+	} else {
+		args = append(args, "-p")
+	}
+	if keyfile != "" {
+		path, err := KeyfilePath(cfg, keyfile)
+		if err != nil {
+			return execwrap.Result{}, err
+		}
+		args = append(args, "-k", path)
+	}
+	return execwrap.Run(ctx, cfg.Paths.GELI, append(args, provider), stdin, cfg.Limits)
+}
+
+// DetachGELI runs `geli detach <provider>.eli`.
+func DetachGELI(ctx context.Context, cfg config.Config, provider string) (execwrap.Result, error) {
+	if !ValidGELIProvider(provider) {
+		return execwrap.Result{}, fmt.Errorf("invalid provider")
+	}
+	return execwrap.Run(ctx, cfg.Paths.GELI, []string{"detach", provider + ".eli"}, nil, cfg.Limits)
+}
+
+// GELIBootPath is the boot attach registry, kept with the configuration next to
+// geli.key_dir (/usr/local/etc/raidraccoon/geli-boot.json by default). It holds provider
+// and keyfile names only, never secrets.
+func GELIBootPath(cfg config.Config) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(cfg.GELI.KeyDir)), "geli-boot.json")
+}
+
+// LoadGELIBoot reads the boot attach registry, sorted by provider.
+func LoadGELIBoot(path string) ([]GELIBootEntry, error) {
+	entries := []GELIBootEntry{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Provider < entries[j].Provider })
+	return entries, nil
+}
+
+// SaveGELIBoot replaces the boot attach registry.
+func SaveGELIBoot(path string, entries []GELIBootEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,265 @@
+// Package drives reads and edits partition tables with gpart(8).
+package drives
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// Partition is one row of `gpart show -p`: a partition, or a free segment when Free is
+// set. Start and Sectors are in sectors of the disk.
+type Partition struct {
+	Index    int    `json:"index"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+	Label    string `json:"label"`
+	Start    int64  `json:"start"`
+	Sectors  int64  `json:"sectors"`
+	Size     string `json:"size"`
+	Free     bool   `json:"free"`
+}
+
+// PartitionTable is the partition layout of one disk.
+type PartitionTable struct {
+	Disk    string      `json:"disk"`
+	Scheme  string      `json:"scheme"`
+	Start   int64       `json:"start"`
+	Sectors int64       `json:"sectors"`
+	Size    string      `json:"size"`
+	State   string      `json:"state"`
+	Entries []Partition `json:"entries"`
+}
+
+// PartitionSpec describes a partition to add. Empty Size takes the largest free
+// segment; Align rounds start and size (e.g. 1M).
+type PartitionSpec struct {
+	Type  string `json:"type"`
+	Align string `json:"align"`
+	Size  string `json:"size"`
+	Label string `json:"label"`
+	Index int    `json:"index"`
+}
+
+var (
+	partitionTypePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$|^![0-9a-fA-F-]{1,36}$`)
+	gpartSizePattern     = regexp.MustCompile(`^[0-9]+[bBkKmMgGtT]?$`)
+	gpartLabelPattern    = regexp.MustCompile(`^[A-Za-z0-9._-]{1,36}$`)
+	gpartIndexSuffix     = regexp.MustCompile(`(?:p|s)([0-9]+)$`)
+)
+
+// PartitionSchemes are the schemes offered for new tables.
+var PartitionSchemes = []string{"gpt", "mbr"}
+
+// PartitionTypes are the common GPT types offered in the UI; gpart accepts more.
+var PartitionTypes = []string{"freebsd-zfs", "freebsd-swap", "freebsd-ufs", "freebsd-boot", "efi"}
+
+// ValidPartitionSpec checks the fields passed to `gpart add`.
+func ValidPartitionSpec(spec PartitionSpec) error {
+	if !partitionTypePattern.MatchString(spec.Type) {
+		return fmt.Errorf("invalid partition type")
+	}
+	if spec.Align != "" && !gpartSizePattern.MatchString(spec.Align) {
+		return fmt.Errorf("invalid alignment (use e.g. 1M)")
+	}
+	if spec.Size != "" && !gpartSizePattern.MatchString(spec.Size) {
+		return fmt.Errorf("invalid size (use e.g. 512K, 16G)")
+	}
+	if spec.Label != "" && !gpartLabelPattern.MatchString(spec.Label) {
+		return fmt.Errorf("invalid label")
+	}
+	if spec.Index < 0 {
+		return fmt.Errorf("invalid index")
+	}
+	return nil
+}
+
+// ListPartitions parses `gpart show -p` (types) and `gpart show -pl` (labels) for disk,
+// or for every partitioned geom when disk is empty.
+func ListPartitions(ctx context.Context, cfg config.Config, disk string) ([]PartitionTable, error) {
+	if disk != "" && !ValidDiskName(disk) {
+		return nil, fmt.Errorf("invalid disk name")
+	}
+	run := func(flags string) (string, error) {
+		args := []string{"show", flags}
+		if disk != "" {
+			args = append(args, disk)
+		}
+		res, err := execwrap.Run(ctx, cfg.Paths.Gpart, args, nil, cfg.Limits)
+		if err != nil {
+			return "", err
+		}
+		if res.ExitCode != 0 {
+			// gpart show on a disk without a table reports "No such geom".
+			if disk != "" && strings.Contains(res.Stderr, "No such geom") {
+				return "", nil
+			}
+			return "", fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+		}
+		return res.Stdout, nil
+	}
+	types, err := run("-p")
+	if err != nil {
+		return nil, err
+	}
+	tables := parseGpartShow(types)
+	labels, err := run("-pl")
+	if err != nil {
+		return tables, nil
+	}
+	byProvider := map[string]string{}
+	for _, table := range parseGpartShow(labels) {
+		for _, entry := range table.Entries {
+			if !entry.Free && entry.Type != "(null)" {
+				byProvider[entry.Provider] = entry.Type
+			}
+		}
+	}
+	for i := range tables {
+		for j := range tables[i].Entries {
+			tables[i].Entries[j].Label = byProvider[tables[i].Entries[j].Provider]
+		}
+	}
+	return tables, nil
+}
+
+// parseGpartShow parses `gpart show -p` output:
+//
+//	=>        40  1953525088    ada0  GPT  (932G)
+//	          40        1024  ada0p1  freebsd-boot  (512K)
+//	        1064         984          - free -  (492K)
+//
+// A damaged table ends its header with a state such as [CORRUPT].
+func parseGpartShow(output string) []PartitionTable {
+	var tables []PartitionTable
+	var current *PartitionTable
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		state := ""
+		if open := strings.LastIndex(line, "["); open >= 0 && strings.HasSuffix(line, "]") {
+			state = line[open+1 : len(line)-1]
+			line = strings.TrimSpace(line[:open])
+		}
+		size := ""
+		if open := strings.LastIndex(line, "("); open >= 0 && strings.HasSuffix(line, ")") {
+			size = line[open+1 : len(line)-1]
+			line = strings.TrimSpace(line[:open])
+		}
+		fields := strings.Fields(line)
+		if fields[0] == "=>" {
+			if len(fields) < 5 {
+				continue
+			}
+			if current != nil {
+				tables = append(tables, *current)
+			}
+			current = &PartitionTable{Disk: fields[3], Scheme: strings.ToLower(fields[4]), Size: size, State: state, Entries: []Partition{}}
+			current.Start, _ = strconv.ParseInt(fields[1], 10, 64)
+			current.Sectors, _ = strconv.ParseInt(fields[2], 10, 64)
+			continue
+		}
+		if current == nil || len(fields) < 3 {
+			continue
+		}
+		start, err1 := strconv.ParseInt(fields[0], 10, 64)
+		sectors, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		entry := Partition{Start: start, Sectors: sectors, Size: size}
+		if fields[2] == "-" {
+			entry.Free = true
+		} else {
+			if len(fields) < 4 {
+				continue
+			}
+			entry.Provider = fields[2]
+			entry.Type = fields[3]
+			if m := gpartIndexSuffix.FindStringSubmatch(entry.Provider); m != nil {
+				entry.Index, _ = strconv.Atoi(m[1])
+			}
+		}
+		current.Entries = append(current.Entries, entry)
+	}
+	if current != nil {
+		tables = append(tables, *current)
+	}
+	return tables
+}
+
+// CreatePartitionScheme runs `gpart create -s <scheme> <disk>`.
+func CreatePartitionScheme(ctx context.Context, cfg config.Config, disk, scheme string) (execwrap.Result, error) {
+	if !ValidDiskName(disk) {
+		return execwrap.Result{}, fmt.Errorf("invalid disk name")
+	}
+	valid := false
+	for _, s := range PartitionSchemes {
+		valid = valid || s == scheme
+	}
+	if !valid {
+		return execwrap.Result{}, fmt.Errorf("unsupported scheme %q", scheme)
+	}
+	return execwrap.Run(ctx, cfg.Paths.Gpart, []string{"create", "-s", scheme, disk}, nil, cfg.Limits)
+}
+
+// DestroyPartitionScheme runs `gpart destroy`; force (-F) also drops the partitions.
+func DestroyPartitionScheme(ctx context.Context, cfg config.Config, disk string, force bool) (execwrap.Result, error) {
+	if !ValidDiskName(disk) {
+		return execwrap.Result{}, fmt.Errorf("invalid disk name")
+	}
+	args := []string{"destroy"}
+	if force {
+		args = append(args, "-F")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Gpart, append(args, disk), nil, cfg.Limits)
+}
+
+// AddPartition runs `gpart add` and returns the new provider (e.g. ada0p1).
+func AddPartition(ctx context.Context, cfg config.Config, disk string, spec PartitionSpec) (string, execwrap.Result, error) {
+	if !ValidDiskName(disk) {
+		return "", execwrap.Result{}, fmt.Errorf("invalid disk name")
+	}
+	if err := ValidPartitionSpec(spec); err != nil {
+		return "", execwrap.Result{}, err
+	}
+	args := []string{"add", "-t", spec.Type}
+	if spec.Align != "" {
+		args = append(args, "-a", spec.Align)
+	}
+	if spec.Size != "" {
+		args = append(args, "-s", spec.Size)
+	}
+	if spec.Label != "" {
+		args = append(args, "-l", spec.Label)
+	}
+	if spec.Index > 0 {
+		args = append(args, "-i", strconv.Itoa(spec.Index))
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.Gpart, append(args, disk), nil, cfg.Limits)
+	if err != nil || res.ExitCode != 0 {
+		return "", res, err
+	}
+	provider, _, _ := strings.Cut(strings.TrimSpace(res.Stdout), " ")
+	return provider, res, nil
+}
+
+// DeletePartition runs `gpart delete -i <index> <disk>`.
+func DeletePartition(ctx context.Context, cfg config.Config, disk string, index int) (execwrap.Result, error) {
+	if !ValidDiskName(disk) {
+		return execwrap.Result{}, fmt.Errorf("invalid disk name")
+	}
+	if index <= 0 {
+		return execwrap.Result{}, fmt.Errorf("invalid partition index")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Gpart, []string{"delete", "-i", strconv.Itoa(index), disk}, nil, cfg.Limits)
+}
@@ -0,0 +1,302 @@
+// Package drives keeps a persistent inventory of disks keyed by serial number, so that
+// a disk can be followed across device renames, slot changes and removals.
+package drives
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+)
+
+// VdevMember places a disk (or one of its partitions) in an imported pool.
+type VdevMember struct {
+	Pool string `json:"pool"`
+	// Vdev is the mirror/raidz group (e.g. mirror-1), empty for a top-level device.
+	Vdev string `json:"vdev,omitempty"`
+	Role string `json:"role"`
+	// Provider is the device as zpool names it (gpt/zfs0, ada0p3, ...).
+	Provider string `json:"provider"`
+}
+
+// DiskIdentity is what is currently known about one disk.
+type DiskIdentity struct {
+	Serial      string   `json:"serial"`
+	Device      string   `json:"device"`
+	Description string   `json:"description"`
+	Mediasize   string   `json:"mediasize"`
+	GPTIDs      []string `json:"gptids"`
+	Labels      []string `json:"labels"`
+	// GELI lists the attached .eli providers on the disk or its partitions.
+	GELI   []string    `json:"geli"`
+	Member *VdevMember `json:"member,omitempty"`
+}
+
+// InventoryRecord is the stored history of one serial. While the disk is absent the
+// identity fields keep their last seen values.
+type InventoryRecord struct {
+	DiskIdentity
+	Present   bool      `json:"present"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// InventoryEvent is one change between two inventory snapshots. Kind is appeared,
+// missing, returned, moved or member.
+type InventoryEvent struct {
+	Time    time.Time `json:"time"`
+	Serial  string    `json:"serial"`
+	Kind    string    `json:"kind"`
+	Device  string    `json:"device"`
+	Message string    `json:"message"`
+}
+
+type inventoryFile struct {
+	Updated time.Time                   `json:"updated"`
+	Disks   map[string]*InventoryRecord `json:"disks"`
+}
+
+// InventoryPath is the inventory file under stats.data_dir; events are appended to
+// InventoryEventsPath next to it.
+func InventoryPath(cfg config.Config) string {
+	return filepath.Join(cfg.Stats.DataDir, "disk-inventory.json")
+}
+
+// InventoryEventsPath is the JSON-lines log of inventory events.
+func InventoryEventsPath(cfg config.Config) string {
+	return filepath.Join(cfg.Stats.DataDir, "disk-events.jsonl")
+}
+
+// BuildIdentities joins geom disks with their GEOM labels (label -> provider, as from
+// ListLabels), attached GELI providers and the pool membership of each disk name.
+// Labels and GELI providers on partitions of a disk are attributed to the disk.
+func BuildIdentities(list []Drive, labels map[string]string, eli []GELIProvider, members map[string]VdevMember, diskOf func(string) string) []DiskIdentity {
+	byDisk := map[string][]string{}
+	for label, provider := range labels {
+		disk := diskOf(provider)
+		byDisk[disk] = append(byDisk[disk], label)
+	}
+	eliByDisk := map[string][]string{}
+	for _, p := range eli {
+		component := p.Component
+		if provider, ok := labels[component]; ok {
+			component = provider
+		}
+		disk := diskOf(component)
+		eliByDisk[disk] = append(eliByDisk[disk], p.Name)
+	}
+	out := make([]DiskIdentity, 0, len(list))
+	for _, drive := range list {
+		if drive.Name == "" {
+			continue
+		}
+		id := DiskIdentity{
+			Serial:      strings.TrimSpace(drive.Ident),
+			Device:      drive.Name,
+			Description: drive.Description,
+			Mediasize:   drive.Mediasize,
+			GPTIDs:      []string{},
+			Labels:      []string{},
+			GELI:        append([]string{}, eliByDisk[drive.Name]...),
+		}
+		sort.Strings(id.GELI)
+		names := byDisk[drive.Name]
+		sort.Strings(names)
+		for _, label := range names {
+			if strings.HasPrefix(label, "gptid/") {
+				id.GPTIDs = append(id.GPTIDs, label)
+			} else {
+				id.Labels = append(id.Labels, label)
+			}
+		}
+		if member, ok := members[drive.Name]; ok {
+			m := member
+			id.Member = &m
+		}
+		out = append(out, id)
+	}
+	return out
+}
+
+// Describe names a pool membership for messages: "mirror-1 of tank", "tank", "log of tank".
+func (m *VdevMember) Describe() string {
+	if m == nil {
+		return ""
+	}
+	switch {
+	case m.Vdev != "":
+		return fmt.Sprintf("%s of %s", m.Vdev, m.Pool)
+	case m.Role != "" && m.Role != "data":
+		return fmt.Sprintf("%s of %s", m.Role, m.Pool)
+	default:
+		return m.Pool
+	}
+}
+
+// LoadInventory reads the stored records, sorted present first, then by serial.
+func LoadInventory(path string) ([]InventoryRecord, time.Time, error) {
+	file, err := readInventory(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	out := make([]InventoryRecord, 0, len(file.Disks))
+	for _, rec := range file.Disks {
+		out = append(out, *rec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Present != out[j].Present {
+			return out[i].Present
+		}
+		return out[i].Serial < out[j].Serial
+	})
+	return out, file.Updated, nil
+}
+
+func readInventory(path string) (inventoryFile, error) {
+	file := inventoryFile{Disks: map[string]*InventoryRecord{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Disks == nil {
+		file.Disks = map[string]*InventoryRecord{}
+	}
+	return file, nil
+}
+
+// UpdateInventory merges the current identities into the inventory at path, appends
+// the resulting events to eventsPath and returns them. Disks without a serial cannot be
+// followed and are skipped.
+func UpdateInventory(path, eventsPath string, current []DiskIdentity, now time.Time) ([]InventoryEvent, error) {
+	file, err := readInventory(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []InventoryEvent
+	add := func(serial, kind, device, format string, args ...any) {
+		events = append(events, InventoryEvent{Time: now, Serial: serial, Kind: kind, Device: device, Message: fmt.Sprintf(format, args...)})
+	}
+	seen := map[string]bool{}
+	for _, id := range current {
+		if id.Serial == "" || seen[id.Serial] {
+			continue
+		}
+		seen[id.Serial] = true
+		rec, ok := file.Disks[id.Serial]
+		switch {
+		case !ok:
+			rec = &InventoryRecord{FirstSeen: now}
+			file.Disks[id.Serial] = rec
+			add(id.Serial, "appeared", id.Device, "serial %s appeared as %s", id.Serial, id.Device)
+		case !rec.Present:
+			add(id.Serial, "returned", id.Device, "serial %s returned as %s (last seen %s as %s)", id.Serial, id.Device, rec.LastSeen.Format(time.RFC3339), rec.Device)
+		case rec.Device != id.Device:
+			add(id.Serial, "moved", id.Device, "serial %s moved from %s to %s", id.Serial, rec.Device, id.Device)
+		}
+		before, after := rec.Member.Describe(), id.Member.Describe()
+		if ok && before != after {
+			switch {
+			case after == "":
+				add(id.Serial, "member", id.Device, "serial %s left %s", id.Serial, before)
+			case before == "":
+				add(id.Serial, "member", id.Device, "serial %s joined %s", id.Serial, after)
+			default:
+				add(id.Serial, "member", id.Device, "serial %s moved from %s to %s", id.Serial, before, after)
+			}
+		}
+		rec.DiskIdentity = id
+		rec.Present = true
+		rec.LastSeen = now
+	}
+	for serial, rec := range file.Disks {
+		if !rec.Present || seen[serial] {
+			continue
+		}
+		rec.Present = false
+		add(serial, "missing", rec.Device, "%s", MissingMessage(*rec))
+	}
+	file.Updated = now
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Serial < events[j].Serial })
+	f, err := os.OpenFile(eventsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return events, err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return events, err
+		}
+	}
+	return events, nil
+}
+
+// MissingMessage describes an absent disk by where it was last seen, e.g. "serial X
+// was in mirror-1 of tank (da3), now missing".
+func MissingMessage(rec InventoryRecord) string {
+	if where := rec.Member.Describe(); where != "" {
+		return fmt.Sprintf("serial %s was in %s (%s), now missing", rec.Serial, where, rec.Device)
+	}
+	return fmt.Sprintf("serial %s was %s, now missing", rec.Serial, rec.Device)
+}
+
+// InventoryEvents returns logged events, newest first, optionally for one serial.
+func InventoryEvents(path, serial string, limit int) ([]InventoryEvent, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []InventoryEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var all []InventoryEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev InventoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		if serial != "" && ev.Serial != serial {
+			continue
+		}
+		all = append(all, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]InventoryEvent, 0, len(all))
+	for i := len(all) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		out = append(out, all[i])
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+// Package drives wipes old ZFS labels and partition tables from a disk and lays out a
+// fresh GPT for a new pool member.
+package drives
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// PrepareOptions describes a disk preparation. With GPT set a fresh GPT is created
+// holding one freebsd-zfs partition spanning the disk, aligned to Align and labeled
+// Label.
+type PrepareOptions struct {
+	Disk  string
+	GPT   bool
+	Label string
+	Align string
+	Log   func(line string)
+}
+
+// MountedDevices maps the providers mounted according to `mount -p` (ada0p2, da1) to
+// their mount points, resolving gpt/, gptid/ and other GEOM labels.
+func MountedDevices(ctx context.Context, cfg config.Config) (map[string]string, error) {
+	res, err := execwrap.RunUnprivileged(ctx, cfg.Paths.Mount, []string{"-p"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+	}
+	labels, _ := ListLabels(ctx, cfg)
+	out := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(res.Stdout))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], "/dev/")
+		if provider, ok := labels[name]; ok {
+			name = provider
+		}
+		out[name] = fields[1]
+	}
+	return out, nil
+}
+
+// SwapDevices maps the providers in use by the system to their role: active swap
+// according to `swapctl -l` and the dump device from kern.shutdown.dumpdevname.
+// gpt/ labels and .eli providers resolve to the partition underneath.
+func SwapDevices(ctx context.Context, cfg config.Config) (map[string]string, error) {
+	res, err := execwrap.RunUnprivileged(ctx, cfg.Paths.SwapCtl, []string{"-l"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+	}
+	labels, _ := ListLabels(ctx, cfg)
+	resolve := func(dev string) string {
+		name := strings.TrimSuffix(strings.TrimPrefix(dev, "/dev/"), ".eli")
+		if provider, ok := labels[name]; ok {
+			return provider
+		}
+		return name
+	}
+	out := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(res.Stdout))
+	for scanner.Scan() {
+		// "Device: 1024-blocks Used:" header, then one line per swap device.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		out[resolve(fields[0])] = "swap"
+	}
+	res, err = execwrap.RunUnprivileged(ctx, cfg.Paths.Sysctl, []string{"-n", "kern.shutdown.dumpdevname"}, nil, cfg.Limits)
+	if err == nil && res.ExitCode == 0 {
+		if dev := strings.TrimSpace(res.Stdout); dev != "" {
+			name := resolve(dev)
+			if out[name] == "swap" {
+				out[name] = "swap and dump device"
+			} else {
+				out[name] = "dump device"
+			}
+		}
+	}
+	return out, nil
+}
+
+// PrepareDisk clears ZFS labels from disk and its partitions, destroys its partition
+// table and, with opts.GPT, creates a GPT with a labeled freebsd-zfs partition. The
+// caller is responsible for checking the disk is not in use. It returns the new
+// partition's provider, or "" without GPT.
+func PrepareDisk(ctx context.Context, cfg config.Config, opts PrepareOptions) (string, error) {
+	logf := func(format string, args ...any) {
+		if opts.Log != nil {
+			opts.Log(fmt.Sprintf(format, args...))
+		}
+	}
+	if !ValidDiskName(opts.Disk) {
+		return "", fmt.Errorf("invalid disk name")
+	}
+	spec := PartitionSpec{Type: "freebsd-zfs", Align: opts.Align, Label: opts.Label}
+	if opts.GPT {
+		if spec.Label == "" {
+			return "", fmt.Errorf("label required for the zfs partition")
+		}
+		if err := ValidPartitionSpec(spec); err != nil {
+			return "", err
+		}
+	}
+	tables, err := ListPartitions(ctx, cfg, opts.Disk)
+	if err != nil {
+		return "", fmt.Errorf("read partition table: %w", err)
+	}
+
+	// Old labels live at both ends of each vdev; clear partitions first, then the disk,
+	// so that a later pool import scan finds nothing stale.
+	providers := []string{}
+	for _, table := range tables {
+		for _, entry := range table.Entries {
+			if !entry.Free && entry.Provider != "" {
+				providers = append(providers, entry.Provider)
+			}
+		}
+	}
+	providers = append(providers, opts.Disk)
+	for _, provider := range providers {
+		logf("zpool labelclear -f /dev/%s", provider)
+		res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"labelclear", "-f", "/dev/" + provider}, nil, cfg.Limits)
+		if err != nil {
+			return "", err
+		}
+		if res.ExitCode != 0 {
+			// Providers that never held a pool have no label to clear.
+			logf("  %s", firstLine(res.Stderr, "no ZFS label"))
+		}
+	}
+
+	if len(tables) > 0 {
+		logf("gpart destroy -F %s", opts.Disk)
+		res, err := DestroyPartitionScheme(ctx, cfg, opts.Disk, true)
+		if err != nil {
+			return "", err
+		}
+		if res.ExitCode != 0 {
+			return "", fmt.Errorf("gpart destroy failed: %s", strings.TrimSpace(res.Stderr))
+		}
+	}
+	if !opts.GPT {
+		logf("%s is blank", opts.Disk)
+		return "", nil
+	}
+
+	logf("gpart create -s gpt %s", opts.Disk)
+	res, err := CreatePartitionScheme(ctx, cfg, opts.Disk, "gpt")
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("gpart create failed: %s", strings.TrimSpace(res.Stderr))
+	}
+	logf("gpart add -t freebsd-zfs -a %s -l %s %s", spec.Align, spec.Label, opts.Disk)
+	provider, res, err := AddPartition(ctx, cfg, opts.Disk, spec)
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("gpart add failed: %s", strings.TrimSpace(res.Stderr))
+	}
+	logf("created %s (gpt/%s)", provider, spec.Label)
+	return provider, nil
+}
+
+func firstLine(text, fallback string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if line == "" {
+		return fallback
+	}
+	return line
+}
@@ -0,0 +1,452 @@
+// Package drives runs SMART self-tests and keeps a per-drive history of their results.
+package drives
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// Self-test results as recorded in the history.
+const (
+	SelfTestPassed  = "passed"
+	SelfTestFailed  = "failed"
+	SelfTestAborted = "aborted"
+)
+
+// SelfTestResult is one completed entry of a drive's self-test log. Completed is derived
+// from the drive's power-on hours, so it is accurate to the hour at best.
+type SelfTestResult struct {
+	Device        string    `json:"device"`
+	Serial        string    `json:"serial,omitempty"`
+	Test          string    `json:"test"`
+	Status        string    `json:"status"`
+	Result        string    `json:"result"`
+	LifetimeHours int64     `json:"lifetime_hours"`
+	Completed     time.Time `json:"completed"`
+	Recorded      time.Time `json:"recorded"`
+}
+
+// SelfTestLog is the self-test state of a drive: the test in progress, if any, and the
+// log entries the drive keeps (newest first).
+type SelfTestLog struct {
+	Device       string           `json:"device"`
+	Serial       string           `json:"serial"`
+	PowerOnHours int64            `json:"power_on_hours"`
+	Running      bool             `json:"running"`
+	Remaining    int              `json:"remaining_percent"`
+	Entries      []SelfTestResult `json:"entries"`
+}
+
+// SelfTestOptions describes one run of self-tests. An empty Devices list means every
+// disk listed by geom.
+type SelfTestOptions struct {
+	Devices []string
+	Test    string
+	Wait    bool
+	Log     func(string)
+}
+
+// ValidSelfTest accepts the test kinds smartctl -t supports on all protocols.
+func ValidSelfTest(test string) bool {
+	return test == "short" || test == "long"
+}
+
+// SelfTestHistoryPath is the JSON-lines file holding recorded self-test results; it
+// lives next to the other collected statistics.
+func SelfTestHistoryPath(cfg config.Config) string {
+	return filepath.Join(cfg.Stats.DataDir, "smart-selftests.jsonl")
+}
+
+// StartSelfTest asks the drive to run a short or long self-test in the background.
+func StartSelfTest(ctx context.Context, cfg config.Config, name, test string) error {
+	if !ValidDiskName(name) {
+		return fmt.Errorf("invalid disk name")
+	}
+	if !ValidSelfTest(test) {
+		return fmt.Errorf("invalid self-test %q (use short or long)", test)
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.Smartctl, []string{"-j", "-t", test, smartDevicePath(name)}, nil, cfg.Limits)
+	if err != nil {
+		return err
+	}
+	// Bit 2 is set when the drive rejects the test command.
+	if res.ExitCode&7 != 0 {
+		return fmt.Errorf("smartctl %s: exit %d: %s", name, res.ExitCode, smartctlErrors(res.Stdout, res.Stderr))
+	}
+	return nil
+}
+
+// ReadSelfTestLog reads the self-test log and progress of a drive.
+func ReadSelfTestLog(ctx context.Context, cfg config.Config, name string) (SelfTestLog, error) {
+	if !ValidDiskName(name) {
+		return SelfTestLog{}, fmt.Errorf("invalid disk name")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.Smartctl, []string{"-j", "-i", "-c", "-A", "-l", "selftest", smartDevicePath(name)}, nil, cfg.Limits)
+	if err != nil {
+		return SelfTestLog{}, err
+	}
+	if res.ExitCode&3 != 0 {
+		return SelfTestLog{}, fmt.Errorf("smartctl %s: exit %d: %s", name, res.ExitCode, smartctlErrors(res.Stdout, res.Stderr))
+	}
+	log, err := parseSelfTestLog([]byte(res.Stdout), time.Now())
+	if err != nil {
+		return SelfTestLog{}, err
+	}
+	log.Device = name
+	for i := range log.Entries {
+		log.Entries[i].Device = name
+	}
+	return log, nil
+}
+
+// smartctlErrors returns the error messages of a JSON smartctl run, or stderr.
+func smartctlErrors(stdout, stderr string) string {
+	var raw smartctlJSON
+	if json.Unmarshal([]byte(stdout), &raw) == nil {
+		var msgs []string
+		for _, msg := range raw.Smartctl.Messages {
+			if msg.Severity == "error" {
+				msgs = append(msgs, msg.String)
+			}
+		}
+		if len(msgs) > 0 {
+			return strings.Join(msgs, "; ")
+		}
+	}
+	return strings.TrimSpace(stderr)
+}
+
+type selfTestCode struct {
+	Value  int    `json:"value"`
+	String string `json:"string"`
+}
+
+type selfTestJSON struct {
+	SerialNumber string `json:"serial_number"`
+	PowerOnTime  struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATAData struct {
+		SelfTest struct {
+			Status struct {
+				Value            int `json:"value"`
+				RemainingPercent int `json:"remaining_percent"`
+			} `json:"status"`
+		} `json:"self_test"`
+	} `json:"ata_smart_data"`
+	ATALog struct {
+		Standard struct {
+			Table []struct {
+				Type   selfTestCode `json:"type"`
+				Status struct {
+					Value  int    `json:"value"`
+					String string `json:"string"`
+				} `json:"status"`
+				LifetimeHours int64 `json:"lifetime_hours"`
+			} `json:"table"`
+		} `json:"standard"`
+	} `json:"ata_smart_self_test_log"`
+	NVMeHealth *struct {
+		PowerOnHours int64 `json:"power_on_hours"`
+	} `json:"nvme_smart_health_information_log"`
+	NVMeLog *struct {
+		Current           selfTestCode `json:"current_self_test_operation"`
+		CompletionPercent int          `json:"current_self_test_completion_percent"`
+		Table             []struct {
+			Code         selfTestCode `json:"self_test_code"`
+			Result       selfTestCode `json:"self_test_result"`
+			PowerOnHours int64        `json:"power_on_hours"`
+		} `json:"table"`
+	} `json:"nvme_self_test_log"`
+}
+
+type scsiSelfTestJSON struct {
+	Code        selfTestCode `json:"code"`
+	Result      selfTestCode `json:"result"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+}
+
+func parseSelfTestLog(data []byte, now time.Time) (SelfTestLog, error) {
+	var raw selfTestJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return SelfTestLog{}, fmt.Errorf("parse smartctl output: %w", err)
+	}
+	log := SelfTestLog{Serial: raw.SerialNumber, PowerOnHours: raw.PowerOnTime.Hours, Entries: []SelfTestResult{}}
+	if raw.NVMeHealth != nil && log.PowerOnHours == 0 {
+		log.PowerOnHours = raw.NVMeHealth.PowerOnHours
+	}
+	add := func(test, status, result string, hours int64) {
+		log.Entries = append(log.Entries, SelfTestResult{
+			Serial:        log.Serial,
+			Test:          test,
+			Status:        status,
+			Result:        result,
+			LifetimeHours: hours,
+			Completed:     completedAt(now, log.PowerOnHours, hours),
+		})
+	}
+
+	// ATA status and NVMe/SCSI result codes: 0 is success, 15 means running or unused.
+	if raw.ATAData.SelfTest.Status.Value>>4 == 15 {
+		log.Running = true
+		log.Remaining = raw.ATAData.SelfTest.Status.RemainingPercent
+	}
+	for _, entry := range raw.ATALog.Standard.Table {
+		code := entry.Status.Value >> 4
+		switch {
+		case code == 15:
+			log.Running = true
+		case code == 0:
+			add(entry.Type.String, entry.Status.String, SelfTestPassed, entry.LifetimeHours)
+		case code == 1 || code == 2:
+			add(entry.Type.String, entry.Status.String, SelfTestAborted, entry.LifetimeHours)
+		default:
+			add(entry.Type.String, entry.Status.String, SelfTestFailed, entry.LifetimeHours)
+		}
+	}
+
+	if nvme := raw.NVMeLog; nvme != nil {
+		if nvme.Current.Value != 0 {
+			log.Running = true
+			log.Remaining = 100 - nvme.CompletionPercent
+		}
+		for _, entry := range nvme.Table {
+			switch code := entry.Result.Value & 0xf; code {
+			case 15:
+			case 0:
+				add(entry.Code.String, entry.Result.String, SelfTestPassed, entry.PowerOnHours)
+			case 5, 6, 7:
+				add(entry.Code.String, entry.Result.String, SelfTestFailed, entry.PowerOnHours)
+			default:
+				add(entry.Code.String, entry.Result.String, SelfTestAborted, entry.PowerOnHours)
+			}
+		}
+	}
+
+	// SCSI logs are numbered objects rather than a table.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err == nil {
+		for i := 0; i < 20; i++ {
+			field, ok := fields[fmt.Sprintf("scsi_self_test_%d", i)]
+			if !ok {
+				break
+			}
+			var entry scsiSelfTestJSON
+			if json.Unmarshal(field, &entry) != nil {
+				continue
+			}
+			switch code := entry.Result.Value; {
+			case code == 15:
+				log.Running = true
+			case code == 0:
+				add(entry.Code.String, entry.Result.String, SelfTestPassed, entry.PowerOnTime.Hours)
+			case code == 1 || code == 2:
+				add(entry.Code.String, entry.Result.String, SelfTestAborted, entry.PowerOnTime.Hours)
+			default:
+				add(entry.Code.String, entry.Result.String, SelfTestFailed, entry.PowerOnTime.Hours)
+			}
+		}
+	}
+	return log, nil
+}
+
+// completedAt converts a log entry's power-on hour into wall time.
+func completedAt(now time.Time, powerOn, lifetime int64) time.Time {
+	if powerOn <= 0 || lifetime <= 0 || lifetime > powerOn {
+		return now.UTC().Truncate(time.Second)
+	}
+	return now.Add(-time.Duration(powerOn-lifetime) * time.Hour).UTC().Truncate(time.Hour)
+}
+
+// RecordSelfTests appends the log entries of a drive that are not in the history yet
+// and returns them.
+func RecordSelfTests(path string, log SelfTestLog) ([]SelfTestResult, error) {
+	known, err := SelfTestHistory(path, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	for _, rec := range known {
+		seen[selfTestKey(rec)] = struct{}{}
+	}
+	added := []SelfTestResult{}
+	now := time.Now().UTC().Truncate(time.Second)
+	// Entries are newest first; append oldest first so the file stays in order.
+	for i := len(log.Entries) - 1; i >= 0; i-- {
+		rec := log.Entries[i]
+		if _, ok := seen[selfTestKey(rec)]; ok {
+			continue
+		}
+		rec.Recorded = now
+		added = append(added, rec)
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for _, rec := range added {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// selfTestKey identifies a log entry across reads; the serial keeps it stable when a
+// disk is renumbered.
+func selfTestKey(rec SelfTestResult) string {
+	id := rec.Serial
+	if id == "" {
+		id = rec.Device
+	}
+	return fmt.Sprintf("%s|%d|%s|%s", id, rec.LifetimeHours, rec.Test, rec.Status)
+}
+
+// SelfTestHistory returns up to limit recorded results for device (all when empty),
+// newest first. A missing file is empty.
+func SelfTestHistory(path, device string, limit int) ([]SelfTestResult, error) {
+	records := []SelfTestResult{}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec SelfTestResult
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		if device != "" && rec.Device != device {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// RunSelfTests starts the test on every drive, optionally waits for them to finish and
+// records the drives' logs in the history. Drives that refuse the test are logged and
+// skipped; it fails only when no drive could be tested.
+func RunSelfTests(ctx context.Context, cfg config.Config, opts SelfTestOptions) ([]SelfTestResult, error) {
+	logf := func(format string, args ...any) {
+		if opts.Log != nil {
+			opts.Log(fmt.Sprintf(format, args...))
+		}
+	}
+	if !ValidSelfTest(opts.Test) {
+		return nil, fmt.Errorf("invalid self-test %q (use short or long)", opts.Test)
+	}
+	devices := opts.Devices
+	if len(devices) == 0 {
+		list, err := ListDrives(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, drive := range list {
+			devices = append(devices, drive.Name)
+		}
+	}
+	var started []string
+	for _, name := range devices {
+		if err := StartSelfTest(ctx, cfg, name, opts.Test); err != nil {
+			logf("%s: %v", name, err)
+			continue
+		}
+		logf("%s: %s self-test started", name, opts.Test)
+		started = append(started, name)
+	}
+	if len(started) == 0 {
+		return nil, fmt.Errorf("no drive started a self-test")
+	}
+	if opts.Wait {
+		waitSelfTests(ctx, cfg, opts.Test, started, logf)
+	}
+	path := SelfTestHistoryPath(cfg)
+	recorded := []SelfTestResult{}
+	for _, name := range started {
+		log, err := ReadSelfTestLog(ctx, cfg, name)
+		if err != nil {
+			logf("%s: %v", name, err)
+			continue
+		}
+		if log.Running {
+			logf("%s: self-test still running (%d%% remaining)", name, log.Remaining)
+		}
+		added, err := RecordSelfTests(path, log)
+		if err != nil {
+			return recorded, err
+		}
+		for _, rec := range added {
+			logf("%s: %s %s (%s)", name, rec.Test, rec.Result, rec.Status)
+		}
+		recorded = append(recorded, added...)
+	}
+	return recorded, nil
+}
+
+// waitSelfTests polls the drives until none is testing. Long tests on large disks take
+// most of a day, so the deadline is generous.
+func waitSelfTests(ctx context.Context, cfg config.Config, test string, names []string, logf func(string, ...any)) {
+	interval, limit := 30*time.Second, 30*time.Minute
+	if test == "long" {
+		interval, limit = 5*time.Minute, 48*time.Hour
+	}
+	deadline := time.Now().Add(limit)
+	pending := names
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		var still []string
+		for _, name := range pending {
+			log, err := ReadSelfTestLog(ctx, cfg, name)
+			if err != nil || !log.Running {
+				continue
+			}
+			still = append(still, name)
+			logf("%s: %d%% remaining", name, log.Remaining)
+		}
+		pending = still
+	}
+}
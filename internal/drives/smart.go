@@ -0,0 +1,251 @@
+// Package drives reads SMART health from smartctl(8) JSON output.
+package drives
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// SMART health levels, from best to worst.
+const (
+	HealthOK      = "ok"
+	HealthWarn    = "warn"
+	HealthFail    = "fail"
+	HealthUnknown = "unknown"
+)
+
+// SMARTHealth is the part of `smartctl -a -j` that predicts drive failure. Counters
+// that do not apply to the drive's protocol stay zero.
+type SMARTHealth struct {
+	Device       string `json:"device"`
+	Protocol     string `json:"protocol"`
+	Model        string `json:"model"`
+	Serial       string `json:"serial"`
+	Passed       bool   `json:"passed"`
+	Temperature  int    `json:"temperature_c"`
+	PowerOnHours int64  `json:"power_on_hours"`
+	// ATA attributes 5, 197 and 198; SCSI grown defects count as reallocated.
+	Reallocated   int64 `json:"reallocated_sectors"`
+	Pending       int64 `json:"pending_sectors"`
+	Uncorrectable int64 `json:"offline_uncorrectable"`
+	// NVMe health log.
+	PercentUsed     int   `json:"percent_used"`
+	AvailableSpare  int   `json:"available_spare"`
+	SpareThreshold  int   `json:"available_spare_threshold"`
+	MediaErrors     int64 `json:"media_errors"`
+	CriticalWarning int   `json:"critical_warning"`
+	// Standby is set when the drive was spun down and left alone (`-n standby`).
+	Standby bool `json:"standby"`
+	// Level is ok, warn, fail or unknown; Reasons explains anything but ok.
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+var nvmeDiskPattern = regexp.MustCompile(`^(nvd|nda)([0-9]+)$`)
+
+// smartDevicePath maps a geom disk name to the node smartctl expects. nvd/nda disks
+// are namespaces of an nvme controller, which carries the health log.
+func smartDevicePath(name string) string {
+	if m := nvmeDiskPattern.FindStringSubmatch(name); m != nil {
+		return "/dev/nvme" + m[2]
+	}
+	return "/dev/" + name
+}
+
+// ValidDiskName accepts bare geom disk names such as ada0, da12 or nvd0.
+func ValidDiskName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadSMART runs `smartctl -a -j -n standby` for a geom disk name. Drives in standby
+// are not woken up and come back with Standby set.
+func ReadSMART(ctx context.Context, cfg config.Config, name string) (SMARTHealth, error) {
+	if !ValidDiskName(name) {
+		return SMARTHealth{}, fmt.Errorf("invalid disk name")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.Smartctl, []string{"-a", "-j", "-n", "standby,2", smartDevicePath(name)}, nil, cfg.Limits)
+	if err != nil {
+		return SMARTHealth{}, err
+	}
+	// smartctl's exit status is a bit mask; bits 0-1 mean it could not talk to the
+	// device, exit 2 with -n standby,2 means the drive is asleep. Higher bits report
+	// health problems that are read from the JSON below.
+	if res.ExitCode == 2 && strings.Contains(res.Stdout, "STANDBY") {
+		return SMARTHealth{Device: name, Standby: true, Level: HealthUnknown}, nil
+	}
+	h, err := parseSMART([]byte(res.Stdout))
+	if res.ExitCode&3 != 0 {
+		details := strings.TrimSpace(res.Stderr)
+		if err == nil && len(h.Reasons) > 0 {
+			details = strings.Join(h.Reasons, "; ")
+		}
+		return SMARTHealth{}, fmt.Errorf("smartctl %s: exit %d: %s", name, res.ExitCode, details)
+	}
+	if err != nil {
+		return SMARTHealth{}, err
+	}
+	h.Device = name
+	return h, nil
+}
+
+type smartctlJSON struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Device struct {
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	ScsiModel    string `json:"scsi_model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATAAttributes struct {
+		Table []struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Value  int    `json:"value"`
+			Thresh int    `json:"thresh"`
+			Raw    struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	SCSIGrownDefects *int64 `json:"scsi_grown_defect_list"`
+	NVMeLog          *struct {
+		CriticalWarning         int   `json:"critical_warning"`
+		Temperature             int   `json:"temperature"`
+		AvailableSpare          int   `json:"available_spare"`
+		AvailableSpareThreshold int   `json:"available_spare_threshold"`
+		PercentageUsed          int   `json:"percentage_used"`
+		PowerOnHours            int64 `json:"power_on_hours"`
+		MediaErrors             int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+func parseSMART(data []byte) (SMARTHealth, error) {
+	var raw smartctlJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return SMARTHealth{}, fmt.Errorf("parse smartctl output: %w", err)
+	}
+	h := SMARTHealth{
+		Protocol:     raw.Device.Protocol,
+		Model:        raw.ModelName,
+		Serial:       raw.SerialNumber,
+		Temperature:  raw.Temperature.Current,
+		PowerOnHours: raw.PowerOnTime.Hours,
+		Level:        HealthOK,
+	}
+	if h.Model == "" {
+		h.Model = raw.ScsiModel
+	}
+	if raw.SmartStatus == nil {
+		h.Level = HealthUnknown
+		for _, msg := range raw.Smartctl.Messages {
+			if msg.Severity == "error" {
+				h.Reasons = append(h.Reasons, msg.String)
+			}
+		}
+		if len(h.Reasons) == 0 {
+			h.Reasons = append(h.Reasons, "no SMART status reported")
+		}
+		return h, nil
+	}
+	h.Passed = raw.SmartStatus.Passed
+	if !h.Passed {
+		h.flag(HealthFail, "SMART overall health self-assessment failed")
+	}
+	for _, attr := range raw.ATAAttributes.Table {
+		switch attr.ID {
+		case 5:
+			h.Reallocated = attr.Raw.Value
+		case 197:
+			h.Pending = attr.Raw.Value
+		case 198:
+			h.Uncorrectable = attr.Raw.Value
+		}
+		if attr.Thresh > 0 && attr.Value <= attr.Thresh {
+			h.flag(HealthFail, fmt.Sprintf("attribute %d %s at or below threshold", attr.ID, attr.Name))
+		}
+	}
+	if raw.SCSIGrownDefects != nil {
+		h.Reallocated = *raw.SCSIGrownDefects
+	}
+	if nvme := raw.NVMeLog; nvme != nil {
+		h.PercentUsed = nvme.PercentageUsed
+		h.AvailableSpare = nvme.AvailableSpare
+		h.SpareThreshold = nvme.AvailableSpareThreshold
+		h.MediaErrors = nvme.MediaErrors
+		h.CriticalWarning = nvme.CriticalWarning
+		if h.Temperature == 0 {
+			h.Temperature = nvme.Temperature
+		}
+		if h.PowerOnHours == 0 {
+			h.PowerOnHours = nvme.PowerOnHours
+		}
+	}
+	h.assess()
+	return h, nil
+}
+
+// assess flags counters that precede failures. Any reallocated, pending or
+// uncorrectable sector is worth a warning: they rarely stay at one.
+func (h *SMARTHealth) assess() {
+	if h.Reallocated > 0 {
+		h.flag(HealthWarn, fmt.Sprintf("%d reallocated sectors", h.Reallocated))
+	}
+	if h.Pending > 0 {
+		h.flag(HealthWarn, fmt.Sprintf("%d pending sectors", h.Pending))
+	}
+	if h.Uncorrectable > 0 {
+		h.flag(HealthWarn, fmt.Sprintf("%d offline uncorrectable sectors", h.Uncorrectable))
+	}
+	if h.CriticalWarning != 0 {
+		h.flag(HealthFail, fmt.Sprintf("NVMe critical warning 0x%02x", h.CriticalWarning))
+	}
+	if h.SpareThreshold > 0 && h.AvailableSpare < h.SpareThreshold {
+		h.flag(HealthFail, fmt.Sprintf("available spare %d%% below threshold %d%%", h.AvailableSpare, h.SpareThreshold))
+	}
+	if h.PercentUsed >= 100 {
+		h.flag(HealthFail, fmt.Sprintf("%d%% of rated endurance used", h.PercentUsed))
+	} else if h.PercentUsed >= 80 {
+		h.flag(HealthWarn, fmt.Sprintf("%d%% of rated endurance used", h.PercentUsed))
+	}
+	if h.MediaErrors > 0 {
+		h.flag(HealthWarn, fmt.Sprintf("%d media errors", h.MediaErrors))
+	}
+	if h.Temperature >= 60 {
+		h.flag(HealthWarn, fmt.Sprintf("temperature %d°C", h.Temperature))
+	}
+}
+
+func (h *SMARTHealth) flag(level, reason string) {
+	h.Reasons = append(h.Reasons, reason)
+	if level == HealthFail || h.Level == HealthOK {
+		h.Level = level
+	}
+}
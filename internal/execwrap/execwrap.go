@@ -1,4 +1,5 @@
-// Package execwrap executes privileged commands via sudo -n with output limits.
+// Package execwrap executes privileged commands via sudo -n, and read-only queries as
+// the service user, with output limits.
 package execwrap
 
 import (
@@ -7,11 +8,17 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"sync"
+	"syscall"
 	"time"
 
 	"raidraccoon/internal/config"
 )
 
+// waitDelay bounds how long a cancelled command may take to exit after SIGTERM before
+// it is killed and its output pipes are closed.
+const waitDelay = 10 * time.Second
+
 type Result struct {
 	Stdout    string
 	Stderr    string
@@ -19,51 +26,88 @@ type Result struct {
 	Truncated bool
 }
 
+// NoRuntimeLimit lifts the MaxRuntimeSeconds cap for long transfers (replication, stream
+// files, windowed or throttled copies) that are bounded by their job or window context.
+func NoRuntimeLimit(limits config.Limits) config.Limits {
+	limits.MaxRuntimeSeconds = -1
+	return limits
+}
+
+// RuntimeContext applies limits.MaxRuntimeSeconds to ctx: the configured value, 120
+// seconds when unset, or no cap after NoRuntimeLimit.
+func RuntimeContext(ctx context.Context, limits config.Limits) (context.Context, context.CancelFunc) {
+	switch {
+	case limits.MaxRuntimeSeconds < 0:
+		return context.WithCancel(ctx)
+	case limits.MaxRuntimeSeconds == 0:
+		return context.WithTimeout(ctx, 120*time.Second)
+	default:
+		return context.WithTimeout(ctx, time.Duration(limits.MaxRuntimeSeconds)*time.Second)
+	}
+}
+
+// Command builds `sudo -n absCmd args...`. sudo gets its own process group so that it
+// relays the SIGTERM sent when ctx is done to the root command (sudo ignores signals from
+// the command's process group); a command that outlives waitDelay is killed.
+func Command(ctx context.Context, absCmd string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sudo", append([]string{"-n", absCmd}, args...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// UserCommand builds `absCmd args...` run as the service user, with the same SIGTERM on
+// cancel and waitDelay as Command.
+func UserCommand(ctx context.Context, absCmd string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, absCmd, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
 // Run executes absCmd via `sudo -n` and returns captured output.
 // This is the only place in the codebase that shells out for privileged actions.
 func Run(ctx context.Context, absCmd string, args []string, stdin []byte, limits config.Limits) (Result, error) {
+	return run(ctx, absCmd, args, stdin, limits, true)
+}
+
+// RunUnprivileged executes absCmd as the service user, for commands that need no root
+// (`mount -p`, `swapctl -l`, ssh with the managed key) and so need no sudoers entry.
+func RunUnprivileged(ctx context.Context, absCmd string, args []string, stdin []byte, limits config.Limits) (Result, error) {
+	return run(ctx, absCmd, args, stdin, limits, false)
+}
+
+func run(ctx context.Context, absCmd string, args []string, stdin []byte, limits config.Limits, privileged bool) (Result, error) {
 	if absCmd == "" || absCmd[0] != '/' {
 		return Result{}, fmt.Errorf("command must be absolute")
 	}
-	if limits.MaxRuntimeSeconds <= 0 {
-		limits.MaxRuntimeSeconds = 120
-	}
-	execCtx, cancel := context.WithTimeout(ctx, time.Duration(limits.MaxRuntimeSeconds)*time.Second)
+	execCtx, cancel := RuntimeContext(ctx, limits)
 	defer cancel()
 
-	cmd := exec.CommandContext(execCtx, "sudo", append([]string{"-n", absCmd}, args...)...)
+	cmd := UserCommand(execCtx, absCmd, args)
+	if privileged {
+		cmd = Command(execCtx, absCmd, args)
+	}
 	if stdin != nil {
 		cmd.Stdin = bytes.NewReader(stdin)
 	}
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return Result{}, err
-	}
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return Result{}, err
-	}
+	stdout := &limitedWriter{limit: limits.MaxOutputBytes}
+	stderr := &limitedWriter{limit: limits.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	if err := cmd.Start(); err != nil {
 		return Result{}, err
 	}
 
-	outBytes, outTrunc, err := config.ReadAllLimited(stdoutPipe, limits.MaxOutputBytes)
-	if err != nil {
-		return Result{}, err
-	}
-	errBytes, errTrunc, err := config.ReadAllLimited(stderrPipe, limits.MaxOutputBytes)
-	if err != nil {
-		return Result{}, err
-	}
-
-	err = cmd.Wait()
+	err := cmd.Wait()
 	exitCode := 0
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
 			exitCode = exitErr.ExitCode()
-		} else if errors.Is(err, context.DeadlineExceeded) {
+		} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(execCtx.Err(), context.DeadlineExceeded) {
 			exitCode = 124
 		} else {
 			exitCode = 1
@@ -71,9 +115,44 @@ func Run(ctx context.Context, absCmd string, args []string, stdin []byte, limits
 	}
 
 	return Result{
-		Stdout:    string(outBytes),
-		Stderr:    string(errBytes),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
 		ExitCode:  exitCode,
-		Truncated: outTrunc || errTrunc,
+		Truncated: stdout.truncated || stderr.truncated,
 	}, nil
 }
+
+// limitedWriter keeps the first limit bytes written to it (1 MiB when unset) and
+// discards the rest.
+type limitedWriter struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.limit
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	remain := limit - int64(l.buf.Len())
+	if remain <= 0 {
+		l.truncated = true
+		return len(p), nil
+	}
+	if int64(len(p)) > remain {
+		l.buf.Write(p[:remain])
+		l.truncated = true
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+func (l *limitedWriter) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
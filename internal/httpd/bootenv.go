@@ -0,0 +1,154 @@
+// Package httpd serves boot environment management backed by bectl.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/execwrap"
+	"raidraccoon/internal/zfs"
+)
+
+type bootEnvRequest struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	PreUpgrade bool   `json:"pre_upgrade"`
+	Prefix     string `json:"prefix"`
+	Keep       int    `json:"keep"`
+	Action     string `json:"action"`
+	NewName    string `json:"new_name"`
+	Temporary  bool   `json:"temporary"`
+	Origin     bool   `json:"origin"`
+	Confirm    bool   `json:"confirm"`
+}
+
+// handleBootEnvironments lists (GET), creates (POST), changes (PUT: activate, rename,
+// mount, unmount) and destroys (DELETE) boot environments.
+func (s *Server) handleBootEnvironments(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	if r.Method == http.MethodGet {
+		envs, err := zfs.ListBootEnvironments(r.Context(), cfg)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list boot environments failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": envs}})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req bootEnvRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	user := auth.UserFromContext(r.Context())
+	switch r.Method {
+	case http.MethodPost:
+		if req.PreUpgrade {
+			if req.Keep < 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "keep must be >= 0"})
+				return
+			}
+			name, pruned, err := zfs.CreatePreUpgradeBootEnvironment(r.Context(), cfg, zfs.PreUpgradeOptions{Prefix: strings.TrimSpace(req.Prefix), Keep: req.Keep})
+			exitCode := 0
+			if err != nil {
+				exitCode = 1
+			}
+			s.audit.Log(user, "bootenv.preupgrade", fmt.Sprintf("%s create %s", cfg.Paths.Bectl, name), exitCode)
+			if err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "boot environment create failed", Details: err.Error()})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"name": name, "pruned": pruned}})
+			return
+		}
+		source := strings.TrimSpace(req.Source)
+		if !zfs.ValidBootEnvName(req.Name) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid boot environment name"})
+			return
+		}
+		if source != "" && !zfs.ValidBootEnvSource(source) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid source", Details: "use a boot environment or be@snapshot"})
+			return
+		}
+		res, err := zfs.CreateBootEnvironment(r.Context(), cfg, req.Name, source)
+		command := fmt.Sprintf("%s create %s", cfg.Paths.Bectl, req.Name)
+		if source != "" {
+			command = fmt.Sprintf("%s create -e %s %s", cfg.Paths.Bectl, source, req.Name)
+		}
+		s.audit.Log(user, "bootenv.create", command, res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "boot environment create failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"name": req.Name}})
+	case http.MethodPut:
+		if !zfs.ValidBootEnvName(req.Name) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid boot environment name"})
+			return
+		}
+		data := map[string]string{"name": req.Name}
+		var (
+			res     execwrap.Result
+			err     error
+			command string
+		)
+		switch req.Action {
+		case "activate":
+			res, err = zfs.ActivateBootEnvironment(r.Context(), cfg, req.Name, req.Temporary)
+			command = fmt.Sprintf("%s activate %s", cfg.Paths.Bectl, req.Name)
+			if req.Temporary {
+				command = fmt.Sprintf("%s activate -t %s", cfg.Paths.Bectl, req.Name)
+			}
+		case "rename":
+			newName := strings.TrimSpace(req.NewName)
+			if !zfs.ValidBootEnvName(newName) {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid new name"})
+				return
+			}
+			res, err = zfs.RenameBootEnvironment(r.Context(), cfg, req.Name, newName)
+			command = fmt.Sprintf("%s rename %s %s", cfg.Paths.Bectl, req.Name, newName)
+			data["name"] = newName
+		case "mount":
+			data["mountpoint"], res, err = zfs.MountBootEnvironment(r.Context(), cfg, req.Name)
+			command = fmt.Sprintf("%s mount %s", cfg.Paths.Bectl, req.Name)
+		case "unmount":
+			res, err = zfs.UnmountBootEnvironment(r.Context(), cfg, req.Name)
+			command = fmt.Sprintf("%s umount %s", cfg.Paths.Bectl, req.Name)
+		default:
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "action must be activate, rename, mount or unmount"})
+			return
+		}
+		s.audit.Log(user, "bootenv."+req.Action, command, res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "boot environment " + req.Action + " failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+	case http.MethodDelete:
+		if !zfs.ValidBootEnvName(req.Name) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid boot environment name"})
+			return
+		}
+		if !req.Confirm {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+			return
+		}
+		res, err := zfs.DestroyBootEnvironment(r.Context(), cfg, req.Name, req.Origin)
+		command := fmt.Sprintf("%s destroy %s", cfg.Paths.Bectl, req.Name)
+		if req.Origin {
+			command = fmt.Sprintf("%s destroy -o %s", cfg.Paths.Bectl, req.Name)
+		}
+		s.audit.Log(user, "bootenv.destroy", command, res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "boot environment destroy failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"name": req.Name}})
+	}
+}
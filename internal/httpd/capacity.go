@@ -0,0 +1,247 @@
+// Package httpd records pool/dataset usage and forecasts when pools fill up.
+package httpd
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/tsdb"
+	"raidraccoon/internal/zfs"
+)
+
+const (
+	capacityInterval   = 15 * time.Minute
+	capacityTopGrowers = 10
+	capacityMinPoints  = 3
+)
+
+// capacityTiers keep hourly usage for two weeks and daily usage for two years, which is
+// what a growth trend needs; per-minute resolution would only add noise.
+var capacityTiers = []tsdb.Tier{
+	{Name: "1h", Step: time.Hour, Retention: 14 * 24 * time.Hour},
+	{Name: "1d", Step: 24 * time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+}
+
+type poolForecast struct {
+	Pool         string  `json:"pool"`
+	Size         int64   `json:"size"`
+	Alloc        int64   `json:"alloc"`
+	Percent      float64 `json:"percent"`
+	GrowthPerDay float64 `json:"growth_per_day"`
+	Days80       float64 `json:"days_to_80,omitempty"`
+	Date80       string  `json:"date_80,omitempty"`
+	Days100      float64 `json:"days_to_100,omitempty"`
+	Date100      string  `json:"date_100,omitempty"`
+	Points       int     `json:"points"`
+	Status       string  `json:"status"`
+}
+
+type datasetGrowth struct {
+	Name         string  `json:"name"`
+	Used         int64   `json:"used"`
+	GrowthPerDay float64 `json:"growth_per_day"`
+}
+
+type capacityReport struct {
+	WindowDays int             `json:"window_days"`
+	Pools      []poolForecast  `json:"pools"`
+	Growers    []datasetGrowth `json:"top_growers"`
+}
+
+// startCapacityRecorder samples pool and dataset usage every capacityInterval into a
+// store under stats.data_dir/capacity.
+func (s *Server) startCapacityRecorder() {
+	store, err := tsdb.Open(filepath.Join(s.cfg.Stats.DataDir, "capacity"), capacityTiers)
+	if err != nil {
+		s.statsMu.Lock()
+		s.capacityErr = err.Error()
+		s.statsMu.Unlock()
+		return
+	}
+	s.capacityStore = store
+	go func() {
+		for {
+			s.recordCapacity(store)
+			time.Sleep(capacityInterval)
+		}
+	}()
+}
+
+func (s *Server) recordCapacity(store *tsdb.Store) {
+	ctx := context.Background()
+	cfg := s.snapshotConfig()
+	now := time.Now()
+	var errs []string
+	pools, err := zfs.ListPoolUsage(ctx, cfg)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, pool := range pools {
+		values := map[string]float64{"alloc": float64(pool.Alloc), "size": float64(pool.Size)}
+		if err := store.Add("pool/"+pool.Name, now, values); err != nil {
+			errs = append(errs, err.Error())
+			break
+		}
+	}
+	datasets, err := zfs.ListDatasetUsage(ctx, cfg)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, ds := range datasets {
+		if err := store.Add("dataset/"+ds.Name, now, map[string]float64{"used": float64(ds.Used)}); err != nil {
+			errs = append(errs, err.Error())
+			break
+		}
+	}
+	s.statsMu.Lock()
+	s.capacityErr = strings.Join(errs, "; ")
+	s.statsMu.Unlock()
+}
+
+func (s *Server) handleZFSCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	s.statsMu.Lock()
+	capacityErr := s.capacityErr
+	s.statsMu.Unlock()
+	if s.capacityStore == nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "capacity history unavailable", Details: capacityErr})
+		return
+	}
+	days := 30
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 1 || val > 730 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "days must be between 1 and 730"})
+			return
+		}
+		days = val
+	}
+	report := s.buildCapacityReport(days, time.Now())
+	data := map[string]any{"report": report}
+	if capacityErr != "" {
+		data["error"] = capacityErr
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+}
+
+// buildCapacityReport fits a linear trend to each pool's allocation over the window and
+// ranks datasets by growth.
+func (s *Server) buildCapacityReport(days int, now time.Time) capacityReport {
+	report := capacityReport{WindowDays: days, Pools: []poolForecast{}, Growers: []datasetGrowth{}}
+	for _, name := range s.capacityStore.Series() {
+		switch {
+		case strings.HasPrefix(name, "pool/"):
+			points := s.capacityPoints(name, days, now)
+			if len(points) == 0 {
+				// Exported or destroyed pools drop out once the window passes.
+				continue
+			}
+			report.Pools = append(report.Pools, forecastPool(strings.TrimPrefix(name, "pool/"), points, now))
+		case strings.HasPrefix(name, "dataset/"):
+			points := s.capacityPoints(name, days, now)
+			if len(points) < 2 {
+				continue
+			}
+			slope, ok := growthPerDay(points, "used")
+			if !ok || slope <= 0 {
+				continue
+			}
+			used := int64(points[len(points)-1].Values["used"])
+			report.Growers = append(report.Growers, datasetGrowth{Name: strings.TrimPrefix(name, "dataset/"), Used: used, GrowthPerDay: slope})
+		}
+	}
+	sort.Slice(report.Pools, func(i, j int) bool { return report.Pools[i].Pool < report.Pools[j].Pool })
+	sort.Slice(report.Growers, func(i, j int) bool { return report.Growers[i].GrowthPerDay > report.Growers[j].GrowthPerDay })
+	if len(report.Growers) > capacityTopGrowers {
+		report.Growers = report.Growers[:capacityTopGrowers]
+	}
+	return report
+}
+
+// capacityPoints returns the window from the daily tier, falling back to the hourly tier
+// while there is not enough daily history yet.
+func (s *Server) capacityPoints(series string, days int, now time.Time) []tsdb.Point {
+	from := now.Add(-time.Duration(days) * 24 * time.Hour)
+	_, points := s.capacityStore.Query(series, from, now)
+	if len(points) >= capacityMinPoints {
+		return points
+	}
+	hourly := capacityTiers[0].Retention - time.Hour
+	if now.Sub(from) > hourly {
+		from = now.Add(-hourly)
+	}
+	_, points = s.capacityStore.Query(series, from, now)
+	return points
+}
+
+func forecastPool(name string, points []tsdb.Point, now time.Time) poolForecast {
+	f := poolForecast{Pool: name, Points: len(points), Status: "insufficient"}
+	if len(points) == 0 {
+		return f
+	}
+	last := points[len(points)-1].Values
+	f.Size = int64(last["size"])
+	f.Alloc = int64(last["alloc"])
+	if f.Size > 0 {
+		f.Percent = float64(f.Alloc) * 100 / float64(f.Size)
+	}
+	if len(points) < capacityMinPoints {
+		return f
+	}
+	slope, ok := growthPerDay(points, "alloc")
+	if !ok {
+		return f
+	}
+	f.GrowthPerDay = slope
+	if slope <= 0 {
+		f.Status = "stable"
+		return f
+	}
+	f.Status = "growing"
+	days := func(fraction float64) float64 {
+		return (fraction*float64(f.Size) - float64(f.Alloc)) / slope
+	}
+	if d := days(0.8); d > 0 {
+		f.Days80 = math.Round(d*10) / 10
+		f.Date80 = now.Add(time.Duration(d * 24 * float64(time.Hour))).Format("2006-01-02")
+	} else {
+		f.Status = "above 80%"
+	}
+	if d := days(1); d > 0 {
+		f.Days100 = math.Round(d*10) / 10
+		f.Date100 = now.Add(time.Duration(d * 24 * float64(time.Hour))).Format("2006-01-02")
+	}
+	return f
+}
+
+// growthPerDay is the least-squares slope of key over time, in units per day.
+func growthPerDay(points []tsdb.Point, key string) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	origin := points[0].Time
+	var n, sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		x := p.Time.Sub(origin).Hours() / 24
+		y := p.Values[key]
+		n++
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denom, true
+}
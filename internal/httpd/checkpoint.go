@@ -0,0 +1,155 @@
+// Package httpd serves pool checkpoints and the guided rewind to them.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/zfs"
+)
+
+// checkpointHint is returned by pool-modifying endpoints when no checkpoint protects
+// the change.
+const checkpointHint = "no checkpoint exists; send checkpoint: true to take one first so the change can be rewound"
+
+type checkpointRequest struct {
+	Pool        string `json:"pool"`
+	Confirm     bool   `json:"confirm"`
+	ConfirmName string `json:"confirm_name"`
+}
+
+// handleZFSCheckpoints lists checkpoints (GET, all pools or ?pool=), takes one (POST)
+// and discards one (DELETE).
+func (s *Server) handleZFSCheckpoints(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	if r.Method == http.MethodGet {
+		pool := strings.TrimSpace(r.URL.Query().Get("pool"))
+		if pool != "" {
+			if !zfs.ValidPoolName(pool) {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+				return
+			}
+			cp, err := zfs.ReadPoolCheckpoint(r.Context(), cfg, pool)
+			if err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read checkpoint failed", Details: err.Error()})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: cp})
+			return
+		}
+		items, err := zfs.ListPoolCheckpoints(r.Context(), cfg)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list checkpoints failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": items}})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req checkpointRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	req.Pool = strings.TrimSpace(req.Pool)
+	if !zfs.ValidPoolName(req.Pool) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+		return
+	}
+	user := auth.UserFromContext(r.Context())
+	if r.Method == http.MethodPost {
+		res, err := zfs.CheckpointPool(r.Context(), cfg, req.Pool)
+		s.audit.Log(user, "zfs.checkpoint", fmt.Sprintf("%s checkpoint %s", cfg.Paths.ZPool, req.Pool), res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "checkpoint failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"pool": req.Pool}})
+		return
+	}
+	if !req.Confirm {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+		return
+	}
+	res, err := zfs.DiscardCheckpoint(r.Context(), cfg, req.Pool)
+	s.audit.Log(user, "zfs.checkpoint_discard", fmt.Sprintf("%s checkpoint -d %s", cfg.Paths.ZPool, req.Pool), res.ExitCode)
+	if err != nil || res.ExitCode != 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "checkpoint discard failed", Details: resultDetails(res, err)})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"pool": req.Pool}})
+}
+
+// handleZFSCheckpointRewind exports the pool and re-imports it at its checkpoint. Every
+// change since the checkpoint is lost, so the pool name has to be typed back.
+func (s *Server) handleZFSCheckpointRewind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req checkpointRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	req.Pool = strings.TrimSpace(req.Pool)
+	if !zfs.ValidPoolName(req.Pool) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+		return
+	}
+	if !req.Confirm || strings.TrimSpace(req.ConfirmName) != req.Pool {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required", Details: "type the pool name to rewind"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	cp, err := zfs.ReadPoolCheckpoint(r.Context(), cfg, req.Pool)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read checkpoint failed", Details: err.Error()})
+		return
+	}
+	if !cp.Exists || cp.Discarding {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "pool has no checkpoint"})
+		return
+	}
+	res, err := zfs.RewindToCheckpoint(r.Context(), cfg, req.Pool)
+	s.audit.Log(auth.UserFromContext(r.Context()), "zfs.checkpoint_rewind", fmt.Sprintf("%s import --rewind-to-checkpoint %s", cfg.Paths.ZPool, req.Pool), res.ExitCode)
+	if err != nil || res.ExitCode != 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "rewind failed", Details: resultDetails(res, err)})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"pool": req.Pool, "checkpoint": cp.Created}})
+}
+
+// checkpointBefore takes a checkpoint of pool ahead of a risky change unless one
+// already exists, and reports whether it took one.
+func (s *Server) checkpointBefore(r *http.Request, cfg config.Config, pool string) (bool, error) {
+	cp, err := zfs.ReadPoolCheckpoint(r.Context(), cfg, pool)
+	if err != nil {
+		return false, err
+	}
+	if cp.Exists && !cp.Discarding {
+		return false, nil
+	}
+	res, err := zfs.CheckpointPool(r.Context(), cfg, pool)
+	s.audit.Log(auth.UserFromContext(r.Context()), "zfs.checkpoint", fmt.Sprintf("%s checkpoint %s", cfg.Paths.ZPool, pool), res.ExitCode)
+	if err != nil {
+		return false, err
+	}
+	if res.ExitCode != 0 {
+		return false, fmt.Errorf(res.Stderr)
+	}
+	return true, nil
+}
+
+// checkpointAdvice returns checkpointHint when pool has no usable checkpoint.
+func checkpointAdvice(r *http.Request, cfg config.Config, pool string) string {
+	cp, err := zfs.ReadPoolCheckpoint(r.Context(), cfg, pool)
+	if err != nil || (cp.Exists && !cp.Discarding) {
+		return ""
+	}
+	return checkpointHint
+}
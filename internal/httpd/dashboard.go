@@ -35,10 +35,21 @@ type dashboardSnapshotsSummary struct {
 }
 
 type dashboardCacheSummary struct {
-	UsedBytes  int64    `json:"used_bytes"`
-	TotalBytes int64    `json:"total_bytes"`
-	Devices    []string `json:"devices"`
-	Present    bool     `json:"present"`
+	UsedBytes  int64         `json:"used_bytes"`
+	TotalBytes int64         `json:"total_bytes"`
+	Devices    []string      `json:"devices"`
+	Present    bool          `json:"present"`
+	ARC        *zfs.ARCStats `json:"arc,omitempty"`
+}
+
+type dashboardIOStatSummary struct {
+	Pools      int       `json:"pools"`
+	ReadOps    float64   `json:"read_ops"`
+	WriteOps   float64   `json:"write_ops"`
+	ReadBytes  float64   `json:"read_bytes"`
+	WriteBytes float64   `json:"write_bytes"`
+	Busiest    string    `json:"busiest"`
+	History    []float64 `json:"history"`
 }
 
 type dashboardSchedulesSummary struct {
@@ -58,9 +69,13 @@ type dashboardSettingsSummary struct {
 
 type dashboardSummary struct {
 	Pools     dashboardPoolsSummary     `json:"pools"`
+	Drives    dashboardDrivesSummary    `json:"drives"`
+	GELI      dashboardGELISummary      `json:"geli"`
 	Datasets  dashboardDatasetsSummary  `json:"datasets"`
 	Snapshots dashboardSnapshotsSummary `json:"snapshots"`
 	Cache     dashboardCacheSummary     `json:"cache"`
+	IOStat    dashboardIOStatSummary    `json:"iostat"`
+	Capacity  *capacityReport           `json:"capacity,omitempty"`
 	Schedules dashboardSchedulesSummary `json:"schedules"`
 	Samba     dashboardSambaSummary     `json:"samba"`
 	Settings  dashboardSettingsSummary  `json:"settings"`
@@ -221,9 +236,10 @@ func (s *Server) buildDashboardSummary(ctx context.Context, cfg config.Config) (
 			}
 		}
 	}
-	if size, err := zfs.L2ARCSize(ctx, cfg); err == nil {
-		cacheUsed = size
-	} else if len(cacheDevices) == 0 {
+	arc, err := zfs.ReadARCStats(ctx, cfg)
+	if err == nil {
+		cacheUsed = arc.L2.Size
+	} else {
 		errs["cache"] = err.Error()
 	}
 	summary.Cache = dashboardCacheSummary{
@@ -232,6 +248,36 @@ func (s *Server) buildDashboardSummary(ctx context.Context, cfg config.Config) (
 		Devices:    cacheDevices,
 		Present:    len(cacheDevices) > 0,
 	}
+	if err == nil {
+		summary.Cache.ARC = &arc
+	}
+
+	drivesSummary, _, err := s.summarizeDriveHealth(ctx, cfg, false)
+	summary.Drives = drivesSummary
+	if err != nil {
+		errs["drives"] = err.Error()
+	}
+
+	geliSummary, err := s.summarizeGELI(ctx, cfg)
+	summary.GELI = geliSummary
+	if err != nil {
+		errs["geli"] = err.Error()
+	}
+
+	iostat, iostatErr := s.ioStatDashboard()
+	summary.IOStat = iostat
+	if iostatErr != "" {
+		errs["iostat"] = iostatErr
+	}
+
+	if s.capacityStore != nil {
+		report := s.buildCapacityReport(30, time.Now())
+		summary.Capacity = &report
+	} else {
+		s.statsMu.Lock()
+		errs["capacity"] = s.capacityErr
+		s.statsMu.Unlock()
+	}
 
 	file, err := cron.Load(cfg.Cron.CronFile, cfg.Cron.CronUser)
 	if err != nil {
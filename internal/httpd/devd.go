@@ -0,0 +1,230 @@
+// Package httpd follows devd for disk attach/detach and ZFS events, refreshes the
+// importable pool cache when disks change and pushes both to the UI over SSE.
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"raidraccoon/internal/devd"
+	"raidraccoon/internal/drives"
+)
+
+const (
+	// devdPollInterval is how often importable pools are polled while devd is unavailable.
+	devdPollInterval = 20 * time.Second
+	// devdSettle coalesces the burst of notifications one disk produces into one refresh.
+	devdSettle     = 2 * time.Second
+	devdBufferSize = 200
+)
+
+// devdMessage is one server-sent event: status, devd, importable or inventory.
+type devdMessage struct {
+	Name string
+	Data any
+}
+
+type devdStatus struct {
+	Connected bool      `json:"connected"`
+	Socket    string    `json:"socket"`
+	Error     string    `json:"error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// startImportWatcher refreshes importable pools once, then on devd disk and vdev events.
+// While the devd socket cannot be reached it polls instead and keeps retrying.
+func (s *Server) startImportWatcher() {
+	s.refreshImportableCache()
+	go s.followDevd(s.snapshotConfig().Devd.Socket)
+}
+
+func (s *Server) followDevd(socket string) {
+	for {
+		conn, err := devd.Dial(context.Background(), socket)
+		if err != nil {
+			s.setDevdStatus(socket, false, err)
+			time.Sleep(devdPollInterval)
+			s.refreshImportable()
+			continue
+		}
+		s.setDevdStatus(socket, true, nil)
+		// Catch up on anything that changed while disconnected.
+		s.refreshImportable()
+		err = devd.Follow(context.Background(), conn, s.handleDevdEvent)
+		s.setDevdStatus(socket, false, err)
+		time.Sleep(devdSettle)
+	}
+}
+
+func (s *Server) setDevdStatus(socket string, connected bool, err error) {
+	s.devdMu.Lock()
+	changed := s.devdStatus.Connected != connected || s.devdStatus.Since.IsZero()
+	s.devdStatus.Socket = socket
+	s.devdStatus.Connected = connected
+	s.devdStatus.Error = ""
+	if err != nil {
+		s.devdStatus.Error = err.Error()
+	}
+	if changed {
+		s.devdStatus.Since = time.Now()
+	}
+	status := s.devdStatus
+	s.devdMu.Unlock()
+	if changed {
+		s.broadcastDevd(devdMessage{Name: "status", Data: status})
+	}
+}
+
+// handleDevdEvent keeps relevant events, forgets cached SMART results for disks that
+// came or went, and schedules an importable pool and inventory refresh.
+func (s *Server) handleDevdEvent(ev devd.Event) {
+	if ev.Kind == "" {
+		return
+	}
+	s.devdMu.Lock()
+	s.devdEvents = append(s.devdEvents, ev)
+	if len(s.devdEvents) > devdBufferSize {
+		s.devdEvents = s.devdEvents[len(s.devdEvents)-devdBufferSize:]
+	}
+	s.devdMu.Unlock()
+	s.broadcastDevd(devdMessage{Name: "devd", Data: ev})
+
+	switch ev.Kind {
+	case devd.KindDiskAttach, devd.KindDiskDetach:
+		s.smartMu.Lock()
+		delete(s.smartCache, ev.Device)
+		s.smartMu.Unlock()
+	case devd.KindVdevState:
+	default:
+		return
+	}
+	s.devdMu.Lock()
+	if s.devdRefresh == nil {
+		s.devdRefresh = time.AfterFunc(devdSettle, s.refreshAfterDevd)
+	} else {
+		s.devdRefresh.Reset(devdSettle)
+	}
+	s.devdMu.Unlock()
+}
+
+func (s *Server) refreshAfterDevd() {
+	s.refreshImportable()
+	events, err := s.recordInventory(context.Background())
+	if err != nil {
+		s.inventoryMu.Lock()
+		s.inventoryErr = err.Error()
+		s.inventoryMu.Unlock()
+		return
+	}
+	if events == nil {
+		events = []drives.InventoryEvent{}
+	}
+	s.broadcastDevd(devdMessage{Name: "inventory", Data: events})
+}
+
+// refreshImportable refreshes the importable pool cache and pushes it to subscribers.
+func (s *Server) refreshImportable() {
+	s.refreshImportableCache()
+	s.broadcastDevd(devdMessage{Name: "importable", Data: s.importableSnapshot()})
+}
+
+// subscribeDevd registers a stream subscriber and returns the current status and
+// buffered events, so nothing is missed between the replay and live events.
+func (s *Server) subscribeDevd() (chan devdMessage, devdStatus, []devd.Event) {
+	ch := make(chan devdMessage, 32)
+	s.devdMu.Lock()
+	defer s.devdMu.Unlock()
+	if s.devdSubs == nil {
+		s.devdSubs = map[chan devdMessage]struct{}{}
+	}
+	s.devdSubs[ch] = struct{}{}
+	events := make([]devd.Event, len(s.devdEvents))
+	copy(events, s.devdEvents)
+	return ch, s.devdStatus, events
+}
+
+func (s *Server) unsubscribeDevd(ch chan devdMessage) {
+	s.devdMu.Lock()
+	delete(s.devdSubs, ch)
+	s.devdMu.Unlock()
+}
+
+// broadcastDevd delivers msg to every subscriber; slow subscribers drop messages rather
+// than stall the devd reader.
+func (s *Server) broadcastDevd(msg devdMessage) {
+	s.devdMu.Lock()
+	defer s.devdMu.Unlock()
+	for ch := range s.devdSubs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// handleDevd returns the devd connection status and buffered events, newest first.
+func (s *Server) handleDevd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	s.devdMu.Lock()
+	status := s.devdStatus
+	events := make([]devd.Event, 0, len(s.devdEvents))
+	for i := len(s.devdEvents) - 1; i >= 0; i-- {
+		events = append(events, s.devdEvents[i])
+	}
+	s.devdMu.Unlock()
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"status": status, "events": events}})
+}
+
+// handleDevdStream streams devd status changes, events (buffered ones replayed first),
+// importable pool refreshes and the inventory changes they caused as server-sent events.
+func (s *Server) handleDevdStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "streaming unsupported"})
+		return
+	}
+	ch, status, events := s.subscribeDevd()
+	defer s.unsubscribeDevd(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	send := func(msg devdMessage) {
+		payload, err := json.Marshal(msg.Data)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Name, payload)
+	}
+	send(devdMessage{Name: "status", Data: status})
+	for _, ev := range events {
+		send(devdMessage{Name: "devd", Data: ev})
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			send(msg)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
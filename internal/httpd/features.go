@@ -0,0 +1,102 @@
+// Package httpd serves pool feature flags, upgrades and the compatibility property.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/zfs"
+)
+
+// handleZFSFeatures lists feature flags (GET, all pools or ?pool=) and sets the
+// compatibility property (PUT).
+func (s *Server) handleZFSFeatures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		pool := strings.TrimSpace(r.URL.Query().Get("pool"))
+		if pool != "" && !zfs.ValidPoolName(pool) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+			return
+		}
+		pools, err := zfs.ListPoolFeatures(r.Context(), s.snapshotConfig(), pool)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list features failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{
+			"pools":              pools,
+			"compatibility_sets": zfs.CompatibilitySets(),
+		}})
+	case http.MethodPut:
+		var req struct {
+			Pool          string `json:"pool"`
+			Compatibility string `json:"compatibility"`
+		}
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		if !zfs.ValidPoolName(req.Pool) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+			return
+		}
+		value := strings.ReplaceAll(strings.TrimSpace(req.Compatibility), " ", "")
+		if !zfs.ValidCompatibility(value) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid compatibility", Details: "use off, legacy or installed feature sets"})
+			return
+		}
+		cfg := s.snapshotConfig()
+		res, err := zfs.SetPoolProperty(r.Context(), cfg, req.Pool, "compatibility", value)
+		s.audit.Log(auth.UserFromContext(r.Context()), "zfs.pool_set", fmt.Sprintf("%s set compatibility=%s %s", cfg.Paths.ZPool, value, req.Pool), res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "compatibility update failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"pool": req.Pool, "compatibility": value}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+// handleZFSUpgrade runs `zpool upgrade`. It cannot be undone except by rewinding to a
+// checkpoint, so it needs confirmation and can take that checkpoint first.
+func (s *Server) handleZFSUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req struct {
+		Pool       string `json:"pool"`
+		Confirm    bool   `json:"confirm"`
+		Checkpoint bool   `json:"checkpoint"`
+	}
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if !zfs.ValidPoolName(req.Pool) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	if !req.Confirm {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required", Details: checkpointAdvice(r, cfg, req.Pool)})
+		return
+	}
+	checkpointed := false
+	if req.Checkpoint {
+		var err error
+		checkpointed, err = s.checkpointBefore(r, cfg, req.Pool)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "checkpoint failed", Details: err.Error()})
+			return
+		}
+	}
+	res, err := zfs.UpgradePool(r.Context(), cfg, req.Pool)
+	s.audit.Log(auth.UserFromContext(r.Context()), "zfs.pool_upgrade", fmt.Sprintf("%s upgrade %s", cfg.Paths.ZPool, req.Pool), res.ExitCode)
+	if err != nil || res.ExitCode != 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "pool upgrade failed", Details: resultDetails(res, err)})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"pool": req.Pool, "output": res.Stdout, "checkpointed": checkpointed}})
+}
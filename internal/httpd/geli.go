@@ -0,0 +1,346 @@
+// Package httpd manages GELI providers, their boot-time attach and the pools waiting for
+// an unlock. Passphrases arrive in request bodies and go to geli on stdin only.
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/drives"
+	"raidraccoon/internal/zfs"
+)
+
+type geliRequest struct {
+	Action     string `json:"action"`
+	Provider   string `json:"provider"`
+	Passphrase string `json:"passphrase"`
+	Keyfile    string `json:"keyfile"`
+	Cipher     string `json:"cipher"`
+	KeyLength  int    `json:"key_length"`
+	SectorSize int    `json:"sector_size"`
+	Pool       string `json:"pool"`
+	// NeedsPassphrase marks a boot entry whose keyfile alone cannot unlock it.
+	NeedsPassphrase bool `json:"needs_passphrase"`
+	Confirm         bool `json:"confirm"`
+}
+
+type geliProviderView struct {
+	drives.GELIProvider
+	Pool string `json:"pool,omitempty"`
+}
+
+type geliBootView struct {
+	drives.GELIBootEntry
+	Attached bool `json:"attached"`
+}
+
+// dashboardGELISummary lists boot attach providers and the pools still locked.
+type dashboardGELISummary struct {
+	Providers int      `json:"providers"`
+	Attached  int      `json:"attached"`
+	Waiting   []string `json:"waiting"`
+	Locked    []string `json:"locked_pools"`
+}
+
+// geliBootState joins the boot registry with `geli status` and lists the registered
+// pools that are not imported yet.
+func geliBootState(ctx context.Context, cfg config.Config) ([]geliBootView, []string, error) {
+	entries, err := drives.LoadGELIBoot(drives.GELIBootPath(cfg))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return []geliBootView{}, []string{}, nil
+	}
+	status, err := drives.GELIStatus(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	attached := map[string]bool{}
+	for _, p := range status {
+		attached[strings.TrimSuffix(p.Name, ".eli")] = true
+	}
+	imported := map[string]bool{}
+	if pools, err := zfs.ListPools(ctx, cfg); err == nil {
+		for _, pool := range pools {
+			imported[pool.Name] = true
+		}
+	}
+	views := make([]geliBootView, 0, len(entries))
+	lockedSet := map[string]bool{}
+	for _, entry := range entries {
+		views = append(views, geliBootView{GELIBootEntry: entry, Attached: attached[entry.Provider]})
+		if entry.Pool != "" && !imported[entry.Pool] {
+			lockedSet[entry.Pool] = true
+		}
+	}
+	locked := make([]string, 0, len(lockedSet))
+	for pool := range lockedSet {
+		locked = append(locked, pool)
+	}
+	sort.Strings(locked)
+	return views, locked, nil
+}
+
+func (s *Server) summarizeGELI(ctx context.Context, cfg config.Config) (dashboardGELISummary, error) {
+	summary := dashboardGELISummary{Waiting: []string{}, Locked: []string{}}
+	views, locked, err := geliBootState(ctx, cfg)
+	if err != nil {
+		return summary, err
+	}
+	summary.Providers = len(views)
+	summary.Locked = locked
+	for _, view := range views {
+		if view.Attached {
+			summary.Attached++
+		} else {
+			summary.Waiting = append(summary.Waiting, view.Provider)
+		}
+	}
+	return summary, nil
+}
+
+// importUnlockedPools imports registered pools whose providers are all attached.
+func (s *Server) importUnlockedPools(ctx context.Context, cfg config.Config, user string) []string {
+	views, locked, err := geliBootState(ctx, cfg)
+	if err != nil {
+		return nil
+	}
+	ready := map[string]bool{}
+	for _, pool := range locked {
+		ready[pool] = true
+	}
+	for _, view := range views {
+		if view.Pool != "" && !view.Attached {
+			ready[view.Pool] = false
+		}
+	}
+	var imported []string
+	for _, pool := range locked {
+		if !ready[pool] {
+			continue
+		}
+		res, err := zfs.ImportPool(ctx, cfg, pool)
+		s.audit.Log(user, "geli.import", fmt.Sprintf("%s import %s", cfg.Paths.ZPool, pool), res.ExitCode)
+		if err == nil && res.ExitCode == 0 {
+			imported = append(imported, pool)
+		}
+	}
+	if len(imported) > 0 {
+		s.refreshImportableCache()
+	}
+	return imported
+}
+
+// startGELIBootAttach attaches keyfile-only boot providers and imports their pools.
+// Providers with a passphrase stay detached until unlocked from the UI.
+func (s *Server) startGELIBootAttach() {
+	go func() {
+		ctx := context.Background()
+		cfg := s.snapshotConfig()
+		views, _, err := geliBootState(ctx, cfg)
+		if err != nil {
+			return
+		}
+		for _, view := range views {
+			if view.Attached || view.Passphrase || view.Keyfile == "" {
+				continue
+			}
+			res, _ := drives.AttachGELI(ctx, cfg, view.Provider, nil, view.Keyfile)
+			s.audit.Log("system", "geli.attach", fmt.Sprintf("%s attach -p -k %s %s", cfg.Paths.GELI, view.Keyfile, view.Provider), res.ExitCode)
+		}
+		s.importUnlockedPools(ctx, cfg, "system")
+	}()
+}
+
+// handleGELI lists GELI providers and the boot registry (GET) and runs init, attach,
+// detach, boot and unboot actions (POST).
+func (s *Server) handleGELI(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	switch r.Method {
+	case http.MethodGet:
+		status, err := drives.GELIStatus(r.Context(), cfg)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "geli status failed", Details: err.Error()})
+			return
+		}
+		inUse, poolErr := poolProviders(r.Context(), cfg)
+		labels, _ := drives.ListLabels(r.Context(), cfg)
+		providers := make([]geliProviderView, 0, len(status))
+		for _, p := range status {
+			component := p.Component
+			if resolved, ok := labels[component]; ok {
+				component = resolved
+			}
+			providers = append(providers, geliProviderView{GELIProvider: p, Pool: inUse[component]})
+		}
+		boot, locked, err := geliBootState(r.Context(), cfg)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read geli boot entries failed", Details: err.Error()})
+			return
+		}
+		data := map[string]any{
+			"providers":    providers,
+			"boot":         boot,
+			"locked_pools": locked,
+			"ciphers":      drives.GELICiphers,
+			"key_dir":      cfg.GELI.KeyDir,
+		}
+		if poolErr != nil {
+			data["errors"] = map[string]string{"pools": poolErr.Error()}
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+	case http.MethodPost:
+		var req geliRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Provider = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(req.Provider), "/dev/"), ".eli")
+		req.Keyfile = strings.TrimSpace(req.Keyfile)
+		req.Pool = strings.TrimSpace(req.Pool)
+		if !drives.ValidGELIProvider(req.Provider) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid provider"})
+			return
+		}
+		if req.Keyfile != "" && !drives.ValidKeyfileName(req.Keyfile) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "keyfile must be a file name inside geli.key_dir"})
+			return
+		}
+		user := auth.UserFromContext(r.Context())
+		passphrase := []byte(req.Passphrase)
+		// The command line recorded in the audit log never carries the passphrase.
+		keyArgs := ""
+		if req.Keyfile != "" {
+			keyArgs = " -k " + req.Keyfile
+		}
+		switch req.Action {
+		case "init":
+			if !req.Confirm {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+				return
+			}
+			if pool, ok := s.geliProviderPool(r, req.Provider); ok {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: fmt.Sprintf("%s belongs to imported pool %s", req.Provider, pool)})
+				return
+			}
+			res, err := drives.InitGELI(r.Context(), cfg, drives.GELIInitOptions{
+				Provider:   req.Provider,
+				Passphrase: passphrase,
+				Keyfile:    req.Keyfile,
+				Cipher:     strings.TrimSpace(req.Cipher),
+				KeyLength:  req.KeyLength,
+				SectorSize: req.SectorSize,
+			})
+			s.audit.Log(user, "geli.init", fmt.Sprintf("%s init -e %s%s %s", cfg.Paths.GELI, req.Cipher, keyArgs, req.Provider), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "geli init failed", Details: resultDetails(res, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"provider": req.Provider}})
+		case "attach":
+			keyfile := req.Keyfile
+			if keyfile == "" {
+				// Unlocking a boot entry reuses its registered keyfile.
+				if entries, err := drives.LoadGELIBoot(drives.GELIBootPath(cfg)); err == nil {
+					for _, entry := range entries {
+						if entry.Provider == req.Provider {
+							keyfile = entry.Keyfile
+						}
+					}
+				}
+			}
+			res, err := drives.AttachGELI(r.Context(), cfg, req.Provider, passphrase, keyfile)
+			if keyfile != "" {
+				keyArgs = " -k " + keyfile
+			}
+			s.audit.Log(user, "geli.attach", fmt.Sprintf("%s attach%s %s", cfg.Paths.GELI, keyArgs, req.Provider), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "geli attach failed", Details: resultDetails(res, err)})
+				return
+			}
+			imported := s.importUnlockedPools(r.Context(), cfg, user)
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"provider": req.Provider + ".eli", "imported": imported}})
+		case "detach":
+			if !req.Confirm {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+				return
+			}
+			if pool, ok := s.geliProviderPool(r, req.Provider); ok {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: fmt.Sprintf("%s.eli belongs to imported pool %s", req.Provider, pool)})
+				return
+			}
+			res, err := drives.DetachGELI(r.Context(), cfg, req.Provider)
+			s.audit.Log(user, "geli.detach", fmt.Sprintf("%s detach %s.eli", cfg.Paths.GELI, req.Provider), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "geli detach failed", Details: resultDetails(res, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"provider": req.Provider}})
+		case "boot", "unboot":
+			if req.Action == "boot" {
+				if req.Passphrase != "" {
+					s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "passphrases are never stored; register the provider without one"})
+					return
+				}
+				if req.Pool != "" && !zfs.ValidPoolName(req.Pool) {
+					s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+					return
+				}
+			}
+			path := drives.GELIBootPath(cfg)
+			entries, err := drives.LoadGELIBoot(path)
+			if err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read geli boot entries failed", Details: err.Error()})
+				return
+			}
+			out := make([]drives.GELIBootEntry, 0, len(entries)+1)
+			for _, entry := range entries {
+				if entry.Provider != req.Provider {
+					out = append(out, entry)
+				}
+			}
+			if req.Action == "boot" {
+				out = append(out, drives.GELIBootEntry{
+					Provider: req.Provider,
+					Keyfile:  req.Keyfile,
+					// Without a keyfile the provider can only be unlocked with a passphrase.
+					Passphrase: req.Keyfile == "" || req.NeedsPassphrase,
+					Pool:       req.Pool,
+				})
+			}
+			if err := drives.SaveGELIBoot(path, out); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "save geli boot entries failed", Details: err.Error()})
+				return
+			}
+			s.audit.Log(user, "geli."+req.Action, fmt.Sprintf("geli-boot %s %s", req.Action, req.Provider), 0)
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"provider": req.Provider}})
+		default:
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "action must be init, attach, detach, boot or unboot"})
+		}
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+// geliProviderPool reports the imported pool using provider (directly or as .eli).
+func (s *Server) geliProviderPool(r *http.Request, provider string) (string, bool) {
+	cfg := s.snapshotConfig()
+	inUse, err := poolProviders(r.Context(), cfg)
+	if err != nil {
+		// Unknown membership: refuse rather than guess.
+		return "unknown (" + err.Error() + ")", true
+	}
+	name := provider
+	if labels, err := drives.ListLabels(r.Context(), cfg); err == nil {
+		if resolved, ok := labels[provider]; ok {
+			name = resolved
+		}
+	}
+	pool, ok := inUse[name]
+	return pool, ok && pool != ""
+}
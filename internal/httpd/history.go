@@ -0,0 +1,148 @@
+// Package httpd serves parsed `zpool history` and a live `zpool events` stream.
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/zfs"
+)
+
+const (
+	historyDefaultLimit = 500
+	historyMaxLimit     = 5000
+)
+
+// parseHistoryTime accepts RFC 3339, the datetime-local form and plain dates, the last
+// two in server local time like the history itself.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func (s *Server) handleZFSHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	query := r.URL.Query()
+	pool := strings.TrimSpace(query.Get("pool"))
+	if pool != "" && !zfs.ValidPoolName(pool) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool"})
+		return
+	}
+	var since, until time.Time
+	if raw := strings.TrimSpace(query.Get("since")); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid since", Details: err.Error()})
+			return
+		}
+		since = t
+	}
+	if raw := strings.TrimSpace(query.Get("until")); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid until", Details: err.Error()})
+			return
+		}
+		until = t
+	}
+	limit := historyDefaultLimit
+	if raw := query.Get("limit"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 1 || val > historyMaxLimit {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: fmt.Sprintf("limit must be between 1 and %d", historyMaxLimit)})
+			return
+		}
+		limit = val
+	}
+	internal := query.Get("internal") == "1" || query.Get("internal") == "true"
+	needle := strings.ToLower(strings.TrimSpace(query.Get("q")))
+
+	entries, truncated, err := zfs.PoolHistory(r.Context(), s.snapshotConfig(), pool)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "zpool history failed", Details: err.Error()})
+		return
+	}
+	matched := []zfs.HistoryEntry{}
+	total := 0
+	// History is oldest first; walk backwards so the limit keeps the newest entries.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Internal && !internal {
+			continue
+		}
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && entry.Time.After(until) {
+			continue
+		}
+		if needle != "" && !historyMatches(entry, needle) {
+			continue
+		}
+		total++
+		if len(matched) < limit {
+			matched = append(matched, entry)
+		}
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{
+		"entries":   matched,
+		"total":     total,
+		"truncated": truncated,
+	}})
+}
+
+func historyMatches(entry zfs.HistoryEntry, needle string) bool {
+	for _, field := range []string{entry.Command, entry.User, entry.Host, entry.Pool} {
+		if strings.Contains(strings.ToLower(field), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleZFSEvents streams `zpool events -fv` as server-sent events. Each client gets its
+// own zpool process, bound to the request so it exits when the browser disconnects.
+func (s *Server) handleZFSEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "streaming unsupported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	err := zfs.FollowEvents(r.Context(), s.snapshotConfig(), func(event zfs.PoolEvent) {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: zpool\ndata: %s\n\n", payload)
+		flusher.Flush()
+	})
+	if err != nil {
+		payload, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Fprintf(w, "event: failed\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,151 @@
+// Package httpd records which disk serial sits in which slot and vdev, and reports
+// disks that went missing from their pool.
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/drives"
+	"raidraccoon/internal/zfs"
+)
+
+const inventoryInterval = 5 * time.Minute
+
+// startInventoryRecorder refreshes the disk inventory every inventoryInterval.
+func (s *Server) startInventoryRecorder() {
+	go func() {
+		for {
+			if _, err := s.recordInventory(context.Background()); err != nil {
+				s.inventoryMu.Lock()
+				s.inventoryErr = err.Error()
+				s.inventoryMu.Unlock()
+			}
+			time.Sleep(inventoryInterval)
+		}
+	}()
+}
+
+// diskMembers maps disk names to the pool vdev using the disk or one of its partitions,
+// resolving gpt/, gptid/ and diskid/ labels and GELI (.eli) providers.
+func diskMembers(devices []zfs.PoolDevice, labels map[string]string) map[string]drives.VdevMember {
+	out := map[string]drives.VdevMember{}
+	for _, dev := range devices {
+		name := strings.TrimSuffix(strings.TrimPrefix(dev.Name, "/dev/"), ".eli")
+		if provider, ok := labels[name]; ok {
+			name = provider
+		}
+		disk := baseDeviceName(name)
+		if _, ok := out[disk]; ok {
+			continue
+		}
+		out[disk] = drives.VdevMember{Pool: dev.Pool, Vdev: dev.Vdev, Role: dev.Role, Provider: dev.Name}
+	}
+	return out
+}
+
+// collectIdentities reads the current disk identities. Failing to list pool devices is
+// an error: recording every disk as having left its pool would be wrong.
+func collectIdentities(ctx context.Context, cfg config.Config) ([]drives.DiskIdentity, error) {
+	list, err := drives.ListDrives(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("list drives: %w", err)
+	}
+	labels, err := drives.ListLabels(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("list labels: %w", err)
+	}
+	devices, err := zfs.ListPoolDevices(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("list pool devices: %w", err)
+	}
+	// GELI is optional; without it no .eli providers are listed.
+	eli, _ := drives.GELIStatus(ctx, cfg)
+	return drives.BuildIdentities(list, labels, eli, diskMembers(devices, labels), baseDeviceName), nil
+}
+
+// recordInventory merges the current identities into the stored inventory.
+func (s *Server) recordInventory(ctx context.Context) ([]drives.InventoryEvent, error) {
+	cfg := s.snapshotConfig()
+	ids, err := collectIdentities(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.inventoryMu.Lock()
+	defer s.inventoryMu.Unlock()
+	events, err := drives.UpdateInventory(drives.InventoryPath(cfg), drives.InventoryEventsPath(cfg), ids, time.Now())
+	if err != nil {
+		s.inventoryErr = err.Error()
+		return events, err
+	}
+	s.inventoryErr = ""
+	return events, nil
+}
+
+type missingDisk struct {
+	drives.InventoryRecord
+	Message string `json:"message"`
+}
+
+// missingDisks lists inventory disks that were in a pool when last seen and are gone.
+func (s *Server) missingDisks(cfg config.Config) ([]missingDisk, error) {
+	s.inventoryMu.Lock()
+	records, _, err := drives.LoadInventory(drives.InventoryPath(cfg))
+	s.inventoryMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := []missingDisk{}
+	for _, rec := range records {
+		if rec.Present || rec.Member == nil {
+			continue
+		}
+		out = append(out, missingDisk{InventoryRecord: rec, Message: drives.MissingMessage(rec)})
+	}
+	return out, nil
+}
+
+// handleDriveInventory returns the disk inventory and its recent events (GET; ?refresh=
+// re-reads the disks first, ?serial= and ?limit= filter the events).
+func (s *Server) handleDriveInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	if r.URL.Query().Get("refresh") != "" {
+		if _, err := s.recordInventory(r.Context()); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "refresh inventory failed", Details: err.Error()})
+			return
+		}
+	}
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	s.inventoryMu.Lock()
+	records, updated, err := drives.LoadInventory(drives.InventoryPath(cfg))
+	recordErr := s.inventoryErr
+	s.inventoryMu.Unlock()
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read inventory failed", Details: err.Error()})
+		return
+	}
+	events, err := drives.InventoryEvents(drives.InventoryEventsPath(cfg), strings.TrimSpace(r.URL.Query().Get("serial")), limit)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read inventory events failed", Details: err.Error()})
+		return
+	}
+	data := map[string]any{"disks": records, "events": events, "updated": updated}
+	if recordErr != "" {
+		data["error"] = recordErr
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"raidraccoon/internal/config"
+	"raidraccoon/internal/zfs"
 )
 
 type JobManager struct {
@@ -40,12 +41,19 @@ type Job struct {
 	Limit     int64     `json:"-"`
 	User      string    `json:"-"`
 
+	// Progress is set by in-process jobs that can measure how far along they are.
+	Progress    *zfs.TransferProgress `json:"progress,omitempty"`
+	progressSeq int
+
 	mu     sync.Mutex
 	buffer strings.Builder
 	subs   map[chan string]struct{}
 	cancel context.CancelFunc
 }
 
+// JobFunc is in-process work tracked like a command job. It returns the exit code to record.
+type JobFunc func(ctx context.Context, job *Job) (int, error)
+
 // NewJobManager constructs a manager with an internal cleanup loop.
 func NewJobManager(cfg config.Config, auditFn func(user, action, command string, exitCode int)) *JobManager {
 	jm := &JobManager{cfg: cfg, jobs: map[string]*Job{}, ttl: 15 * time.Minute, audit: auditFn}
@@ -86,6 +94,40 @@ func (jm *JobManager) Start(ctx context.Context, user, command string) (*Job, er
 	return job, nil
 }
 
+// StartFunc tracks fn as a job. label and args only describe the work for listings and the
+// audit log; nothing is executed through the command allowlist.
+func (jm *JobManager) StartFunc(user, action, label string, args []string, fn JobFunc) *Job {
+	cfg := jm.configSnapshot()
+	id := newID()
+	job := &Job{ID: id, Cmd: label, Args: args, Start: time.Now(), subs: map[chan string]struct{}{}, Limit: cfg.Limits.MaxOutputBytes, User: user}
+	ctx, cancel := context.WithCancel(context.Background())
+	job.cancel = cancel
+	jm.mu.Lock()
+	jm.jobs[id] = job
+	jm.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		exitCode, err := fn(ctx, job)
+		if err != nil {
+			job.Logf("%s", err.Error())
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+		job.mu.Lock()
+		job.Done = true
+		job.End = time.Now()
+		job.ExitCode = exitCode
+		job.Output = job.buffer.String()
+		job.mu.Unlock()
+		if jm.audit != nil {
+			jm.audit(job.User, action, job.CommandString(), exitCode)
+		}
+	}()
+	return job
+}
+
 // Get returns the current job record, if present.
 func (jm *JobManager) Get(id string) (*Job, bool) {
 	jm.mu.Lock()
@@ -217,6 +259,30 @@ func (job *Job) Unsubscribe(ch chan string) {
 	close(ch)
 }
 
+// Logf appends one line to the job output.
+func (job *Job) Logf(format string, args ...any) {
+	job.append(strings.TrimRight(fmt.Sprintf(format, args...), "\n") + "\n")
+}
+
+// SetProgress records the latest transfer progress for streaming clients.
+func (job *Job) SetProgress(p zfs.TransferProgress) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.Progress = &p
+	job.progressSeq++
+}
+
+// progressSince returns the current progress if it changed after seq.
+func (job *Job) progressSince(seq int) (*zfs.TransferProgress, int) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.Progress == nil || job.progressSeq == seq {
+		return nil, seq
+	}
+	p := *job.Progress
+	return &p, job.progressSeq
+}
+
 func (job *Job) finishError(err error) {
 	job.mu.Lock()
 	defer job.mu.Unlock()
@@ -0,0 +1,181 @@
+// Package httpd exposes gpart partition tables and refuses changes to partitions that
+// back an imported pool.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/drives"
+)
+
+type partitionView struct {
+	drives.Partition
+	Pool string `json:"pool,omitempty"`
+}
+
+type partitionTableView struct {
+	drives.PartitionTable
+	Entries []partitionView `json:"entries"`
+	// Pool is set when the whole disk, rather than a partition, is a vdev.
+	Pool string `json:"pool,omitempty"`
+}
+
+type partitionRequest struct {
+	Action  string `json:"action"`
+	Disk    string `json:"disk"`
+	Scheme  string `json:"scheme"`
+	Index   int    `json:"index"`
+	Force   bool   `json:"force"`
+	Confirm bool   `json:"confirm"`
+	drives.PartitionSpec
+}
+
+// handlePartitions lists partition tables (GET, optional ?disk=) and creates or destroys
+// schemes and adds or deletes partitions (POST with action create, destroy, add or
+// delete).
+func (s *Server) handlePartitions(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	switch r.Method {
+	case http.MethodGet:
+		disk := strings.TrimSpace(r.URL.Query().Get("disk"))
+		if disk != "" && !drives.ValidDiskName(disk) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid disk"})
+			return
+		}
+		tables, err := drives.ListPartitions(r.Context(), cfg, disk)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list partitions failed", Details: err.Error()})
+			return
+		}
+		data := map[string]any{"schemes": drives.PartitionSchemes, "types": drives.PartitionTypes}
+		inUse, err := poolProviders(r.Context(), cfg)
+		if err != nil {
+			data["errors"] = map[string]string{"pools": err.Error()}
+		}
+		views := make([]partitionTableView, 0, len(tables))
+		for _, table := range tables {
+			view := partitionTableView{PartitionTable: table, Pool: inUse[table.Disk], Entries: make([]partitionView, 0, len(table.Entries))}
+			for _, entry := range table.Entries {
+				view.Entries = append(view.Entries, partitionView{Partition: entry, Pool: inUse[entry.Provider]})
+			}
+			views = append(views, view)
+		}
+		data["tables"] = views
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+	case http.MethodPost:
+		var req partitionRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Disk = strings.TrimPrefix(strings.TrimSpace(req.Disk), "/dev/")
+		if !drives.ValidDiskName(req.Disk) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid disk"})
+			return
+		}
+		user := auth.UserFromContext(r.Context())
+		switch req.Action {
+		case "create":
+			req.Scheme = strings.ToLower(strings.TrimSpace(req.Scheme))
+			res, err := drives.CreatePartitionScheme(r.Context(), cfg, req.Disk, req.Scheme)
+			s.audit.Log(user, "gpart.create", fmt.Sprintf("%s create -s %s %s", cfg.Paths.Gpart, req.Scheme, req.Disk), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "create partition scheme failed", Details: resultDetails(res, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"disk": req.Disk, "scheme": req.Scheme}})
+		case "add":
+			spec := req.PartitionSpec
+			spec.Index = req.Index
+			spec.Type = strings.TrimSpace(spec.Type)
+			spec.Align = strings.TrimSpace(spec.Align)
+			spec.Size = strings.TrimSpace(spec.Size)
+			spec.Label = strings.TrimSpace(spec.Label)
+			if err := drives.ValidPartitionSpec(spec); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+				return
+			}
+			provider, res, err := drives.AddPartition(r.Context(), cfg, req.Disk, spec)
+			s.audit.Log(user, "gpart.add", fmt.Sprintf("%s add -t %s %s", cfg.Paths.Gpart, spec.Type, req.Disk), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "add partition failed", Details: resultDetails(res, err)})
+				return
+			}
+			data := map[string]string{"provider": provider}
+			if spec.Label != "" {
+				data["label"] = "gpt/" + spec.Label
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+		case "delete", "destroy":
+			if !req.Confirm {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+				return
+			}
+			pool, provider, err := s.partitionInUse(r, req.Disk, req.Action, req.Index)
+			if err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "check pool devices failed", Details: err.Error()})
+				return
+			}
+			if pool != "" {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: fmt.Sprintf("%s belongs to imported pool %s", provider, pool)})
+				return
+			}
+			if req.Action == "delete" {
+				res, err := drives.DeletePartition(r.Context(), cfg, req.Disk, req.Index)
+				s.audit.Log(user, "gpart.delete", fmt.Sprintf("%s delete -i %d %s", cfg.Paths.Gpart, req.Index, req.Disk), res.ExitCode)
+				if err != nil || res.ExitCode != 0 {
+					s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "delete partition failed", Details: resultDetails(res, err)})
+					return
+				}
+				s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"disk": req.Disk, "index": req.Index}})
+				return
+			}
+			res, err := drives.DestroyPartitionScheme(r.Context(), cfg, req.Disk, req.Force)
+			cmd := fmt.Sprintf("%s destroy %s", cfg.Paths.Gpart, req.Disk)
+			if req.Force {
+				cmd = fmt.Sprintf("%s destroy -F %s", cfg.Paths.Gpart, req.Disk)
+			}
+			s.audit.Log(user, "gpart.destroy", cmd, res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "destroy partition scheme failed", Details: resultDetails(res, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"disk": req.Disk}})
+		default:
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "action must be create, add, delete or destroy"})
+		}
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+// partitionInUse returns the pool and provider that block deleting partition index of
+// disk, or destroying its table (any partition, or the disk itself). Unknown pool
+// membership is an error: guessing wrong destroys a pool.
+func (s *Server) partitionInUse(r *http.Request, disk, action string, index int) (string, string, error) {
+	cfg := s.snapshotConfig()
+	inUse, err := poolProviders(r.Context(), cfg)
+	if err != nil {
+		return "", "", err
+	}
+	if pool := inUse[disk]; pool != "" {
+		return pool, disk, nil
+	}
+	tables, err := drives.ListPartitions(r.Context(), cfg, disk)
+	if err != nil {
+		return "", "", err
+	}
+	for _, table := range tables {
+		for _, entry := range table.Entries {
+			if entry.Free || (action == "delete" && entry.Index != index) {
+				continue
+			}
+			if pool := inUse[entry.Provider]; pool != "" {
+				return pool, entry.Provider, nil
+			}
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,198 @@
+// Package httpd prepares unused disks for a new pool: usage checks, then a job that
+// wipes ZFS labels and the partition table, confirmed by typing the disk serial.
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/drives"
+)
+
+type prepareRequest struct {
+	Disk          string `json:"disk"`
+	ConfirmSerial string `json:"confirm_serial"`
+	GPT           bool   `json:"gpt"`
+	Label         string `json:"label"`
+	Align         string `json:"align"`
+}
+
+type prepareCheck struct {
+	Disk     string   `json:"disk"`
+	Serial   string   `json:"serial"`
+	Size     string   `json:"size"`
+	Blockers []string `json:"blockers"`
+}
+
+// checkPrepareDisk looks up disk and lists why it cannot be wiped: vdevs of imported
+// pools, mounted file systems, active swap, the dump device and labels on it that are
+// in use, and (when label is set) a gpt/<label> that already exists elsewhere.
+func checkPrepareDisk(ctx context.Context, cfg config.Config, disk, label string) (prepareCheck, error) {
+	check := prepareCheck{Disk: disk, Blockers: []string{}}
+	list, err := drives.ListDrives(ctx, cfg)
+	if err != nil {
+		return check, fmt.Errorf("list drives: %w", err)
+	}
+	found := false
+	for _, drive := range list {
+		if drive.Name == disk {
+			found = true
+			check.Serial = drive.Ident
+			check.Size = drive.Mediasize
+		}
+	}
+	if !found {
+		return check, fmt.Errorf("unknown disk %s", disk)
+	}
+	pools, err := poolProviders(ctx, cfg)
+	if err != nil {
+		return check, fmt.Errorf("list pool devices: %w", err)
+	}
+	mounts, err := drives.MountedDevices(ctx, cfg)
+	if err != nil {
+		return check, fmt.Errorf("list mounts: %w", err)
+	}
+	swaps, err := drives.SwapDevices(ctx, cfg)
+	if err != nil {
+		return check, fmt.Errorf("list swap devices: %w", err)
+	}
+	labels, err := drives.ListLabels(ctx, cfg)
+	if err != nil {
+		return check, fmt.Errorf("list labels: %w", err)
+	}
+	for _, provider := range sortedKeys(pools) {
+		if baseDeviceName(provider) == disk {
+			check.Blockers = append(check.Blockers, fmt.Sprintf("%s is a vdev of pool %s", provider, pools[provider]))
+		}
+	}
+	for _, provider := range sortedKeys(mounts) {
+		if baseDeviceName(provider) == disk {
+			check.Blockers = append(check.Blockers, fmt.Sprintf("%s is mounted on %s", provider, mounts[provider]))
+		}
+	}
+	for _, provider := range sortedKeys(swaps) {
+		if baseDeviceName(provider) == disk {
+			check.Blockers = append(check.Blockers, fmt.Sprintf("%s is in use as %s", provider, swaps[provider]))
+		}
+	}
+	// Labels resolve to their provider above, so a label on this disk only blocks when
+	// pools or mounts refer to it; a requested label must not already exist elsewhere.
+	if label != "" {
+		if provider, ok := labels["gpt/"+label]; ok && baseDeviceName(provider) != disk {
+			check.Blockers = append(check.Blockers, fmt.Sprintf("label gpt/%s is already used by %s", label, provider))
+		}
+	}
+	return check, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handlePrepareDisk reports whether a disk can be prepared (GET ?disk=) or starts the
+// preparation job (POST). confirm_serial must equal the disk's serial, or its name when
+// the disk reports none.
+func (s *Server) handlePrepareDisk(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	switch r.Method {
+	case http.MethodGet:
+		disk := strings.TrimSpace(r.URL.Query().Get("disk"))
+		if !drives.ValidDiskName(disk) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid disk"})
+			return
+		}
+		check, err := checkPrepareDisk(r.Context(), cfg, disk, strings.TrimSpace(r.URL.Query().Get("label")))
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "check disk failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: check})
+	case http.MethodPost:
+		var req prepareRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Disk = strings.TrimPrefix(strings.TrimSpace(req.Disk), "/dev/")
+		req.Label = strings.TrimSpace(req.Label)
+		req.Align = strings.TrimSpace(req.Align)
+		if !drives.ValidDiskName(req.Disk) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid disk"})
+			return
+		}
+		if req.GPT {
+			if req.Align == "" {
+				req.Align = "1M"
+			}
+			if req.Label == "" {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "label required"})
+				return
+			}
+			if err := drives.ValidPartitionSpec(drives.PartitionSpec{Type: "freebsd-zfs", Align: req.Align, Label: req.Label}); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+				return
+			}
+		} else {
+			req.Label = ""
+		}
+		check, err := checkPrepareDisk(r.Context(), cfg, req.Disk, req.Label)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "check disk failed", Details: err.Error()})
+			return
+		}
+		expected := check.Serial
+		if expected == "" {
+			expected = check.Disk
+		}
+		if strings.TrimSpace(req.ConfirmSerial) != expected {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required: type the disk serial"})
+			return
+		}
+		if len(check.Blockers) > 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: fmt.Sprintf("%s is in use", req.Disk), Details: strings.Join(check.Blockers, "\n")})
+			return
+		}
+		args := []string{req.Disk}
+		if req.GPT {
+			args = append(args, "--gpt", "--label", req.Label, "--align", req.Align)
+		}
+		job := s.jobs.StartFunc(auth.UserFromContext(r.Context()), "drives.prepare", "prepare-disk", args, func(ctx context.Context, job *Job) (int, error) {
+			// Pools may have been created or imported since the request was checked.
+			again, err := checkPrepareDisk(ctx, cfg, req.Disk, req.Label)
+			if err != nil {
+				return 1, err
+			}
+			// Device names can shift with hot-plug; only wipe the disk the user confirmed.
+			if again.Serial != check.Serial {
+				return 1, fmt.Errorf("%s now reports serial %q, not the confirmed %q; refusing to wipe", req.Disk, again.Serial, check.Serial)
+			}
+			if len(again.Blockers) > 0 {
+				return 1, fmt.Errorf("%s is in use: %s", req.Disk, strings.Join(again.Blockers, "; "))
+			}
+			job.Logf("preparing %s (serial %s, %s)", req.Disk, check.Serial, check.Size)
+			_, err = drives.PrepareDisk(ctx, cfg, drives.PrepareOptions{
+				Disk:  req.Disk,
+				GPT:   req.GPT,
+				Label: req.Label,
+				Align: req.Align,
+				Log:   func(line string) { job.Logf("%s", line) },
+			})
+			if err != nil {
+				return 1, err
+			}
+			return 0, nil
+		})
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"job_id": job.ID}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
@@ -0,0 +1,387 @@
+// Package httpd handles replication transport, target checks and on-demand runs.
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/cron"
+	"raidraccoon/internal/window"
+	"raidraccoon/internal/zfs"
+)
+
+type replicationSSHRequest struct {
+	Action     string `json:"action"`
+	Target     string `json:"target"`
+	Host       string `json:"host"`
+	SSHPort    int    `json:"ssh_port"`
+	Cipher     string `json:"cipher"`
+	Compress   bool   `json:"compress"`
+	RemoteSudo bool   `json:"remote_sudo"`
+	TrustNew   bool   `json:"trust_new"`
+	Confirm    bool   `json:"confirm"`
+}
+
+func (s *Server) handleReplicationSSH(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	switch r.Method {
+	case http.MethodGet:
+		data := map[string]any{
+			"key_file":         cfg.Replication.KeyFile,
+			"known_hosts_file": cfg.Replication.KnownHostsFile,
+			"known_hosts":      []zfs.KnownHost{},
+		}
+		if key, err := zfs.SSHPublicKey(r.Context(), cfg); err != nil {
+			data["key_error"] = strings.TrimSpace(err.Error())
+		} else {
+			data["public_key"] = key
+		}
+		if hosts, err := zfs.ListKnownHosts(r.Context(), cfg); err != nil {
+			data["known_hosts_error"] = strings.TrimSpace(err.Error())
+		} else {
+			data["known_hosts"] = hosts
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+	case http.MethodPost:
+		var req replicationSSHRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		user := auth.UserFromContext(r.Context())
+		switch req.Action {
+		case "keygen":
+			if !req.Confirm {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+				return
+			}
+			if _, err := zfs.SSHPublicKey(r.Context(), cfg); err == nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "key already exists", Details: cfg.Replication.KeyFile})
+				return
+			}
+			res, err := zfs.GenerateSSHKey(r.Context(), cfg)
+			s.audit.Log(user, "replication.keygen", fmt.Sprintf("%s -t ed25519 -f %s", cfg.Paths.SSHKeygen, cfg.Replication.KeyFile), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "key generation failed", Details: errDetails(res.Stderr, err)})
+				return
+			}
+			key, _ := zfs.SSHPublicKey(r.Context(), cfg)
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"public_key": key}})
+		case "test":
+			remote, ok := zfs.ParseRemoteTarget(req.Target)
+			if !ok {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "target must be user@host:pool/dataset"})
+				return
+			}
+			opts := zfs.SSHOptions{
+				Port:       req.SSHPort,
+				Cipher:     strings.TrimSpace(req.Cipher),
+				Compress:   req.Compress,
+				RemoteSudo: req.RemoteSudo,
+				TrustNew:   req.TrustNew,
+			}
+			if err := validateSSHOptions(opts); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid ssh options", Details: err.Error()})
+				return
+			}
+			res, err := zfs.TestRemoteTarget(r.Context(), cfg, remote, opts)
+			s.audit.Log(user, "replication.test", fmt.Sprintf("%s %s", cfg.Paths.SSH, remote.String()), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "connection failed", Details: errDetails(res.Stderr, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"output": res.Stdout}})
+		case "forget":
+			if !req.Confirm {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+				return
+			}
+			host := strings.TrimSpace(req.Host)
+			res, err := zfs.ForgetKnownHost(r.Context(), cfg, host)
+			s.audit.Log(user, "replication.forget", fmt.Sprintf("%s -R %s", cfg.Paths.SSHKeygen, host), res.ExitCode)
+			if err != nil || res.ExitCode != 0 {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "forget host failed", Details: errDetails(res.Stderr, err)})
+				return
+			}
+			s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"host": host}})
+		default:
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "unknown action"})
+		}
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+func validateSSHOptions(opts zfs.SSHOptions) error {
+	if opts.Port < 0 || opts.Port > 65535 {
+		return fmt.Errorf("ssh port must be 0-65535")
+	}
+	if opts.Cipher != "" && !zfs.ValidSSHCipher(opts.Cipher) {
+		return fmt.Errorf("invalid cipher")
+	}
+	return nil
+}
+
+// setReplicationSSHMeta stores ssh transport options; they are dropped for local targets.
+func setReplicationSSHMeta(meta map[string]string, opts zfs.SSHOptions) {
+	if !zfs.IsRemoteTarget(meta["target"]) {
+		delete(meta, "ssh_port")
+		delete(meta, "cipher")
+		delete(meta, "compress")
+		delete(meta, "remote_sudo")
+		return
+	}
+	meta["ssh_port"] = ""
+	if opts.Port > 0 {
+		meta["ssh_port"] = strconv.Itoa(opts.Port)
+	}
+	meta["cipher"] = opts.Cipher
+	meta["compress"] = boolToIntString(opts.Compress)
+	meta["remote_sudo"] = boolToIntString(opts.RemoteSudo)
+}
+
+func replicationSSHFromMeta(meta map[string]string) zfs.SSHOptions {
+	return zfs.SSHOptions{
+		Port:       metaInt(meta, "ssh_port", 0),
+		Cipher:     metaValue(meta, "cipher", ""),
+		Compress:   metaBool(meta, "compress"),
+		RemoteSudo: metaBool(meta, "remote_sudo"),
+	}
+}
+
+func errDetails(stderr string, err error) string {
+	details := strings.TrimSpace(stderr)
+	if details == "" && err != nil {
+		details = err.Error()
+	}
+	return details
+}
+
+type replicationCheckRequest struct {
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Force      bool   `json:"force"`
+	Reseed     bool   `json:"reseed"`
+	SSHPort    int    `json:"ssh_port"`
+	Cipher     string `json:"cipher"`
+	Compress   bool   `json:"compress"`
+	RemoteSudo bool   `json:"remote_sudo"`
+}
+
+// handleReplicationCheck reports the common snapshot and any divergence for a source/target pair.
+func (s *Server) handleReplicationCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req replicationCheckRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	cfg := s.snapshotConfig()
+	source := strings.TrimSpace(req.Source)
+	target := strings.TrimSpace(req.Target)
+	if !zfs.ValidDatasetName(source) || !zfs.ValidateDataset(cfg, source) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid source dataset"})
+		return
+	}
+	if !zfs.ValidReplicationTarget(target) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid target dataset"})
+		return
+	}
+	opts := zfs.ReplicationOptions{
+		Force:  req.Force,
+		Reseed: req.Reseed,
+		SSH: zfs.SSHOptions{
+			Port:       req.SSHPort,
+			Cipher:     strings.TrimSpace(req.Cipher),
+			Compress:   req.Compress,
+			RemoteSudo: req.RemoteSudo,
+		},
+	}
+	if err := validateSSHOptions(opts.SSH); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid ssh options", Details: err.Error()})
+		return
+	}
+	plan, err := zfs.CheckReplication(r.Context(), cfg, source, target, opts)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "replication check failed", Details: strings.TrimSpace(err.Error())})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"plan": plan, "blocked": plan.Blocked()}})
+}
+
+// replicationOptionsFromMeta mirrors the flags cron passes to `raidraccoon replicate`.
+func replicationOptionsFromMeta(meta map[string]string) zfs.ReplicationOptions {
+	opts := zfs.ReplicationOptions{
+		Prefix:      metaValue(meta, "prefix", ""),
+		Template:    meta["template"],
+		UTC:         metaBool(meta, "utc"),
+		Retention:   metaInt(meta, "retention", 0),
+		Recursive:   metaBool(meta, "recursive"),
+		Force:       metaBool(meta, "force"),
+		Reseed:      metaBool(meta, "reseed"),
+		Raw:         metaBool(meta, "raw"),
+		Compressed:  metaBool(meta, "compressed"),
+		LargeBlock:  metaBool(meta, "large_block"),
+		Embedded:    metaBool(meta, "embedded"),
+		SendProps:   metaBool(meta, "send_props"),
+		RecvExclude: zfs.SplitPropertyList(meta["recv_exclude"]),
+		RecvProps:   zfs.SplitPropertyList(meta["recv_props"]),
+		SSH:         replicationSSHFromMeta(meta),
+	}
+	if limits, policy, err := transferLimitsFromMeta(meta).normalize(); err == nil {
+		opts.BandwidthLimit = limits.BWLimit
+		opts.Window = policy
+	}
+	return opts
+}
+
+// setReplicationSendMeta stores send flags and receive overrides as comma lists so they
+// survive the space-separated cron metadata format.
+func setReplicationSendMeta(meta map[string]string, opts zfs.ReplicationOptions) {
+	meta["raw"] = boolToIntString(opts.Raw)
+	meta["compressed"] = boolToIntString(opts.Compressed)
+	meta["large_block"] = boolToIntString(opts.LargeBlock)
+	meta["embedded"] = boolToIntString(opts.Embedded)
+	meta["send_props"] = boolToIntString(opts.SendProps)
+	meta["recv_exclude"] = strings.Join(opts.RecvExclude, ",")
+	meta["recv_props"] = strings.Join(opts.RecvProps, ",")
+}
+
+// handleReplicationRun starts a configured replication job now and tracks it as a job with
+// transfer progress.
+func (s *Server) handleReplicationRun(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	file, err := cron.Load(cfg.Cron.CronFile, cfg.Cron.CronUser)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
+		return
+	}
+	var meta map[string]string
+	for _, item := range file.Items {
+		if item.ID == id && scheduleKind(item) == "replication" {
+			meta = item.Meta
+			break
+		}
+	}
+	if meta == nil {
+		s.writeJSON(w, http.StatusNotFound, apiEnvelope{Ok: false, Error: "job not found"})
+		return
+	}
+	source := meta["source"]
+	target := meta["target"]
+	if !zfs.ValidDatasetName(source) || !zfs.ValidReplicationTarget(target) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid replication job"})
+		return
+	}
+	opts := replicationOptionsFromMeta(meta)
+	job := s.jobs.StartFunc(auth.UserFromContext(r.Context()), "replication.run", "replicate", []string{source, target}, func(ctx context.Context, job *Job) (int, error) {
+		job.Logf("replicating %s -> %s", source, target)
+		opts.Progress = job.SetProgress
+		res, err := zfs.ReplicateDataset(ctx, cfg, source, target, opts)
+		if err != nil || res.ExitCode != 0 {
+			return res.ExitCode, fmt.Errorf("replication failed: %s", errDetails(res.Stderr, err))
+		}
+		if progress, _ := job.progressSince(0); progress != nil {
+			job.Logf("sent %d bytes in %.0fs", progress.Bytes, progress.Elapsed)
+		}
+		job.Logf("replication completed")
+		return 0, nil
+	})
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"job_id": job.ID}})
+}
+
+func (s *Server) handleReplicationHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	cfg := s.snapshotConfig()
+	records, err := zfs.ReplicationHistory(cfg.Replication.HistoryFile, limit)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read history failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": records}})
+}
+
+// transferLimits are the bandwidth and time-window settings shared by replication and rsync jobs.
+type transferLimits struct {
+	BWLimit     int64  `json:"bwlimit"`
+	Window      string `json:"window"`
+	WindowStart string `json:"window_start"`
+	WindowClose string `json:"window_close"`
+}
+
+// transferLimitsUpdate is the partial-update form of transferLimits.
+type transferLimitsUpdate struct {
+	BWLimit     *int64  `json:"bwlimit"`
+	Window      *string `json:"window"`
+	WindowStart *string `json:"window_start"`
+	WindowClose *string `json:"window_close"`
+}
+
+func (u transferLimitsUpdate) apply(l transferLimits) transferLimits {
+	if u.BWLimit != nil {
+		l.BWLimit = *u.BWLimit
+	}
+	if u.Window != nil {
+		l.Window = *u.Window
+	}
+	if u.WindowStart != nil {
+		l.WindowStart = *u.WindowStart
+	}
+	if u.WindowClose != nil {
+		l.WindowClose = *u.WindowClose
+	}
+	return l
+}
+
+// normalize validates the limits and returns them in the canonical form stored in cron metadata.
+func (l transferLimits) normalize() (transferLimits, window.Policy, error) {
+	if l.BWLimit < 0 {
+		return l, window.Policy{}, fmt.Errorf("bwlimit must be >= 0")
+	}
+	policy, err := window.ParsePolicy(l.Window, l.WindowStart, l.WindowClose)
+	if err != nil {
+		return l, window.Policy{}, err
+	}
+	l.Window = policy.Windows.String()
+	l.WindowStart = policy.Before
+	l.WindowClose = policy.OnClose
+	if l.Window == "" {
+		l.WindowStart = ""
+		l.WindowClose = ""
+	}
+	return l, policy, nil
+}
+
+func transferLimitsFromMeta(meta map[string]string) transferLimits {
+	return transferLimits{
+		BWLimit:     int64(metaInt(meta, "bwlimit", 0)),
+		Window:      metaValue(meta, "window", ""),
+		WindowStart: metaValue(meta, "window_start", ""),
+		WindowClose: metaValue(meta, "window_close", ""),
+	}
+}
+
+func setTransferLimitMeta(meta map[string]string, l transferLimits) {
+	meta["bwlimit"] = strconv.FormatInt(l.BWLimit, 10)
+	meta["window"] = l.Window
+	meta["window_start"] = l.WindowStart
+	meta["window_close"] = l.WindowClose
+}
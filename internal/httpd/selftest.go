@@ -0,0 +1,196 @@
+// Package httpd runs SMART self-tests on demand and manages their cron schedules.
+package httpd
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/cron"
+	"raidraccoon/internal/drives"
+)
+
+type selfTestRequest struct {
+	Devices []string `json:"devices"`
+	Test    string   `json:"test"`
+}
+
+// cleanDiskNames trims and validates a list of disk names; empty means all disks.
+func cleanDiskNames(names []string) ([]string, bool) {
+	out := []string{}
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "/dev/")
+		if name == "" {
+			continue
+		}
+		if !drives.ValidDiskName(name) {
+			return nil, false
+		}
+		out = append(out, name)
+	}
+	return out, true
+}
+
+// handleDriveSelfTests returns the recorded self-test history (GET, ?device= and
+// ?limit=) or starts self-tests as a job that waits for the results (POST).
+func (s *Server) handleDriveSelfTests(w http.ResponseWriter, r *http.Request) {
+	cfg := s.snapshotConfig()
+	switch r.Method {
+	case http.MethodGet:
+		device := strings.TrimSpace(r.URL.Query().Get("device"))
+		if device != "" && !drives.ValidDiskName(device) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid device"})
+			return
+		}
+		limit := 200
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+				limit = n
+			}
+		}
+		items, err := drives.SelfTestHistory(drives.SelfTestHistoryPath(cfg), device, limit)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read self-test history failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": items}})
+	case http.MethodPost:
+		var req selfTestRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Test = strings.TrimSpace(req.Test)
+		if !drives.ValidSelfTest(req.Test) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "test must be short or long"})
+			return
+		}
+		names, ok := cleanDiskNames(req.Devices)
+		if !ok {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid device"})
+			return
+		}
+		args := append([]string{"--test", req.Test}, names...)
+		job := s.jobs.StartFunc(auth.UserFromContext(r.Context()), "drives.selftest", "smarttest", args, func(ctx context.Context, job *Job) (int, error) {
+			recorded, err := drives.RunSelfTests(ctx, cfg, drives.SelfTestOptions{
+				Devices: names,
+				Test:    req.Test,
+				Wait:    true,
+				Log:     func(line string) { job.Logf("%s", line) },
+			})
+			if err != nil {
+				return 1, err
+			}
+			job.Logf("recorded %d result(s)", len(recorded))
+			return 0, nil
+		})
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"job_id": job.ID}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+// handleSelfTestSchedules lists and creates (or, with an id, replaces) cron schedules
+// of type "smarttest", which run `raidraccoon smarttest --test <short|long>`. Toggle and
+// delete go through /api/zfs/schedules/<id> like snapshot schedules.
+func (s *Server) handleSelfTestSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
+			return
+		}
+		type selfTestView struct {
+			ID       string        `json:"id"`
+			Test     string        `json:"test"`
+			Devices  []string      `json:"devices"`
+			Enabled  bool          `json:"enabled"`
+			Schedule cron.CronSpec `json:"schedule"`
+			Cron     string        `json:"cron"`
+		}
+		views := []selfTestView{}
+		for _, item := range file.Items {
+			if scheduleKind(item) != "smarttest" {
+				continue
+			}
+			meta := item.Meta
+			if meta == nil {
+				meta = map[string]string{}
+			}
+			devices := []string{}
+			if meta["devices"] != "" {
+				devices = strings.Split(meta["devices"], ",")
+			}
+			views = append(views, selfTestView{
+				ID:       item.ID,
+				Test:     meta["test"],
+				Devices:  devices,
+				Enabled:  item.Enabled,
+				Schedule: item.Cron,
+				Cron:     item.RawCron,
+			})
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": views, "updated": file.Updated}})
+	case http.MethodPost:
+		var req struct {
+			ID       string        `json:"id"`
+			Test     string        `json:"test"`
+			Devices  []string      `json:"devices"`
+			Enabled  bool          `json:"enabled"`
+			Schedule cron.CronSpec `json:"schedule"`
+		}
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Test = strings.TrimSpace(req.Test)
+		if !drives.ValidSelfTest(req.Test) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "test must be short or long"})
+			return
+		}
+		names, ok := cleanDiskNames(req.Devices)
+		if !ok {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid device"})
+			return
+		}
+		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
+			return
+		}
+		if req.ID != "" {
+			found := false
+			for _, item := range file.Items {
+				if item.ID == req.ID {
+					found = scheduleKind(item) == "smarttest"
+					break
+				}
+			}
+			if !found {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "self-test schedule not found"})
+				return
+			}
+		}
+		item := cron.Schedule{
+			ID:      req.ID,
+			Type:    "smarttest",
+			Enabled: req.Enabled,
+			Cron:    normalizeCron(req.Schedule),
+			Meta: map[string]string{
+				"type":    "smarttest",
+				"test":    req.Test,
+				"devices": strings.Join(names, ","),
+			},
+		}
+		file.Items = cron.Upsert(file.Items, item)
+		updated, err := s.saveCronFile(file)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "save cron failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"updated": updated}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
@@ -22,9 +22,11 @@ import (
 	"raidraccoon/internal/auth"
 	"raidraccoon/internal/config"
 	"raidraccoon/internal/cron"
+	"raidraccoon/internal/devd"
 	"raidraccoon/internal/drives"
 	"raidraccoon/internal/execwrap"
 	"raidraccoon/internal/samba"
+	"raidraccoon/internal/tsdb"
 	"raidraccoon/internal/ui"
 	"raidraccoon/internal/zfs"
 )
@@ -40,6 +42,22 @@ type Server struct {
 	importablePools   []zfs.ImportablePool
 	importableErr     string
 	importableChecked time.Time
+	statsStore        *tsdb.Store
+	statsMu           sync.Mutex
+	statsLatest       []zfs.IOStat
+	statsUpdated      time.Time
+	statsErr          string
+	capacityStore     *tsdb.Store
+	capacityErr       string
+	smartMu           sync.Mutex
+	smartCache        map[string]driveHealthView
+	inventoryMu       sync.Mutex
+	inventoryErr      string
+	devdMu            sync.Mutex
+	devdStatus        devdStatus
+	devdEvents        []devd.Event
+	devdSubs          map[chan devdMessage]struct{}
+	devdRefresh       *time.Timer
 }
 
 type pageData struct {
@@ -60,31 +78,63 @@ type scheduleUpdateRequest struct {
 	Dataset   string        `json:"dataset"`
 	Retention int           `json:"retention"`
 	Prefix    string        `json:"prefix"`
+	Template  *string       `json:"template"`
+	UTC       *bool         `json:"utc"`
 	Enabled   *bool         `json:"enabled"`
 	Schedule  cron.CronSpec `json:"schedule"`
 }
 
 type replicationRequest struct {
-	Source    string        `json:"source"`
-	Target    string        `json:"target"`
-	Retention int           `json:"retention"`
-	Prefix    string        `json:"prefix"`
-	Recursive bool          `json:"recursive"`
-	Force     bool          `json:"force"`
-	Enabled   bool          `json:"enabled"`
-	Schedule  cron.CronSpec `json:"schedule"`
+	Source      string        `json:"source"`
+	Target      string        `json:"target"`
+	Retention   int           `json:"retention"`
+	Prefix      string        `json:"prefix"`
+	Template    string        `json:"template"`
+	UTC         bool          `json:"utc"`
+	Recursive   bool          `json:"recursive"`
+	Force       bool          `json:"force"`
+	Reseed      bool          `json:"reseed"`
+	Raw         bool          `json:"raw"`
+	Compressed  bool          `json:"compressed"`
+	LargeBlock  bool          `json:"large_block"`
+	Embedded    bool          `json:"embedded"`
+	SendProps   bool          `json:"send_props"`
+	RecvExclude []string      `json:"recv_exclude"`
+	RecvProps   []string      `json:"recv_props"`
+	SSHPort     int           `json:"ssh_port"`
+	Cipher      string        `json:"cipher"`
+	Compress    bool          `json:"compress"`
+	RemoteSudo  bool          `json:"remote_sudo"`
+	Enabled     bool          `json:"enabled"`
+	Schedule    cron.CronSpec `json:"schedule"`
+	transferLimits
 }
 
 type replicationUpdateRequest struct {
-	Toggle    bool          `json:"toggle"`
-	Source    string        `json:"source"`
-	Target    string        `json:"target"`
-	Retention *int          `json:"retention"`
-	Prefix    string        `json:"prefix"`
-	Recursive *bool         `json:"recursive"`
-	Force     *bool         `json:"force"`
-	Enabled   *bool         `json:"enabled"`
-	Schedule  cron.CronSpec `json:"schedule"`
+	Toggle      bool          `json:"toggle"`
+	Source      string        `json:"source"`
+	Target      string        `json:"target"`
+	Retention   *int          `json:"retention"`
+	Prefix      string        `json:"prefix"`
+	Template    *string       `json:"template"`
+	UTC         *bool         `json:"utc"`
+	Recursive   *bool         `json:"recursive"`
+	Force       *bool         `json:"force"`
+	Reseed      *bool         `json:"reseed"`
+	Raw         *bool         `json:"raw"`
+	Compressed  *bool         `json:"compressed"`
+	LargeBlock  *bool         `json:"large_block"`
+	Embedded    *bool         `json:"embedded"`
+	SendProps   *bool         `json:"send_props"`
+	RecvExclude *[]string     `json:"recv_exclude"`
+	RecvProps   *[]string     `json:"recv_props"`
+	SSHPort     *int          `json:"ssh_port"`
+	Cipher      *string       `json:"cipher"`
+	Compress    *bool         `json:"compress"`
+	RemoteSudo  *bool         `json:"remote_sudo"`
+	Enabled     *bool         `json:"enabled"`
+	Schedule    cron.CronSpec `json:"schedule"`
+	transferLimitsUpdate
 }
 
 type rsyncRequest struct {
@@ -94,6 +144,7 @@ type rsyncRequest struct {
 	Flags    string        `json:"flags"`
 	Enabled  bool          `json:"enabled"`
 	Schedule cron.CronSpec `json:"schedule"`
+	transferLimits
 }
 
 type rsyncUpdateRequest struct {
@@ -104,6 +155,7 @@ type rsyncUpdateRequest struct {
 	Flags    string        `json:"flags"`
 	Enabled  *bool         `json:"enabled"`
 	Schedule cron.CronSpec `json:"schedule"`
+	transferLimitsUpdate
 }
 
 func New(cfg config.Config) *Server {
@@ -117,6 +169,10 @@ func New(cfg config.Config) *Server {
 	}
 	s.routes()
 	s.startImportWatcher()
+	s.startStatsCollector()
+	s.startCapacityRecorder()
+	s.startInventoryRecorder()
+	s.startGELIBootAttach()
 	return s
 }
 
@@ -146,6 +202,12 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/zfs/pools", func(w http.ResponseWriter, r *http.Request) {
 		ui.Render(w, "zfs_pools", pageData{Title: "ZFS Pools", Active: "zfs-pools"})
 	})
+	s.mux.HandleFunc("/zfs/history", func(w http.ResponseWriter, r *http.Request) {
+		ui.Render(w, "zfs_history", pageData{Title: "ZFS History", Active: "zfs-history"})
+	})
+	s.mux.HandleFunc("/zfs/bootenv", func(w http.ResponseWriter, r *http.Request) {
+		ui.Render(w, "zfs_bootenv", pageData{Title: "Boot Environments", Active: "zfs-bootenv"})
+	})
 	s.mux.HandleFunc("/zfs/mounts", func(w http.ResponseWriter, r *http.Request) {
 		ui.Render(w, "zfs_mounts", pageData{Title: "ZFS Mounts", Active: "zfs-mounts"})
 	})
@@ -161,6 +223,9 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/zfs/replication", func(w http.ResponseWriter, r *http.Request) {
 		ui.Render(w, "zfs_replication", pageData{Title: "ZFS Snapshots: Replication", Active: "zfs-replication"})
 	})
+	s.mux.HandleFunc("/zfs/streams", func(w http.ResponseWriter, r *http.Request) {
+		ui.Render(w, "zfs_streams", pageData{Title: "ZFS Snapshots: Stream Files", Active: "zfs-streams"})
+	})
 	s.mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
 		ui.Render(w, "settings", pageData{Title: "System Settings", Active: "settings"})
 	})
@@ -173,6 +238,8 @@ func (s *Server) routes() {
 
 	s.mux.HandleFunc("/api/samba/users", s.handleSambaUsers)
 	s.mux.HandleFunc("/api/samba/users/", s.handleSambaUserAction)
+	s.mux.HandleFunc("/api/samba/groups", s.handleSambaGroups)
+	s.mux.HandleFunc("/api/samba/accounts", s.handleSambaAccounts)
 	s.mux.HandleFunc("/api/samba/shares", s.handleSambaShares)
 	s.mux.HandleFunc("/api/samba/shares/", s.handleSambaShare)
 	s.mux.HandleFunc("/api/samba/testparm", s.handleSambaTest)
@@ -180,22 +247,52 @@ func (s *Server) routes() {
 
 	s.mux.HandleFunc("/api/zfs/pools", s.handleZFSPools)
 	s.mux.HandleFunc("/api/zfs/importable", s.handleZFSImportable)
+	s.mux.HandleFunc("/api/zfs/devd", s.handleDevd)
+	s.mux.HandleFunc("/api/zfs/devd/stream", s.handleDevdStream)
 	s.mux.HandleFunc("/api/zfs/import", s.handleZFSImport)
 	s.mux.HandleFunc("/api/zfs/pools/", s.handleZFSPoolItem)
 	s.mux.HandleFunc("/api/zfs/pools/status", s.handleZFSPoolStatus)
 	s.mux.HandleFunc("/api/zfs/datasets", s.handleZFSDatasets)
 	s.mux.HandleFunc("/api/zfs/datasets/", s.handleZFSDatasetItem)
 	s.mux.HandleFunc("/api/zfs/drives", s.handleZFSDrives)
+	s.mux.HandleFunc("/api/zfs/drives/smart", s.handleDriveHealth)
+	s.mux.HandleFunc("/api/zfs/drives/selftests", s.handleDriveSelfTests)
+	s.mux.HandleFunc("/api/zfs/drives/selftests/schedules", s.handleSelfTestSchedules)
+	s.mux.HandleFunc("/api/zfs/drives/prepare", s.handlePrepareDisk)
+	s.mux.HandleFunc("/api/zfs/drives/inventory", s.handleDriveInventory)
+	s.mux.HandleFunc("/api/zfs/geli", s.handleGELI)
 	s.mux.HandleFunc("/api/zfs/mounts", s.handleZFSMounts)
+	s.mux.HandleFunc("/api/zfs/iostat", s.handleZFSIOStat)
+	s.mux.HandleFunc("/api/zfs/arc", s.handleZFSARC)
+	s.mux.HandleFunc("/api/zfs/capacity", s.handleZFSCapacity)
+	s.mux.HandleFunc("/api/zfs/features", s.handleZFSFeatures)
+	s.mux.HandleFunc("/api/zfs/upgrade", s.handleZFSUpgrade)
+	s.mux.HandleFunc("/api/zfs/checkpoint", s.handleZFSCheckpoints)
+	s.mux.HandleFunc("/api/zfs/checkpoint/rewind", s.handleZFSCheckpointRewind)
+	s.mux.HandleFunc("/api/zfs/trim", s.handleZFSTrim)
+	s.mux.HandleFunc("/api/zfs/trim/schedules", s.handleTrimSchedules)
+	s.mux.HandleFunc("/api/zfs/initialize", s.handleZFSInitialize)
+	s.mux.HandleFunc("/api/zfs/history", s.handleZFSHistory)
+	s.mux.HandleFunc("/api/zfs/events", s.handleZFSEvents)
+	s.mux.HandleFunc("/api/zfs/bootenv", s.handleBootEnvironments)
 	s.mux.HandleFunc("/api/zfs/snapshots", s.handleZFSSnapshots)
+	s.mux.HandleFunc("/api/zfs/snapshots/preview", s.handleZFSSnapshotPreview)
+	s.mux.HandleFunc("/api/zfs/snapshots/destroy", s.handleZFSSnapshotDestroy)
+	s.mux.HandleFunc("/api/zfs/streams", s.handleZFSStreams)
+	s.mux.HandleFunc("/api/zfs/streams/export", s.handleZFSStreamExport)
+	s.mux.HandleFunc("/api/zfs/streams/import", s.handleZFSStreamImport)
 
 	s.mux.HandleFunc("/api/zfs/schedules", s.handleSchedules)
 	s.mux.HandleFunc("/api/zfs/schedules/", s.handleScheduleItem)
 	s.mux.HandleFunc("/api/zfs/replication", s.handleZFSReplication)
 	s.mux.HandleFunc("/api/zfs/replication/", s.handleZFSReplicationItem)
+	s.mux.HandleFunc("/api/zfs/replication/ssh", s.handleReplicationSSH)
+	s.mux.HandleFunc("/api/zfs/replication/check", s.handleReplicationCheck)
+	s.mux.HandleFunc("/api/zfs/replication/history", s.handleReplicationHistory)
 	s.mux.HandleFunc("/api/rsync", s.handleRsyncJobs)
 	s.mux.HandleFunc("/api/rsync/", s.handleRsyncJobItem)
 	s.mux.HandleFunc("/api/zfs/labels", s.handleZFSLabels)
+	s.mux.HandleFunc("/api/zfs/partitions", s.handlePartitions)
 
 	s.mux.HandleFunc("/api/settings", s.handleSettings)
 	s.mux.HandleFunc("/api/settings/password", s.handleSettingsPassword)
@@ -210,17 +307,6 @@ func (s *Server) writeJSON(w http.ResponseWriter, status int, env apiEnvelope) {
 	_ = json.NewEncoder(w).Encode(env)
 }
 
-func (s *Server) startImportWatcher() {
-	interval := 20 * time.Second
-	s.refreshImportableCache()
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			s.refreshImportableCache()
-		}
-	}()
-}
-
 func (s *Server) importableSnapshot() []zfs.ImportablePool {
 	s.importMu.Lock()
 	defer s.importMu.Unlock()
@@ -325,6 +411,9 @@ func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
 		"truncated": job.Truncated,
 		"duration":  duration(job.Start, job.End, job.Done),
 	}
+	if job.Progress != nil {
+		data["progress"] = *job.Progress
+	}
 	job.mu.Unlock()
 	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
 }
@@ -352,6 +441,7 @@ func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, job *Job) {
 	notify := r.Context().Done()
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
+	progressSeq := 0
 	for {
 		select {
 		case <-notify:
@@ -360,6 +450,14 @@ func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, job *Job) {
 			sendSSE(w, chunk)
 			flusher.Flush()
 		case <-ticker.C:
+			var progress *zfs.TransferProgress
+			progress, progressSeq = job.progressSince(progressSeq)
+			if progress != nil {
+				if payload, err := json.Marshal(progress); err == nil {
+					fmt.Fprintf(w, "event: progress\ndata: %s\n\n", payload)
+					flusher.Flush()
+				}
+			}
 			job.mu.Lock()
 			done := job.Done
 			job.mu.Unlock()
@@ -494,6 +592,74 @@ func (s *Server) handleSambaUserAction(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"user": username}})
 }
 
+// handleSambaAccounts lists the system accounts offered as force user.
+func (s *Server) handleSambaAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	accounts, err := samba.ListAccounts(samba.PasswdFile)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list accounts failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: accounts})
+}
+
+// handleSambaGroups lists the system groups offered for share access.
+func (s *Server) handleSambaGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	groups, err := samba.ListGroups(samba.GroupFile)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list groups failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: groups})
+}
+
+// validateShareAccess checks share access entries against the Samba users and system
+// accounts and groups before the share is saved; it writes the error response and returns false.
+func (s *Server) validateShareAccess(w http.ResponseWriter, r *http.Request, access *samba.ShareAccess) bool {
+	if access == nil {
+		return true
+	}
+	users, err := samba.ListUsers(r.Context(), s.cfg)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list users failed", Details: err.Error()})
+		return false
+	}
+	accounts, err := samba.ListAccounts(samba.PasswdFile)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list accounts failed", Details: err.Error()})
+		return false
+	}
+	groups, err := samba.ListGroups(samba.GroupFile)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list groups failed", Details: err.Error()})
+		return false
+	}
+	userNames := make([]string, 0, len(users))
+	for _, user := range users {
+		userNames = append(userNames, user.Name)
+	}
+	accountNames := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		accountNames = append(accountNames, account.Name)
+	}
+	groupNames := make([]string, 0, len(groups))
+	for _, group := range groups {
+		groupNames = append(groupNames, group.Name)
+	}
+	if err := samba.ValidateAccess(access, userNames, accountNames, groupNames); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid share access", Details: err.Error()})
+		return false
+	}
+	return true
+}
+
 func (s *Server) handleSambaShares(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -517,6 +683,10 @@ func (s *Server) handleSambaShares(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list shares failed", Details: err.Error()})
 			return
 		}
+		samba.FoldAccessParams(shares, &req)
+		if !s.validateShareAccess(w, r, req.Access) {
+			return
+		}
 		shares = samba.UpsertShare(shares, req)
 		if err := samba.SaveShares(s.cfg.Samba.IncludeFile, shares); err != nil {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "save shares failed", Details: err.Error()})
@@ -546,6 +716,10 @@ func (s *Server) handleSambaShare(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list shares failed", Details: err.Error()})
 			return
 		}
+		samba.FoldAccessParams(shares, &req)
+		if !s.validateShareAccess(w, r, req.Access) {
+			return
+		}
 		shares = samba.UpsertShare(shares, req)
 		if err := samba.SaveShares(s.cfg.Samba.IncludeFile, shares); err != nil {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "save shares failed", Details: err.Error()})
@@ -642,9 +816,14 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 		Ident       string `json:"ident"`
 		Pool        string `json:"pool"`
 		Role        string `json:"role"`
+		Vdev        string `json:"vdev,omitempty"`
 		Alloc       string `json:"alloc"`
 		Free        string `json:"free"`
 		Size        string `json:"size"`
+		// Labels are the GEOM labels (gpt/, gptid/, diskid/) on the disk or its partitions.
+		Labels []string `json:"labels,omitempty"`
+		// SMART is only read for whole disks listed by geom.
+		SMART *driveHealthView `json:"smart,omitempty"`
 	}
 
 	usageByName := map[string]zfs.PoolDevice{}
@@ -660,6 +839,15 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	labelsByDisk := map[string][]string{}
+	for label, provider := range labelMap {
+		disk := strings.ToLower(baseDeviceName(provider))
+		labelsByDisk[disk] = append(labelsByDisk[disk], label)
+	}
+	for _, list := range labelsByDisk {
+		sort.Strings(list)
+	}
+
 	mapped := map[string]struct{}{}
 	driveSizeByName := map[string]string{}
 	for _, drive := range geomDrives {
@@ -668,6 +856,12 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 		}
 		driveSizeByName[strings.ToLower(drive.Name)] = drive.Mediasize
 	}
+	driveNames := make([]string, 0, len(geomDrives))
+	for _, drive := range geomDrives {
+		driveNames = append(driveNames, drive.Name)
+	}
+	health := s.driveHealth(r.Context(), s.snapshotConfig(), driveNames, r.URL.Query().Get("refresh") != "")
+	flagged := []string{}
 	views := make([]driveView, 0, len(geomDrives))
 	for _, drive := range geomDrives {
 		key := strings.ToLower(drive.Name)
@@ -684,10 +878,18 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 			Mediasize:   drive.Mediasize,
 			Description: drive.Description,
 			Ident:       drive.Ident,
+			Labels:      labelsByDisk[key],
+		}
+		if h, found := health[drive.Name]; found {
+			view.SMART = &h
+			if h.Level == drives.HealthWarn || h.Level == drives.HealthFail {
+				flagged = append(flagged, drive.Name)
+			}
 		}
 		if ok {
 			view.Pool = usage.Pool
 			view.Role = usage.Role
+			view.Vdev = usage.Vdev
 			view.Alloc = usage.Alloc
 			view.Free = usage.Free
 			view.Size = usage.Size
@@ -711,6 +913,7 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 			Name:  usage.Name,
 			Pool:  usage.Pool,
 			Role:  usage.Role,
+			Vdev:  usage.Vdev,
 			Alloc: usage.Alloc,
 			Free:  usage.Free,
 			Size:  usage.Size,
@@ -762,13 +965,19 @@ func (s *Server) handleZFSDrives(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := map[string]any{
-		"drives": views,
+		"drives":  views,
+		"flagged": flagged,
 		"cache": map[string]any{
 			"used_bytes":  l2size,
 			"total_bytes": cacheTotal,
 			"devices":     cacheDevices,
 		},
 	}
+	missing, err := s.missingDisks(s.snapshotConfig())
+	if err != nil {
+		errors["inventory"] = err.Error()
+	}
+	data["missing"] = missing
 	if len(errors) > 0 {
 		data["errors"] = errors
 	}
@@ -929,6 +1138,9 @@ func (s *Server) handleZFSImportable(w http.ResponseWriter, r *http.Request) {
 		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
 		return
 	}
+	if r.URL.Query().Get("refresh") != "" {
+		s.refreshImportable()
+	}
 	pools := s.importableSnapshot()
 	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: pools})
 }
@@ -1071,17 +1283,24 @@ func (s *Server) handleZFSDatasets(w http.ResponseWriter, r *http.Request) {
 			Available  string `json:"available"`
 			Referenced string `json:"referenced"`
 			Mountpoint string `json:"mountpoint"`
+			// Space is omitted when the byte-level listing fails; the list itself still works.
+			Space *zfs.DatasetSpace `json:"space,omitempty"`
 		}
+		space, _ := zfs.ListDatasetSpace(r.Context(), s.cfg)
 		views := make([]datasetView, 0, len(data))
 		for _, ds := range data {
-			views = append(views, datasetView{
+			view := datasetView{
 				Name:       ds.Name,
 				Type:       ds.Type,
 				Used:       ds.Used,
 				Available:  ds.Available,
 				Referenced: ds.Referenced,
 				Mountpoint: ds.Mountpoint,
-			})
+			}
+			if entry, ok := space[ds.Name]; ok {
+				view.Space = &entry
+			}
+			views = append(views, view)
 		}
 		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: views})
 	case http.MethodPost:
@@ -1263,6 +1482,8 @@ func (s *Server) handleZFSSnapshots(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Dataset   string `json:"dataset"`
 			Prefix    string `json:"prefix"`
+			Template  string `json:"template"`
+			UTC       bool   `json:"utc"`
 			Name      string `json:"name"`
 			Recursive bool   `json:"recursive"`
 		}
@@ -1287,7 +1508,12 @@ func (s *Server) handleZFSSnapshots(w http.ResponseWriter, r *http.Request) {
 				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot prefix"})
 				return
 			}
-			name = zfs.BuildSnapshotName(prefix, time.Now())
+			naming := zfs.NameTemplate{Pattern: strings.TrimSpace(req.Template), Prefix: prefix, UTC: req.UTC}
+			if err := naming.Validate(); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot template", Details: err.Error()})
+				return
+			}
+			name = naming.Format(time.Now())
 		} else if !zfs.ValidSnapshotName(name) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot name"})
 			return
@@ -1357,12 +1583,14 @@ func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
 				items = append(items, item)
 			}
 		}
-		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": items, "updated": file.Updated}})
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": items, "updated": file.Updated, "templates": zfs.SnapshotTemplatePresets}})
 	case http.MethodPost:
 		var req struct {
 			Dataset   string        `json:"dataset"`
 			Retention int           `json:"retention"`
 			Prefix    string        `json:"prefix"`
+			Template  string        `json:"template"`
+			UTC       bool          `json:"utc"`
 			Enabled   bool          `json:"enabled"`
 			Schedule  cron.CronSpec `json:"schedule"`
 		}
@@ -1377,6 +1605,11 @@ func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid dataset name"})
 			return
 		}
+		req.Template = strings.TrimSpace(req.Template)
+		if err := (zfs.NameTemplate{Pattern: req.Template, Prefix: req.Prefix, UTC: req.UTC}).Validate(); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot template", Details: err.Error()})
+			return
+		}
 		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
 		if err != nil {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
@@ -1389,7 +1622,9 @@ func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
 			Prefix:    req.Prefix,
 			Enabled:   req.Enabled,
 			Cron:      normalizeCron(req.Schedule),
+			Meta:      map[string]string{},
 		}
+		setNamingMeta(item.Meta, req.Template, req.UTC)
 		file.Items = cron.Upsert(file.Items, item)
 		updated, err := s.saveCronFile(file)
 		if err != nil {
@@ -1418,6 +1653,13 @@ func (s *Server) handleScheduleItem(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid dataset name"})
 			return
 		}
+		if req.Template != nil {
+			*req.Template = strings.TrimSpace(*req.Template)
+			if err := (zfs.NameTemplate{Pattern: *req.Template, Prefix: req.Prefix}).Validate(); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot template", Details: err.Error()})
+				return
+			}
+		}
 		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
 		if err != nil {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
@@ -1471,16 +1713,32 @@ func (s *Server) handleZFSReplication(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		type replicationView struct {
-			ID        string        `json:"id"`
-			Source    string        `json:"source"`
-			Target    string        `json:"target"`
-			Retention int           `json:"retention"`
-			Prefix    string        `json:"prefix"`
-			Recursive bool          `json:"recursive"`
-			Force     bool          `json:"force"`
-			Enabled   bool          `json:"enabled"`
-			Schedule  cron.CronSpec `json:"schedule"`
-			Cron      string        `json:"cron"`
+			ID          string        `json:"id"`
+			Source      string        `json:"source"`
+			Target      string        `json:"target"`
+			Remote      bool          `json:"remote"`
+			Retention   int           `json:"retention"`
+			Prefix      string        `json:"prefix"`
+			Template    string        `json:"template"`
+			UTC         bool          `json:"utc"`
+			Recursive   bool          `json:"recursive"`
+			Force       bool          `json:"force"`
+			Reseed      bool          `json:"reseed"`
+			Raw         bool          `json:"raw"`
+			Compressed  bool          `json:"compressed"`
+			LargeBlock  bool          `json:"large_block"`
+			Embedded    bool          `json:"embedded"`
+			SendProps   bool          `json:"send_props"`
+			RecvExclude []string      `json:"recv_exclude"`
+			RecvProps   []string      `json:"recv_props"`
+			SSHPort     int           `json:"ssh_port"`
+			Cipher      string        `json:"cipher"`
+			Compress    bool          `json:"compress"`
+			RemoteSudo  bool          `json:"remote_sudo"`
+			Enabled     bool          `json:"enabled"`
+			Schedule    cron.CronSpec `json:"schedule"`
+			Cron        string        `json:"cron"`
+			transferLimits
 		}
 		views := []replicationView{}
 		for _, item := range file.Items {
@@ -1491,20 +1749,38 @@ func (s *Server) handleZFSReplication(w http.ResponseWriter, r *http.Request) {
 			if meta == nil {
 				meta = map[string]string{}
 			}
+			sshOpts := replicationSSHFromMeta(meta)
+			sendOpts := replicationOptionsFromMeta(meta)
 			views = append(views, replicationView{
-				ID:        item.ID,
-				Source:    meta["source"],
-				Target:    meta["target"],
-				Retention: metaInt(meta, "retention", item.Retention),
-				Prefix:    metaValue(meta, "prefix", item.Prefix),
-				Recursive: metaBool(meta, "recursive"),
-				Force:     metaBool(meta, "force"),
-				Enabled:   item.Enabled,
-				Schedule:  item.Cron,
-				Cron:      item.RawCron,
+				ID:             item.ID,
+				Source:         meta["source"],
+				Target:         meta["target"],
+				Remote:         zfs.IsRemoteTarget(meta["target"]),
+				Retention:      metaInt(meta, "retention", item.Retention),
+				Prefix:         metaValue(meta, "prefix", item.Prefix),
+				Template:       meta["template"],
+				UTC:            metaBool(meta, "utc"),
+				Recursive:      metaBool(meta, "recursive"),
+				Force:          metaBool(meta, "force"),
+				Reseed:         metaBool(meta, "reseed"),
+				Raw:            sendOpts.Raw,
+				Compressed:     sendOpts.Compressed,
+				LargeBlock:     sendOpts.LargeBlock,
+				Embedded:       sendOpts.Embedded,
+				SendProps:      sendOpts.SendProps,
+				RecvExclude:    sendOpts.RecvExclude,
+				RecvProps:      sendOpts.RecvProps,
+				SSHPort:        sshOpts.Port,
+				Cipher:         sshOpts.Cipher,
+				Compress:       sshOpts.Compress,
+				RemoteSudo:     sshOpts.RemoteSudo,
+				Enabled:        item.Enabled,
+				Schedule:       item.Cron,
+				Cron:           item.RawCron,
+				transferLimits: transferLimitsFromMeta(meta),
 			})
 		}
-		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": views, "updated": file.Updated}})
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": views, "updated": file.Updated, "templates": zfs.SnapshotTemplatePresets}})
 	case http.MethodPost:
 		var req replicationRequest
 		if !s.decodeJSON(w, r, &req) {
@@ -1524,10 +1800,38 @@ func (s *Server) handleZFSReplication(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid source dataset"})
 			return
 		}
-		if !zfs.ValidDatasetName(req.Target) || !zfs.ValidateDataset(s.cfg, req.Target) {
+		if !zfs.ValidReplicationTarget(req.Target) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid target dataset"})
 			return
 		}
+		sshOpts := zfs.SSHOptions{
+			Port:       req.SSHPort,
+			Cipher:     strings.TrimSpace(req.Cipher),
+			Compress:   req.Compress,
+			RemoteSudo: req.RemoteSudo,
+		}
+		if err := validateSSHOptions(sshOpts); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid ssh options", Details: err.Error()})
+			return
+		}
+		sendOpts := zfs.ReplicationOptions{
+			Raw:         req.Raw,
+			Compressed:  req.Compressed,
+			LargeBlock:  req.LargeBlock,
+			Embedded:    req.Embedded,
+			SendProps:   req.SendProps,
+			RecvExclude: cleanList(req.RecvExclude),
+			RecvProps:   cleanList(req.RecvProps),
+		}
+		if err := zfs.ValidateRecvOverrides(sendOpts.RecvExclude, sendOpts.RecvProps); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid receive options", Details: err.Error()})
+			return
+		}
+		limits, _, err := req.transferLimits.normalize()
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid transfer limits", Details: err.Error()})
+			return
+		}
 		prefix := strings.TrimSpace(req.Prefix)
 		if prefix == "" {
 			if s.cfg.ZFS.SnapshotPrefix != "" {
@@ -1540,6 +1844,11 @@ func (s *Server) handleZFSReplication(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid prefix"})
 			return
 		}
+		req.Template = strings.TrimSpace(req.Template)
+		if err := (zfs.NameTemplate{Pattern: req.Template, Prefix: prefix, UTC: req.UTC}).Validate(); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot template", Details: err.Error()})
+			return
+		}
 		if req.Retention < 0 {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "retention must be >= 0"})
 			return
@@ -1563,8 +1872,13 @@ func (s *Server) handleZFSReplication(w http.ResponseWriter, r *http.Request) {
 				"retention": strconv.Itoa(req.Retention),
 				"recursive": boolToIntString(req.Recursive),
 				"force":     boolToIntString(req.Force),
+				"reseed":    boolToIntString(req.Reseed),
 			},
 		}
+		setNamingMeta(item.Meta, req.Template, req.UTC)
+		setReplicationSSHMeta(item.Meta, sshOpts)
+		setReplicationSendMeta(item.Meta, sendOpts)
+		setTransferLimitMeta(item.Meta, limits)
 		file.Items = cron.Upsert(file.Items, item)
 		updated, err := s.saveCronFile(file)
 		if err != nil {
@@ -1583,6 +1897,10 @@ func (s *Server) handleZFSReplicationItem(w http.ResponseWriter, r *http.Request
 		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "missing id"})
 		return
 	}
+	if strings.HasSuffix(id, "/run") {
+		s.handleReplicationRun(w, r, strings.TrimSuffix(id, "/run"))
+		return
+	}
 	switch r.Method {
 	case http.MethodPut:
 		var req replicationUpdateRequest
@@ -1655,6 +1973,7 @@ func (s *Server) handleRsyncJobs(w http.ResponseWriter, r *http.Request) {
 			Enabled  bool          `json:"enabled"`
 			Schedule cron.CronSpec `json:"schedule"`
 			Cron     string        `json:"cron"`
+			transferLimits
 		}
 		views := []rsyncView{}
 		for _, item := range file.Items {
@@ -1666,14 +1985,15 @@ func (s *Server) handleRsyncJobs(w http.ResponseWriter, r *http.Request) {
 				meta = map[string]string{}
 			}
 			views = append(views, rsyncView{
-				ID:       item.ID,
-				Source:   meta["source"],
-				Target:   meta["target"],
-				Mode:     metaValue(meta, "mode", "mirror"),
-				Flags:    meta["flags"],
-				Enabled:  item.Enabled,
-				Schedule: item.Cron,
-				Cron:     item.RawCron,
+				ID:             item.ID,
+				Source:         meta["source"],
+				Target:         meta["target"],
+				Mode:           metaValue(meta, "mode", "mirror"),
+				Flags:          meta["flags"],
+				Enabled:        item.Enabled,
+				Schedule:       item.Cron,
+				Cron:           item.RawCron,
+				transferLimits: transferLimitsFromMeta(meta),
 			})
 		}
 		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": views, "updated": file.Updated}})
@@ -1714,6 +2034,11 @@ func (s *Server) handleRsyncJobs(w http.ResponseWriter, r *http.Request) {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "flags must be comma-separated without spaces"})
 			return
 		}
+		limits, _, err := req.transferLimits.normalize()
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid transfer limits", Details: err.Error()})
+			return
+		}
 		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
 		if err != nil {
 			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
@@ -1731,6 +2056,7 @@ func (s *Server) handleRsyncJobs(w http.ResponseWriter, r *http.Request) {
 				"flags":  flags,
 			},
 		}
+		setTransferLimitMeta(item.Meta, limits)
 		file.Items = cron.Upsert(file.Items, item)
 		updated, err := s.saveCronFile(file)
 		if err != nil {
@@ -1887,7 +2213,7 @@ func (s *Server) saveCronFile(file cron.File) (string, error) {
 		return "", tmpErr
 	}
 
-	res, runErr := s.runCommand(context.Background(), "/usr/bin/install", []string{"-m", "0644", tmpPath, s.cfg.Cron.CronFile}, nil)
+	res, runErr := s.runCommand(context.Background(), s.cfg.Paths.Install, []string{"-m", "0644", tmpPath, s.cfg.Cron.CronFile}, nil)
 	if runErr != nil {
 		return "", runErr
 	}
@@ -1920,6 +2246,23 @@ func normalizeCron(spec cron.CronSpec) cron.CronSpec {
 	return spec
 }
 
+// namingFromMeta reads a schedule's snapshot naming template from its cron metadata.
+func namingFromMeta(meta map[string]string, prefix string) zfs.NameTemplate {
+	return zfs.NameTemplate{Pattern: meta["template"], Prefix: metaValue(meta, "prefix", prefix), UTC: metaBool(meta, "utc")}
+}
+
+// setNamingMeta stores a naming template; an empty template means the default.
+func setNamingMeta(meta map[string]string, template string, utc bool) {
+	delete(meta, "template")
+	delete(meta, "utc")
+	if template != "" {
+		meta["template"] = template
+	}
+	if utc {
+		meta["utc"] = "1"
+	}
+}
+
 func updateSchedule(items []cron.Schedule, id string, req scheduleUpdateRequest, cfg config.Config) []cron.Schedule {
 	for i := range items {
 		if items[i].ID != id {
@@ -1936,6 +2279,22 @@ func updateSchedule(items []cron.Schedule, id string, req scheduleUpdateRequest,
 		}
 		if req.Prefix != "" {
 			items[i].Prefix = req.Prefix
+			if items[i].Meta != nil {
+				items[i].Meta["prefix"] = req.Prefix
+			}
+		}
+		if req.Template != nil || req.UTC != nil {
+			if items[i].Meta == nil {
+				items[i].Meta = map[string]string{}
+			}
+			naming := namingFromMeta(items[i].Meta, items[i].Prefix)
+			if req.Template != nil {
+				naming.Pattern = *req.Template
+			}
+			if req.UTC != nil {
+				naming.UTC = *req.UTC
+			}
+			setNamingMeta(items[i].Meta, naming.Pattern, naming.UTC)
 		}
 		if req.Enabled != nil {
 			items[i].Enabled = *req.Enabled
@@ -1969,11 +2328,28 @@ func updateReplication(items []cron.Schedule, id string, req replicationUpdateRe
 		}
 		if req.Target != "" {
 			target := strings.TrimSpace(req.Target)
-			if !zfs.ValidDatasetName(target) || !zfs.ValidateDataset(cfg, target) {
+			if !zfs.ValidReplicationTarget(target) {
 				return items, fmt.Errorf("invalid target dataset")
 			}
 			meta["target"] = target
 		}
+		sshOpts := replicationSSHFromMeta(meta)
+		if req.SSHPort != nil {
+			sshOpts.Port = *req.SSHPort
+		}
+		if req.Cipher != nil {
+			sshOpts.Cipher = strings.TrimSpace(*req.Cipher)
+		}
+		if req.Compress != nil {
+			sshOpts.Compress = *req.Compress
+		}
+		if req.RemoteSudo != nil {
+			sshOpts.RemoteSudo = *req.RemoteSudo
+		}
+		if err := validateSSHOptions(sshOpts); err != nil {
+			return items, err
+		}
+		setReplicationSSHMeta(meta, sshOpts)
 		if req.Prefix != "" {
 			prefix := strings.TrimSpace(req.Prefix)
 			if !zfs.ValidSnapshotToken(prefix) {
@@ -1982,6 +2358,19 @@ func updateReplication(items []cron.Schedule, id string, req replicationUpdateRe
 			meta["prefix"] = prefix
 			items[i].Prefix = prefix
 		}
+		if req.Template != nil || req.UTC != nil {
+			naming := namingFromMeta(meta, items[i].Prefix)
+			if req.Template != nil {
+				naming.Pattern = strings.TrimSpace(*req.Template)
+			}
+			if req.UTC != nil {
+				naming.UTC = *req.UTC
+			}
+			if err := naming.Validate(); err != nil {
+				return items, err
+			}
+			setNamingMeta(meta, naming.Pattern, naming.UTC)
+		}
 		if req.Retention != nil {
 			if *req.Retention < 0 {
 				return items, fmt.Errorf("retention must be >= 0")
@@ -1995,6 +2384,39 @@ func updateReplication(items []cron.Schedule, id string, req replicationUpdateRe
 		if req.Force != nil {
 			meta["force"] = boolToIntString(*req.Force)
 		}
+		if req.Reseed != nil {
+			meta["reseed"] = boolToIntString(*req.Reseed)
+		}
+		sendOpts := replicationOptionsFromMeta(meta)
+		for _, flag := range []struct {
+			val *bool
+			dst *bool
+		}{
+			{req.Raw, &sendOpts.Raw},
+			{req.Compressed, &sendOpts.Compressed},
+			{req.LargeBlock, &sendOpts.LargeBlock},
+			{req.Embedded, &sendOpts.Embedded},
+			{req.SendProps, &sendOpts.SendProps},
+		} {
+			if flag.val != nil {
+				*flag.dst = *flag.val
+			}
+		}
+		if req.RecvExclude != nil {
+			sendOpts.RecvExclude = cleanList(*req.RecvExclude)
+		}
+		if req.RecvProps != nil {
+			sendOpts.RecvProps = cleanList(*req.RecvProps)
+		}
+		if err := zfs.ValidateRecvOverrides(sendOpts.RecvExclude, sendOpts.RecvProps); err != nil {
+			return items, err
+		}
+		setReplicationSendMeta(meta, sendOpts)
+		limits, _, err := req.transferLimitsUpdate.apply(transferLimitsFromMeta(meta)).normalize()
+		if err != nil {
+			return items, err
+		}
+		setTransferLimitMeta(meta, limits)
 		if req.Enabled != nil {
 			items[i].Enabled = *req.Enabled
 		}
@@ -2053,6 +2475,11 @@ func updateRsync(items []cron.Schedule, id string, req rsyncUpdateRequest) ([]cr
 			}
 			meta["flags"] = flags
 		}
+		limits, _, err := req.transferLimitsUpdate.apply(transferLimitsFromMeta(meta)).normalize()
+		if err != nil {
+			return items, err
+		}
+		setTransferLimitMeta(meta, limits)
 		if req.Enabled != nil {
 			items[i].Enabled = *req.Enabled
 		}
@@ -2182,6 +2609,7 @@ var devicePartitionSuffix = regexp.MustCompile(`^(.*?)(p[0-9]+|s[0-9]+)$`)
 
 func baseDeviceName(name string) string {
 	value := strings.TrimSpace(strings.TrimPrefix(name, "/dev/"))
+	value = strings.TrimSuffix(value, ".eli")
 	if value == "" {
 		return value
 	}
@@ -26,17 +26,21 @@ type settingsAuth struct {
 }
 
 type settingsPayload struct {
-	Server      config.ServerConfig   `json:"server"`
-	Auth        settingsAuth          `json:"auth"`
-	Paths       config.Paths          `json:"paths"`
-	Samba       config.SambaConfig    `json:"samba"`
-	ZFS         config.ZFSConfig      `json:"zfs"`
-	Cron        config.CronConfig     `json:"cron"`
-	Terminal    config.TerminalConfig `json:"terminal"`
-	Limits      config.Limits         `json:"limits"`
-	Audit       config.AuditConfig    `json:"audit"`
-	AllowedCmds []string              `json:"allowed_cmds"`
-	BinaryPath  string                `json:"binary_path"`
+	Server      config.ServerConfig      `json:"server"`
+	Auth        settingsAuth             `json:"auth"`
+	Paths       config.Paths             `json:"paths"`
+	Samba       config.SambaConfig       `json:"samba"`
+	ZFS         config.ZFSConfig         `json:"zfs"`
+	Replication config.ReplicationConfig `json:"replication"`
+	Stats       config.StatsConfig       `json:"stats"`
+	GELI        config.GELIConfig        `json:"geli"`
+	Devd        config.DevdConfig        `json:"devd"`
+	Cron        config.CronConfig        `json:"cron"`
+	Terminal    config.TerminalConfig    `json:"terminal"`
+	Limits      config.Limits            `json:"limits"`
+	Audit       config.AuditConfig       `json:"audit"`
+	AllowedCmds []string                 `json:"allowed_cmds"`
+	BinaryPath  string                   `json:"binary_path"`
 }
 
 type settingsMeta struct {
@@ -245,6 +249,10 @@ func settingsPayloadFromConfig(cfg config.Config) settingsPayload {
 		Paths:       cfg.Paths,
 		Samba:       cfg.Samba,
 		ZFS:         cfg.ZFS,
+		Replication: cfg.Replication,
+		Stats:       cfg.Stats,
+		GELI:        cfg.GELI,
+		Devd:        cfg.Devd,
 		Cron:        cfg.Cron,
 		Terminal:    cfg.Terminal,
 		Limits:      cfg.Limits,
@@ -331,6 +339,10 @@ func (s *Server) applySettingsUpdate(req settingsPayload) (bool, error) {
 	updated.Paths = req.Paths
 	updated.Samba = req.Samba
 	updated.ZFS = req.ZFS
+	updated.Replication = req.Replication
+	updated.Stats = req.Stats
+	updated.GELI = req.GELI
+	updated.Devd = req.Devd
 	updated.Cron = req.Cron
 	updated.Terminal = req.Terminal
 	updated.Limits = req.Limits
@@ -360,6 +372,12 @@ func settingsNeedsRestart(before, after config.Config) bool {
 	if before.Auth.Username != after.Auth.Username {
 		return true
 	}
+	if before.Stats.DataDir != after.Stats.DataDir {
+		return true
+	}
+	if before.Devd.Socket != after.Devd.Socket {
+		return true
+	}
 	return false
 }
 
@@ -377,10 +395,26 @@ func normalizeSettings(req *settingsPayload) {
 	req.Paths.Sysctl = strings.TrimSpace(req.Paths.Sysctl)
 	req.Paths.Sysrc = strings.TrimSpace(req.Paths.Sysrc)
 	req.Paths.Shutdown = strings.TrimSpace(req.Paths.Shutdown)
+	req.Paths.SSH = strings.TrimSpace(req.Paths.SSH)
+	req.Paths.SSHKeygen = strings.TrimSpace(req.Paths.SSHKeygen)
+	req.Paths.Bectl = strings.TrimSpace(req.Paths.Bectl)
+	req.Paths.Smartctl = strings.TrimSpace(req.Paths.Smartctl)
+	req.Paths.Gpart = strings.TrimSpace(req.Paths.Gpart)
+	req.Paths.Mount = strings.TrimSpace(req.Paths.Mount)
+	req.Paths.GELI = strings.TrimSpace(req.Paths.GELI)
+	req.Paths.SwapCtl = strings.TrimSpace(req.Paths.SwapCtl)
+	req.Paths.Install = strings.TrimSpace(req.Paths.Install)
 	req.Samba.IncludeFile = strings.TrimSpace(req.Samba.IncludeFile)
 	req.Samba.ReloadArgs = cleanList(req.Samba.ReloadArgs)
 	req.Samba.TestparmArgs = cleanList(req.Samba.TestparmArgs)
 	req.ZFS.SnapshotPrefix = strings.TrimSpace(req.ZFS.SnapshotPrefix)
+	req.Replication.KeyFile = strings.TrimSpace(req.Replication.KeyFile)
+	req.Replication.KnownHostsFile = strings.TrimSpace(req.Replication.KnownHostsFile)
+	req.Replication.RemoteZFS = strings.TrimSpace(req.Replication.RemoteZFS)
+	req.Replication.HistoryFile = strings.TrimSpace(req.Replication.HistoryFile)
+	req.Stats.DataDir = strings.TrimSpace(req.Stats.DataDir)
+	req.GELI.KeyDir = strings.TrimSpace(req.GELI.KeyDir)
+	req.Devd.Socket = strings.TrimSpace(req.Devd.Socket)
 	req.Cron.CronFile = strings.TrimSpace(req.Cron.CronFile)
 	req.Cron.CronUser = strings.TrimSpace(req.Cron.CronUser)
 	req.Terminal.Aliases = cleanMap(req.Terminal.Aliases)
@@ -431,6 +465,33 @@ func validateSettings(req settingsPayload) error {
 	if err := validateAbsPath("paths.shutdown", req.Paths.Shutdown); err != nil {
 		return err
 	}
+	if err := validateAbsPath("paths.ssh", req.Paths.SSH); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.ssh_keygen", req.Paths.SSHKeygen); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.bectl", req.Paths.Bectl); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.smartctl", req.Paths.Smartctl); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.gpart", req.Paths.Gpart); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.mount", req.Paths.Mount); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.geli", req.Paths.GELI); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.swapctl", req.Paths.SwapCtl); err != nil {
+		return err
+	}
+	if err := validateAbsPath("paths.install", req.Paths.Install); err != nil {
+		return err
+	}
 	if req.Samba.IncludeFile == "" {
 		return errors.New("samba.include_file required")
 	}
@@ -443,6 +504,30 @@ func validateSettings(req settingsPayload) error {
 	if req.ZFS.SnapshotPrefix == "" {
 		return errors.New("zfs.snapshot_prefix required")
 	}
+	if err := validateAbsPath("replication.key_file", req.Replication.KeyFile); err != nil {
+		return err
+	}
+	if err := validateAbsPath("replication.known_hosts_file", req.Replication.KnownHostsFile); err != nil {
+		return err
+	}
+	if err := validateAbsPath("replication.remote_zfs", req.Replication.RemoteZFS); err != nil {
+		return err
+	}
+	if err := validateAbsPath("replication.history_file", req.Replication.HistoryFile); err != nil {
+		return err
+	}
+	if err := validateAbsPath("stats.data_dir", req.Stats.DataDir); err != nil {
+		return err
+	}
+	if req.Stats.IntervalSeconds < 10 {
+		return errors.New("stats.interval_seconds must be >= 10")
+	}
+	if err := validateAbsPath("geli.key_dir", req.GELI.KeyDir); err != nil {
+		return err
+	}
+	if err := validateAbsPath("devd.socket", req.Devd.Socket); err != nil {
+		return err
+	}
 	if err := validateAbsPath("cron.cron_file", req.Cron.CronFile); err != nil {
 		return err
 	}
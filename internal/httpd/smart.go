@@ -0,0 +1,177 @@
+// Package httpd caches SMART readings and reports drives that are close to failing.
+package httpd
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/drives"
+	"raidraccoon/internal/zfs"
+)
+
+// smartCacheTTL bounds how often page loads query each drive; smartctl is slow on
+// busy disks and SMART counters change slowly.
+const smartCacheTTL = 10 * time.Minute
+
+type driveHealthView struct {
+	drives.SMARTHealth
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// flaggedDrive is a drive whose SMART data predicts failure, with the pool it serves.
+type flaggedDrive struct {
+	Name    string   `json:"name"`
+	Pool    string   `json:"pool,omitempty"`
+	Health  string   `json:"pool_health,omitempty"`
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons"`
+}
+
+type dashboardDrivesSummary struct {
+	Count   int            `json:"count"`
+	Healthy int            `json:"healthy"`
+	Warn    int            `json:"warn"`
+	Fail    int            `json:"fail"`
+	Unknown int            `json:"unknown"`
+	Flagged []flaggedDrive `json:"flagged"`
+}
+
+// driveHealth returns SMART health for the named disks, reading those whose cached
+// result is older than smartCacheTTL, or all of them when refresh is set.
+func (s *Server) driveHealth(ctx context.Context, cfg config.Config, names []string, refresh bool) map[string]driveHealthView {
+	out := map[string]driveHealthView{}
+	for _, name := range names {
+		s.smartMu.Lock()
+		cached, ok := s.smartCache[name]
+		s.smartMu.Unlock()
+		if ok && !refresh && time.Since(cached.Checked) < smartCacheTTL {
+			out[name] = cached
+			continue
+		}
+		view := driveHealthView{Checked: time.Now()}
+		health, err := drives.ReadSMART(ctx, cfg, name)
+		if err != nil {
+			view.SMARTHealth = drives.SMARTHealth{Device: name, Level: drives.HealthUnknown}
+			view.Error = err.Error()
+		} else {
+			view.SMARTHealth = health
+		}
+		s.smartMu.Lock()
+		if s.smartCache == nil {
+			s.smartCache = map[string]driveHealthView{}
+		}
+		s.smartCache[name] = view
+		s.smartMu.Unlock()
+		out[name] = view
+	}
+	return out
+}
+
+// summarizeDriveHealth reads every drive, counts levels and lists flagged drives with
+// the pool they sit in, so a failing disk under an ONLINE pool is visible before the
+// pool degrades.
+func (s *Server) summarizeDriveHealth(ctx context.Context, cfg config.Config, refresh bool) (dashboardDrivesSummary, []driveHealthView, error) {
+	summary := dashboardDrivesSummary{Flagged: []flaggedDrive{}}
+	geomDrives, err := drives.ListDrives(ctx, cfg)
+	if err != nil {
+		return summary, nil, err
+	}
+	names := make([]string, 0, len(geomDrives))
+	for _, drive := range geomDrives {
+		names = append(names, drive.Name)
+	}
+	health := s.driveHealth(ctx, cfg, names, refresh)
+	poolOf := drivePools(ctx, cfg)
+	poolHealth := map[string]string{}
+	if pools, err := zfs.ListPools(ctx, cfg); err == nil {
+		for _, pool := range pools {
+			poolHealth[pool.Name] = pool.Health
+		}
+	}
+	items := make([]driveHealthView, 0, len(names))
+	for _, name := range names {
+		h := health[name]
+		items = append(items, h)
+		summary.Count++
+		switch h.Level {
+		case drives.HealthOK:
+			summary.Healthy++
+			continue
+		case drives.HealthWarn:
+			summary.Warn++
+		case drives.HealthFail:
+			summary.Fail++
+		default:
+			summary.Unknown++
+			continue
+		}
+		pool := poolOf[name]
+		summary.Flagged = append(summary.Flagged, flaggedDrive{Name: name, Pool: pool, Health: poolHealth[pool], Level: h.Level, Reasons: h.Reasons})
+	}
+	sort.SliceStable(summary.Flagged, func(i, j int) bool {
+		return summary.Flagged[i].Level == drives.HealthFail && summary.Flagged[j].Level != drives.HealthFail
+	})
+	return summary, items, nil
+}
+
+// drivePools maps disk names to the pool using them.
+func drivePools(ctx context.Context, cfg config.Config) map[string]string {
+	out := map[string]string{}
+	providers, err := poolProviders(ctx, cfg)
+	if err != nil {
+		return out
+	}
+	for provider, pool := range providers {
+		out[baseDeviceName(provider)] = pool
+	}
+	return out
+}
+
+// poolProviders maps the providers of imported pools' vdevs (ada0p3, da1) to their
+// pool, resolving gpt/, gptid/ and diskid/ labels. GELI vdevs (ada0p3.eli) count as
+// their underlying provider.
+func poolProviders(ctx context.Context, cfg config.Config) (map[string]string, error) {
+	devices, err := zfs.ListPoolDevices(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	labels, _ := drives.ListLabels(ctx, cfg)
+	out := map[string]string{}
+	for _, dev := range devices {
+		name := strings.TrimSuffix(strings.TrimPrefix(dev.Name, "/dev/"), ".eli")
+		if provider, ok := labels[name]; ok {
+			name = provider
+		}
+		out[name] = dev.Pool
+	}
+	return out, nil
+}
+
+// handleDriveHealth reads SMART health now, for ?device= or every drive.
+func (s *Server) handleDriveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	if device := strings.TrimSpace(r.URL.Query().Get("device")); device != "" {
+		if !drives.ValidDiskName(device) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid device"})
+			return
+		}
+		view := s.driveHealth(r.Context(), cfg, []string{device}, true)[device]
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: view})
+		return
+	}
+	summary, items, err := s.summarizeDriveHealth(r.Context(), cfg, true)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read drive health failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": items, "summary": summary}})
+}
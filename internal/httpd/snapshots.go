@@ -0,0 +1,155 @@
+// Package httpd previews and destroys snapshot selections in bulk.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/zfs"
+)
+
+// snapshotSelection names snapshots of one dataset either as a list, as a from/to range,
+// or as a raw destroy spec (`pool/ds@a%b`, `pool/ds@a,b`). Expected carries back the
+// snapshots of the preview the user confirmed.
+type snapshotSelection struct {
+	Spec      string   `json:"spec"`
+	Dataset   string   `json:"dataset"`
+	Snapshots []string `json:"snapshots"`
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Recursive bool     `json:"recursive"`
+	Confirm   bool     `json:"confirm"`
+	Expected  []string `json:"expected"`
+}
+
+func (sel snapshotSelection) spec() (string, error) {
+	dataset := strings.TrimSpace(sel.Dataset)
+	names := []string{}
+	from, to := strings.TrimSpace(sel.From), strings.TrimSpace(sel.To)
+	if raw := strings.TrimSpace(sel.Spec); raw != "" {
+		ds, rest, ok := strings.Cut(raw, "@")
+		if !ok || rest == "" {
+			return "", fmt.Errorf("spec must look like pool/ds@a%%b or pool/ds@a,b")
+		}
+		dataset = ds
+		if start, end, isRange := strings.Cut(rest, "%"); isRange {
+			from, to = start, end
+		} else {
+			names = strings.Split(rest, ",")
+		}
+	} else {
+		for _, name := range sel.Snapshots {
+			name = strings.TrimSpace(name)
+			// Accept full names from listings as long as they belong to the dataset.
+			if ds, short, ok := strings.Cut(name, "@"); ok {
+				if ds != dataset {
+					return "", fmt.Errorf("snapshot %s is not in %s", name, dataset)
+				}
+				name = short
+			}
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return zfs.SnapshotSpec(dataset, names, from, to)
+}
+
+// handleZFSSnapshotPreview reports what a selection would destroy and how much space
+// comes back, using `zfs destroy -nvp`.
+func (s *Server) handleZFSSnapshotPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req snapshotSelection
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	spec, err := req.spec()
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+		return
+	}
+	preview, err := zfs.PreviewDestroy(r.Context(), s.snapshotConfig(), spec, req.Recursive)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "destroy preview failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: preview})
+}
+
+// handleZFSSnapshotDestroy destroys a whole selection with one `zfs destroy` call. It
+// refuses when the selection no longer matches the confirmed preview, e.g. because a
+// range now covers snapshots taken since.
+func (s *Server) handleZFSSnapshotDestroy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req snapshotSelection
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if !req.Confirm {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+		return
+	}
+	spec, err := req.spec()
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+		return
+	}
+	cfg := s.snapshotConfig()
+	preview, err := zfs.PreviewDestroy(r.Context(), cfg, spec, req.Recursive)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "destroy preview failed", Details: err.Error()})
+		return
+	}
+	if len(req.Expected) == 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "expected snapshots required; preview the selection first"})
+		return
+	}
+	if !sameSnapshots(preview.Snapshots, req.Expected) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{
+			Ok:      false,
+			Error:   "selection changed since the preview; preview it again",
+			Details: fmt.Sprintf("preview now destroys %d snapshot(s), %d were confirmed", len(preview.Snapshots), len(req.Expected)),
+		})
+		return
+	}
+	res, err := zfs.DestroySnapshots(r.Context(), cfg, spec, req.Recursive)
+	command := fmt.Sprintf("%s destroy %s", cfg.Paths.ZFS, spec)
+	if req.Recursive {
+		command = fmt.Sprintf("%s destroy -r %s", cfg.Paths.ZFS, spec)
+	}
+	s.audit.Log(auth.UserFromContext(r.Context()), "zfs.destroy_snapshots", command, res.ExitCode)
+	if err != nil || res.ExitCode != 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "snapshot destroy failed", Details: resultDetails(res, err)})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{
+		"spec":      spec,
+		"destroyed": preview.Snapshots,
+		"reclaim":   preview.Reclaim,
+	}})
+}
+
+// sameSnapshots reports whether a and b name the same snapshots, in any order.
+func sameSnapshots(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+// Package httpd handles the background I/O statistics collector and the ARC/iostat APIs.
+package httpd
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/tsdb"
+	"raidraccoon/internal/zfs"
+)
+
+// statsRanges are the chart ranges accepted by /api/zfs/iostat.
+var statsRanges = map[string]time.Duration{
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+type ioStatSeries struct {
+	Name   string       `json:"name"`
+	Vdev   bool         `json:"vdev"`
+	Points []tsdb.Point `json:"points"`
+}
+
+type ioStatHistory struct {
+	Pool        string         `json:"pool"`
+	Range       string         `json:"range"`
+	Tier        string         `json:"tier"`
+	StepSeconds int64          `json:"step_seconds"`
+	Series      []ioStatSeries `json:"series"`
+}
+
+// startStatsCollector opens the stats store and samples `zpool iostat` in the
+// background. Each sample blocks for the configured interval, so consecutive samples
+// cover the timeline without gaps; samples that return early are padded to it.
+func (s *Server) startStatsCollector() {
+	store, err := tsdb.Open(s.cfg.Stats.DataDir, tsdb.DefaultTiers)
+	if err != nil {
+		s.setStatsResult(nil, err)
+		return
+	}
+	s.statsStore = store
+	go func() {
+		for {
+			cfg := s.snapshotConfig()
+			interval := time.Duration(max(cfg.Stats.IntervalSeconds, 1)) * time.Second
+			started := time.Now()
+			samples, err := zfs.SampleIOStats(context.Background(), cfg, cfg.Stats.IntervalSeconds)
+			s.setStatsResult(samples, err)
+			// Errors and hosts without pools return at once; wait out the rest of the
+			// interval rather than spin.
+			if elapsed := time.Since(started); elapsed < interval {
+				time.Sleep(interval - elapsed)
+			}
+			if err != nil {
+				continue
+			}
+			now := time.Now()
+			for _, sample := range samples {
+				if err := store.Add(ioStatSeriesName(sample), now, sample.Values()); err != nil {
+					s.setStatsResult(samples, err)
+					break
+				}
+			}
+		}
+	}()
+}
+
+func (s *Server) setStatsResult(samples []zfs.IOStat, err error) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	if err != nil {
+		s.statsErr = err.Error()
+		return
+	}
+	s.statsErr = ""
+	s.statsLatest = samples
+	s.statsUpdated = time.Now()
+}
+
+// ioStatSeriesName keys pools as "tank" and vdevs as "tank/ada0". Pool names cannot
+// contain '/', so the first slash always separates pool and vdev.
+func ioStatSeriesName(sample zfs.IOStat) string {
+	if !sample.Vdev {
+		return sample.Pool
+	}
+	return sample.Pool + "/" + sample.Name
+}
+
+func (s *Server) handleZFSIOStat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	s.statsMu.Lock()
+	latest := append([]zfs.IOStat{}, s.statsLatest...)
+	updated := s.statsUpdated
+	statsErr := s.statsErr
+	s.statsMu.Unlock()
+	if s.statsStore == nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "stats unavailable", Details: statsErr})
+		return
+	}
+
+	pool := strings.TrimSpace(r.URL.Query().Get("pool"))
+	data := map[string]any{
+		"interval_seconds": s.snapshotConfig().Stats.IntervalSeconds,
+		"pools":            ioStatPools(s.statsStore.Series()),
+	}
+	if !updated.IsZero() {
+		data["updated"] = updated.UTC().Format(time.RFC3339)
+	}
+	if statsErr != "" {
+		data["error"] = statsErr
+	}
+	if pool == "" {
+		data["latest"] = latest
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+		return
+	}
+	if !zfs.ValidPoolName(pool) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool"})
+		return
+	}
+	rangeName := r.URL.Query().Get("range")
+	if rangeName == "" {
+		rangeName = "1h"
+	}
+	span, ok := statsRanges[rangeName]
+	if !ok {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid range"})
+		return
+	}
+	to := time.Now()
+	history := ioStatHistory{Pool: pool, Range: rangeName, Series: []ioStatSeries{}}
+	for _, name := range s.statsStore.Series() {
+		if name != pool && !strings.HasPrefix(name, pool+"/") {
+			continue
+		}
+		tier, points := s.statsStore.Query(name, to.Add(-span), to)
+		history.Tier = tier.Name
+		history.StepSeconds = int64(tier.Step / time.Second)
+		entry := ioStatSeries{Name: name, Points: points}
+		if name != pool {
+			entry.Name = strings.TrimPrefix(name, pool+"/")
+			entry.Vdev = true
+		}
+		history.Series = append(history.Series, entry)
+	}
+	poolLatest := []zfs.IOStat{}
+	for _, row := range latest {
+		if row.Pool == pool {
+			poolLatest = append(poolLatest, row)
+		}
+	}
+	data["history"] = history
+	data["latest"] = poolLatest
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: data})
+}
+
+func ioStatPools(series []string) []string {
+	pools := []string{}
+	for _, name := range series {
+		if !strings.Contains(name, "/") {
+			pools = append(pools, name)
+		}
+	}
+	sort.Strings(pools)
+	return pools
+}
+
+// ioStatDashboard summarises the latest sample and the last hour of combined pool
+// bandwidth for the dashboard widget.
+func (s *Server) ioStatDashboard() (dashboardIOStatSummary, string) {
+	s.statsMu.Lock()
+	latest := append([]zfs.IOStat{}, s.statsLatest...)
+	statsErr := s.statsErr
+	s.statsMu.Unlock()
+	summary := dashboardIOStatSummary{History: []float64{}}
+	if s.statsStore == nil {
+		if statsErr == "" {
+			statsErr = "stats unavailable"
+		}
+		return summary, statsErr
+	}
+	var busiest float64
+	for _, row := range latest {
+		if row.Vdev {
+			continue
+		}
+		summary.Pools++
+		summary.ReadOps += row.ReadOps
+		summary.WriteOps += row.WriteOps
+		summary.ReadBytes += row.ReadBytes
+		summary.WriteBytes += row.WriteBytes
+		if total := row.ReadBytes + row.WriteBytes; total >= busiest {
+			busiest = total
+			summary.Busiest = row.Pool
+		}
+	}
+	to := time.Now()
+	buckets := map[int64]float64{}
+	for _, pool := range ioStatPools(s.statsStore.Series()) {
+		_, points := s.statsStore.Query(pool, to.Add(-time.Hour), to)
+		for _, p := range points {
+			buckets[p.Time.Unix()] += p.Values["read_bytes"] + p.Values["write_bytes"]
+		}
+	}
+	keys := make([]int64, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, key := range keys {
+		summary.History = append(summary.History, buckets[key])
+	}
+	return summary, statsErr
+}
+
+func (s *Server) handleZFSARC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	stats, err := zfs.ReadARCStats(r.Context(), s.snapshotConfig())
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "arcstats failed", Details: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: stats})
+}
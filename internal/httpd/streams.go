@@ -0,0 +1,161 @@
+// Package httpd runs stream file exports and imports as tracked jobs.
+package httpd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/zfs"
+)
+
+type streamExportRequest struct {
+	Snapshot  string `json:"snapshot"`
+	Base      string `json:"base"`
+	Dir       string `json:"dir"`
+	Raw       bool   `json:"raw"`
+	Compress  bool   `json:"compress"`
+	Recursive bool   `json:"recursive"`
+}
+
+type streamImportRequest struct {
+	Manifest   string `json:"manifest"`
+	Target     string `json:"target"`
+	Force      bool   `json:"force"`
+	VerifyOnly bool   `json:"verify_only"`
+	Confirm    bool   `json:"confirm"`
+}
+
+type streamManifestView struct {
+	Path string `json:"path"`
+	zfs.StreamManifest
+}
+
+// handleZFSStreams lists the stream manifests in ?dir=.
+func (s *Server) handleZFSStreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	dir := strings.TrimSpace(r.URL.Query().Get("dir"))
+	if !filepath.IsAbs(dir) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "dir must be an absolute path"})
+		return
+	}
+	if _, err := os.Stat(dir); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read dir failed", Details: err.Error()})
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(filepath.Clean(dir), "*.manifest.json"))
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "list manifests failed", Details: err.Error()})
+		return
+	}
+	sort.Strings(paths)
+	items := []streamManifestView{}
+	for _, path := range paths {
+		m, err := zfs.ReadStreamManifest(path)
+		if err != nil {
+			continue
+		}
+		items = append(items, streamManifestView{Path: path, StreamManifest: m})
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"dir": dir, "items": items}})
+}
+
+// handleZFSStreamExport starts a job that writes a send stream into a file and records
+// it in the directory's manifest.
+func (s *Server) handleZFSStreamExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req streamExportRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	cfg := s.snapshotConfig()
+	opts := zfs.StreamExportOptions{
+		Snapshot:  strings.TrimSpace(req.Snapshot),
+		Base:      strings.TrimSpace(req.Base),
+		Dir:       strings.TrimSpace(req.Dir),
+		Raw:       req.Raw,
+		Compress:  req.Compress,
+		Recursive: req.Recursive,
+	}
+	dataset, _, ok := strings.Cut(opts.Snapshot, "@")
+	if !ok || !zfs.ValidateDataset(cfg, dataset) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid snapshot"})
+		return
+	}
+	if !filepath.IsAbs(opts.Dir) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "dir must be an absolute path"})
+		return
+	}
+	job := s.jobs.StartFunc(auth.UserFromContext(r.Context()), "zfs.stream_export", "stream-export", []string{opts.Snapshot, opts.Dir}, func(ctx context.Context, job *Job) (int, error) {
+		job.Logf("exporting %s to %s", opts.Snapshot, opts.Dir)
+		opts.Progress = job.SetProgress
+		entry, err := zfs.ExportStream(ctx, cfg, opts)
+		if err != nil {
+			return 1, err
+		}
+		job.Logf("wrote %s (%d bytes, sha256 %s)", entry.File, entry.Size, entry.SHA256)
+		job.Logf("manifest %s", zfs.StreamManifestPath(opts.Dir, dataset))
+		return 0, nil
+	})
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"job_id": job.ID}})
+}
+
+// handleZFSStreamImport starts a job that verifies a manifest's streams and receives them.
+func (s *Server) handleZFSStreamImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req streamImportRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	cfg := s.snapshotConfig()
+	opts := zfs.StreamImportOptions{
+		Manifest:   strings.TrimSpace(req.Manifest),
+		Target:     strings.TrimSpace(req.Target),
+		Force:      req.Force,
+		VerifyOnly: req.VerifyOnly,
+	}
+	if !filepath.IsAbs(opts.Manifest) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "manifest must be an absolute path"})
+		return
+	}
+	if opts.Target != "" && !zfs.ValidateDataset(cfg, opts.Target) {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid target dataset"})
+		return
+	}
+	if !opts.VerifyOnly && !req.Confirm {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+		return
+	}
+	action, label := "zfs.stream_import", "stream-import"
+	if opts.VerifyOnly {
+		action, label = "zfs.stream_verify", "stream-verify"
+	}
+	job := s.jobs.StartFunc(auth.UserFromContext(r.Context()), action, label, []string{opts.Manifest, opts.Target}, func(ctx context.Context, job *Job) (int, error) {
+		opts.Progress = job.SetProgress
+		opts.Log = func(line string) { job.Logf("%s", line) }
+		received, err := zfs.ImportStreams(ctx, cfg, opts)
+		if err != nil {
+			return 1, err
+		}
+		if opts.VerifyOnly {
+			job.Logf("all streams match the manifest")
+		} else {
+			job.Logf("received %d stream(s)", len(received))
+		}
+		return 0, nil
+	})
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]string{"job_id": job.ID}})
+}
@@ -0,0 +1,225 @@
+// Package httpd serves TRIM/initialize controls and periodic trim schedules.
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"raidraccoon/internal/auth"
+	"raidraccoon/internal/cron"
+	"raidraccoon/internal/execwrap"
+	"raidraccoon/internal/zfs"
+)
+
+type maintenanceRequest struct {
+	Pool    string   `json:"pool"`
+	Action  string   `json:"action"`
+	Devices []string `json:"devices"`
+	Rate    string   `json:"rate"`
+	Confirm bool     `json:"confirm"`
+}
+
+func (req *maintenanceRequest) validate() error {
+	req.Pool = strings.TrimSpace(req.Pool)
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	req.Rate = strings.TrimSpace(req.Rate)
+	if !zfs.ValidPoolName(req.Pool) {
+		return fmt.Errorf("invalid pool name")
+	}
+	if !zfs.ValidMaintenanceAction(req.Action) {
+		return fmt.Errorf("action must be start, cancel or suspend")
+	}
+	for _, dev := range req.Devices {
+		if !zfs.ValidDeviceName(dev) {
+			return fmt.Errorf("invalid device %q", dev)
+		}
+	}
+	if req.Rate != "" && !zfs.ValidTrimRate(req.Rate) {
+		return fmt.Errorf("invalid rate (use e.g. 100M)")
+	}
+	return nil
+}
+
+// handleZFSTrim reports trim/initialize progress (GET), runs `zpool trim` (POST) and
+// toggles the autotrim property (PUT).
+func (s *Server) handleZFSTrim(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		pool := strings.TrimSpace(r.URL.Query().Get("pool"))
+		if !zfs.ValidPoolName(pool) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+			return
+		}
+		status, err := zfs.ReadPoolMaintenance(r.Context(), s.snapshotConfig(), pool)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "trim status failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: status})
+	case http.MethodPost:
+		var req maintenanceRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		if err := req.validate(); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+			return
+		}
+		cfg := s.snapshotConfig()
+		res, err := zfs.TrimPool(r.Context(), cfg, req.Pool, req.Action, req.Devices, req.Rate)
+		s.writeMaintenanceResult(w, r, "zfs.trim", cfg.Paths.ZPool, req, res, err)
+	case http.MethodPut:
+		var req struct {
+			Pool     string `json:"pool"`
+			Autotrim bool   `json:"autotrim"`
+		}
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		if !zfs.ValidPoolName(req.Pool) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+			return
+		}
+		value := "off"
+		if req.Autotrim {
+			value = "on"
+		}
+		cfg := s.snapshotConfig()
+		res, err := zfs.SetPoolProperty(r.Context(), cfg, req.Pool, "autotrim", value)
+		s.audit.Log(auth.UserFromContext(r.Context()), "zfs.pool_set", fmt.Sprintf("%s set autotrim=%s %s", cfg.Paths.ZPool, value, req.Pool), res.ExitCode)
+		if err != nil || res.ExitCode != 0 {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "autotrim update failed", Details: resultDetails(res, err)})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"pool": req.Pool, "autotrim": req.Autotrim}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
+
+// handleZFSInitialize runs `zpool initialize`. Starting requires confirmation because it
+// writes to every unallocated block of the selected vdevs.
+func (s *Server) handleZFSInitialize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+		return
+	}
+	var req maintenanceRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: err.Error()})
+		return
+	}
+	if req.Action == "start" && !req.Confirm {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "confirmation required"})
+		return
+	}
+	cfg := s.snapshotConfig()
+	res, err := zfs.InitializePool(r.Context(), cfg, req.Pool, req.Action, req.Devices)
+	s.writeMaintenanceResult(w, r, "zfs.initialize", cfg.Paths.ZPool, req, res, err)
+}
+
+func (s *Server) writeMaintenanceResult(w http.ResponseWriter, r *http.Request, action, zpool string, req maintenanceRequest, res execwrap.Result, err error) {
+	cmd := strings.TrimSpace(fmt.Sprintf("%s %s %s %s %s", zpool, strings.TrimPrefix(action, "zfs."), req.Action, req.Pool, strings.Join(req.Devices, " ")))
+	s.audit.Log(auth.UserFromContext(r.Context()), action, cmd, res.ExitCode)
+	if err != nil || res.ExitCode != 0 {
+		s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: strings.TrimPrefix(action, "zfs.") + " failed", Details: resultDetails(res, err)})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"pool": req.Pool, "action": req.Action, "devices": req.Devices}})
+}
+
+func resultDetails(res execwrap.Result, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return res.Stderr
+}
+
+// handleTrimSchedules lists and creates cron schedules of type "trim", which run
+// `raidraccoon trim --pool <pool>`. Toggle, edit and delete go through
+// /api/zfs/schedules/<id> like snapshot schedules.
+func (s *Server) handleTrimSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
+			return
+		}
+		type trimView struct {
+			ID       string        `json:"id"`
+			Pool     string        `json:"pool"`
+			Rate     string        `json:"rate"`
+			Enabled  bool          `json:"enabled"`
+			Schedule cron.CronSpec `json:"schedule"`
+			Cron     string        `json:"cron"`
+		}
+		views := []trimView{}
+		for _, item := range file.Items {
+			if scheduleKind(item) != "trim" {
+				continue
+			}
+			meta := item.Meta
+			if meta == nil {
+				meta = map[string]string{}
+			}
+			views = append(views, trimView{
+				ID:       item.ID,
+				Pool:     meta["pool"],
+				Rate:     meta["rate"],
+				Enabled:  item.Enabled,
+				Schedule: item.Cron,
+				Cron:     item.RawCron,
+			})
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"items": views, "updated": file.Updated}})
+	case http.MethodPost:
+		var req struct {
+			Pool     string        `json:"pool"`
+			Rate     string        `json:"rate"`
+			Enabled  bool          `json:"enabled"`
+			Schedule cron.CronSpec `json:"schedule"`
+		}
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		req.Pool = strings.TrimSpace(req.Pool)
+		req.Rate = strings.TrimSpace(req.Rate)
+		if !zfs.ValidPoolName(req.Pool) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid pool name"})
+			return
+		}
+		if req.Rate != "" && !zfs.ValidTrimRate(req.Rate) {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "invalid rate (use e.g. 100M)"})
+			return
+		}
+		file, err := cron.Load(s.cfg.Cron.CronFile, s.cfg.Cron.CronUser)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "read cron failed", Details: err.Error()})
+			return
+		}
+		item := cron.Schedule{
+			Type:    "trim",
+			Enabled: req.Enabled,
+			Cron:    normalizeCron(req.Schedule),
+			Meta: map[string]string{
+				"type": "trim",
+				"pool": req.Pool,
+				"rate": req.Rate,
+			},
+		}
+		file.Items = cron.Upsert(file.Items, item)
+		updated, err := s.saveCronFile(file)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, apiEnvelope{Ok: false, Error: "save cron failed", Details: err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, apiEnvelope{Ok: true, Data: map[string]any{"updated": updated}})
+	default:
+		s.writeJSON(w, http.StatusMethodNotAllowed, apiEnvelope{Ok: false, Error: "method not allowed"})
+	}
+}
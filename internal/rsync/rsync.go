@@ -3,10 +3,13 @@ package rsync
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"raidraccoon/internal/config"
 	"raidraccoon/internal/execwrap"
+	"raidraccoon/internal/window"
 )
 
 func Run(ctx context.Context, cfg config.Config, source, target string, flags []string) (execwrap.Result, error) {
@@ -21,6 +24,62 @@ func Run(ctx context.Context, cfg config.Config, source, target string, flags []
 	return execwrap.Run(ctx, cfg.Paths.Rsync, args, nil, cfg.Limits)
 }
 
+// BandwidthFlag returns the rsync flag for a KiB/s limit, or "" when unlimited.
+func BandwidthFlag(kbps int64) string {
+	if kbps <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("--bwlimit=%d", kbps)
+}
+
+func hasBandwidthLimit(flags []string) bool {
+	for _, flag := range flags {
+		if strings.HasPrefix(strings.TrimSpace(flag), "--bwlimit") {
+			return true
+		}
+	}
+	return false
+}
+
+// RunWindowed runs rsync inside the policy's time windows. When a window closes mid-run
+// rsync is stopped; with the pause policy it is restarted (with --partial, so transferred
+// data is kept) once the next window opens.
+func RunWindowed(ctx context.Context, cfg config.Config, source, target string, flags []string, policy window.Policy) (execwrap.Result, error) {
+	if policy.Enabled() || hasBandwidthLimit(flags) {
+		// Throttled or paused copies outlast MaxRuntimeSeconds; the window and ctx bound them.
+		cfg.Limits = execwrap.NoRuntimeLimit(cfg.Limits)
+	}
+	if !policy.Enabled() {
+		return Run(ctx, cfg, source, target, flags)
+	}
+	if policy.Pauses() {
+		flags = append(append([]string{}, flags...), "--partial")
+	}
+	for {
+		if err := policy.Gate(ctx); err != nil {
+			return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		if closeAt := policy.Windows.NextClose(time.Now()); !closeAt.IsZero() {
+			cancel()
+			runCtx, cancel = context.WithDeadline(ctx, closeAt)
+		}
+		res, err := Run(runCtx, cfg, source, target, flags)
+		closed := runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if !closed {
+			return res, err
+		}
+		if !policy.Pauses() {
+			res.ExitCode = 1
+			res.Stderr = strings.TrimSpace(res.Stderr + "\ncancelled: allowed time window closed")
+			return res, fmt.Errorf("allowed time window closed")
+		}
+		// Waiting for the next window replaces the skip policy after the first start.
+		policy.Before = window.BeforeWait
+	}
+}
+
 // SplitFlags parses comma-separated rsync flags from config/UI input.
 func SplitFlags(raw string) []string {
 	raw = strings.TrimSpace(raw)
@@ -0,0 +1,354 @@
+// Package samba parses, validates and writes per-share access settings, checking names
+// against the Samba users and the system account and group databases.
+package samba
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GroupFile is the system group database offered for share access.
+	GroupFile = "/etc/group"
+	// PasswdFile is the system account database force user is checked against.
+	PasswdFile = "/etc/passwd"
+)
+
+// ShareAccess holds the per-share access parameters. User lists take user names and
+// groups prefixed with @ (or + / &, as smb.conf allows) and %-substitutions such as %S.
+type ShareAccess struct {
+	ValidUsers    []string `json:"valid_users"`
+	InvalidUsers  []string `json:"invalid_users"`
+	WriteList     []string `json:"write_list"`
+	ReadList      []string `json:"read_list"`
+	AdminUsers    []string `json:"admin_users"`
+	ForceUser     string   `json:"force_user"`
+	ForceGroup    string   `json:"force_group"`
+	CreateMask    string   `json:"create_mask"`
+	DirectoryMask string   `json:"directory_mask"`
+}
+
+// Account is one entry of the system account database.
+type Account struct {
+	Name string `json:"name"`
+	UID  int    `json:"uid"`
+}
+
+// Group is one entry of the system group database.
+type Group struct {
+	Name    string   `json:"name"`
+	GID     int      `json:"gid"`
+	Members []string `json:"members"`
+}
+
+var (
+	accessNamePattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,31}\$?$`)
+	accessSubstPattern = regexp.MustCompile(`^%[A-Za-z]$`)
+	accessMaskPattern  = regexp.MustCompile(`^[0-7]{3,4}$`)
+)
+
+// accessKeys are the smb.conf keys parsed into ShareAccess, synonyms included.
+var accessKeys = []string{
+	"valid users",
+	"invalid users",
+	"write list",
+	"read list",
+	"admin users",
+	"force user",
+	"force group",
+	"group",
+	"create mask",
+	"create mode",
+	"directory mask",
+	"directory mode",
+}
+
+// ListGroups parses a group(5) file such as GroupFile, sorted by name.
+func ListGroups(path string) ([]Group, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	groups := []Group{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		group := Group{Name: fields[0], GID: gid, Members: []string{}}
+		if len(fields) > 3 && fields[3] != "" {
+			group.Members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, group)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// ListAccounts parses a passwd(5) file such as PasswdFile, sorted by name.
+func ListAccounts(path string) ([]Account, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	accounts := []Account{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		accounts = append(accounts, Account{Name: fields[0], UID: uid})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+// ValidateAccess trims and de-duplicates the entries of a in place, then checks their
+// syntax and that every listed user is in users (Samba users), force user in accounts
+// (UNIX accounts) and every group in groups.
+func ValidateAccess(a *ShareAccess, users, accounts, groups []string) error {
+	knownUsers := map[string]bool{}
+	for _, name := range users {
+		knownUsers[name] = true
+	}
+	knownAccounts := map[string]bool{}
+	for _, name := range accounts {
+		knownAccounts[name] = true
+	}
+	knownGroups := map[string]bool{}
+	for _, name := range groups {
+		knownGroups[name] = true
+	}
+	checkList := func(key string, list *[]string) error {
+		out := []string{}
+		seen := map[string]bool{}
+		for _, entry := range *list {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || seen[entry] {
+				continue
+			}
+			seen[entry] = true
+			if accessSubstPattern.MatchString(entry) {
+				out = append(out, entry)
+				continue
+			}
+			if name := strings.TrimLeft(entry, "@+&"); name != entry {
+				if len(entry)-len(name) > 2 || !accessNamePattern.MatchString(name) {
+					return fmt.Errorf("%s: invalid group %q", key, entry)
+				}
+				if !knownGroups[name] {
+					return fmt.Errorf("%s: unknown group %q", key, name)
+				}
+			} else {
+				if !accessNamePattern.MatchString(entry) {
+					return fmt.Errorf("%s: invalid user %q", key, entry)
+				}
+				if !knownUsers[entry] {
+					return fmt.Errorf("%s: unknown user %q", key, entry)
+				}
+			}
+			out = append(out, entry)
+		}
+		*list = out
+		return nil
+	}
+	lists := []struct {
+		key  string
+		list *[]string
+	}{
+		{"valid users", &a.ValidUsers},
+		{"invalid users", &a.InvalidUsers},
+		{"write list", &a.WriteList},
+		{"read list", &a.ReadList},
+		{"admin users", &a.AdminUsers},
+	}
+	for _, item := range lists {
+		if err := checkList(item.key, item.list); err != nil {
+			return err
+		}
+	}
+	for _, entry := range a.InvalidUsers {
+		for _, valid := range a.ValidUsers {
+			if entry == valid {
+				return fmt.Errorf("%s is in both valid users and invalid users", entry)
+			}
+		}
+	}
+	a.ForceUser = strings.TrimSpace(a.ForceUser)
+	if a.ForceUser != "" && (!accessNamePattern.MatchString(a.ForceUser) || !knownAccounts[a.ForceUser]) {
+		return fmt.Errorf("force user: %q is not a UNIX account", a.ForceUser)
+	}
+	a.ForceGroup = strings.TrimSpace(a.ForceGroup)
+	if group := strings.TrimPrefix(a.ForceGroup, "+"); group != "" && (!accessNamePattern.MatchString(group) || !knownGroups[group]) {
+		return fmt.Errorf("force group: unknown group %q", group)
+	}
+	a.CreateMask = strings.TrimSpace(a.CreateMask)
+	if a.CreateMask != "" && !accessMaskPattern.MatchString(a.CreateMask) {
+		return fmt.Errorf("create mask must be an octal mode such as 0664")
+	}
+	a.DirectoryMask = strings.TrimSpace(a.DirectoryMask)
+	if a.DirectoryMask != "" && !accessMaskPattern.MatchString(a.DirectoryMask) {
+		return fmt.Errorf("directory mask must be an octal mode such as 0775")
+	}
+	return nil
+}
+
+func parseAccess(params map[string]string) *ShareAccess {
+	return &ShareAccess{
+		ValidUsers:    splitList(pickParam(params, "valid users")),
+		InvalidUsers:  splitList(pickParam(params, "invalid users")),
+		WriteList:     splitList(pickParam(params, "write list")),
+		ReadList:      splitList(pickParam(params, "read list")),
+		AdminUsers:    splitList(pickParam(params, "admin users")),
+		ForceUser:     pickParam(params, "force user"),
+		ForceGroup:    fallback(pickParam(params, "force group"), pickParam(params, "group")),
+		CreateMask:    fallback(pickParam(params, "create mask"), pickParam(params, "create mode")),
+		DirectoryMask: fallback(pickParam(params, "directory mask"), pickParam(params, "directory mode")),
+	}
+}
+
+// FoldAccessParams moves access keys sent in share.Params into share.Access so they are
+// validated and written like the access fields instead of being dropped. They apply on
+// top of share.Access or, when that is nil, of the access of the saved share with the
+// same name in shares.
+func FoldAccessParams(shares []Share, share *Share) {
+	found := map[string]string{}
+	for key, val := range share.Params {
+		if isAccessKey(key) {
+			found[key] = val
+			delete(share.Params, key)
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	access := ShareAccess{}
+	if share.Access != nil {
+		access = *share.Access
+	} else {
+		for _, existing := range shares {
+			if existing.Name == share.Name && existing.Access != nil {
+				access = *existing.Access
+			}
+		}
+	}
+	for key, val := range found {
+		setAccessParam(&access, key, val)
+	}
+	share.Access = &access
+}
+
+func isAccessKey(key string) bool {
+	for _, access := range accessKeys {
+		if strings.EqualFold(access, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func setAccessParam(a *ShareAccess, key, val string) {
+	switch strings.ToLower(key) {
+	case "valid users":
+		a.ValidUsers = splitList(val)
+	case "invalid users":
+		a.InvalidUsers = splitList(val)
+	case "write list":
+		a.WriteList = splitList(val)
+	case "read list":
+		a.ReadList = splitList(val)
+	case "admin users":
+		a.AdminUsers = splitList(val)
+	case "force user":
+		a.ForceUser = val
+	case "force group", "group":
+		a.ForceGroup = val
+	case "create mask", "create mode":
+		a.CreateMask = val
+	case "directory mask", "directory mode":
+		a.DirectoryMask = val
+	}
+}
+
+func writeAccess(w *bufio.Writer, a *ShareAccess) {
+	if a == nil {
+		return
+	}
+	writeParam(w, "valid users", joinList(a.ValidUsers))
+	writeParam(w, "invalid users", joinList(a.InvalidUsers))
+	writeParam(w, "write list", joinList(a.WriteList))
+	writeParam(w, "read list", joinList(a.ReadList))
+	writeParam(w, "admin users", joinList(a.AdminUsers))
+	writeParam(w, "force user", a.ForceUser)
+	writeParam(w, "force group", a.ForceGroup)
+	writeParam(w, "create mask", a.CreateMask)
+	writeParam(w, "directory mask", a.DirectoryMask)
+}
+
+// splitList splits an smb.conf list on commas and whitespace; double quotes keep names
+// with spaces together.
+func splitList(val string) []string {
+	out := []string{}
+	var cur strings.Builder
+	quoted := false
+	flush := func() {
+		if cur.Len() > 0 {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range val {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ',' || r == ' ' || r == '\t'):
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return out
+}
+
+func joinList(list []string) string {
+	parts := make([]string, 0, len(list))
+	for _, entry := range list {
+		if strings.ContainsAny(entry, " \t") {
+			entry = `"` + entry + `"`
+		}
+		parts = append(parts, entry)
+	}
+	return strings.Join(parts, ", ")
+}
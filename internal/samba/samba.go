@@ -21,6 +21,8 @@ type User struct {
 
 // Share is a UI-friendly view of a Samba share section.
 // Params stores additional raw key/value pairs preserved on round-trip.
+// Access is always set on listed shares; a nil Access in an update keeps the existing
+// access parameters, a non-nil one replaces them.
 type Share struct {
 	Name       string            `json:"name"`
 	Path       string            `json:"path"`
@@ -28,6 +30,7 @@ type Share struct {
 	Browseable string            `json:"browseable"`
 	GuestOK    string            `json:"guest_ok"`
 	Comment    string            `json:"comment"`
+	Access     *ShareAccess      `json:"access,omitempty"`
 	Params     map[string]string `json:"params"`
 	ParamOrder []string          `json:"-"`
 }
@@ -194,6 +197,7 @@ func SaveShares(path string, shares []Share) error {
 		if share.Comment != "" {
 			writeParam(w, "comment", share.Comment)
 		}
+		writeAccess(w, share.Access)
 		for _, key := range extraKeys(share) {
 			writeParam(w, key, share.Params[key])
 		}
@@ -246,6 +250,10 @@ func mergeShare(existing, incoming Share) Share {
 	if incoming.Comment != "" {
 		existing.Comment = incoming.Comment
 	}
+	if incoming.Access != nil {
+		access := *incoming.Access
+		existing.Access = &access
+	}
 	if existing.Params == nil {
 		existing.Params = map[string]string{}
 	}
@@ -357,6 +365,7 @@ func readSambaFileRecursive(path string, seen map[string]bool) (*sambaFile, erro
 			Browseable: pickBrowseable(currentParams),
 			GuestOK:    pickParam(currentParams, "guest ok"),
 			Comment:    pickParam(currentParams, "comment"),
+			Access:     parseAccess(currentParams),
 			Params:     currentParams,
 			ParamOrder: currentOrder,
 		}
@@ -500,7 +509,7 @@ func isPrimaryKey(key string) bool {
 			return true
 		}
 	}
-	return false
+	return isAccessKey(key)
 }
 
 func pickBrowseable(params map[string]string) string {
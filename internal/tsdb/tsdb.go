@@ -0,0 +1,301 @@
+// Package tsdb is a small on-disk time-series store. Samples are averaged into
+// fixed-step buckets per tier (e.g. 1m kept for a day, 1h kept for a month) and each
+// tier is persisted as an append-only JSON-lines file that is compacted periodically.
+package tsdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is one averaged bucket of a series.
+type Point struct {
+	Time   time.Time          `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// Tier is one resolution of the store.
+type Tier struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+}
+
+// DefaultTiers keeps 1-minute points for a day and 1-hour points for 30 days.
+var DefaultTiers = []Tier{
+	{Name: "1m", Step: time.Minute, Retention: 24 * time.Hour},
+	{Name: "1h", Step: time.Hour, Retention: 30 * 24 * time.Hour},
+}
+
+const compactEvery = time.Hour
+
+type record struct {
+	Series string `json:"s"`
+	Point
+}
+
+type bucket struct {
+	start time.Time
+	sums  map[string]float64
+	count int
+}
+
+func (b *bucket) add(values map[string]float64) {
+	for key, val := range values {
+		b.sums[key] += val
+	}
+	b.count++
+}
+
+func (b *bucket) point() Point {
+	values := make(map[string]float64, len(b.sums))
+	for key, sum := range b.sums {
+		values[key] = sum / float64(b.count)
+	}
+	return Point{Time: b.start, Values: values}
+}
+
+type tierState struct {
+	Tier
+	path   string
+	series map[string][]Point
+	open   map[string]*bucket
+}
+
+// Store holds all tiers in memory and mirrors finished buckets to disk.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	tiers     []*tierState
+	compacted time.Time
+}
+
+// Open loads (or creates) a store in dir. Tiers must be ordered finest first.
+func Open(dir string, tiers []Tier) (*Store, error) {
+	if len(tiers) == 0 {
+		tiers = DefaultTiers
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir}
+	for _, tier := range tiers {
+		ts := &tierState{
+			Tier:   tier,
+			path:   filepath.Join(dir, tier.Name+".jsonl"),
+			series: map[string][]Point{},
+			open:   map[string]*bucket{},
+		}
+		if err := ts.load(); err != nil {
+			return nil, err
+		}
+		s.tiers = append(s.tiers, ts)
+	}
+	s.rebuildOpen()
+	if err := s.compactLocked(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (ts *tierState) load() error {
+	f, err := os.Open(ts.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.Series == "" {
+			continue
+		}
+		ts.series[rec.Series] = append(ts.series[rec.Series], rec.Point)
+	}
+	for name, points := range ts.series {
+		sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		ts.series[name] = points
+	}
+	return scanner.Err()
+}
+
+// rebuildOpen refills the open buckets of coarser tiers from finer points written after
+// their last finished bucket, so a restart does not lose the partial hour.
+func (s *Store) rebuildOpen() {
+	if len(s.tiers) < 2 {
+		return
+	}
+	finest := s.tiers[0]
+	for _, ts := range s.tiers[1:] {
+		for name, points := range finest.series {
+			var after time.Time
+			if done := ts.series[name]; len(done) > 0 {
+				after = done[len(done)-1].Time.Add(ts.Step)
+			}
+			for _, p := range points {
+				if p.Time.Before(after) {
+					continue
+				}
+				start := p.Time.Truncate(ts.Step)
+				b := ts.open[name]
+				if b == nil || !b.start.Equal(start) {
+					if b != nil {
+						ts.series[name] = append(ts.series[name], b.point())
+					}
+					b = &bucket{start: start, sums: map[string]float64{}}
+					ts.open[name] = b
+				}
+				b.add(p.Values)
+			}
+		}
+	}
+}
+
+// Add records one sample for series at time t.
+func (s *Store) Add(series string, t time.Time, values map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ts := range s.tiers {
+		start := t.Truncate(ts.Step)
+		b := ts.open[series]
+		if b != nil && !b.start.Equal(start) {
+			p := b.point()
+			ts.series[series] = append(ts.series[series], p)
+			if err := appendRecords(ts.path, []record{{Series: series, Point: p}}); err != nil {
+				return err
+			}
+			b = nil
+		}
+		if b == nil {
+			b = &bucket{start: start, sums: map[string]float64{}}
+			ts.open[series] = b
+		}
+		b.add(values)
+	}
+	if time.Since(s.compacted) >= compactEvery {
+		return s.compactLocked(time.Now())
+	}
+	return nil
+}
+
+// Query returns points of series between from and to from the finest tier that still
+// covers from, including the bucket currently being filled.
+func (s *Store) Query(series string, from, to time.Time) (Tier, []Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := s.tierFor(from)
+	points := []Point{}
+	for _, p := range ts.series[series] {
+		if p.Time.Before(from.Truncate(ts.Step)) || p.Time.After(to) {
+			continue
+		}
+		points = append(points, p)
+	}
+	if b := ts.open[series]; b != nil && !b.start.After(to) {
+		points = append(points, b.point())
+	}
+	return ts.Tier, points
+}
+
+// Series lists series names with data in any tier, sorted.
+func (s *Store) Series() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	for _, ts := range s.tiers {
+		for name := range ts.series {
+			seen[name] = true
+		}
+		for name := range ts.open {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Store) tierFor(from time.Time) *tierState {
+	age := time.Since(from)
+	for _, ts := range s.tiers {
+		if age <= ts.Retention {
+			return ts
+		}
+	}
+	return s.tiers[len(s.tiers)-1]
+}
+
+// compactLocked drops expired points and rewrites each tier file.
+func (s *Store) compactLocked(now time.Time) error {
+	for _, ts := range s.tiers {
+		cutoff := now.Add(-ts.Retention)
+		var recs []record
+		for name, points := range ts.series {
+			idx := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(cutoff) })
+			points = points[idx:]
+			if len(points) == 0 {
+				delete(ts.series, name)
+				continue
+			}
+			ts.series[name] = points
+			for _, p := range points {
+				recs = append(recs, record{Series: name, Point: p})
+			}
+		}
+		for name, b := range ts.open {
+			if b.start.Before(cutoff) {
+				delete(ts.open, name)
+			}
+		}
+		if err := rewriteRecords(ts.path, recs); err != nil {
+			return err
+		}
+	}
+	s.compacted = now
+	return nil
+}
+
+func appendRecords(path string, recs []record) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func rewriteRecords(path string, recs []record) error {
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := appendRecords(tmp, recs); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -54,6 +54,15 @@
     });
   };
 
+  // One devd event stream per page, shared by the import prompt and the Drives page.
+  let devdStream = null;
+  const devdSource = () => {
+    if (!devdStream && window.EventSource) {
+      devdStream = new EventSource('/api/zfs/devd/stream');
+    }
+    return devdStream;
+  };
+
   const bindZpoolImportWatcher = () => {
     if (!modal) return;
     const dismissed = new Map();
@@ -100,11 +109,11 @@
       }
     };
 
-    const poll = async () => {
+    const poll = async (pushed) => {
       if (inFlight) return;
       inFlight = true;
       try {
-        const pools = await api('GET', '/api/zfs/importable');
+        const pools = pushed || await api('GET', '/api/zfs/importable');
         const candidates = (pools || []).filter((pool) => pool && pool.name && !isDismissed(poolKey(pool)));
         if (candidates.length) {
           await promptImport(candidates);
@@ -116,8 +125,26 @@
       }
     };
 
+    // The server refreshes importable pools on devd disk events (or its own poll while
+    // devd is down) and pushes them; poll here only while the stream is disconnected.
+    let streaming = false;
+    const source = devdSource();
+    if (source) {
+      source.addEventListener('open', () => { streaming = true; });
+      source.addEventListener('error', () => { streaming = false; });
+      source.addEventListener('importable', (ev) => {
+        try {
+          poll(JSON.parse(ev.data) || []);
+        } catch (err) {
+          // ignore malformed events
+        }
+      });
+    }
+
     poll();
-    setInterval(poll, 20000);
+    setInterval(() => {
+      if (!streaming) poll();
+    }, 20000);
   };
 
   const setBusy = (btn, busy) => {
@@ -247,6 +274,39 @@
     return { interval: step, start: hours[0], anchored: true };
   };
 
+  // Mirrors zfs.NameTemplate.Format so forms can preview snapshot names.
+  const formatSnapshotTemplate = (template, prefix, utc, date = new Date()) => {
+    const pad = (value, width = 2) => String(value).padStart(width, '0');
+    const get = (local, universal) => (utc ? date[universal]() : date[local]());
+    const year = get('getFullYear', 'getUTCFullYear');
+    const start = utc ? Date.UTC(year, 0, 1) : new Date(year, 0, 1).getTime();
+    const values = {
+      Y: pad(year, 4),
+      y: pad(year % 100),
+      m: pad(get('getMonth', 'getUTCMonth') + 1),
+      d: pad(get('getDate', 'getUTCDate')),
+      j: pad(Math.floor((date.getTime() - start) / 86400000) + 1, 3),
+      H: pad(get('getHours', 'getUTCHours')),
+      M: pad(get('getMinutes', 'getUTCMinutes')),
+      S: pad(get('getSeconds', 'getUTCSeconds')),
+      s: String(Math.floor(date.getTime() / 1000)),
+      p: prefix || 'snapshot',
+      '%': '%',
+    };
+    return (template || '%p-%Y%m%d-%H%M%S').replace(/%(.)/g, (match, key) => (key in values ? values[key] : match));
+  };
+
+  const fillTemplatePresets = (list, presets) => {
+    if (!list || !presets) return;
+    list.innerHTML = '';
+    presets.forEach((preset) => {
+      const opt = document.createElement('option');
+      opt.value = preset.template;
+      opt.label = preset.utc ? `${preset.name} (UTC)` : preset.name;
+      list.appendChild(opt);
+    });
+  };
+
   const summarizeCron = (spec, raw) => {
     if (!spec) return raw || '';
     const minute = (spec.minute || '*').trim();
@@ -544,6 +604,82 @@
     return `${fixed}${units[idx]}`;
   };
 
+  const formatSeconds = (secs) => {
+    if (secs === null || secs === undefined || Number.isNaN(secs)) return '-';
+    const total = Math.max(0, Math.round(secs));
+    const h = Math.floor(total / 3600);
+    const m = Math.floor((total % 3600) / 60);
+    const s = total % 60;
+    if (h > 0) return `${h}h ${m}m`;
+    if (m > 0) return `${m}m ${s}s`;
+    return `${s}s`;
+  };
+
+  const formatRate = (bytes) => (bytes ? `${formatSize(bytes)}/s` : '0');
+
+  // buildLineChart draws series ([{ label, points: [[time, value], ...], alt }]) into an
+  // SVG scaled to the largest value; alt series are dashed.
+  const buildLineChart = (series, opts = {}) => {
+    const ns = 'http://www.w3.org/2000/svg';
+    const width = 300;
+    const height = 100;
+    const svg = document.createElementNS(ns, 'svg');
+    svg.setAttribute('viewBox', `0 0 ${width} ${height}`);
+    svg.setAttribute('preserveAspectRatio', 'none');
+    const all = series.flatMap((s) => s.points || []);
+    const times = all.map((p) => p[0]);
+    const minT = times.length ? Math.min(...times) : 0;
+    const maxT = times.length ? Math.max(...times) : 1;
+    const maxV = Math.max(0, ...all.map((p) => p[1])) || 1;
+    [0.5, 1].forEach((frac) => {
+      const line = document.createElementNS(ns, 'line');
+      line.setAttribute('x1', '0');
+      line.setAttribute('x2', `${width}`);
+      line.setAttribute('y1', `${height - frac * height}`);
+      line.setAttribute('y2', `${height - frac * height}`);
+      line.classList.add('chart-axis');
+      svg.appendChild(line);
+    });
+    series.forEach((s) => {
+      const pts = (s.points || []).map((p) => {
+        const x = maxT > minT ? ((p[0] - minT) / (maxT - minT)) * width : width;
+        const y = height - (p[1] / maxV) * height;
+        return `${x.toFixed(1)},${y.toFixed(1)}`;
+      });
+      if (!pts.length) return;
+      const line = document.createElementNS(ns, 'polyline');
+      line.setAttribute('points', pts.join(' '));
+      line.classList.add('chart-line');
+      if (s.alt) line.classList.add('alt');
+      svg.appendChild(line);
+    });
+    if (opts.bare) return svg;
+    const fmt = opts.format || ((v) => `${Math.round(v)}`);
+    const wrap = document.createElement('div');
+    wrap.className = 'chart';
+    if (opts.title) {
+      const title = document.createElement('div');
+      title.className = 'chart-title';
+      title.textContent = opts.title;
+      wrap.appendChild(title);
+    }
+    wrap.appendChild(svg);
+    const legend = document.createElement('div');
+    legend.className = 'chart-legend';
+    const labels = series.map((s) => {
+      const last = (s.points || []).length ? s.points[s.points.length - 1][1] : 0;
+      return `${s.alt ? '- -' : '—'} ${s.label}: ${fmt(last)}`;
+    });
+    labels.push(`max ${fmt(maxV)}`);
+    labels.forEach((text) => {
+      const span = document.createElement('span');
+      span.textContent = text;
+      legend.appendChild(span);
+    });
+    wrap.appendChild(legend);
+    return wrap;
+  };
+
   const parseLines = (value) => {
     if (!value) return [];
     return value.split(/\r?\n/).map((item) => item.trim()).filter((item) => item);
@@ -598,7 +734,11 @@
 
     const widgetDefs = {
       pools: { title: 'ZFS Pools', link: '/zfs/pools', hint: 'Health + allocation' },
-      cache: { title: 'L2ARC Cache', link: '/zfs/mounts', hint: 'Used vs total cache' },
+      drives: { title: 'Drive Health', link: '/zfs/mounts', hint: 'SMART status' },
+      geli: { title: 'Encrypted Pools', link: '/zfs/mounts', hint: 'GELI unlock at startup' },
+      cache: { title: 'ARC / L2ARC Cache', link: '/zfs/mounts', hint: 'Hit ratios since boot' },
+      iostat: { title: 'Pool I/O', link: '/zfs/pools', hint: 'Bandwidth, last hour' },
+      capacity: { title: 'Capacity Forecast', link: '/zfs/pools', hint: 'Linear trend over 30 days' },
       datasets: { title: 'Datasets', link: '/zfs/datasets', hint: 'Used vs available' },
       snapshots: { title: 'Snapshots', link: '/zfs/snapshots', hint: 'Total snapshots' },
       schedules: { title: 'Schedules', link: '/zfs/schedules', hint: 'Enabled vs disabled' },
@@ -854,6 +994,44 @@
           ],
         };
       }
+      if (id === 'drives') {
+        const drives = data.drives || {};
+        const flagged = drives.flagged || [];
+        const lines = flagged.map((d) => {
+          const pool = d.pool ? ` in ${d.pool}${d.pool_health ? ` (${d.pool_health})` : ''}` : '';
+          return `${d.level === 'fail' ? '✖' : '!'} ${d.name}${pool}: ${(d.reasons || []).join(', ')}`;
+        });
+        if (!lines.length) {
+          lines.push(`Healthy: ${drives.healthy || 0}`);
+        }
+        if (drives.unknown) {
+          lines.push(`Unknown or asleep: ${drives.unknown}`);
+        }
+        return {
+          type: 'stat',
+          label: flagged.length ? `${flagged.length}` : 'OK',
+          sub: flagged.length ? `of ${drives.count || 0} drives flagged` : `${drives.count || 0} drives`,
+          lines,
+        };
+      }
+      if (id === 'geli') {
+        const geli = data.geli || {};
+        const locked = geli.locked_pools || [];
+        const waiting = geli.waiting || [];
+        const lines = locked.map((pool) => `Locked: ${pool}`);
+        if (waiting.length) {
+          lines.push(`Waiting: ${waiting.join(', ')}`);
+        }
+        if (!lines.length) {
+          lines.push(geli.providers ? 'All providers attached' : 'No providers registered');
+        }
+        return {
+          type: 'stat',
+          label: locked.length ? `${locked.length}` : 'OK',
+          sub: locked.length ? 'pools waiting for unlock' : `${geli.attached || 0} of ${geli.providers || 0} attached`,
+          lines,
+        };
+      }
       if (id === 'datasets') {
         const ds = data.datasets || {};
         const used = ds.used_bytes || 0;
@@ -878,6 +1056,29 @@
         const total = cache.total_bytes || 0;
         const devices = cache.devices || [];
         const pct = total > 0 ? (used / total) * 100 : 0;
+        const arc = cache.arc;
+        if (arc) {
+          const ratio = (r) => `${((r && r.percent) || 0).toFixed(1)}%`;
+          const l2 = arc.l2 || {};
+          const lines = [
+            `ARC: ${formatSize(arc.size || 0)} of ${formatSize(arc.max || 0)} (target ${formatSize(arc.target || 0)})`,
+            `Demand ${ratio(arc.demand)} · Prefetch ${ratio(arc.prefetch)} · Metadata ${ratio(arc.metadata)}`,
+            `MFU ${formatSize(arc.mfu_size || 0)} · MRU ${formatSize(arc.mru_size || 0)}`,
+          ];
+          if (l2.present || devices.length) {
+            lines.push(`L2ARC: ${formatSize(l2.size || 0)}${total > 0 ? ` of ${formatSize(total)}` : ''} · hits ${ratio(l2.ratio)}`);
+            lines.push(`L2 serves ${(l2.misses_served_percent || 0).toFixed(1)}% of ARC misses · headers ${formatSize(l2.header_size || 0)} RAM`);
+          } else {
+            lines.push('No L2ARC devices');
+          }
+          return {
+            type: 'donut',
+            percent: (arc.total && arc.total.percent) || 0,
+            label: ratio(arc.total),
+            sub: 'ARC hits',
+            lines,
+          };
+        }
         if (total > 0) {
           return {
             type: 'donut',
@@ -900,6 +1101,41 @@
           ],
         };
       }
+      if (id === 'capacity') {
+        const report = data.capacity || {};
+        const pools = report.pools || [];
+        const growing = pools.filter((p) => p.days_to_100 > 0).sort((a, b) => a.days_to_100 - b.days_to_100);
+        const soonest = growing[0];
+        const lines = pools.map((p) => {
+          const growth = p.growth_per_day > 0 ? `+${formatSize(p.growth_per_day)}/day` : 'no growth';
+          if (p.status === 'insufficient') return `${p.pool}: ${Math.round(p.percent || 0)}%, collecting data`;
+          const when = p.date_80 ? `80% ${p.date_80}` : (p.date_100 ? `full ${p.date_100}` : '');
+          return `${p.pool}: ${Math.round(p.percent || 0)}%, ${growth}${when ? `, ${when}` : ''}`;
+        });
+        (report.top_growers || []).slice(0, 3).forEach((g) => {
+          lines.push(`↑ ${g.name}: +${formatSize(g.growth_per_day)}/day`);
+        });
+        return {
+          type: 'stat',
+          label: soonest ? `${Math.round(soonest.days_to_100)}d` : '--',
+          sub: soonest ? `until ${soonest.pool} is full` : 'No pool filling up',
+          lines: lines.length ? lines : ['No usage history yet'],
+        };
+      }
+      if (id === 'iostat') {
+        const io = data.iostat || {};
+        return {
+          type: 'spark',
+          values: io.history || [],
+          label: formatRate((io.read_bytes || 0) + (io.write_bytes || 0)),
+          sub: 'Now',
+          lines: [
+            `Read: ${formatRate(io.read_bytes || 0)} (${Math.round(io.read_ops || 0)} ops)`,
+            `Write: ${formatRate(io.write_bytes || 0)} (${Math.round(io.write_ops || 0)} ops)`,
+            io.busiest ? `Busiest: ${io.busiest}` : `Pools: ${io.pools || 0}`,
+          ],
+        };
+      }
       if (id === 'snapshots') {
         const snaps = data.snapshots || {};
         const total = snaps.count || 0;
@@ -996,6 +1232,13 @@
         wrap.appendChild(stat);
         wrap.appendChild(blocks);
         graph = wrap;
+      } else if (info.type === 'spark') {
+        const wrap = document.createElement('div');
+        wrap.className = 'dashboard-spark';
+        wrap.appendChild(buildStat(info.label, info.sub));
+        const points = (info.values || []).map((v, i) => [i, v]);
+        wrap.appendChild(buildLineChart([{ label: 'total', points }], { bare: true }));
+        graph = wrap;
       } else if (info.type === 'pill') {
         graph = buildPill(info.label, !!info.active);
       } else {
@@ -1580,12 +1823,108 @@
     const table = document.getElementById('samba-shares-table');
     if (!table) return;
     const form = document.getElementById('share-form');
+    const nameInput = document.getElementById('share-name');
+    const submitBtn = form.querySelector('button[type="submit"]');
+    const cancelEditBtn = form.querySelector('[data-action="share-edit-cancel"]');
+    const forceUser = document.getElementById('share-force-user');
+    const forceGroup = document.getElementById('share-force-group');
+    const listFields = {
+      valid_users: 'share-valid-users',
+      invalid_users: 'share-invalid-users',
+      write_list: 'share-write-list',
+      read_list: 'share-read-list',
+      admin_users: 'share-admin-users',
+    };
+    let shareList = [];
+
+    const splitList = (value) => value.split(',').map((item) => item.trim()).filter((item) => item);
+
+    const fillSelect = (select, values) => {
+      if (!select) return;
+      const current = select.value;
+      select.querySelectorAll('option:not(:first-child), optgroup').forEach((el) => el.remove());
+      values.forEach((value) => {
+        const opt = document.createElement('option');
+        opt.value = value;
+        opt.textContent = value;
+        select.appendChild(opt);
+      });
+      select.value = current;
+    };
+
+    // Pickers are fed by the Samba users (pdbedit) and the system group database; force
+    // user takes a UNIX account instead.
+    const loadPrincipals = async () => {
+      const [users, accounts, groups] = await Promise.all([
+        api('GET', '/api/samba/users').catch(() => []),
+        api('GET', '/api/samba/accounts').catch(() => []),
+        api('GET', '/api/samba/groups').catch(() => []),
+      ]);
+      const userNames = (users || []).map((user) => user.name);
+      const accountNames = (accounts || []).map((account) => account.name);
+      const groupNames = (groups || []).map((group) => group.name);
+      form.querySelectorAll('[data-share-picker]').forEach((select) => {
+        select.querySelectorAll('option:not(:first-child), optgroup').forEach((el) => el.remove());
+        [['Users', userNames], ['Groups', groupNames.map((name) => `@${name}`)]].forEach(([label, values]) => {
+          if (!values.length) return;
+          const group = document.createElement('optgroup');
+          group.label = label;
+          values.forEach((value) => {
+            const opt = document.createElement('option');
+            opt.value = value;
+            opt.textContent = value;
+            group.appendChild(opt);
+          });
+          select.appendChild(group);
+        });
+      });
+      fillSelect(forceUser, accountNames);
+      fillSelect(forceGroup, groupNames);
+    };
+
+    const setEditing = (name) => {
+      nameInput.readOnly = !!name;
+      submitBtn.textContent = name ? 'Save Share' : 'Create Share';
+      cancelEditBtn?.classList.toggle('hidden', !name);
+    };
+
+    const ensureOption = (select, value) => {
+      if (!select || !value || Array.from(select.options).some((opt) => opt.value === value)) return;
+      const opt = document.createElement('option');
+      opt.value = value;
+      opt.textContent = value;
+      select.appendChild(opt);
+    };
+
+    const editShare = (share) => {
+      const access = share.access || {};
+      nameInput.value = share.name;
+      document.getElementById('share-path').value = share.path || '';
+      document.getElementById('share-readonly').value = share.read_only || 'no';
+      document.getElementById('share-browseable').value = share.browseable || 'yes';
+      document.getElementById('share-guest').value = share.guest_ok || 'no';
+      document.getElementById('share-comment').value = share.comment || '';
+      Object.entries(listFields).forEach(([key, id]) => {
+        document.getElementById(id).value = (access[key] || []).join(', ');
+      });
+      ensureOption(forceUser, access.force_user);
+      ensureOption(forceGroup, access.force_group);
+      forceUser.value = access.force_user || '';
+      forceGroup.value = access.force_group || '';
+      document.getElementById('share-create-mask').value = access.create_mask || '';
+      document.getElementById('share-directory-mask').value = access.directory_mask || '';
+      setEditing(share.name);
+      form.scrollIntoView({ behavior: 'smooth', block: 'start' });
+    };
 
     const loadShares = async () => {
       const shares = await api('GET', '/api/samba/shares');
+      shareList = shares || [];
       renderTable('#samba-shares-table', shares, '#samba-shares-empty', (share) => {
+        const access = share.access || {};
         const tr = document.createElement('tr');
         tr.innerHTML = `<td>${share.name}</td><td>${share.path}</td><td>${share.read_only}</td><td>${share.browseable}</td><td>${share.guest_ok}</td>
+          <td>${(access.valid_users || []).join(', ')}</td><td>${(access.write_list || []).join(', ')}</td>
           <td>
             <button class="btn" data-action="share-edit" data-name="${share.name}">Edit</button>
             <button class="btn" data-action="share-delete" data-name="${share.name}">Delete</button>
@@ -1594,22 +1933,42 @@
       });
     };
 
+    form.addEventListener('change', (e) => {
+      const picker = e.target.closest('[data-share-picker]');
+      if (!picker || !picker.value) return;
+      const input = document.getElementById(picker.dataset.sharePicker);
+      const items = splitList(input.value);
+      if (!items.includes(picker.value)) items.push(picker.value);
+      input.value = items.join(', ');
+      picker.value = '';
+    });
+
     form.addEventListener('submit', async (e) => {
       e.preventDefault();
       clearBanner();
+      const access = {
+        force_user: forceUser.value,
+        force_group: forceGroup.value,
+        create_mask: document.getElementById('share-create-mask').value.trim(),
+        directory_mask: document.getElementById('share-directory-mask').value.trim(),
+      };
+      Object.entries(listFields).forEach(([key, id]) => {
+        access[key] = splitList(document.getElementById(id).value);
+      });
       const body = {
-        name: document.getElementById('share-name').value.trim(),
+        name: nameInput.value.trim(),
         path: document.getElementById('share-path').value.trim(),
         read_only: document.getElementById('share-readonly').value,
         browseable: document.getElementById('share-browseable').value,
         guest_ok: document.getElementById('share-guest').value,
         comment: document.getElementById('share-comment').value.trim(),
+        access,
       };
       try {
-        const btn = form.querySelector('button[type="submit"]');
-        await withBusy(btn, () => api('POST', '/api/samba/shares', body));
+        await withBusy(submitBtn, () => api('POST', '/api/samba/shares', body));
         showToast('Share saved');
         form.reset();
+        setEditing('');
         loadShares();
       } catch (err) {
         showBanner(err.message, err.details);
@@ -1639,20 +1998,19 @@
           loadShares();
         }
         if (btn.dataset.action === 'share-edit') {
-          const name = btn.dataset.name;
-          const path = prompt('New path for share', '');
-          if (!path) return;
-          const ok = await confirmModal('Edit share', `Update share ${name}?`);
-          if (!ok) return;
-          await withBusy(btn, () => api('PUT', `/api/samba/shares/${encodeURIComponent(name)}`, { path, confirm: true }));
-          showToast('Share updated');
-          loadShares();
+          const share = shareList.find((item) => item.name === btn.dataset.name);
+          if (share) editShare(share);
+        }
+        if (btn.dataset.action === 'share-edit-cancel') {
+          form.reset();
+          setEditing('');
         }
       } catch (err) {
         showBanner(err.message, err.details);
       }
     });
 
+    loadPrincipals().catch((err) => showBanner(err.message, err.details));
     loadShares();
   };
 
@@ -1791,6 +2149,26 @@
       const res = await api('GET', '/api/zfs/drives');
       const drives = Array.isArray(res) ? res : (res.drives || []);
       const filtered = drives.filter((drive) => !drive.pool);
+      try {
+        const parts = await api('GET', '/api/zfs/partitions');
+        (parts.tables || []).forEach((table) => {
+          (table.entries || []).forEach((entry) => {
+            if (entry.free || entry.pool || entry.type !== 'freebsd-zfs') return;
+            filtered.push({ name: entry.label ? `gpt/${entry.label}` : entry.provider, mediasize: entry.size, description: `${table.disk} partition ${entry.index}` });
+          });
+        });
+      } catch (err) {
+        // Partitions are optional here; whole disks are still listed.
+      }
+      try {
+        const geli = await api('GET', '/api/zfs/geli');
+        (geli.providers || []).forEach((prov) => {
+          if (prov.pool || prov.status !== 'ACTIVE') return;
+          filtered.push({ name: prov.name, mediasize: '', description: `GELI on ${prov.component}` });
+        });
+      } catch (err) {
+        // GELI is optional as well.
+      }
       const seen = new Set();
       availableDevices = filtered.filter((drive) => {
         if (!drive.name) return false;
@@ -1882,182 +2260,1764 @@
       cacheEnabled.addEventListener('change', updateCacheOptions);
     }
 
-    loadPools();
-    loadDevices();
-  };
-
-  const bindZFSMounts = () => {
-    const drivesTable = document.getElementById('zfs-drives-table');
-    const mountsTable = document.getElementById('zfs-mounts-table');
-    if (!drivesTable && !mountsTable) return;
-    const cacheSummary = document.getElementById('cache-summary');
-    const cacheFill = document.getElementById('cache-bar-fill');
-    const cacheDevices = document.getElementById('cache-devices');
-    const mountForm = document.getElementById('mount-create-form');
-    const mountDataset = document.getElementById('mount-dataset');
-    const mountPoint = document.getElementById('mount-point');
-    const mountCanmount = document.getElementById('mount-canmount');
-    const labelForm = document.getElementById('gpt-label-form');
-    const labelProvider = document.getElementById('gpt-provider');
-    const labelName = document.getElementById('gpt-label');
-    const labelsTable = document.getElementById('gpt-labels-table');
-    const labelsEmpty = document.getElementById('gpt-labels-empty');
-
-    const loadDrives = async () => {
-      if (!drivesTable) return;
-      const res = await api('GET', '/api/zfs/drives');
-      const drives = Array.isArray(res) ? res : (res.drives || []);
-      const cache = res && res.cache ? res.cache : {};
-      const errors = res && res.errors ? res.errors : {};
-      if (errors.pool_devices) {
-        showBanner('Pool device info unavailable', errors.pool_devices);
-      }
-      if (cacheSummary) {
-        const usedBytes = cache.used_bytes || 0;
-        const totalBytes = cache.total_bytes || 0;
-        const cacheList = cache.devices || [];
-        if (errors.cache) {
-          cacheSummary.textContent = `Cache info unavailable: ${errors.cache}`;
-        } else if (totalBytes > 0) {
-          cacheSummary.textContent = `L2ARC used ${formatSize(usedBytes)} of ${formatSize(totalBytes)}`;
-        } else if (cacheList.length) {
-          cacheSummary.textContent = `L2ARC used ${formatSize(usedBytes)} (total unknown)`;
-        } else {
-          cacheSummary.textContent = 'No cache devices detected.';
-        }
-        if (cacheFill) {
-          const pct = totalBytes > 0 ? Math.min(100, Math.max(0, Math.round((usedBytes / totalBytes) * 100))) : 0;
-          cacheFill.style.width = `${pct}%`;
-          cacheFill.title = totalBytes > 0 ? `${pct}% used` : '';
-        }
-        if (cacheDevices) {
-          const list = cacheList.map((dev) => `${dev.name}${dev.size ? ` (${dev.size})` : ''}`);
-          cacheDevices.textContent = list.length ? `Cache devices: ${list.join(', ')}` : '';
-        }
-      }
-      renderTable('#zfs-drives-table', drives, '#zfs-drives-empty', (drive) => {
+    const featuresPool = document.getElementById('features-pool');
+    const featuresSummary = document.getElementById('features-summary');
+    const featuresRefresh = document.querySelector('[data-action="features-refresh"]');
+    const featuresCompatForm = document.getElementById('features-compat-form');
+    const featuresCompat = document.getElementById('features-compat');
+    const featuresCompatSets = document.getElementById('features-compat-sets');
+    const upgradeBtn = document.querySelector('[data-action="pool-upgrade"]');
+    const upgradeCheckpoint = document.getElementById('features-checkpoint');
+    let featurePools = [];
+
+    const renderFeatures = () => {
+      if (!featuresPool) return;
+      const entry = featurePools.find((p) => p.pool === featuresPool.value);
+      if (featuresCompat) featuresCompat.value = entry ? (entry.compatibility || 'off') : '';
+      if (upgradeBtn) upgradeBtn.disabled = !entry || entry.disabled === 0;
+      renderTable('#features-table', entry ? entry.features : [], '#features-empty', (feature) => {
         const tr = document.createElement('tr');
-        const avail = drive.free || '';
-        const total = drive.size || drive.mediasize || '';
-        const availText = avail && total ? `${avail} / ${total}` : (total ? `- / ${total}` : '-');
-        tr.innerHTML = `<td>${drive.name}</td><td>${drive.pool || ''}</td><td>${drive.role || ''}</td><td>${availText}</td><td>${drive.description || ''}</td><td>${drive.ident || ''}</td>`;
+        const stateClass = feature.state === 'disabled' ? 'warn' : (feature.state === 'active' ? 'ok' : '');
+        tr.innerHTML = `<td>${feature.name}</td><td><span class="badge ${stateClass}">${feature.state}</span></td><td>${feature.read_only_compatible ? 'Yes' : 'No'}</td><td>${feature.description || ''}</td><td class="tiny">${feature.note}</td>`;
         return tr;
       });
     };
 
-    const loadMounts = async () => {
-      if (!mountsTable) return;
-      const mounts = await api('GET', '/api/zfs/mounts');
-      renderTable('#zfs-mounts-table', mounts, '#zfs-mounts-empty', (mnt) => {
-        const tr = document.createElement('tr');
-        const badgeClass = mnt.mounted ? 'ok' : '';
-        const badgeText = mnt.mounted ? 'Yes' : 'No';
-        const action = mnt.mounted ? 'zfs-unmount' : 'zfs-mount';
-        const actionLabel = mnt.mounted ? 'Unmount' : 'Mount';
-        tr.innerHTML = `<td>${mnt.name}</td><td>${mnt.mountpoint}</td><td>${mnt.canmount}</td><td><span class="badge ${badgeClass}">${badgeText}</span></td>\n          <td><button class="btn" data-action="${action}" data-dataset="${mnt.name}">${actionLabel}</button></td>`;
-        return tr;
+    const loadFeatures = async () => {
+      if (!featuresPool) return;
+      const data = await api('GET', '/api/zfs/features');
+      featurePools = data.pools || [];
+      const current = featuresPool.value;
+      featuresPool.innerHTML = '';
+      featurePools.forEach((entry) => {
+        const option = document.createElement('option');
+        option.value = entry.pool;
+        option.textContent = entry.disabled ? `${entry.pool} (${entry.disabled} not enabled)` : entry.pool;
+        featuresPool.appendChild(option);
       });
+      if (featurePools.some((entry) => entry.pool === current)) featuresPool.value = current;
+      if (featuresCompatSets) {
+        featuresCompatSets.innerHTML = '';
+        ['off', 'legacy', ...(data.compatibility_sets || [])].forEach((name) => {
+          const option = document.createElement('option');
+          option.value = name;
+          featuresCompatSets.appendChild(option);
+        });
+      }
+      if (featuresSummary) {
+        const behind = featurePools.filter((entry) => entry.disabled > 0).map((entry) => entry.pool);
+        featuresSummary.textContent = behind.length ? `Pools with features not enabled: ${behind.join(', ')}` : 'All pools have every supported feature enabled.';
+      }
+      renderFeatures();
     };
 
-    const loadLabels = async () => {
-      if (!labelsTable) return;
-      const labels = await api('GET', '/api/zfs/labels');
-      renderTable('#gpt-labels-table', labels, '#gpt-labels-empty', (item) => {
+    if (featuresPool) {
+      featuresPool.addEventListener('change', renderFeatures);
+    }
+    if (featuresRefresh) {
+      featuresRefresh.addEventListener('click', async () => {
+        clearBanner();
+        try {
+          await withBusy(featuresRefresh, () => loadFeatures());
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+    if (featuresCompatForm) {
+      featuresCompatForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        if (!featuresPool || !featuresPool.value) return;
+        const btn = featuresCompatForm.querySelector('button[type="submit"]');
+        try {
+          await withBusy(btn, () => api('PUT', '/api/zfs/features', { pool: featuresPool.value, compatibility: featuresCompat.value.trim() }));
+          showToast('Compatibility updated');
+          loadFeatures();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+    if (upgradeBtn) {
+      upgradeBtn.addEventListener('click', async () => {
+        if (!featuresPool || !featuresPool.value) return;
+        clearBanner();
+        const pool = featuresPool.value;
+        const checkpoint = !!(upgradeCheckpoint && upgradeCheckpoint.checked);
+        const undo = checkpoint ? 'A checkpoint is taken first, so the upgrade can be rewound until you discard it.' : 'Without a checkpoint this cannot be undone.';
+        const ok = await confirmModal('Upgrade pool', `Enable all supported features on ${pool}? ${undo} If ${pool} is a boot pool, update the boot loader first; older hosts may no longer import it.`);
+        if (!ok) return;
+        try {
+          const data = await withBusy(upgradeBtn, () => api('POST', '/api/zfs/upgrade', { pool, confirm: true, checkpoint }));
+          showToast(data.checkpointed ? `Pool ${pool} checkpointed and upgraded` : `Pool ${pool} upgraded`);
+          loadFeatures();
+          loadCheckpoints();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    const checkpointsRefresh = document.querySelector('[data-action="checkpoints-refresh"]');
+
+    const loadCheckpoints = async () => {
+      if (!document.getElementById('checkpoints-table')) return;
+      const data = await api('GET', '/api/zfs/checkpoint');
+      renderTable('#checkpoints-table', data.items || [], '#checkpoints-empty', (cp) => {
         const tr = document.createElement('tr');
-        tr.innerHTML = `<td>${item.label}</td><td>${item.provider}</td>`;
+        let state = '<span class="muted">None</span>';
+        if (cp.discarding) state = '<span class="badge warn">Discarding</span>';
+        else if (cp.exists) state = `<span class="badge ok">Created</span> ${cp.created || ''}`;
+        tr.innerHTML = `<td>${cp.pool}</td><td>${state}</td><td>${cp.exists ? formatSize(cp.bytes) : '-'}</td>`;
+        const actions = document.createElement('td');
+        const addButton = (label, op, primary) => {
+          const btn = document.createElement('button');
+          btn.className = primary ? 'btn primary' : 'btn';
+          btn.type = 'button';
+          btn.dataset.action = 'checkpoint';
+          btn.dataset.op = op;
+          btn.dataset.pool = cp.pool;
+          btn.textContent = label;
+          actions.appendChild(btn);
+        };
+        if (!cp.exists) {
+          addButton('Checkpoint', 'create', true);
+        } else if (!cp.discarding) {
+          addButton('Discard', 'discard');
+          addButton('Rewind', 'rewind');
+        }
+        tr.appendChild(actions);
         return tr;
       });
     };
 
-    const refreshAll = () => Promise.all([loadDrives(), loadMounts(), loadLabels()]);
-
     document.addEventListener('click', async (e) => {
-      const btn = e.target.closest('[data-action]');
+      const btn = e.target.closest('[data-action="checkpoint"]');
       if (!btn) return;
+      clearBanner();
+      const pool = btn.dataset.pool;
       try {
-        if (btn.dataset.action === 'drives-refresh') {
-          await withBusy(btn, () => loadDrives());
-        }
-        if (btn.dataset.action === 'mounts-refresh') {
-          await withBusy(btn, () => loadMounts());
-        }
-        if (btn.dataset.action === 'labels-refresh') {
-          await withBusy(btn, () => loadLabels());
-        }
-        if (btn.dataset.action === 'zfs-mount') {
-          const dataset = btn.dataset.dataset;
-          if (!dataset) return;
-          await withBusy(btn, () => api('POST', '/api/zfs/mounts', { dataset, action: 'mount' }));
-          showToast('Dataset mounted');
-          loadMounts();
-        }
-        if (btn.dataset.action === 'zfs-unmount') {
-          const dataset = btn.dataset.dataset;
-          if (!dataset) return;
-          const ok = await confirmModal('Unmount dataset', `Unmount ${dataset}?`);
+        if (btn.dataset.op === 'create') {
+          await withBusy(btn, () => api('POST', '/api/zfs/checkpoint', { pool }));
+          showToast(`Checkpoint of ${pool} taken`);
+        } else if (btn.dataset.op === 'discard') {
+          const ok = await confirmModal('Discard checkpoint', `Discard the checkpoint of ${pool}? The space it holds is freed in the background and the pool can no longer be rewound.`);
           if (!ok) return;
-          await withBusy(btn, () => api('POST', '/api/zfs/mounts', { dataset, action: 'unmount', confirm: true }));
-          showToast('Dataset unmounted');
-          loadMounts();
+          await withBusy(btn, () => api('DELETE', '/api/zfs/checkpoint', { pool, confirm: true }));
+          showToast(`Checkpoint of ${pool} discarded`);
+        } else if (btn.dataset.op === 'rewind') {
+          const ok = await confirmModal('Rewind to checkpoint', `Rewinding exports ${pool}, then imports it with --rewind-to-checkpoint. Every write, snapshot, property change and added vdev since the checkpoint is lost, and the checkpoint is consumed. Stop services using ${pool} before continuing.`);
+          if (!ok) return;
+          const typed = prompt(`Type ${pool} to rewind it`);
+          if (typed === null) return;
+          if (typed.trim() !== pool) {
+            showBanner('pool name did not match');
+            return;
+          }
+          await withBusy(btn, () => api('POST', '/api/zfs/checkpoint/rewind', { pool, confirm: true, confirm_name: typed.trim() }));
+          showToast(`Pool ${pool} rewound to its checkpoint`);
+          loadPools();
+          loadFeatures();
         }
+        loadCheckpoints();
       } catch (err) {
         showBanner(err.message, err.details);
       }
     });
 
-    if (mountForm) {
-      mountForm.addEventListener('submit', async (e) => {
-        e.preventDefault();
+    if (checkpointsRefresh) {
+      checkpointsRefresh.addEventListener('click', async () => {
         clearBanner();
-        const name = (mountDataset.value || '').trim();
-        const point = (mountPoint.value || '').trim();
-        const canmount = (mountCanmount.value || '').trim();
-        if (!name || !point) {
-          showBanner('dataset and mountpoint required');
-          return;
-        }
-        const btn = mountForm.querySelector('button[type="submit"]');
         try {
-          await withBusy(btn, () => api('POST', '/api/zfs/datasets', {
-            name,
-            kind: 'filesystem',
-            size: '',
-            properties: { mountpoint: point, canmount },
-          }));
-          showToast('Mount created');
-          mountForm.reset();
-          loadMounts();
+          await withBusy(checkpointsRefresh, () => loadCheckpoints());
         } catch (err) {
           showBanner(err.message, err.details);
         }
       });
     }
 
-    if (labelForm) {
-      labelForm.addEventListener('submit', async (e) => {
-        e.preventDefault();
-        clearBanner();
-        const provider = (labelProvider.value || '').trim();
-        const label = (labelName.value || '').trim();
+    const trimPool = document.getElementById('trim-pool');
+    const trimAutotrim = document.getElementById('trim-autotrim');
+    const trimRate = document.getElementById('trim-rate');
+    const trimMeta = document.getElementById('trim-meta');
+    const trimRefresh = document.querySelector('[data-action="trim-refresh"]');
+    const trimScheduleForm = document.getElementById('trim-schedule-form');
+    const trimScheduleDow = document.getElementById('trim-schedule-dow');
+    const trimScheduleTime = document.getElementById('trim-schedule-time');
+
+    const progressText = (progress) => {
+      if (!progress || progress.state === 'none') return '-';
+      if (progress.state === 'unsupported') return 'unsupported';
+      return `${progress.percent}% ${progress.state}`;
+    };
+
+    const loadTrimStatus = async () => {
+      if (!trimPool || !trimPool.value) {
+        renderTable('#trim-devices-table', [], '#trim-devices-empty', () => null);
+        return;
+      }
+      const pool = trimPool.value;
+      const data = await api('GET', `/api/zfs/trim?pool=${encodeURIComponent(pool)}`);
+      if (trimAutotrim) trimAutotrim.checked = !!data.autotrim;
+      const devices = data.devices || [];
+      const active = devices.filter((dev) => dev.trim.state === 'active' || dev.initialize.state === 'active').length;
+      if (trimMeta) trimMeta.textContent = active ? `${active} device(s) busy` : '';
+      renderTable('#trim-devices-table', devices, '#trim-devices-empty', (dev) => {
+        const tr = document.createElement('tr');
+        const trimCell = document.createElement('td');
+        trimCell.textContent = progressText(dev.trim);
+        trimCell.title = dev.trim.detail || '';
+        const initCell = document.createElement('td');
+        initCell.textContent = progressText(dev.initialize);
+        initCell.title = dev.initialize.detail || '';
+        tr.innerHTML = `<td>${dev.name}</td><td>${dev.role}</td>`;
+        tr.appendChild(trimCell);
+        tr.appendChild(initCell);
+        const actions = document.createElement('td');
+        [['pool-trim', 'start', 'Trim'], ['pool-trim', 'cancel', 'Cancel trim'], ['pool-initialize', 'start', 'Initialize'], ['pool-initialize', 'cancel', 'Cancel init']].forEach(([action, op, label]) => {
+          const btn = document.createElement('button');
+          btn.className = 'btn';
+          btn.dataset.action = action;
+          btn.dataset.op = op;
+          btn.dataset.device = dev.name;
+          btn.textContent = label;
+          actions.appendChild(btn);
+        });
+        tr.appendChild(actions);
+        return tr;
+      });
+    };
+
+    const loadTrimSchedules = async () => {
+      if (!trimScheduleForm) return;
+      const data = await api('GET', '/api/zfs/trim/schedules');
+      renderTable('#trim-schedules-table', data.items || [], '#trim-schedules-empty', (item) => {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `<td>${item.pool}</td><td>${summarizeCron(item.schedule, item.cron)}</td><td>${item.cron}</td><td>${item.rate || '-'}</td><td>${item.enabled}</td>
+          <td><button class="btn" data-action="trim-schedule-toggle" data-id="${item.id}">${item.enabled ? 'Disable' : 'Enable'}</button>
+          <button class="btn" data-action="trim-schedule-delete" data-id="${item.id}">Delete</button></td>`;
+        return tr;
+      });
+    };
+
+    const loadTrim = async () => {
+      if (!trimPool) return;
+      const pools = await api('GET', '/api/zfs/pools');
+      const current = trimPool.value;
+      trimPool.innerHTML = '';
+      pools.forEach((pool) => {
+        const option = document.createElement('option');
+        option.value = pool.name;
+        option.textContent = pool.name;
+        trimPool.appendChild(option);
+      });
+      if (pools.some((pool) => pool.name === current)) trimPool.value = current;
+      await loadTrimStatus();
+      await loadTrimSchedules();
+    };
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action="pool-trim"], [data-action="pool-initialize"]');
+      if (!btn || !trimPool || !trimPool.value) return;
+      clearBanner();
+      const pool = trimPool.value;
+      const op = btn.dataset.op;
+      const devices = btn.dataset.device ? [btn.dataset.device] : [];
+      const initialize = btn.dataset.action === 'pool-initialize';
+      const target = devices.length ? devices[0] : pool;
+      const body = { pool, action: op, devices };
+      if (initialize && op === 'start') {
+        const ok = await confirmModal('Initialize', `Initialize ${target}? ZFS writes to every unallocated block, which can take hours on large vdevs.`);
+        if (!ok) return;
+        body.confirm = true;
+      }
+      if (!initialize && op === 'start' && trimRate && trimRate.value.trim()) {
+        body.rate = trimRate.value.trim();
+      }
+      try {
+        await withBusy(btn, () => api('POST', initialize ? '/api/zfs/initialize' : '/api/zfs/trim', body));
+        showToast(`${initialize ? 'Initialize' : 'Trim'} ${op} sent for ${target}`);
+        loadTrimStatus().catch((err) => showBanner(err.message, err.details));
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action="trim-schedule-toggle"], [data-action="trim-schedule-delete"]');
+      if (!btn) return;
+      clearBanner();
+      const url = `/api/zfs/schedules/${encodeURIComponent(btn.dataset.id)}`;
+      try {
+        if (btn.dataset.action === 'trim-schedule-delete') {
+          const ok = await confirmModal('Delete schedule', 'Delete this trim schedule?');
+          if (!ok) return;
+          await withBusy(btn, () => api('DELETE', url, { confirm: true }));
+          showToast('Schedule deleted');
+        } else {
+          await withBusy(btn, () => api('PUT', url, { toggle: true }));
+          showToast('Schedule updated');
+        }
+        loadTrimSchedules();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    if (trimScheduleForm) {
+      trimScheduleForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        if (!trimPool || !trimPool.value) {
+          showBanner('select a pool');
+          return;
+        }
+        const [hour, minute] = (trimScheduleTime.value || '03:00').split(':');
+        const payload = {
+          pool: trimPool.value,
+          rate: trimRate ? trimRate.value.trim() : '',
+          enabled: true,
+          schedule: { minute: String(parseInt(minute, 10) || 0), hour: String(parseInt(hour, 10) || 0), dom: '*', month: '*', dow: trimScheduleDow.value },
+        };
+        const btn = trimScheduleForm.querySelector('button[type="submit"]');
+        try {
+          await withBusy(btn, () => api('POST', '/api/zfs/trim/schedules', payload));
+          showToast('Trim schedule saved');
+          loadTrimSchedules();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    if (trimAutotrim) {
+      trimAutotrim.addEventListener('change', async () => {
+        if (!trimPool || !trimPool.value) return;
+        clearBanner();
+        try {
+          await api('PUT', '/api/zfs/trim', { pool: trimPool.value, autotrim: trimAutotrim.checked });
+          showToast(`Autotrim ${trimAutotrim.checked ? 'enabled' : 'disabled'}`);
+        } catch (err) {
+          trimAutotrim.checked = !trimAutotrim.checked;
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+    if (trimPool) {
+      trimPool.addEventListener('change', () => loadTrimStatus().catch((err) => showBanner(err.message, err.details)));
+    }
+    if (trimRefresh) {
+      trimRefresh.addEventListener('click', async () => {
+        clearBanner();
+        try {
+          await withBusy(trimRefresh, () => loadTrim());
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    const iostatPool = document.getElementById('iostat-pool');
+    const iostatVdev = document.getElementById('iostat-vdev');
+    const iostatRange = document.getElementById('iostat-range');
+    const iostatCharts = document.getElementById('iostat-charts');
+    const iostatMeta = document.getElementById('iostat-meta');
+    const iostatRefresh = document.querySelector('[data-action="iostat-refresh"]');
+    const formatMs = (ms) => (ms ? `${ms.toFixed(ms >= 10 ? 0 : 2)} ms` : '0');
+
+    const renderIOStatLatest = (rows) => {
+      let slowest = null;
+      rows.forEach((row) => {
+        if (!row.vdev) return;
+        const wait = Math.max(row.read_wait_ms || 0, row.write_wait_ms || 0);
+        if (wait > 0 && (!slowest || wait > slowest.wait)) slowest = { name: row.name, wait };
+      });
+      renderTable('#iostat-latest-table', rows, '#iostat-latest-empty', (row) => {
+        const tr = document.createElement('tr');
+        const name = row.vdev ? row.name : `${row.name} (pool)`;
+        tr.innerHTML = `<td></td><td>${Math.round(row.read_ops || 0)}</td><td>${Math.round(row.write_ops || 0)}</td>`
+          + `<td>${formatRate(row.read_bytes)}</td><td>${formatRate(row.write_bytes)}</td>`
+          + `<td>${formatMs(row.read_wait_ms)}</td><td>${formatMs(row.write_wait_ms)}</td>`
+          + `<td>${formatMs(row.disk_read_wait_ms)} / ${formatMs(row.disk_write_wait_ms)}</td>`;
+        tr.firstChild.textContent = name;
+        if (slowest && row.vdev && row.name === slowest.name) {
+          const badge = document.createElement('span');
+          badge.className = 'badge warn';
+          badge.textContent = 'Slowest';
+          tr.firstChild.appendChild(document.createTextNode(' '));
+          tr.firstChild.appendChild(badge);
+        }
+        return tr;
+      });
+    };
+
+    const renderIOStatCharts = (history) => {
+      if (!iostatCharts) return;
+      iostatCharts.innerHTML = '';
+      const wanted = iostatVdev && iostatVdev.value ? iostatVdev.value : '';
+      const entry = (history.series || []).find((s) => (wanted ? s.vdev && s.name === wanted : !s.vdev));
+      const points = entry ? entry.points || [] : [];
+      const series = (key) => points.map((p) => [new Date(p.t).getTime(), (p.v || {})[key] || 0]);
+      iostatCharts.appendChild(buildLineChart([
+        { label: 'read', points: series('read_bytes') },
+        { label: 'write', points: series('write_bytes'), alt: true },
+      ], { title: 'Bandwidth', format: formatRate }));
+      iostatCharts.appendChild(buildLineChart([
+        { label: 'read', points: series('read_ops') },
+        { label: 'write', points: series('write_ops'), alt: true },
+      ], { title: 'Operations/s' }));
+      iostatCharts.appendChild(buildLineChart([
+        { label: 'read', points: series('read_wait_ms') },
+        { label: 'write', points: series('write_wait_ms'), alt: true },
+      ], { title: 'Latency', format: formatMs }));
+    };
+
+    const loadIOStat = async () => {
+      if (!iostatPool) return;
+      const overview = await api('GET', '/api/zfs/iostat');
+      const pools = overview.pools || [];
+      const current = iostatPool.value;
+      iostatPool.innerHTML = '';
+      pools.forEach((name) => {
+        const option = document.createElement('option');
+        option.value = name;
+        option.textContent = name;
+        iostatPool.appendChild(option);
+      });
+      if (pools.includes(current)) iostatPool.value = current;
+      if (!iostatPool.value) {
+        if (iostatMeta) iostatMeta.textContent = overview.error || 'Waiting for the first sample.';
+        renderIOStatLatest([]);
+        renderIOStatCharts({});
+        return;
+      }
+      const range = iostatRange ? iostatRange.value : '1h';
+      const data = await api('GET', `/api/zfs/iostat?pool=${encodeURIComponent(iostatPool.value)}&range=${encodeURIComponent(range)}`);
+      const history = data.history || {};
+      if (iostatVdev) {
+        const selected = iostatVdev.value;
+        iostatVdev.innerHTML = '<option value="">Pool total</option>';
+        (history.series || []).filter((s) => s.vdev).forEach((s) => {
+          const option = document.createElement('option');
+          option.value = s.name;
+          option.textContent = s.name;
+          iostatVdev.appendChild(option);
+        });
+        if ((history.series || []).some((s) => s.vdev && s.name === selected)) iostatVdev.value = selected;
+      }
+      if (iostatMeta) {
+        const parts = [];
+        if (history.step_seconds) parts.push(`${formatSeconds(history.step_seconds)} resolution`);
+        if (data.updated) parts.push(`updated ${new Date(data.updated).toLocaleTimeString()}`);
+        if (data.error) parts.push(`last sample failed: ${data.error}`);
+        iostatMeta.textContent = parts.join(' · ');
+      }
+      renderIOStatLatest(data.latest || []);
+      renderIOStatCharts(history);
+    };
+
+    [iostatPool, iostatVdev, iostatRange].forEach((el) => {
+      if (!el) return;
+      el.addEventListener('change', () => loadIOStat().catch((err) => showBanner(err.message, err.details)));
+    });
+    if (iostatRefresh) {
+      iostatRefresh.addEventListener('click', async () => {
+        clearBanner();
+        try {
+          await withBusy(iostatRefresh, () => loadIOStat());
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    loadPools();
+    loadDevices();
+    loadIOStat().catch((err) => showBanner(err.message, err.details));
+    loadTrim().catch((err) => showBanner(err.message, err.details));
+    loadFeatures().catch((err) => showBanner(err.message, err.details));
+    loadCheckpoints().catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindBootEnvironments = () => {
+    const table = document.getElementById('bootenv-table');
+    if (!table) return;
+    const createForm = document.getElementById('bootenv-create-form');
+    const preUpgradeForm = document.getElementById('bootenv-preupgrade-form');
+    const sources = document.getElementById('bootenv-sources');
+    const summary = document.getElementById('bootenv-summary');
+    let envs = [];
+
+    const loadBootEnvironments = async () => {
+      const data = await api('GET', '/api/zfs/bootenv');
+      envs = data.items || [];
+      if (sources) {
+        sources.innerHTML = '';
+        envs.forEach((be) => {
+          const option = document.createElement('option');
+          option.value = be.name;
+          sources.appendChild(option);
+        });
+      }
+      if (summary) {
+        const now = envs.find((be) => be.now);
+        const next = envs.find((be) => be.temporary) || envs.find((be) => be.next_boot);
+        summary.textContent = `Running: ${now ? now.name : '-'} · Next boot: ${next ? next.name : '-'}`;
+      }
+      renderTable('#bootenv-table', envs, '#bootenv-empty', (be) => {
+        const tr = document.createElement('tr');
+        const mounted = be.mountpoint && !be.now;
+        tr.innerHTML = `<td>${be.name}</td><td>${be.active}</td><td>${be.mountpoint || '-'}</td><td>${be.space}</td><td>${be.created}</td>
+          <td>
+            <button class="btn" data-action="bootenv-activate" data-name="${be.name}" ${be.next_boot ? 'disabled' : ''}>Activate</button>
+            <button class="btn" data-action="bootenv-activate-once" data-name="${be.name}" ${be.now ? 'disabled' : ''}>Boot once</button>
+            <button class="btn" data-action="bootenv-rename" data-name="${be.name}" ${be.now ? 'disabled' : ''}>Rename</button>
+            <button class="btn" data-action="${mounted ? 'bootenv-unmount' : 'bootenv-mount'}" data-name="${be.name}" ${be.now ? 'disabled' : ''}>${mounted ? 'Unmount' : 'Mount'}</button>
+            <button class="btn" data-action="bootenv-destroy" data-name="${be.name}" ${be.now || be.next_boot ? 'disabled' : ''}>Destroy</button>
+          </td>`;
+        return tr;
+      });
+    };
+
+    const refresh = () => loadBootEnvironments().catch((err) => showBanner(err.message, err.details));
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action^="bootenv-"]');
+      if (!btn) return;
+      const name = btn.dataset.name;
+      clearBanner();
+      try {
+        switch (btn.dataset.action) {
+          case 'bootenv-refresh':
+            await withBusy(btn, () => loadBootEnvironments());
+            return;
+          case 'bootenv-activate': {
+            const ok = await confirmModal('Activate boot environment', `Boot ${name} by default from the next reboot on?`);
+            if (!ok) return;
+            await withBusy(btn, () => api('PUT', '/api/zfs/bootenv', { name, action: 'activate' }));
+            showToast(`${name} activated`);
+            break;
+          }
+          case 'bootenv-activate-once': {
+            const ok = await confirmModal('Boot once', `Boot ${name} on the next reboot only? The following reboot returns to the default.`);
+            if (!ok) return;
+            await withBusy(btn, () => api('PUT', '/api/zfs/bootenv', { name, action: 'activate', temporary: true }));
+            showToast(`${name} set for the next boot`);
+            break;
+          }
+          case 'bootenv-rename': {
+            const newName = prompt(`New name for ${name}`, name);
+            if (!newName || newName.trim() === name) return;
+            await withBusy(btn, () => api('PUT', '/api/zfs/bootenv', { name, action: 'rename', new_name: newName.trim() }));
+            showToast('Boot environment renamed');
+            break;
+          }
+          case 'bootenv-mount': {
+            const data = await withBusy(btn, () => api('PUT', '/api/zfs/bootenv', { name, action: 'mount' }));
+            showToast(data.mountpoint ? `${name} mounted at ${data.mountpoint}` : `${name} mounted`);
+            break;
+          }
+          case 'bootenv-unmount':
+            await withBusy(btn, () => api('PUT', '/api/zfs/bootenv', { name, action: 'unmount' }));
+            showToast(`${name} unmounted`);
+            break;
+          case 'bootenv-destroy': {
+            const ok = await confirmModal('Destroy boot environment', `Destroy ${name} and the snapshot it was cloned from?`);
+            if (!ok) return;
+            await withBusy(btn, () => api('DELETE', '/api/zfs/bootenv', { name, origin: true, confirm: true }));
+            showToast(`${name} destroyed`);
+            break;
+          }
+          default:
+            return;
+        }
+        refresh();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    if (createForm) {
+      createForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const name = document.getElementById('bootenv-name').value.trim();
+        const source = document.getElementById('bootenv-source').value.trim();
+        const btn = createForm.querySelector('button[type="submit"]');
+        try {
+          await withBusy(btn, () => api('POST', '/api/zfs/bootenv', { name, source }));
+          showToast(`${name} created`);
+          createForm.reset();
+          refresh();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+    if (preUpgradeForm) {
+      preUpgradeForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const prefix = document.getElementById('bootenv-prefix').value.trim();
+        const keep = parseInt(document.getElementById('bootenv-keep').value, 10) || 0;
+        const btn = preUpgradeForm.querySelector('button[type="submit"]');
+        try {
+          const data = await withBusy(btn, () => api('POST', '/api/zfs/bootenv', { pre_upgrade: true, prefix, keep }));
+          const pruned = (data.pruned || []).length;
+          showToast(pruned ? `${data.name} created, ${pruned} older removed` : `${data.name} created`);
+          refresh();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    refresh();
+  };
+
+  const bindZFSHistory = () => {
+    const historyTable = document.getElementById('history-table');
+    if (!historyTable) return;
+    const filterForm = document.getElementById('history-filter-form');
+    const poolSelect = document.getElementById('history-pool');
+    const sinceInput = document.getElementById('history-since');
+    const untilInput = document.getElementById('history-until');
+    const queryInput = document.getElementById('history-query');
+    const internalInput = document.getElementById('history-internal');
+    const historyMeta = document.getElementById('history-meta');
+    const eventsStatus = document.getElementById('events-status');
+    const eventsBody = document.querySelector('#events-table tbody');
+    const eventsEmpty = document.getElementById('events-empty');
+    const toggleBtn = document.querySelector('[data-action="events-toggle"]');
+    const clearBtn = document.querySelector('[data-action="events-clear"]');
+    const maxEvents = 500;
+    let source = null;
+    let paused = false;
+
+    const cell = (text, className) => {
+      const td = document.createElement('td');
+      td.textContent = text;
+      if (className) td.className = className;
+      return td;
+    };
+
+    const loadPools = async () => {
+      if (!poolSelect) return;
+      const res = await api('GET', '/api/zfs/pools');
+      const pools = Array.isArray(res) ? res : (res.pools || []);
+      pools.forEach((pool) => {
+        const opt = document.createElement('option');
+        opt.value = pool.name;
+        opt.textContent = pool.name;
+        poolSelect.appendChild(opt);
+      });
+    };
+
+    const loadHistory = async () => {
+      const params = new URLSearchParams();
+      if (poolSelect && poolSelect.value) params.set('pool', poolSelect.value);
+      if (sinceInput && sinceInput.value) params.set('since', sinceInput.value);
+      if (untilInput && untilInput.value) params.set('until', untilInput.value);
+      if (queryInput && queryInput.value.trim()) params.set('q', queryInput.value.trim());
+      if (internalInput && internalInput.checked) params.set('internal', '1');
+      const res = await api('GET', `/api/zfs/history?${params.toString()}`);
+      const entries = res.entries || [];
+      renderTable('#history-table', entries, '#history-empty', (entry) => {
+        const tr = document.createElement('tr');
+        const when = entry.time ? new Date(entry.time).toLocaleString() : '';
+        const user = entry.user ? `${entry.user} (${entry.uid})` : '';
+        const host = entry.zone && entry.zone !== 'global' ? `${entry.host}:${entry.zone}` : (entry.host || '');
+        const command = cell(entry.command || '', entry.internal ? 'muted' : '');
+        if (entry.details && entry.details.length) {
+          command.title = entry.details.join('\n');
+        }
+        tr.append(cell(when), cell(entry.pool || ''), command, cell(user), cell(host), cell(entry.txg ? String(entry.txg) : ''));
+        return tr;
+      });
+      if (historyMeta) {
+        let text = `Showing ${entries.length} of ${res.total || 0} entries, newest first.`;
+        if (res.truncated) text += ' Output was truncated at the output limit; older entries are missing.';
+        historyMeta.textContent = text;
+      }
+    };
+
+    const addEvent = (event) => {
+      if (!eventsBody) return;
+      const tr = document.createElement('tr');
+      const fields = event.fields || {};
+      const skip = new Set(['class', 'time', 'pool', 'vdev_path', 'eid']);
+      const details = Object.keys(fields)
+        .filter((key) => !skip.has(key))
+        .map((key) => `${key}=${fields[key]}`)
+        .join(' ');
+      tr.append(cell(event.time || ''), cell(event.class || ''), cell(event.pool || ''), cell(event.vdev || ''), cell(details, 'tiny'));
+      eventsBody.insertBefore(tr, eventsBody.firstChild);
+      while (eventsBody.children.length > maxEvents) {
+        eventsBody.removeChild(eventsBody.lastChild);
+      }
+      eventsEmpty?.classList.add('hidden');
+    };
+
+    const connectEvents = () => {
+      source = new EventSource('/api/zfs/events');
+      source.onopen = () => {
+        if (eventsStatus) eventsStatus.textContent = 'Live: zpool events -f (buffered events replayed first)';
+      };
+      source.addEventListener('zpool', (ev) => {
+        try {
+          addEvent(JSON.parse(ev.data));
+        } catch (err) {
+          // ignore malformed events
+        }
+      });
+      source.addEventListener('failed', (ev) => {
+        let msg = 'zpool events stopped';
+        try { msg = JSON.parse(ev.data).error || msg; } catch (err) { /* ignore */ }
+        if (eventsStatus) eventsStatus.textContent = msg;
+        source.close();
+        source = null;
+      });
+      source.onerror = () => {
+        if (eventsStatus && source && source.readyState !== EventSource.CLOSED) {
+          eventsStatus.textContent = 'Disconnected, retrying...';
+        }
+      };
+    };
+
+    filterForm?.addEventListener('submit', (e) => {
+      e.preventDefault();
+      clearBanner();
+      loadHistory().catch((err) => showBanner(err.message, err.details));
+    });
+
+    toggleBtn?.addEventListener('click', () => {
+      paused = !paused;
+      if (paused) {
+        if (source) source.close();
+        source = null;
+        toggleBtn.textContent = 'Resume';
+        if (eventsStatus) eventsStatus.textContent = 'Paused';
+      } else {
+        toggleBtn.textContent = 'Pause';
+        if (eventsBody) eventsBody.innerHTML = '';
+        eventsEmpty?.classList.remove('hidden');
+        connectEvents();
+      }
+    });
+
+    clearBtn?.addEventListener('click', () => {
+      if (eventsBody) eventsBody.innerHTML = '';
+      eventsEmpty?.classList.remove('hidden');
+    });
+
+    loadPools().catch((err) => showBanner(err.message, err.details));
+    loadHistory().catch((err) => showBanner(err.message, err.details));
+    connectEvents();
+  };
+
+  const bindZFSMounts = () => {
+    const drivesTable = document.getElementById('zfs-drives-table');
+    const mountsTable = document.getElementById('zfs-mounts-table');
+    if (!drivesTable && !mountsTable) return;
+    const cacheSummary = document.getElementById('cache-summary');
+    const missingPanel = document.getElementById('zfs-drives-missing');
+    const missingList = document.getElementById('zfs-drives-missing-list');
+    const cacheFill = document.getElementById('cache-bar-fill');
+    const cacheDevices = document.getElementById('cache-devices');
+    const mountForm = document.getElementById('mount-create-form');
+    const mountDataset = document.getElementById('mount-dataset');
+    const mountPoint = document.getElementById('mount-point');
+    const mountCanmount = document.getElementById('mount-canmount');
+    const labelForm = document.getElementById('gpt-label-form');
+    const labelProvider = document.getElementById('gpt-provider');
+    const labelName = document.getElementById('gpt-label');
+    const labelsTable = document.getElementById('gpt-labels-table');
+    const labelsEmpty = document.getElementById('gpt-labels-empty');
+
+    const smartCell = (smart) => {
+      if (!smart) return '<td>-</td>';
+      const labels = { ok: 'OK', warn: 'Warning', fail: 'Failing', unknown: smart.standby ? 'Standby' : 'Unknown' };
+      const reasons = smart.error ? [smart.error] : (smart.reasons || []);
+      const cls = smart.level === 'ok' ? 'ok' : (smart.level === 'unknown' ? '' : 'warn');
+      const title = reasons.join('\n').replace(/"/g, '&quot;');
+      return `<td><span class="badge ${cls}" title="${title}">${labels[smart.level] || smart.level}</span></td>`;
+    };
+
+    const loadDrives = async (refresh) => {
+      if (!drivesTable) return;
+      const res = await api('GET', `/api/zfs/drives${refresh ? '?refresh=1' : ''}`);
+      const drives = Array.isArray(res) ? res : (res.drives || []);
+      const cache = res && res.cache ? res.cache : {};
+      const errors = res && res.errors ? res.errors : {};
+      if (errors.pool_devices) {
+        showBanner('Pool device info unavailable', errors.pool_devices);
+      }
+      if (missingPanel && missingList) {
+        const missing = res.missing || [];
+        missingList.innerHTML = '';
+        missing.forEach((rec) => {
+          const line = document.createElement('div');
+          const badge = document.createElement('span');
+          badge.className = 'badge warn';
+          badge.textContent = 'missing';
+          line.appendChild(badge);
+          line.appendChild(document.createTextNode(` ${rec.message} — last seen ${new Date(rec.last_seen).toLocaleString()}`));
+          missingList.appendChild(line);
+        });
+        missingPanel.classList.toggle('hidden', missing.length === 0);
+      }
+      if (cacheSummary) {
+        const usedBytes = cache.used_bytes || 0;
+        const totalBytes = cache.total_bytes || 0;
+        const cacheList = cache.devices || [];
+        if (errors.cache) {
+          cacheSummary.textContent = `Cache info unavailable: ${errors.cache}`;
+        } else if (totalBytes > 0) {
+          cacheSummary.textContent = `L2ARC used ${formatSize(usedBytes)} of ${formatSize(totalBytes)}`;
+        } else if (cacheList.length) {
+          cacheSummary.textContent = `L2ARC used ${formatSize(usedBytes)} (total unknown)`;
+        } else {
+          cacheSummary.textContent = 'No cache devices detected.';
+        }
+        if (cacheFill) {
+          const pct = totalBytes > 0 ? Math.min(100, Math.max(0, Math.round((usedBytes / totalBytes) * 100))) : 0;
+          cacheFill.style.width = `${pct}%`;
+          cacheFill.title = totalBytes > 0 ? `${pct}% used` : '';
+        }
+        if (cacheDevices) {
+          const list = cacheList.map((dev) => `${dev.name}${dev.size ? ` (${dev.size})` : ''}`);
+          cacheDevices.textContent = list.length ? `Cache devices: ${list.join(', ')}` : '';
+        }
+      }
+      renderTable('#zfs-drives-table', drives, '#zfs-drives-empty', (drive) => {
+        const tr = document.createElement('tr');
+        const avail = drive.free || '';
+        const total = drive.size || drive.mediasize || '';
+        const availText = avail && total ? `${avail} / ${total}` : (total ? `- / ${total}` : '-');
+        const smart = drive.smart;
+        const temp = smart && smart.temperature_c ? `${smart.temperature_c}°C` : '-';
+        const hours = smart && smart.power_on_hours ? `${smart.power_on_hours} h` : '-';
+        tr.innerHTML = `<td>${drive.name}</td><td>${drive.pool || ''}</td><td>${drive.role || ''}${drive.vdev ? ` (${drive.vdev})` : ''}</td><td>${availText}</td>${smartCell(smart)}<td>${temp}</td><td>${hours}</td><td>${drive.description || ''}</td><td>${drive.ident || ''}</td><td>${drive.pool ? '' : `<button class="btn" data-action="drive-prepare" data-disk="${drive.name}">Prepare</button>`}</td>`;
+        return tr;
+      });
+    };
+
+    const loadMounts = async () => {
+      if (!mountsTable) return;
+      const mounts = await api('GET', '/api/zfs/mounts');
+      renderTable('#zfs-mounts-table', mounts, '#zfs-mounts-empty', (mnt) => {
+        const tr = document.createElement('tr');
+        const badgeClass = mnt.mounted ? 'ok' : '';
+        const badgeText = mnt.mounted ? 'Yes' : 'No';
+        const action = mnt.mounted ? 'zfs-unmount' : 'zfs-mount';
+        const actionLabel = mnt.mounted ? 'Unmount' : 'Mount';
+        tr.innerHTML = `<td>${mnt.name}</td><td>${mnt.mountpoint}</td><td>${mnt.canmount}</td><td><span class="badge ${badgeClass}">${badgeText}</span></td>\n          <td><button class="btn" data-action="${action}" data-dataset="${mnt.name}">${actionLabel}</button></td>`;
+        return tr;
+      });
+    };
+
+    const loadLabels = async () => {
+      if (!labelsTable) return;
+      const labels = await api('GET', '/api/zfs/labels');
+      renderTable('#gpt-labels-table', labels, '#gpt-labels-empty', (item) => {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `<td>${item.label}</td><td>${item.provider}</td>`;
+        return tr;
+      });
+    };
+
+    const refreshAll = () => Promise.all([loadDrives(), loadMounts(), loadLabels()]);
+
+    // The server pushes an inventory update once it has re-read the disks after a
+    // hot-plug event.
+    devdSource()?.addEventListener('inventory', () => {
+      Promise.all([loadDrives(), loadLabels()]).catch(() => {});
+    });
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action]');
+      if (!btn) return;
+      try {
+        if (btn.dataset.action === 'drives-refresh') {
+          await withBusy(btn, () => loadDrives());
+        }
+        if (btn.dataset.action === 'drives-smart') {
+          await withBusy(btn, () => loadDrives(true));
+        }
+        if (btn.dataset.action === 'mounts-refresh') {
+          await withBusy(btn, () => loadMounts());
+        }
+        if (btn.dataset.action === 'labels-refresh') {
+          await withBusy(btn, () => loadLabels());
+        }
+        if (btn.dataset.action === 'zfs-mount') {
+          const dataset = btn.dataset.dataset;
+          if (!dataset) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/mounts', { dataset, action: 'mount' }));
+          showToast('Dataset mounted');
+          loadMounts();
+        }
+        if (btn.dataset.action === 'zfs-unmount') {
+          const dataset = btn.dataset.dataset;
+          if (!dataset) return;
+          const ok = await confirmModal('Unmount dataset', `Unmount ${dataset}?`);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/mounts', { dataset, action: 'unmount', confirm: true }));
+          showToast('Dataset unmounted');
+          loadMounts();
+        }
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    if (mountForm) {
+      mountForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const name = (mountDataset.value || '').trim();
+        const point = (mountPoint.value || '').trim();
+        const canmount = (mountCanmount.value || '').trim();
+        if (!name || !point) {
+          showBanner('dataset and mountpoint required');
+          return;
+        }
+        const btn = mountForm.querySelector('button[type="submit"]');
+        try {
+          await withBusy(btn, () => api('POST', '/api/zfs/datasets', {
+            name,
+            kind: 'filesystem',
+            size: '',
+            properties: { mountpoint: point, canmount },
+          }));
+          showToast('Mount created');
+          mountForm.reset();
+          loadMounts();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    if (labelForm) {
+      labelForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const provider = (labelProvider.value || '').trim();
+        const label = (labelName.value || '').trim();
         if (!provider || !label) {
           showBanner('provider and label required');
           return;
         }
-        const ok = await confirmModal('Create GPT label', `Create gpt/${label} on ${provider}?`);
-        if (!ok) return;
-        const btn = labelForm.querySelector('button[type="submit"]');
+        const ok = await confirmModal('Create GPT label', `Create gpt/${label} on ${provider}?`);
+        if (!ok) return;
+        const btn = labelForm.querySelector('button[type="submit"]');
+        try {
+          await withBusy(btn, () => api('POST', '/api/zfs/labels', { label, provider, confirm: true }));
+          showToast('Label created');
+          labelForm.reset();
+          loadLabels();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    refreshAll().catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindSelfTests = () => {
+    const scheduleForm = document.getElementById('selftest-schedule-form');
+    if (!scheduleForm) return;
+    const runForm = document.getElementById('selftest-run-form');
+    const runTest = document.getElementById('selftest-run-test');
+    const runDevices = document.getElementById('selftest-run-devices');
+    const runLog = document.getElementById('selftest-log');
+    const stId = document.getElementById('selftest-id');
+    const stTest = document.getElementById('selftest-test');
+    const stDevices = document.getElementById('selftest-devices');
+    const stEnabled = document.getElementById('selftest-enabled');
+    const stMode = document.getElementById('selftest-mode');
+    const stFrequency = document.getElementById('selftest-frequency');
+    const stTime = document.getElementById('selftest-time');
+    const stDay = document.getElementById('selftest-day');
+    const stMinute = document.getElementById('selftest-minute');
+    const stHour = document.getElementById('selftest-hour');
+    const stDom = document.getElementById('selftest-dom');
+    const stMonth = document.getElementById('selftest-month');
+    const stDow = document.getElementById('selftest-dow');
+    const stPreview = document.getElementById('selftest-preview');
+    const stReset = document.getElementById('selftest-reset');
+    const historyDevice = document.getElementById('selftest-history-device');
+
+    const state = { items: [] };
+    const splitDevices = (raw) => (raw || '').split(',').map((d) => d.trim()).filter(Boolean);
+
+    const buildQuickSchedule = () => {
+      const [hourRaw, minuteRaw] = (stTime.value || '03:00').split(':');
+      const schedule = { minute: minuteRaw || '0', hour: hourRaw || '0', dom: '*', month: '*', dow: '*' };
+      if (stFrequency.value === 'weekly') {
+        schedule.dow = stDay.value || '0';
+      }
+      if (stFrequency.value === 'monthly') {
+        schedule.dom = stDay.value || '1';
+      }
+      return schedule;
+    };
+
+    const buildAdvancedSchedule = () => {
+      const minute = stMinute.value.trim();
+      const hour = stHour.value.trim();
+      const dom = stDom.value.trim();
+      const month = stMonth.value.trim();
+      const dow = stDow.value.trim();
+      if (!minute || !hour || !dom || !month || !dow) {
+        return null;
+      }
+      return { minute, hour, dom, month, dow };
+    };
+
+    const updatePreview = () => {
+      const schedule = stMode.value === 'advanced' ? buildAdvancedSchedule() : buildQuickSchedule();
+      if (!schedule) {
+        stPreview.textContent = 'Cron: invalid (fill all fields)';
+        return;
+      }
+      stPreview.textContent = `Cron: ${schedule.minute} ${schedule.hour} ${schedule.dom} ${schedule.month} ${schedule.dow}`;
+    };
+
+    const setMode = (mode) => {
+      document.querySelectorAll('.selftest-quick').forEach((el) => el.classList.toggle('hidden', mode !== 'quick'));
+      document.querySelectorAll('.selftest-advanced').forEach((el) => el.classList.toggle('hidden', mode !== 'advanced'));
+      updatePreview();
+    };
+
+    const resetForm = () => {
+      scheduleForm.reset();
+      stId.value = '';
+      setMode('quick');
+    };
+
+    const loadSchedules = async () => {
+      const data = await api('GET', '/api/zfs/drives/selftests/schedules');
+      state.items = data.items || [];
+      renderTable('#selftest-schedules-table', state.items, '#selftest-schedules-empty', (item) => {
+        const tr = document.createElement('tr');
+        const devices = (item.devices || []).length ? item.devices.join(', ') : 'all';
+        tr.innerHTML = `<td>${item.test}</td><td>${devices}</td><td>${summarizeCron(item.schedule, item.cron)}</td><td>${item.cron}</td><td>${item.enabled}</td>
+          <td><button class="btn" data-action="selftest-schedule-toggle" data-id="${item.id}">${item.enabled ? 'Disable' : 'Enable'}</button>
+          <button class="btn" data-action="selftest-schedule-edit" data-id="${item.id}">Edit</button>
+          <button class="btn" data-action="selftest-schedule-delete" data-id="${item.id}">Delete</button></td>`;
+        return tr;
+      });
+    };
+
+    const loadHistory = async () => {
+      const device = historyDevice ? historyDevice.value.trim() : '';
+      const data = await api('GET', `/api/zfs/drives/selftests${device ? `?device=${encodeURIComponent(device)}` : ''}`);
+      renderTable('#selftest-history-table', data.items || [], '#selftest-history-empty', (rec) => {
+        const tr = document.createElement('tr');
+        const cls = rec.result === 'passed' ? 'ok' : (rec.result === 'failed' ? 'warn' : '');
+        const completed = rec.completed ? new Date(rec.completed).toLocaleString() : '';
+        tr.innerHTML = `<td>${rec.device}</td><td>${rec.serial || ''}</td><td>${rec.test}</td><td><span class="badge ${cls}">${rec.result}</span></td><td>${rec.status}</td><td>${completed}</td><td>${rec.lifetime_hours}</td>`;
+        return tr;
+      });
+    };
+
+    const watchSelfTestJob = (id) => {
+      if (runLog) {
+        runLog.classList.remove('hidden');
+        runLog.textContent = '';
+      }
+      const evt = new EventSource(`/api/jobs/${id}/stream`);
+      evt.onmessage = (ev) => {
+        if (runLog) runLog.textContent += `${ev.data}\n`;
+      };
+      evt.onerror = () => { evt.close(); };
+      const poll = async () => {
+        try {
+          const job = await api('GET', `/api/jobs/${id}`);
+          if (!job.done) {
+            setTimeout(poll, 5000);
+            return;
+          }
+          evt.close();
+          if (runLog) runLog.textContent = job.output || '';
+          if (job.exit_code === 0) {
+            showToast('Self-tests finished');
+          } else {
+            showBanner('Self-tests failed', (job.output || '').trim());
+          }
+          loadHistory().catch(() => {});
+        } catch (err) {
+          evt.close();
+          showBanner(err.message, err.details);
+        }
+      };
+      poll();
+    };
+
+    runForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const test = runTest.value;
+      const devices = splitDevices(runDevices.value);
+      if (test === 'long') {
+        const ok = await confirmModal('Run long self-test', `Start a long self-test on ${devices.length ? devices.join(', ') : 'all disks'}? Drives stay busy for hours and pool I/O slows down.`);
+        if (!ok) return;
+      }
+      const btn = runForm.querySelector('button[type="submit"]');
+      try {
+        const data = await withBusy(btn, () => api('POST', '/api/zfs/drives/selftests', { test, devices }));
+        showToast('Self-tests started');
+        watchSelfTestJob(data.job_id);
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    scheduleForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const schedule = stMode.value === 'advanced' ? buildAdvancedSchedule() : buildQuickSchedule();
+      if (!schedule) {
+        showBanner('invalid cron fields');
+        return;
+      }
+      const payload = {
+        id: stId.value,
+        test: stTest.value,
+        devices: splitDevices(stDevices.value),
+        enabled: stEnabled.value === 'true',
+        schedule,
+      };
+      try {
+        await withBusy(document.getElementById('selftest-save'), () => api('POST', '/api/zfs/drives/selftests/schedules', payload));
+        showToast(payload.id ? 'Schedule updated' : 'Schedule saved');
+        resetForm();
+        loadSchedules();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action^="selftest-"]');
+      if (!btn) return;
+      const id = btn.dataset.id;
+      try {
+        if (btn.dataset.action === 'selftest-history-refresh') {
+          await withBusy(btn, () => loadHistory());
+          return;
+        }
+        if (btn.dataset.action === 'selftest-schedule-edit') {
+          const item = state.items.find((entry) => entry.id === id);
+          if (!item) return;
+          stId.value = item.id;
+          stTest.value = item.test;
+          stDevices.value = (item.devices || []).join(',');
+          stEnabled.value = item.enabled ? 'true' : 'false';
+          stMode.value = 'advanced';
+          stMinute.value = item.schedule.minute;
+          stHour.value = item.schedule.hour;
+          stDom.value = item.schedule.dom;
+          stMonth.value = item.schedule.month;
+          stDow.value = item.schedule.dow;
+          setMode('advanced');
+          return;
+        }
+        if (btn.dataset.action === 'selftest-schedule-delete') {
+          const ok = await confirmModal('Delete schedule', 'Delete this self-test schedule?');
+          if (!ok) return;
+          await withBusy(btn, () => api('DELETE', `/api/zfs/schedules/${id}`, { confirm: true }));
+          showToast('Schedule deleted');
+        }
+        if (btn.dataset.action === 'selftest-schedule-toggle') {
+          await withBusy(btn, () => api('PUT', `/api/zfs/schedules/${id}`, { toggle: true }));
+          showToast('Schedule updated');
+        }
+        loadSchedules();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    [stMode, stFrequency, stTime, stDay, stMinute, stHour, stDom, stMonth, stDow].forEach((el) => {
+      el.addEventListener('input', updatePreview);
+      el.addEventListener('change', updatePreview);
+    });
+    stMode.addEventListener('change', () => setMode(stMode.value));
+    if (stReset) stReset.addEventListener('click', resetForm);
+
+    setMode(stMode.value);
+    loadSchedules().catch((err) => showBanner(err.message, err.details));
+    loadHistory().catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindGELI = () => {
+    const table = document.getElementById('geli-table');
+    if (!table) return;
+    const meta = document.getElementById('geli-meta');
+    const lockedPanel = document.getElementById('geli-locked');
+    const lockedList = document.getElementById('geli-locked-list');
+    const attachForm = document.getElementById('geli-attach-form');
+    const attachProvider = document.getElementById('geli-attach-provider');
+    const attachPass = document.getElementById('geli-attach-passphrase');
+    const attachKeyfile = document.getElementById('geli-attach-keyfile');
+    const initForm = document.getElementById('geli-init-form');
+    const initCipher = document.getElementById('geli-init-cipher');
+    const bootForm = document.getElementById('geli-boot-form');
+
+    const load = async () => {
+      const data = await api('GET', '/api/zfs/geli');
+      if (meta) meta.textContent = data.key_dir ? `Key directory: ${data.key_dir}` : '';
+      if (initCipher && !initCipher.children.length) {
+        (data.ciphers || []).forEach((cipher) => {
+          const opt = document.createElement('option');
+          opt.value = cipher;
+          opt.textContent = cipher;
+          initCipher.appendChild(opt);
+        });
+      }
+      const locked = data.locked_pools || [];
+      if (lockedPanel && lockedList) {
+        lockedList.innerHTML = '';
+        locked.forEach((pool) => {
+          const waiting = (data.boot || []).filter((entry) => entry.pool === pool && !entry.attached).map((entry) => entry.provider);
+          const line = document.createElement('div');
+          line.textContent = waiting.length ? `${pool}: unlock ${waiting.join(', ')}` : `${pool}: all providers attached, not imported`;
+          lockedList.appendChild(line);
+        });
+        lockedPanel.classList.toggle('hidden', locked.length === 0);
+      }
+      renderTable('#geli-table', data.providers || [], '#geli-empty', (prov) => {
+        const tr = document.createElement('tr');
+        const cls = prov.status === 'ACTIVE' ? 'ok' : 'warn';
+        const action = prov.pool ? '' : `<button class="btn" data-action="geli-detach" data-provider="${prov.component}">Detach</button>`;
+        tr.innerHTML = `<td>${prov.name}</td><td><span class="badge ${cls}">${prov.status}</span></td><td>${prov.component}</td><td>${prov.pool || ''}</td><td>${action}</td>`;
+        return tr;
+      });
+      renderTable('#geli-boot-table', data.boot || [], '#geli-boot-empty', (entry) => {
+        const tr = document.createElement('tr');
+        const state = entry.attached ? '<span class="badge ok">attached</span>' : '<span class="badge warn">locked</span>';
+        const unlock = entry.attached ? '' : `<button class="btn" data-action="geli-unlock" data-provider="${entry.provider}" data-keyfile="${entry.keyfile || ''}">Unlock</button> `;
+        tr.innerHTML = `<td>${entry.provider}</td><td>${entry.keyfile || ''}</td><td>${entry.passphrase ? 'yes' : 'no'}</td><td>${entry.pool || ''}</td><td>${state}</td>
+          <td>${unlock}<button class="btn" data-action="geli-unboot" data-provider="${entry.provider}">Remove</button></td>`;
+        return tr;
+      });
+    };
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action]');
+      if (!btn) return;
+      const provider = btn.dataset.provider;
+      try {
+        if (btn.dataset.action === 'geli-refresh') {
+          await withBusy(btn, load);
+        }
+        if (btn.dataset.action === 'geli-unlock') {
+          attachProvider.value = provider;
+          attachKeyfile.value = btn.dataset.keyfile || '';
+          attachPass.value = '';
+          attachPass.focus();
+        }
+        if (btn.dataset.action === 'geli-detach') {
+          const ok = await confirmModal('Detach GELI provider', `Detach ${provider}.eli? Data stays encrypted on ${provider}.`);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/geli', { action: 'detach', provider, confirm: true }));
+          showToast('Provider detached');
+          load();
+        }
+        if (btn.dataset.action === 'geli-unboot') {
+          const ok = await confirmModal('Remove startup attach', `Stop attaching ${provider} at startup?`);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/geli', { action: 'unboot', provider }));
+          showToast('Startup attach removed');
+          load();
+        }
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    attachForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const btn = attachForm.querySelector('button[type="submit"]');
+      const payload = {
+        action: 'attach',
+        provider: attachProvider.value.trim(),
+        passphrase: attachPass.value,
+        keyfile: attachKeyfile.value.trim(),
+      };
+      try {
+        const res = await withBusy(btn, () => api('POST', '/api/zfs/geli', payload));
+        attachPass.value = '';
+        const imported = res.imported || [];
+        showToast(imported.length ? `Attached ${res.provider}, imported ${imported.join(', ')}` : `Attached ${res.provider}`);
+        load();
+      } catch (err) {
+        attachPass.value = '';
+        showBanner(err.message, err.details);
+      }
+    });
+
+    initForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const pass = document.getElementById('geli-init-passphrase');
+      const pass2 = document.getElementById('geli-init-passphrase2');
+      const provider = document.getElementById('geli-init-provider').value.trim();
+      const keyfile = document.getElementById('geli-init-keyfile').value.trim();
+      if (pass.value !== pass2.value) {
+        showBanner('passphrases do not match');
+        return;
+      }
+      if (!pass.value && !keyfile) {
+        showBanner('passphrase or keyfile required');
+        return;
+      }
+      const ok = await confirmModal('Initialize GELI', `Initialize GELI on ${provider}? Existing data on it becomes unreadable.`);
+      if (!ok) return;
+      const btn = initForm.querySelector('button[type="submit"]');
+      try {
+        await withBusy(btn, () => api('POST', '/api/zfs/geli', {
+          action: 'init',
+          provider,
+          passphrase: pass.value,
+          keyfile,
+          cipher: initCipher.value,
+          key_length: parseInt(document.getElementById('geli-init-keylen').value, 10) || 256,
+          sector_size: parseInt(document.getElementById('geli-init-sector').value, 10) || 4096,
+          confirm: true,
+        }));
+        showToast(`Initialized ${provider}; attach it to use ${provider}.eli`);
+        attachProvider.value = provider;
+        attachKeyfile.value = keyfile;
+        load();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      } finally {
+        pass.value = '';
+        pass2.value = '';
+      }
+    });
+
+    bootForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const btn = bootForm.querySelector('button[type="submit"]');
+      try {
+        await withBusy(btn, () => api('POST', '/api/zfs/geli', {
+          action: 'boot',
+          provider: document.getElementById('geli-boot-provider').value.trim(),
+          keyfile: document.getElementById('geli-boot-keyfile').value.trim(),
+          needs_passphrase: document.getElementById('geli-boot-passphrase').checked,
+          pool: document.getElementById('geli-boot-pool').value.trim(),
+        }));
+        showToast('Startup attach registered');
+        bootForm.reset();
+        load();
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    load().catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindInventory = () => {
+    const table = document.getElementById('inventory-table');
+    if (!table) return;
+    const meta = document.getElementById('inventory-meta');
+    const when = (value) => (value ? new Date(value).toLocaleString() : '');
+
+    const load = async (refresh) => {
+      const data = await api('GET', `/api/zfs/drives/inventory${refresh ? '?refresh=1' : ''}`);
+      if (meta) {
+        const updated = data.updated && !data.updated.startsWith('0001') ? `Updated ${when(data.updated)}` : 'Not recorded yet';
+        meta.textContent = data.error ? `${updated} — last refresh failed: ${data.error}` : updated;
+      }
+      renderTable('#inventory-table', data.disks || [], '#inventory-empty', (rec) => {
+        const tr = document.createElement('tr');
+        const member = rec.member ? `${rec.member.pool}${rec.member.vdev ? ` / ${rec.member.vdev}` : ''}${rec.member.role && rec.member.role !== 'data' ? ` (${rec.member.role})` : ''}` : '';
+        const status = rec.present ? '<span class="badge ok">present</span>' : '<span class="badge warn">missing</span>';
+        tr.innerHTML = `<td>${rec.serial}</td><td>${rec.device}</td><td>${member}</td><td>${(rec.labels || []).join(', ')}</td><td>${(rec.gptids || []).join(', ')}</td><td>${(rec.geli || []).join(', ')}</td><td>${when(rec.first_seen)}</td><td>${when(rec.last_seen)}</td><td>${status}</td>`;
+        return tr;
+      });
+      renderTable('#inventory-events-table', data.events || [], '#inventory-events-empty', (ev) => {
+        const tr = document.createElement('tr');
+        const cls = ev.kind === 'missing' ? 'warn' : (ev.kind === 'appeared' || ev.kind === 'returned' ? 'ok' : '');
+        tr.innerHTML = `<td>${when(ev.time)}</td><td>${ev.serial}</td><td><span class="badge ${cls}">${ev.kind}</span></td><td>${ev.message}</td>`;
+        return tr;
+      });
+    };
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action="inventory-refresh"]');
+      if (!btn) return;
+      try {
+        await withBusy(btn, () => load(true));
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    devdSource()?.addEventListener('inventory', () => {
+      load().catch(() => {});
+    });
+
+    load().catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindHotplug = () => {
+    const table = document.getElementById('devd-events-table');
+    if (!table) return;
+    const status = document.getElementById('devd-status');
+    const body = table.querySelector('tbody');
+    const empty = document.getElementById('devd-events-empty');
+    const maxRows = 200;
+    const source = devdSource();
+    if (!source) {
+      if (status) status.textContent = 'This browser does not support live events.';
+      return;
+    }
+
+    const badges = { 'disk-attach': 'ok', 'disk-detach': 'warn', 'vdev-state': 'warn', checksum: 'warn', 'io-error': 'warn' };
+    const details = (ev) => {
+      if (ev.kind === 'vdev-state') return `${ev.vdev || 'vdev'} is ${ev.state || 'changed'}`;
+      if (ev.kind === 'checksum') return `checksum error on ${ev.vdev || 'a vdev'}`;
+      if (ev.kind === 'io-error') return `I/O error on ${ev.vdev || 'a vdev'}`;
+      return ev.type || ev.raw;
+    };
+
+    source.addEventListener('status', (msg) => {
+      if (!status) return;
+      try {
+        const st = JSON.parse(msg.data);
+        status.textContent = st.connected
+          ? `Live: devd events from ${st.socket}`
+          : `devd unavailable${st.error ? ` (${st.error})` : ''}; importable pools are polled every 20 seconds.`;
+      } catch (err) {
+        // ignore malformed events
+      }
+    });
+    source.addEventListener('devd', (msg) => {
+      let ev;
+      try { ev = JSON.parse(msg.data); } catch (err) { return; }
+      const tr = document.createElement('tr');
+      tr.innerHTML = `<td>${new Date(ev.time).toLocaleString()}</td><td><span class="badge ${badges[ev.kind] || ''}">${ev.kind}</span></td><td>${ev.device || ev.vdev || ''}</td><td>${ev.pool || ''}</td><td>${details(ev)}</td>`;
+      tr.title = ev.raw;
+      body.prepend(tr);
+      while (body.children.length > maxRows) body.lastElementChild.remove();
+      empty?.classList.add('hidden');
+    });
+    source.addEventListener('error', () => {
+      if (status && source.readyState !== EventSource.CLOSED) status.textContent = 'Disconnected, retrying...';
+    });
+  };
+
+  const bindPrepareDisk = () => {
+    const form = document.getElementById('prepare-form');
+    if (!form) return;
+    const diskSelect = document.getElementById('prepare-disk');
+    const gptInput = document.getElementById('prepare-gpt');
+    const labelInput = document.getElementById('prepare-label');
+    const alignInput = document.getElementById('prepare-align');
+    const serialInput = document.getElementById('prepare-serial');
+    const status = document.getElementById('prepare-status');
+    const log = document.getElementById('prepare-log');
+
+    const loadDisks = async () => {
+      const res = await api('GET', '/api/zfs/drives');
+      const drives = Array.isArray(res) ? res : (res.drives || []);
+      const current = diskSelect.value;
+      diskSelect.innerHTML = '';
+      drives.filter((drive) => drive.name && !drive.pool).forEach((drive) => {
+        const opt = document.createElement('option');
+        opt.value = drive.name;
+        opt.textContent = `${drive.name}${drive.ident ? ` — ${drive.ident}` : ''}`;
+        diskSelect.appendChild(opt);
+      });
+      if (current) diskSelect.value = current;
+    };
+
+    const check = async () => {
+      const disk = diskSelect.value;
+      if (!disk) {
+        status.textContent = 'No unused disks.';
+        return null;
+      }
+      const label = gptInput.checked ? (labelInput.value || '').trim() : '';
+      const res = await api('GET', `/api/zfs/drives/prepare?disk=${encodeURIComponent(disk)}&label=${encodeURIComponent(label)}`);
+      const serial = res.serial || '';
+      if (serial && !labelInput.value) {
+        labelInput.value = `zfs-${serial}`.replace(/[^A-Za-z0-9._-]/g, '').slice(0, 36);
+      }
+      const ident = serial ? `serial ${serial}` : 'no serial reported, type the disk name';
+      const blockers = res.blockers || [];
+      status.innerHTML = '';
+      const line = document.createElement('div');
+      line.textContent = `${res.disk} (${ident})${res.size ? `, ${res.size}` : ''}: `;
+      const badge = document.createElement('span');
+      badge.className = `badge ${blockers.length ? 'warn' : 'ok'}`;
+      badge.textContent = blockers.length ? 'in use' : 'ready';
+      line.appendChild(badge);
+      status.appendChild(line);
+      blockers.forEach((text) => {
+        const item = document.createElement('div');
+        item.textContent = text;
+        status.appendChild(item);
+      });
+      return res;
+    };
+
+    const watchJob = (id) => {
+      log.classList.remove('hidden');
+      log.textContent = '';
+      const evt = new EventSource(`/api/jobs/${id}/stream`);
+      evt.onmessage = (ev) => {
+        log.textContent += `${ev.data}\n`;
+      };
+      evt.onerror = () => { evt.close(); };
+      const poll = async () => {
+        try {
+          const job = await api('GET', `/api/jobs/${id}`);
+          if (!job.done) {
+            setTimeout(poll, 2000);
+            return;
+          }
+          evt.close();
+          log.textContent = job.output || '';
+          if (job.exit_code === 0) {
+            showToast('Disk prepared');
+          } else {
+            showBanner('Disk preparation failed', (job.output || '').trim());
+          }
+          serialInput.value = '';
+          check().catch(() => {});
+        } catch (err) {
+          evt.close();
+          showBanner(err.message, err.details);
+        }
+      };
+      poll();
+    };
+
+    const syncLayout = () => {
+      labelInput.disabled = !gptInput.checked;
+      alignInput.disabled = !gptInput.checked;
+    };
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action="drive-prepare"], [data-action="prepare-check"]');
+      if (!btn) return;
+      try {
+        if (btn.dataset.action === 'drive-prepare') {
+          await loadDisks();
+          diskSelect.value = btn.dataset.disk;
+          labelInput.value = '';
+          serialInput.value = '';
+          form.scrollIntoView({ behavior: 'smooth' });
+        }
+        await withBusy(btn, check);
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    diskSelect.addEventListener('change', () => {
+      labelInput.value = '';
+      serialInput.value = '';
+      check().catch((err) => showBanner(err.message, err.details));
+    });
+    gptInput.addEventListener('change', syncLayout);
+
+    form.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const disk = diskSelect.value;
+      if (!disk) return;
+      const payload = {
+        disk,
+        gpt: gptInput.checked,
+        label: (labelInput.value || '').trim(),
+        align: (alignInput.value || '').trim(),
+        confirm_serial: (serialInput.value || '').trim(),
+      };
+      const layout = payload.gpt ? `create a GPT with gpt/${payload.label}` : 'leave it blank';
+      const ok = await confirmModal('Wipe disk', `Erase all ZFS labels and partitions on ${disk} and ${layout}? This cannot be undone.`);
+      if (!ok) return;
+      const btn = form.querySelector('button[type="submit"]');
+      try {
+        const res = await withBusy(btn, () => api('POST', '/api/zfs/drives/prepare', payload));
+        watchJob(res.job_id);
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    syncLayout();
+    loadDisks()
+      .then(() => (diskSelect.value ? check() : null))
+      .catch((err) => showBanner(err.message, err.details));
+  };
+
+  const bindPartitions = () => {
+    const diskSelect = document.getElementById('part-disk');
+    if (!diskSelect) return;
+    const meta = document.getElementById('part-meta');
+    const schemeForm = document.getElementById('part-scheme-form');
+    const schemeSelect = document.getElementById('part-scheme');
+    const addForm = document.getElementById('part-add-form');
+    const typeInput = document.getElementById('part-type');
+    const typeList = document.getElementById('part-types');
+    const alignInput = document.getElementById('part-align');
+    const sizeInput = document.getElementById('part-size');
+    const labelInput = document.getElementById('part-label');
+
+    const state = { table: null };
+
+    const loadDisks = async () => {
+      const res = await api('GET', '/api/zfs/drives');
+      const drives = Array.isArray(res) ? res : (res.drives || []);
+      const current = diskSelect.value;
+      diskSelect.innerHTML = '';
+      drives.forEach((drive) => {
+        if (!drive.name) return;
+        const opt = document.createElement('option');
+        opt.value = drive.name;
+        opt.textContent = `${drive.name}${drive.pool ? ` (${drive.pool})` : ''}`;
+        diskSelect.appendChild(opt);
+      });
+      if (current) diskSelect.value = current;
+    };
+
+    const loadLayout = async () => {
+      const disk = diskSelect.value;
+      if (!disk) {
+        renderTable('#partitions-table', [], '#partitions-empty', () => null);
+        return;
+      }
+      const data = await api('GET', `/api/zfs/partitions?disk=${encodeURIComponent(disk)}`);
+      if (typeList && !typeList.children.length) {
+        (data.types || []).forEach((type) => {
+          const opt = document.createElement('option');
+          opt.value = type;
+          typeList.appendChild(opt);
+        });
+      }
+      const table = (data.tables || [])[0] || null;
+      state.table = table;
+      if (meta) {
+        if (!table) {
+          meta.textContent = 'No partition table';
+        } else {
+          const stateText = table.state ? ` [${table.state}]` : '';
+          meta.textContent = `${table.scheme.toUpperCase()} ${table.size || ''}${stateText}${table.pool ? ` — whole disk in pool ${table.pool}` : ''}`;
+        }
+      }
+      renderTable('#partitions-table', table ? table.entries : [], '#partitions-empty', (entry) => {
+        const tr = document.createElement('tr');
+        if (entry.free) {
+          tr.innerHTML = `<td></td><td class="muted">free</td><td></td><td></td><td>${entry.start}</td><td>${entry.size || ''}</td><td></td><td></td>`;
+          return tr;
+        }
+        const pool = entry.pool ? `<span class="badge warn">${entry.pool}</span>` : '';
+        const action = entry.pool ? '' : `<button class="btn" data-action="partition-delete" data-index="${entry.index}" data-provider="${entry.provider}">Delete</button>`;
+        tr.innerHTML = `<td>${entry.index}</td><td>${entry.provider}</td><td>${entry.type}</td><td>${entry.label || ''}</td><td>${entry.start}</td><td>${entry.size || ''}</td><td>${pool}</td><td>${action}</td>`;
+        return tr;
+      });
+    };
+
+    diskSelect.addEventListener('change', () => {
+      loadLayout().catch((err) => showBanner(err.message, err.details));
+    });
+
+    document.addEventListener('click', async (e) => {
+      const btn = e.target.closest('[data-action]');
+      if (!btn) return;
+      const disk = diskSelect.value;
+      try {
+        if (btn.dataset.action === 'partitions-refresh') {
+          await withBusy(btn, async () => {
+            await loadDisks();
+            await loadLayout();
+          });
+        }
+        if (btn.dataset.action === 'partition-delete') {
+          const index = Number(btn.dataset.index);
+          const ok = await confirmModal('Delete partition', `Delete ${btn.dataset.provider}? Data on it will be lost.`);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/partitions', { action: 'delete', disk, index, confirm: true }));
+          showToast('Partition deleted');
+          loadLayout();
+        }
+        if (btn.dataset.action === 'partitions-destroy') {
+          if (!disk || !state.table) return;
+          const force = state.table.entries.some((entry) => !entry.free);
+          const msg = force
+            ? `Destroy the ${state.table.scheme.toUpperCase()} table on ${disk} and all of its partitions?`
+            : `Destroy the ${state.table.scheme.toUpperCase()} table on ${disk}?`;
+          const ok = await confirmModal('Destroy partition table', msg);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/partitions', { action: 'destroy', disk, force, confirm: true }));
+          showToast('Partition table destroyed');
+          loadLayout();
+        }
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    if (schemeForm) {
+      schemeForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const disk = diskSelect.value;
+        if (!disk) return;
+        const btn = schemeForm.querySelector('button[type="submit"]');
         try {
-          await withBusy(btn, () => api('POST', '/api/zfs/labels', { label, provider, confirm: true }));
-          showToast('Label created');
-          labelForm.reset();
-          loadLabels();
+          await withBusy(btn, () => api('POST', '/api/zfs/partitions', { action: 'create', disk, scheme: schemeSelect.value }));
+          showToast('Partition table created');
+          loadLayout();
         } catch (err) {
           showBanner(err.message, err.details);
         }
       });
     }
 
-    refreshAll().catch((err) => showBanner(err.message, err.details));
+    if (addForm) {
+      addForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        clearBanner();
+        const disk = diskSelect.value;
+        if (!disk) return;
+        const payload = {
+          action: 'add',
+          disk,
+          type: (typeInput.value || '').trim(),
+          align: (alignInput.value || '').trim(),
+          size: (sizeInput.value || '').trim(),
+          label: (labelInput.value || '').trim(),
+        };
+        const btn = addForm.querySelector('button[type="submit"]');
+        try {
+          const res = await withBusy(btn, () => api('POST', '/api/zfs/partitions', payload));
+          showToast(`Added ${res.label || res.provider || 'partition'}`);
+          sizeInput.value = '';
+          labelInput.value = '';
+          loadLayout();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
+    loadDisks()
+      .then(loadLayout)
+      .catch((err) => showBanner(err.message, err.details));
   };
 
   const bindZFSSnapshots = () => {
@@ -2095,13 +4055,57 @@
       }
     };
 
+    const rangeFrom = document.getElementById('snapshot-range-from');
+    const rangeTo = document.getElementById('snapshot-range-to');
+    const selectAll = document.getElementById('snapshot-select-all');
+    const bulkSummary = document.getElementById('snapshot-bulk-summary');
+    let currentSnaps = [];
+
+    const selectedSnapshots = () => Array.from(document.querySelectorAll('#zfs-snapshots-table tbody input[type="checkbox"]:checked')).map((el) => el.value);
+
+    const updateBulkSummary = () => {
+      if (!bulkSummary) return;
+      const count = selectedSnapshots().length;
+      bulkSummary.textContent = count ? `${count} snapshot(s) selected.` : 'No snapshots selected.';
+    };
+
+    const setSelection = (names) => {
+      const wanted = new Set(names);
+      document.querySelectorAll('#zfs-snapshots-table tbody input[type="checkbox"]').forEach((el) => {
+        el.checked = wanted.has(el.value);
+      });
+      if (selectAll) selectAll.checked = names.length > 0 && names.length === currentSnaps.length;
+      updateBulkSummary();
+    };
+
+    const fillRangeSelects = () => {
+      [rangeFrom, rangeTo].forEach((select, idx) => {
+        if (!select) return;
+        select.innerHTML = '';
+        currentSnaps.forEach((snap) => {
+          const option = document.createElement('option');
+          option.value = snap.name;
+          option.textContent = snap.name.split('@')[1] || snap.name;
+          select.appendChild(option);
+        });
+        if (currentSnaps.length) {
+          select.value = idx === 0 ? currentSnaps[0].name : currentSnaps[currentSnaps.length - 1].name;
+        }
+      });
+    };
+
+    const bulkSelection = () => ({ dataset: picker.getSelected(), snapshots: selectedSnapshots() });
+
     const loadSnapshots = async () => {
       const dataset = picker.getSelected();
       if (!dataset) return;
       const snaps = await api('GET', `/api/zfs/snapshots?dataset=${encodeURIComponent(dataset)}`);
+      currentSnaps = snaps || [];
+      fillRangeSelects();
+      if (selectAll) selectAll.checked = false;
       renderTable('#zfs-snapshots-table', snaps, '#zfs-snapshots-empty', (snap) => {
         const tr = document.createElement('tr');
-        tr.innerHTML = `<td>${snap.name}</td><td>${snap.created}</td>
+        tr.innerHTML = `<td><input type="checkbox" value="${snap.name}" aria-label="Select"></td><td>${snap.name}</td><td>${snap.created}</td><td>${formatSize(snap.used || 0)}</td><td>${formatSize(snap.written || 0)}</td>
           <td>
             <button class="btn" data-action="snapshot-destroy" data-name="${snap.name}">Destroy</button>
             <button class="btn" data-action="snapshot-force-destroy" data-name="${snap.name}">Force Destroy</button>
@@ -2145,8 +4149,47 @@
         showToast('Snapshot force-destroy requested');
         loadSnapshots();
       }
+      if (btn.dataset.action === 'snapshot-range-select') {
+        const from = currentSnaps.findIndex((snap) => snap.name === rangeFrom.value);
+        const to = currentSnaps.findIndex((snap) => snap.name === rangeTo.value);
+        if (from < 0 || to < 0) return;
+        const [lo, hi] = from <= to ? [from, to] : [to, from];
+        setSelection(currentSnaps.slice(lo, hi + 1).map((snap) => snap.name));
+      }
+      if (btn.dataset.action === 'snapshot-select-none') {
+        setSelection([]);
+      }
+      if (btn.dataset.action === 'snapshot-bulk-preview' || btn.dataset.action === 'snapshot-bulk-destroy') {
+        clearBanner();
+        const selection = bulkSelection();
+        if (!selection.snapshots.length) {
+          showBanner('select at least one snapshot');
+          return;
+        }
+        try {
+          const preview = await withBusy(btn, () => api('POST', '/api/zfs/snapshots/preview', selection));
+          const summary = `${preview.snapshots.length} snapshot(s), ${formatSize(preview.reclaim)} reclaimable`;
+          if (bulkSummary) bulkSummary.textContent = summary;
+          if (btn.dataset.action === 'snapshot-bulk-preview') return;
+          const ok = await confirmModal('Destroy snapshots', `Destroy ${summary}? This cannot be undone.`);
+          if (!ok) return;
+          const res = await withBusy(btn, () => api('POST', '/api/zfs/snapshots/destroy', { ...selection, confirm: true, expected: preview.snapshots }));
+          showToast(`Destroyed ${res.destroyed.length} snapshot(s), freed ${formatSize(res.reclaim)}`);
+          loadSnapshots();
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      }
     });
 
+    if (selectAll) {
+      selectAll.addEventListener('change', () => setSelection(selectAll.checked ? currentSnaps.map((snap) => snap.name) : []));
+    }
+    const snapshotsBody = document.querySelector('#zfs-snapshots-table tbody');
+    if (snapshotsBody) {
+      snapshotsBody.addEventListener('change', updateBulkSummary);
+    }
+
     form.addEventListener('submit', async (e) => {
       e.preventDefault();
       clearBanner();
@@ -2202,6 +4245,7 @@
     const quotaInput = document.getElementById('dataset-quota');
     const quotaMaxBtn = document.getElementById('dataset-quota-max');
     const details = document.getElementById('dataset-details');
+    const spaceEl = document.getElementById('dataset-space');
     const resetBtn = document.getElementById('dataset-reset');
 
     let selectedData = null;
@@ -2238,6 +4282,7 @@
           line.textContent = `${label}: ${value}`;
           details.appendChild(line);
         });
+        renderSpace(data);
         updateSizeControls();
       },
       onEdit: (name, data) => {
@@ -2277,6 +4322,56 @@
       },
     });
 
+    const renderSpace = (data) => {
+      if (!spaceEl) return;
+      spaceEl.innerHTML = '';
+      const space = data ? data.space : null;
+      if (!space) {
+        spaceEl.textContent = data ? 'Space breakdown unavailable.' : 'Select a dataset to see where its space goes.';
+        renderTable('#dataset-snapshot-space-table', [], '#dataset-snapshot-space-empty', () => null);
+        return;
+      }
+      const parts = [
+        ['Dataset', space.usedbydataset],
+        ['Snapshots', space.usedbysnapshots],
+        ['Children', space.usedbychildren],
+        ['Refreservation', space.usedbyrefreservation],
+      ];
+      parts.forEach(([label, bytes]) => {
+        const pct = space.used > 0 ? Math.round((bytes / space.used) * 100) : 0;
+        const line = document.createElement('div');
+        line.textContent = `${label}: ${formatSize(bytes)} (${pct}%)`;
+        const bar = document.createElement('div');
+        bar.className = 'health-bar';
+        const fill = document.createElement('div');
+        fill.className = 'health-bar-fill';
+        fill.style.width = `${pct}%`;
+        bar.appendChild(fill);
+        spaceEl.appendChild(line);
+        spaceEl.appendChild(bar);
+      });
+      [
+        ['Written since last snapshot', formatSize(space.written)],
+        ['Logical used', formatSize(space.logicalused)],
+        ['Compression ratio', `${(space.compressratio || 1).toFixed(2)}x`],
+      ].forEach(([label, value]) => {
+        const line = document.createElement('div');
+        line.textContent = `${label}: ${value}`;
+        spaceEl.appendChild(line);
+      });
+      loadSnapshotSpace(data.name).catch((err) => showBanner(err.message, err.details));
+    };
+
+    const loadSnapshotSpace = async (name) => {
+      const snaps = await api('GET', `/api/zfs/snapshots?dataset=${encodeURIComponent(name)}`);
+      const sorted = (snaps || []).slice().sort((a, b) => (b.used || 0) - (a.used || 0));
+      renderTable('#dataset-snapshot-space-table', sorted, '#dataset-snapshot-space-empty', (snap) => {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `<td>${snap.name.split('@')[1] || snap.name}</td><td>${formatSize(snap.used || 0)}</td><td>${formatSize(snap.written || 0)}</td>`;
+        return tr;
+      });
+    };
+
     const maxSizeBytes = (data) => {
       if (!data) return null;
       const usedBytes = parseSize(data.used);
@@ -2456,6 +4551,9 @@
     const schedId = document.getElementById('sched-id');
     const schedRetention = document.getElementById('sched-retention');
     const schedPrefix = document.getElementById('sched-prefix');
+    const schedTemplate = document.getElementById('sched-template');
+    const schedUTC = document.getElementById('sched-utc');
+    const schedNamePreview = document.getElementById('sched-name-preview');
     const schedEnabled = document.getElementById('sched-enabled');
     const schedMode = document.getElementById('sched-mode');
     const schedFrequency = document.getElementById('sched-frequency');
@@ -2498,10 +4596,13 @@
       const data = await api('GET', '/api/zfs/schedules');
       cronUpdated.textContent = data.updated ? `cron updated ${data.updated}` : '';
       state.items = data.items || [];
+      fillTemplatePresets(document.getElementById('sched-template-presets'), data.templates);
       renderTable('#schedules-table', state.items, '#schedules-empty', (item) => {
         const summary = summarizeCron(item.schedule, item.cron);
+        const meta = item.meta || {};
+        const template = meta.template ? `${meta.template}${meta.utc === '1' ? ' (UTC)' : ''}` : 'default';
         const tr = document.createElement('tr');
-        tr.innerHTML = `<td>${item.id}</td><td>${item.dataset}</td><td>${summary}</td><td>${item.cron}</td><td>${item.retention}</td><td>${item.prefix}</td><td>${item.enabled}</td>
+        tr.innerHTML = `<td>${item.id}</td><td>${item.dataset}</td><td>${summary}</td><td>${item.cron}</td><td>${item.retention}</td><td>${item.prefix}</td><td>${template}</td><td>${item.enabled}</td>
           <td>
             <button class="btn" data-action="schedule-toggle" data-id="${item.id}">${item.enabled ? 'Disable' : 'Enable'}</button>
             <button class="btn" data-action="schedule-edit" data-id="${item.id}">Edit</button>
@@ -2561,17 +4662,27 @@
       schedPreview.textContent = `Cron: ${schedule.minute} ${schedule.hour} ${schedule.dom} ${schedule.month} ${schedule.dow}`;
     };
 
+    const updateNamePreview = () => {
+      if (!schedNamePreview) return;
+      const prefix = schedPrefix.value.trim() || schedPrefix.placeholder;
+      schedNamePreview.textContent = `Name: ${formatSnapshotTemplate(schedTemplate.value.trim(), prefix, schedUTC.checked)}`;
+    };
+
     const resetForm = () => {
       form.reset();
       schedId.value = '';
       setMode('quick');
       if (schedPreview) schedPreview.textContent = 'Cron: -';
+      updateNamePreview();
     };
 
     const enterEdit = (item) => {
       schedId.value = item.id;
       schedRetention.value = item.retention;
       schedPrefix.value = item.prefix || '';
+      schedTemplate.value = (item.meta && item.meta.template) || '';
+      schedUTC.checked = !!(item.meta && item.meta.utc === '1');
+      updateNamePreview();
       schedEnabled.value = item.enabled ? 'true' : 'false';
       schedMode.value = 'advanced';
       schedMinute.value = item.schedule.minute;
@@ -2593,6 +4704,8 @@
       }
       const retention = parseInt(schedRetention.value, 10);
       const prefix = schedPrefix.value.trim();
+      const template = schedTemplate.value.trim();
+      const utc = schedUTC.checked;
       const enabled = schedEnabled.value === 'true';
       const mode = schedMode.value;
       const schedule = mode === 'advanced' ? buildAdvancedSchedule() : buildQuickSchedule();
@@ -2603,10 +4716,10 @@
       try {
         const btn = document.getElementById('sched-save');
         if (schedId.value) {
-          await withBusy(btn, () => api('PUT', `/api/zfs/schedules/${schedId.value}`, { dataset, retention, prefix, enabled, schedule }));
+          await withBusy(btn, () => api('PUT', `/api/zfs/schedules/${schedId.value}`, { dataset, retention, prefix, template, utc, enabled, schedule }));
           showToast('Schedule updated');
         } else {
-          await withBusy(btn, () => api('POST', '/api/zfs/schedules', { dataset, retention, prefix, enabled, schedule }));
+          await withBusy(btn, () => api('POST', '/api/zfs/schedules', { dataset, retention, prefix, template, utc, enabled, schedule }));
           showToast('Schedule saved');
         }
         resetForm();
@@ -2672,6 +4785,11 @@
     if (schedMode) {
       schedMode.addEventListener('change', () => setMode(schedMode.value));
     }
+    [schedPrefix, schedTemplate, schedUTC].forEach((el) => {
+      if (!el) return;
+      el.addEventListener('input', updateNamePreview);
+      el.addEventListener('change', updateNamePreview);
+    });
 
     api('GET', '/api/zfs/datasets')
       .then((datasets) => {
@@ -2685,6 +4803,7 @@
       .catch((err) => showBanner(err.message, err.details));
 
     setMode(schedMode.value);
+    updateNamePreview();
     loadSchedules();
   };
 
@@ -2699,10 +4818,33 @@
     const replSourceSelect = document.getElementById('repl-source-select');
     const replTargetPool = document.getElementById('repl-target-pool');
     const replTargetSuffix = document.getElementById('repl-target-suffix');
+    const replTargetKind = document.getElementById('repl-target-kind');
+    const replRemoteTarget = document.getElementById('repl-remote-target');
+    const replSshPort = document.getElementById('repl-ssh-port');
+    const replCipher = document.getElementById('repl-cipher');
+    const replCompress = document.getElementById('repl-compress');
+    const replRemoteSudo = document.getElementById('repl-remote-sudo');
+    const replTrustNew = document.getElementById('repl-trust-new');
+    const replKeyFile = document.getElementById('repl-ssh-key-file');
+    const replPublicKey = document.getElementById('repl-ssh-public-key');
     const replPrefix = document.getElementById('repl-prefix');
+    const replTemplate = document.getElementById('repl-template');
+    const replUTC = document.getElementById('repl-utc');
     const replRetention = document.getElementById('repl-retention');
     const replRecursive = document.getElementById('repl-recursive');
     const replForce = document.getElementById('repl-force');
+    const replReseed = document.getElementById('repl-reseed');
+    const replSendFlags = {
+      raw: document.getElementById('repl-send-raw'),
+      compressed: document.getElementById('repl-send-compressed'),
+      large_block: document.getElementById('repl-send-large-block'),
+      embedded: document.getElementById('repl-send-embedded'),
+      send_props: document.getElementById('repl-send-props'),
+    };
+    const replRecvProps = document.getElementById('repl-recv-props');
+    const replRecvExclude = document.getElementById('repl-recv-exclude');
+    const replCheck = document.getElementById('repl-check');
+    const replCheckResult = document.getElementById('repl-check-result');
     const replEnabled = document.getElementById('repl-enabled');
     const replMode = document.getElementById('repl-mode');
     const replFrequency = document.getElementById('repl-frequency');
@@ -2821,14 +4963,151 @@
       replPreview.textContent = `Cron: ${schedule.minute} ${schedule.hour} ${schedule.dom} ${schedule.month} ${schedule.dow}`;
     };
 
+    const isReplRemote = () => !!(replTargetKind && replTargetKind.value === 'remote');
+
+    const setReplTargetKind = (kind) => {
+      if (replTargetKind) replTargetKind.value = kind;
+      document.querySelectorAll('.repl-local').forEach((el) => el.classList.toggle('hidden', kind === 'remote'));
+      document.querySelectorAll('.repl-remote').forEach((el) => el.classList.toggle('hidden', kind !== 'remote'));
+      updateReplTargetPreview();
+    };
+
     const updateReplTargetPreview = () => {
       if (!replTargetPreview || !replTargetPool) return;
-      const pool = replTargetPool.value;
-      const suffix = (replTargetSuffix && replTargetSuffix.value || '').trim();
-      const target = pool ? (suffix ? `${pool}/${suffix}` : pool) : '';
+      const target = replTargetValue();
       replTargetPreview.textContent = target ? `Target dataset: ${target}` : 'Target dataset: -';
     };
 
+    const readTransferLimits = (prefix) => {
+      const val = (suffix) => {
+        const el = document.getElementById(`${prefix}-${suffix}`);
+        return el ? el.value.trim() : '';
+      };
+      return {
+        bwlimit: parseInt(val('bwlimit'), 10) || 0,
+        window: val('window'),
+        window_start: val('window-start'),
+        window_close: val('window-close'),
+      };
+    };
+
+    const fillTransferLimits = (prefix, item) => {
+      const set = (suffix, value) => {
+        const el = document.getElementById(`${prefix}-${suffix}`);
+        if (el && value !== undefined) el.value = value;
+      };
+      set('bwlimit', item.bwlimit ? item.bwlimit : '');
+      set('window', item.window || '');
+      set('window-start', item.window_start || 'wait');
+      set('window-close', item.window_close || 'pause');
+    };
+
+    const splitList = (value) => (value || '').split(',').map((item) => item.trim()).filter((item) => item);
+
+    const replSendOptions = () => {
+      const out = {};
+      Object.entries(replSendFlags).forEach(([key, el]) => {
+        out[key] = !!(el && el.checked);
+      });
+      out.recv_props = splitList(replRecvProps && replRecvProps.value);
+      out.recv_exclude = splitList(replRecvExclude && replRecvExclude.value);
+      return out;
+    };
+
+    const replSSHOptions = () => ({
+      ssh_port: replSshPort ? parseInt(replSshPort.value, 10) || 0 : 0,
+      cipher: replCipher ? replCipher.value : '',
+      compress: !!(replCompress && replCompress.checked),
+      remote_sudo: !!(replRemoteSudo && replRemoteSudo.checked),
+    });
+
+    const renderReplProgress = (p) => {
+      const fill = document.getElementById('repl-progress-fill');
+      const text = document.getElementById('repl-progress-text');
+      if (!p) return;
+      const pct = p.total > 0 ? p.percent : 0;
+      if (fill) fill.style.width = `${Math.min(100, pct).toFixed(1)}%`;
+      if (text) {
+        const size = p.total > 0 ? `${formatSize(p.bytes)} / ~${formatSize(p.total)} (${pct.toFixed(1)}%)` : formatSize(p.bytes);
+        const rate = `${formatSize(Math.round(p.rate || 0))}/s`;
+        const eta = p.done ? `done in ${formatSeconds(p.elapsed_seconds)}` : `ETA ${p.eta_seconds > 0 ? formatSeconds(p.eta_seconds) : '-'}`;
+        text.textContent = `${size} • ${rate} • ${eta}`;
+      }
+    };
+
+    const watchReplJob = (id) => {
+      const panel = document.getElementById('repl-progress-panel');
+      const log = document.getElementById('repl-progress-log');
+      const text = document.getElementById('repl-progress-text');
+      const fill = document.getElementById('repl-progress-fill');
+      if (panel) panel.classList.remove('hidden');
+      if (log) log.textContent = '';
+      if (fill) fill.style.width = '0%';
+      if (text) text.textContent = 'Estimating stream size...';
+      const evt = new EventSource(`/api/jobs/${id}/stream`);
+      evt.onmessage = (ev) => {
+        if (log) log.textContent += `${ev.data}\n`;
+      };
+      evt.addEventListener('progress', (ev) => {
+        try { renderReplProgress(JSON.parse(ev.data)); } catch (e) { /* ignore */ }
+      });
+      evt.onerror = () => { evt.close(); };
+      const poll = async () => {
+        try {
+          const job = await api('GET', `/api/jobs/${id}`);
+          if (job.progress) renderReplProgress(job.progress);
+          if (!job.done) {
+            setTimeout(poll, 2000);
+            return;
+          }
+          evt.close();
+          if (log) log.textContent = job.output || '';
+          if (job.exit_code === 0) {
+            showToast('Replication completed');
+          } else {
+            showBanner('Replication failed', (job.output || '').trim());
+          }
+          loadReplHistory().catch(() => {});
+        } catch (err) {
+          evt.close();
+          showBanner(err.message, err.details);
+        }
+      };
+      poll();
+    };
+
+    const loadReplHistory = async () => {
+      if (!document.getElementById('repl-history-table')) return;
+      const data = await api('GET', '/api/zfs/replication/history?limit=25');
+      renderTable('#repl-history-table', data.items || [], '#repl-history-empty', (rec) => {
+        const tr = document.createElement('tr');
+        const when = rec.end ? new Date(rec.end).toLocaleString() : '-';
+        const status = rec.exit_code === 0 ? 'ok' : (rec.error || `exit ${rec.exit_code}`);
+        tr.innerHTML = `<td>${when}</td><td>${rec.source}</td><td>${rec.target}</td><td>${rec.base || 'full'}</td>
+          <td>${formatSize(rec.bytes)}</td><td>${formatSeconds(rec.duration_seconds)}</td><td></td>`;
+        tr.lastElementChild.textContent = status;
+        return tr;
+      });
+    };
+
+    const loadReplSSH = async () => {
+      if (!replPublicKey) return;
+      const data = await api('GET', '/api/zfs/replication/ssh');
+      if (replKeyFile) {
+        replKeyFile.textContent = `Key: ${data.key_file || '-'}${data.key_error ? ' (not generated)' : ''}`;
+      }
+      replPublicKey.textContent = data.public_key || '';
+      if (data.known_hosts_error) {
+        showBanner('Known hosts unavailable', data.known_hosts_error);
+      }
+      renderTable('#repl-known-hosts-table', data.known_hosts || [], '#repl-known-hosts-empty', (host) => {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `<td>${host.host}</td><td>${host.type}</td><td>${host.fingerprint}</td>
+          <td><button class="btn" data-action="repl-ssh-forget" data-host="${host.host}">Forget</button></td>`;
+        return tr;
+      });
+    };
+
     const loadReplPools = async () => {
       if (!replTargetPool) return;
       const pools = await api('GET', '/api/zfs/pools');
@@ -2878,12 +5157,16 @@
         replUpdated.textContent = data.updated ? `cron updated ${data.updated}` : '';
       }
       replState.items = data.items || [];
+      fillTemplatePresets(document.getElementById('repl-template-presets'), data.templates);
       renderTable('#repl-table', replState.items, '#repl-empty', (item) => {
         const summary = summarizeCron(item.schedule, item.cron);
         const tr = document.createElement('tr');
-        tr.innerHTML = `<td>${item.id}</td><td>${item.source}</td><td>${item.target}</td><td>${summary}</td><td>${item.cron}</td><td>${item.retention}</td><td>${item.prefix || ''}</td><td>${item.enabled}</td>
+        const target = item.remote ? `${item.target} (ssh)` : item.target;
+        const template = item.template ? `${item.template}${item.utc ? ' (UTC)' : ''}` : 'default';
+        tr.innerHTML = `<td>${item.id}</td><td>${item.source}</td><td>${target}</td><td>${summary}</td><td>${item.cron}</td><td>${item.retention}</td><td>${item.prefix || ''}</td><td>${template}</td><td>${item.enabled}</td>
           <td>
             <button class="btn" data-action="repl-toggle" data-id="${item.id}">${item.enabled ? 'Disable' : 'Enable'}</button>
+            <button class="btn" data-action="repl-run" data-id="${item.id}">Run now</button>
             <button class="btn" data-action="repl-edit" data-id="${item.id}">Edit</button>
             <button class="btn" data-action="repl-delete" data-id="${item.id}">Delete</button>
           </td>`;
@@ -2892,6 +5175,9 @@
     };
 
     const replTargetValue = () => {
+      if (isReplRemote()) {
+        return (replRemoteTarget && replRemoteTarget.value || '').trim();
+      }
       if (!replTargetPool) return '';
       const pool = replTargetPool.value;
       const suffix = (replTargetSuffix && replTargetSuffix.value || '').trim();
@@ -2905,6 +5191,9 @@
       replId.value = '';
       if (replRecursive) replRecursive.checked = false;
       if (replForce) replForce.checked = false;
+      if (replReseed) replReseed.checked = false;
+      if (replCheckResult) replCheckResult.textContent = '';
+      setReplTargetKind('local');
       setReplMode('quick');
       if (replSourceList.length) {
         setReplSource(replSourceList[0]);
@@ -2916,9 +5205,18 @@
       replId.value = item.id;
       replRetention.value = item.retention || 0;
       replPrefix.value = item.prefix || '';
+      if (replTemplate) replTemplate.value = item.template || '';
+      if (replUTC) replUTC.checked = !!item.utc;
       replEnabled.value = item.enabled ? 'true' : 'false';
       if (replRecursive) replRecursive.checked = !!item.recursive;
       if (replForce) replForce.checked = !!item.force;
+      if (replReseed) replReseed.checked = !!item.reseed;
+      Object.entries(replSendFlags).forEach(([key, el]) => {
+        if (el) el.checked = !!item[key];
+      });
+      if (replRecvProps) replRecvProps.value = (item.recv_props || []).join(',');
+      if (replRecvExclude) replRecvExclude.value = (item.recv_exclude || []).join(',');
+      fillTransferLimits('repl', item);
       replMode.value = 'advanced';
       replMinute.value = item.schedule.minute;
       replHour.value = item.schedule.hour;
@@ -2927,7 +5225,14 @@
       replDow.value = item.schedule.dow;
       setReplMode('advanced');
       setReplSource(item.source);
-      if (replTargetPool && item.target) {
+      setReplTargetKind(item.remote ? 'remote' : 'local');
+      if (item.remote) {
+        if (replRemoteTarget) replRemoteTarget.value = item.target;
+        if (replSshPort) replSshPort.value = item.ssh_port || '';
+        if (replCipher) replCipher.value = item.cipher || '';
+        if (replCompress) replCompress.checked = !!item.compress;
+        if (replRemoteSudo) replRemoteSudo.checked = !!item.remote_sudo;
+      } else if (replTargetPool && item.target) {
         const parts = item.target.split('/');
         replTargetPool.value = parts[0] || '';
         if (replTargetSuffix) {
@@ -2948,14 +5253,18 @@
         }
         const target = replTargetValue();
         if (!target) {
-          showBanner('select a target pool');
+          showBanner(isReplRemote() ? 'enter a remote target (user@host:pool/dataset)' : 'select a target pool');
           return;
         }
+        const sshOptions = replSSHOptions();
         const retention = parseInt(replRetention.value, 10) || 0;
         const prefix = replPrefix.value.trim();
+        const template = replTemplate ? replTemplate.value.trim() : '';
+        const utc = !!(replUTC && replUTC.checked);
         const enabled = replEnabled.value === 'true';
         const recursive = !!(replRecursive && replRecursive.checked);
         const force = !!(replForce && replForce.checked);
+        const reseed = !!(replReseed && replReseed.checked);
         const mode = replMode.value;
         const schedule = mode === 'advanced' ? buildReplAdvancedSchedule() : buildReplQuickSchedule();
         if (!schedule) {
@@ -2970,9 +5279,15 @@
               target,
               retention,
               prefix,
+              template,
+              utc,
               enabled,
               recursive,
               force,
+              reseed,
+              ...replSendOptions(),
+              ...readTransferLimits('repl'),
+              ...sshOptions,
               schedule,
             }));
             showToast('Replication updated');
@@ -2982,9 +5297,15 @@
               target,
               retention,
               prefix,
+              template,
+              utc,
               enabled,
               recursive,
               force,
+              reseed,
+              ...replSendOptions(),
+              ...readTransferLimits('repl'),
+              ...sshOptions,
               schedule,
             }));
             showToast('Replication saved');
@@ -2997,6 +5318,39 @@
       });
     }
 
+    if (replCheck) {
+      replCheck.addEventListener('click', async () => {
+        clearBanner();
+        const source = replSourceSelect ? replSourceSelect.value : (replPicker ? replPicker.getSelected() : '');
+        const target = replTargetValue();
+        if (!source || !target) {
+          showBanner('select a source dataset and target first');
+          return;
+        }
+        try {
+          const data = await withBusy(replCheck, () => api('POST', '/api/zfs/replication/check', {
+            source,
+            target,
+            force: !!(replForce && replForce.checked),
+            reseed: !!(replReseed && replReseed.checked),
+            ...replSSHOptions(),
+          }));
+          const plan = data.plan || {};
+          if (replCheckResult) {
+            const base = plan.base ? `Common snapshot: ${plan.base} (guid ${plan.base_guid}). ` : '';
+            replCheckResult.textContent = `${base}${plan.message || ''}`;
+          }
+          if (data.blocked) {
+            showBanner('Target diverged', plan.message);
+          } else {
+            showToast('Target check passed');
+          }
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+
     document.addEventListener('click', async (e) => {
       const btn = e.target.closest('[data-action]');
       if (!btn) return;
@@ -3021,6 +5375,55 @@
         if (btn.dataset.action === 'repl-datasets-refresh') {
           await loadReplDatasets();
         }
+        if (btn.dataset.action === 'repl-run') {
+          const ok = await confirmModal('Run replication', `Run job ${id} now?`);
+          if (!ok) return;
+          const data = await withBusy(btn, () => api('POST', `/api/zfs/replication/${id}/run`));
+          watchReplJob(data.job_id);
+          return;
+        }
+        if (btn.dataset.action === 'repl-history-refresh') {
+          await withBusy(btn, () => loadReplHistory());
+          return;
+        }
+        if (btn.dataset.action === 'repl-ssh-refresh') {
+          await withBusy(btn, () => loadReplSSH());
+          return;
+        }
+        if (btn.dataset.action === 'repl-ssh-keygen') {
+          const ok = await confirmModal('Generate SSH key', 'Generate a new ed25519 replication key?');
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/replication/ssh', { action: 'keygen', confirm: true }));
+          showToast('SSH key generated');
+          await loadReplSSH();
+          return;
+        }
+        if (btn.dataset.action === 'repl-ssh-test') {
+          const target = (replRemoteTarget && replRemoteTarget.value || '').trim();
+          if (!target) {
+            showBanner('enter a remote target (user@host:pool/dataset)');
+            return;
+          }
+          const trustNew = !!(replTrustNew && replTrustNew.checked);
+          const res = await withBusy(btn, () => api('POST', '/api/zfs/replication/ssh', {
+            action: 'test',
+            target,
+            trust_new: trustNew,
+            ...replSSHOptions(),
+          }));
+          showToast(`Connection ok: ${(res.output || '').trim()}`);
+          await loadReplSSH();
+          return;
+        }
+        if (btn.dataset.action === 'repl-ssh-forget') {
+          const host = btn.dataset.host;
+          const ok = await confirmModal('Forget host', `Remove trusted keys for ${host}?`);
+          if (!ok) return;
+          await withBusy(btn, () => api('POST', '/api/zfs/replication/ssh', { action: 'forget', host, confirm: true }));
+          showToast('Host removed');
+          await loadReplSSH();
+          return;
+        }
         loadReplication();
       } catch (err) {
         showBanner(err.message, err.details);
@@ -3044,6 +5447,12 @@
     if (replTargetSuffix) {
       replTargetSuffix.addEventListener('input', updateReplTargetPreview);
     }
+    if (replTargetKind) {
+      replTargetKind.addEventListener('change', () => setReplTargetKind(replTargetKind.value));
+    }
+    if (replRemoteTarget) {
+      replRemoteTarget.addEventListener('input', updateReplTargetPreview);
+    }
     if (replSourceSelect) {
       replSourceSelect.addEventListener('change', () => {
         const value = replSourceSelect.value;
@@ -3146,7 +5555,8 @@
       renderTable('#rsync-table', rsyncState.items, '#rsync-empty', (item) => {
         const summary = summarizeCron(item.schedule, item.cron);
         const tr = document.createElement('tr');
-        tr.innerHTML = `<td>${item.id}</td><td>${item.source}</td><td>${item.target}</td><td>${summary}</td><td>${item.cron}</td><td>${item.mode || ''}</td><td>${item.flags || ''}</td><td>${item.enabled}</td>
+        const target = item.remote ? `${item.target} (ssh)` : item.target;
+        tr.innerHTML = `<td>${item.id}</td><td>${item.source}</td><td>${target}</td><td>${summary}</td><td>${item.cron}</td><td>${item.mode || ''}</td><td>${item.flags || ''}</td><td>${item.enabled}</td>
           <td>
             <button class="btn" data-action="rsync-toggle" data-id="${item.id}">${item.enabled ? 'Disable' : 'Enable'}</button>
             <button class="btn" data-action="rsync-edit" data-id="${item.id}">Edit</button>
@@ -3171,6 +5581,7 @@
       rsyncMode.value = item.mode || 'mirror';
       rsyncEnabled.value = item.enabled ? 'true' : 'false';
       rsyncFlags.value = item.flags || '';
+      fillTransferLimits('rsync', item);
       rsyncModeCron.value = 'advanced';
       rsyncMinute.value = item.schedule.minute;
       rsyncHour.value = item.schedule.hour;
@@ -3212,6 +5623,7 @@
               mode,
               flags,
               enabled,
+              ...readTransferLimits('rsync'),
               schedule,
             }));
             showToast('Rsync updated');
@@ -3222,6 +5634,7 @@
               mode,
               flags,
               enabled,
+              ...readTransferLimits('rsync'),
               schedule,
             }));
             showToast('Rsync saved');
@@ -3276,7 +5689,7 @@
       rsyncMode.addEventListener('change', () => setRsyncFlagsMode(rsyncMode.value));
     }
 
-    Promise.all([loadReplPools(), loadReplDatasets(), loadReplication(), loadRsync()])
+    Promise.all([loadReplPools(), loadReplDatasets(), loadReplication(), loadReplSSH(), loadReplHistory(), loadRsync()])
       .catch((err) => showBanner(err.message, err.details));
 
     if (replMode) setReplMode(replMode.value);
@@ -3284,6 +5697,159 @@
     if (rsyncMode) setRsyncFlagsMode(rsyncMode.value);
   };
 
+  const bindStreamFiles = () => {
+    const exportForm = document.getElementById('stream-export-form');
+    if (!exportForm) return;
+    const importForm = document.getElementById('stream-import-form');
+    const dirInput = document.getElementById('stream-dir');
+    const manifestInput = document.getElementById('stream-import-manifest');
+    const targetInput = document.getElementById('stream-import-target');
+    const forceInput = document.getElementById('stream-import-force');
+    const refreshBtn = document.querySelector('[data-action="streams-refresh"]');
+    const verifyBtn = document.querySelector('[data-action="stream-verify"]');
+
+    const renderStreamProgress = (p) => {
+      const fill = document.getElementById('stream-progress-fill');
+      const text = document.getElementById('stream-progress-text');
+      if (!p) return;
+      const pct = p.total > 0 ? p.percent : 0;
+      if (fill) fill.style.width = `${Math.min(100, pct).toFixed(1)}%`;
+      if (text) {
+        const size = p.total > 0 ? `${formatSize(p.bytes)} / ~${formatSize(p.total)} (${pct.toFixed(1)}%)` : formatSize(p.bytes);
+        const eta = p.done ? `done in ${formatSeconds(p.elapsed_seconds)}` : `ETA ${p.eta_seconds > 0 ? formatSeconds(p.eta_seconds) : '-'}`;
+        text.textContent = `${size} • ${formatSize(Math.round(p.rate || 0))}/s • ${eta}`;
+      }
+    };
+
+    const watchStreamJob = (id, label) => {
+      const panel = document.getElementById('stream-progress-panel');
+      const log = document.getElementById('stream-progress-log');
+      const fill = document.getElementById('stream-progress-fill');
+      const text = document.getElementById('stream-progress-text');
+      if (panel) panel.classList.remove('hidden');
+      if (log) log.textContent = '';
+      if (fill) fill.style.width = '0%';
+      if (text) text.textContent = '-';
+      const evt = new EventSource(`/api/jobs/${id}/stream`);
+      evt.onmessage = (ev) => {
+        if (log) log.textContent += `${ev.data}\n`;
+      };
+      evt.addEventListener('progress', (ev) => {
+        try { renderStreamProgress(JSON.parse(ev.data)); } catch (e) { /* ignore */ }
+      });
+      evt.onerror = () => { evt.close(); };
+      const poll = async () => {
+        try {
+          const job = await api('GET', `/api/jobs/${id}`);
+          if (job.progress) renderStreamProgress(job.progress);
+          if (!job.done) {
+            setTimeout(poll, 2000);
+            return;
+          }
+          evt.close();
+          if (log) log.textContent = job.output || '';
+          if (job.exit_code === 0) {
+            showToast(`${label} completed`);
+          } else {
+            showBanner(`${label} failed`, (job.output || '').trim());
+          }
+          if (dirInput && dirInput.value.trim()) loadManifests().catch(() => {});
+        } catch (err) {
+          evt.close();
+          showBanner(err.message, err.details);
+        }
+      };
+      poll();
+    };
+
+    const loadManifests = async () => {
+      const dir = dirInput ? dirInput.value.trim() : '';
+      if (!dir) return;
+      const data = await api('GET', `/api/zfs/streams?dir=${encodeURIComponent(dir)}`);
+      renderTable('#streams-table', data.items || [], '#streams-empty', (m) => {
+        const tr = document.createElement('tr');
+        const streams = m.streams || [];
+        const total = streams.reduce((sum, entry) => sum + (entry.size || 0), 0);
+        const last = streams.length ? streams[streams.length - 1].snapshot : '-';
+        tr.innerHTML = `<td>${m.path}</td><td>${m.dataset}</td><td>${m.host || '-'}</td><td>${streams.length} (latest ${last})</td><td>${formatSize(total)}</td>`;
+        const actions = document.createElement('td');
+        const btn = document.createElement('button');
+        btn.className = 'btn';
+        btn.type = 'button';
+        btn.textContent = 'Use';
+        btn.addEventListener('click', () => {
+          if (manifestInput) manifestInput.value = m.path;
+          if (targetInput && !targetInput.value) targetInput.placeholder = m.dataset;
+        });
+        actions.appendChild(btn);
+        tr.appendChild(actions);
+        return tr;
+      });
+    };
+
+    exportForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      clearBanner();
+      const payload = {
+        snapshot: document.getElementById('stream-export-snapshot').value.trim(),
+        base: document.getElementById('stream-export-base').value.trim(),
+        dir: document.getElementById('stream-export-dir').value.trim(),
+        raw: document.getElementById('stream-export-raw').checked,
+        compress: document.getElementById('stream-export-compress').checked,
+        recursive: document.getElementById('stream-export-recursive').checked,
+      };
+      const btn = exportForm.querySelector('button[type="submit"]');
+      try {
+        const data = await withBusy(btn, () => api('POST', '/api/zfs/streams/export', payload));
+        watchStreamJob(data.job_id, 'Export');
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    });
+
+    const startImport = async (btn, verifyOnly) => {
+      clearBanner();
+      const manifest = manifestInput ? manifestInput.value.trim() : '';
+      if (!manifest) {
+        showBanner('manifest required');
+        return;
+      }
+      const target = targetInput ? targetInput.value.trim() : '';
+      const force = !!(forceInput && forceInput.checked);
+      if (!verifyOnly) {
+        const into = target || 'the dataset recorded in the manifest';
+        const ok = await confirmModal('Import streams', `Receive the streams of ${manifest} into ${into}?${force ? ' With -F the target is rolled back and snapshots missing from the stream are destroyed.' : ''}`);
+        if (!ok) return;
+      }
+      try {
+        const data = await withBusy(btn, () => api('POST', '/api/zfs/streams/import', { manifest, target, force, verify_only: verifyOnly, confirm: !verifyOnly }));
+        watchStreamJob(data.job_id, verifyOnly ? 'Verify' : 'Import');
+      } catch (err) {
+        showBanner(err.message, err.details);
+      }
+    };
+
+    if (importForm) {
+      importForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        startImport(importForm.querySelector('button[type="submit"]'), false);
+      });
+    }
+    if (verifyBtn) {
+      verifyBtn.addEventListener('click', () => startImport(verifyBtn, true));
+    }
+    if (refreshBtn) {
+      refreshBtn.addEventListener('click', async () => {
+        clearBanner();
+        try {
+          await withBusy(refreshBtn, () => loadManifests());
+        } catch (err) {
+          showBanner(err.message, err.details);
+        }
+      });
+    }
+  };
+
   const bindSettings = () => {
     const form = document.getElementById('settings-form');
     if (!form) return;
@@ -3310,6 +5876,15 @@
     const pathSysctl = document.getElementById('settings-path-sysctl');
     const pathSysrc = document.getElementById('settings-path-sysrc');
     const pathShutdown = document.getElementById('settings-path-shutdown');
+    const pathSsh = document.getElementById('settings-path-ssh');
+    const pathSshKeygen = document.getElementById('settings-path-ssh-keygen');
+    const pathBectl = document.getElementById('settings-path-bectl');
+    const pathSmartctl = document.getElementById('settings-path-smartctl');
+    const pathGpart = document.getElementById('settings-path-gpart');
+    const pathMount = document.getElementById('settings-path-mount');
+    const pathGeli = document.getElementById('settings-path-geli');
+    const pathSwapctl = document.getElementById('settings-path-swapctl');
+    const pathInstall = document.getElementById('settings-path-install');
 
     const sambaInclude = document.getElementById('settings-samba-include');
     const sambaReload = document.getElementById('settings-samba-reload');
@@ -3317,6 +5892,15 @@
 
     const zfsSnapPrefix = document.getElementById('settings-zfs-snap-prefix');
 
+    const replKeyFile = document.getElementById('settings-repl-key-file');
+    const replKnownHosts = document.getElementById('settings-repl-known-hosts');
+    const replRemoteZfs = document.getElementById('settings-repl-remote-zfs');
+    const replHistory = document.getElementById('settings-repl-history');
+    const statsDir = document.getElementById('settings-stats-dir');
+    const statsInterval = document.getElementById('settings-stats-interval');
+    const geliKeyDir = document.getElementById('settings-geli-keydir');
+    const devdSocket = document.getElementById('settings-devd-socket');
+
     const cronFile = document.getElementById('settings-cron-file');
     const cronUser = document.getElementById('settings-cron-user');
 
@@ -3353,6 +5937,8 @@
       const pathsCfg = cfg.paths || {};
       const sambaCfg = cfg.samba || {};
       const zfsCfg = cfg.zfs || {};
+      const replCfg = cfg.replication || {};
+      const statsCfg = cfg.stats || {};
       const cronCfg = cfg.cron || {};
       const terminalCfg = cfg.terminal || {};
       const limitsCfg = cfg.limits || {};
@@ -3377,6 +5963,15 @@
       pathSysctl.value = pathsCfg.sysctl || '';
       pathSysrc.value = pathsCfg.sysrc || '';
       pathShutdown.value = pathsCfg.shutdown || '';
+      if (pathSsh) pathSsh.value = pathsCfg.ssh || '';
+      if (pathSshKeygen) pathSshKeygen.value = pathsCfg.ssh_keygen || '';
+      if (pathBectl) pathBectl.value = pathsCfg.bectl || '';
+      if (pathSmartctl) pathSmartctl.value = pathsCfg.smartctl || '';
+      if (pathGpart) pathGpart.value = pathsCfg.gpart || '';
+      if (pathMount) pathMount.value = pathsCfg.mount || '';
+      if (pathGeli) pathGeli.value = pathsCfg.geli || '';
+      if (pathSwapctl) pathSwapctl.value = pathsCfg.swapctl || '';
+      if (pathInstall) pathInstall.value = pathsCfg.install || '';
 
       sambaInclude.value = sambaCfg.include_file || '';
       sambaReload.value = (sambaCfg.reload_args || []).join(' ');
@@ -3384,6 +5979,16 @@
 
       zfsSnapPrefix.value = zfsCfg.snapshot_prefix || '';
 
+      if (replKeyFile) replKeyFile.value = replCfg.key_file || '';
+      if (replKnownHosts) replKnownHosts.value = replCfg.known_hosts_file || '';
+      if (replRemoteZfs) replRemoteZfs.value = replCfg.remote_zfs || '';
+      if (replHistory) replHistory.value = replCfg.history_file || '';
+
+      if (statsDir) statsDir.value = statsCfg.data_dir || '';
+      if (statsInterval) statsInterval.value = statsCfg.interval_seconds || 60;
+      if (geliKeyDir) geliKeyDir.value = (cfg.geli || {}).key_dir || '';
+      if (devdSocket) devdSocket.value = (cfg.devd || {}).socket || '';
+
       cronFile.value = cronCfg.cron_file || '';
       cronUser.value = cronCfg.cron_user || '';
 
@@ -3443,6 +6048,15 @@
           sysctl: pathSysctl.value.trim(),
           sysrc: pathSysrc.value.trim(),
           shutdown: pathShutdown.value.trim(),
+          ssh: pathSsh ? pathSsh.value.trim() : '',
+          ssh_keygen: pathSshKeygen ? pathSshKeygen.value.trim() : '',
+          bectl: pathBectl ? pathBectl.value.trim() : '',
+          smartctl: pathSmartctl ? pathSmartctl.value.trim() : '',
+          gpart: pathGpart ? pathGpart.value.trim() : '',
+          mount: pathMount ? pathMount.value.trim() : '',
+          geli: pathGeli ? pathGeli.value.trim() : '',
+          swapctl: pathSwapctl ? pathSwapctl.value.trim() : '',
+          install: pathInstall ? pathInstall.value.trim() : '',
         },
         samba: {
           include_file: sambaInclude.value.trim(),
@@ -3452,6 +6066,22 @@
         zfs: {
           snapshot_prefix: zfsSnapPrefix.value.trim(),
         },
+        replication: {
+          key_file: replKeyFile ? replKeyFile.value.trim() : '',
+          known_hosts_file: replKnownHosts ? replKnownHosts.value.trim() : '',
+          remote_zfs: replRemoteZfs ? replRemoteZfs.value.trim() : '',
+          history_file: replHistory ? replHistory.value.trim() : '',
+        },
+        stats: {
+          data_dir: statsDir ? statsDir.value.trim() : '',
+          interval_seconds: statsInterval ? (parseInt(statsInterval.value, 10) || 0) : 0,
+        },
+        geli: {
+          key_dir: geliKeyDir ? geliKeyDir.value.trim() : '',
+        },
+        devd: {
+          socket: devdSocket ? devdSocket.value.trim() : '',
+        },
         cron: {
           cron_file: cronFile.value.trim(),
           cron_user: cronUser.value.trim(),
@@ -3558,11 +6188,20 @@
     bindSambaUsers();
     bindSambaShares();
     bindZFSPools();
+    bindZFSHistory();
+    bindBootEnvironments();
     bindZFSMounts();
+    bindSelfTests();
+    bindPartitions();
+    bindPrepareDisk();
+    bindInventory();
+    bindGELI();
+    bindHotplug();
     bindZFSDatasets();
     bindZFSSnapshots();
     bindSchedules();
     bindReplicationJobs();
+    bindStreamFiles();
     bindSettings();
   });
 })();
@@ -0,0 +1,209 @@
+// Package window parses daily time windows that gate when transfer jobs may run.
+package window
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Before/close policies stored in cron metadata.
+const (
+	BeforeWait  = "wait"
+	BeforeSkip  = "skip"
+	ClosePause  = "pause"
+	CloseCancel = "cancel"
+)
+
+// ErrSkipped is returned by Gate when a run starts outside its window and should be skipped.
+var ErrSkipped = errors.New("outside allowed time window")
+
+// Range is one daily window in minutes since midnight. End <= Start wraps past midnight.
+type Range struct {
+	Start int
+	End   int
+}
+
+// Windows is a set of daily ranges. A nil set is always open.
+type Windows []Range
+
+// Policy combines windows with what to do before they open and when they close.
+type Policy struct {
+	Windows Windows
+	Before  string
+	OnClose string
+}
+
+// Parse reads a comma-separated list of HH:MM-HH:MM ranges, e.g. `22:00-06:30,12:00-13:00`.
+func Parse(spec string) (Windows, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	var out Windows
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid window %q (want HH:MM-HH:MM)", part)
+		}
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %q is empty", part)
+		}
+		out = append(out, Range{Start: start, End: end})
+	}
+	return out, nil
+}
+
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[0]) > 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return (hour*60 + minute) % (24 * 60), nil
+}
+
+// String formats the windows back into the Parse syntax.
+func (w Windows) String() string {
+	parts := make([]string, 0, len(w))
+	for _, r := range w {
+		parts = append(parts, fmt.Sprintf("%02d:%02d-%02d:%02d", r.Start/60, r.Start%60, r.End/60, r.End%60))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Open reports whether t falls inside any window.
+func (w Windows) Open(t time.Time) bool {
+	if len(w) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range w {
+		if r.Start < r.End {
+			if minute >= r.Start && minute < r.End {
+				return true
+			}
+			continue
+		}
+		if minute >= r.Start || minute < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns t if the window is open, otherwise the start of the next window.
+func (w Windows) NextOpen(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	return w.nextChange(t, true)
+}
+
+// NextClose returns when the currently open window ends, or the zero time if it never does.
+func (w Windows) NextClose(t time.Time) time.Time {
+	if len(w) == 0 || !w.Open(t) {
+		return time.Time{}
+	}
+	return w.nextChange(t, false)
+}
+
+// nextChange walks forward minute by minute (at most two days) until Open equals open.
+func (w Windows) nextChange(t time.Time, open bool) time.Time {
+	next := t.Truncate(time.Minute)
+	for i := 0; i < 2*24*60; i++ {
+		next = next.Add(time.Minute)
+		if w.Open(next) == open {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// WaitOpen blocks until the window opens or ctx is done.
+func (w Windows) WaitOpen(ctx context.Context) error {
+	for !w.Open(time.Now()) {
+		wait := time.Until(w.NextOpen(time.Now()))
+		if wait <= 0 {
+			wait = time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// ParsePolicy builds a policy from the window spec and policy names used in cron metadata.
+func ParsePolicy(spec, before, onClose string) (Policy, error) {
+	windows, err := Parse(spec)
+	if err != nil {
+		return Policy{}, err
+	}
+	p := Policy{Windows: windows, Before: strings.TrimSpace(before), OnClose: strings.TrimSpace(onClose)}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// Validate checks the before/close policy names.
+func (p Policy) Validate() error {
+	switch p.Before {
+	case "", BeforeWait, BeforeSkip:
+	default:
+		return fmt.Errorf("window start policy must be wait or skip")
+	}
+	switch p.OnClose {
+	case "", ClosePause, CloseCancel:
+	default:
+		return fmt.Errorf("window close policy must be pause or cancel")
+	}
+	return nil
+}
+
+// Enabled reports whether the policy restricts run times at all.
+func (p Policy) Enabled() bool {
+	return len(p.Windows) > 0
+}
+
+// Gate is called before a run starts: it returns immediately inside the window, returns
+// ErrSkipped for the skip policy, and otherwise waits for the window to open.
+func (p Policy) Gate(ctx context.Context) error {
+	if p.Windows.Open(time.Now()) {
+		return nil
+	}
+	if p.Before == BeforeSkip {
+		return ErrSkipped
+	}
+	return p.Windows.WaitOpen(ctx)
+}
+
+// Pauses reports whether a run should pause (rather than be cancelled) when the window closes.
+func (p Policy) Pauses() bool {
+	return p.Enabled() && p.OnClose != CloseCancel
+}
@@ -0,0 +1,144 @@
+// Package zfs parses ARC and L2ARC statistics from kstat.zfs.misc.arcstats.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+const arcstatsPrefix = "kstat.zfs.misc.arcstats."
+
+// HitRatio is a hit/miss pair with the hit percentage.
+type HitRatio struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	Percent float64 `json:"percent"`
+}
+
+// L2ARCStats covers the second-level cache devices.
+type L2ARCStats struct {
+	Present    bool     `json:"present"`
+	Size       int64    `json:"size"`
+	AllocSize  int64    `json:"alloc_size"`
+	HeaderSize int64    `json:"header_size"`
+	ReadBytes  int64    `json:"read_bytes"`
+	WriteBytes int64    `json:"write_bytes"`
+	Ratio      HitRatio `json:"ratio"`
+	// MissesServed is the share of ARC misses answered by L2ARC instead of the pool.
+	MissesServed float64 `json:"misses_served_percent"`
+}
+
+// ARCStats is the parsed subset of arcstats used by the API and dashboard. Counters are
+// cumulative since boot.
+type ARCStats struct {
+	Size         int64      `json:"size"`
+	Target       int64      `json:"target"`
+	Min          int64      `json:"min"`
+	Max          int64      `json:"max"`
+	MFUSize      int64      `json:"mfu_size"`
+	MRUSize      int64      `json:"mru_size"`
+	DataSize     int64      `json:"data_size"`
+	MetadataSize int64      `json:"metadata_size"`
+	Total        HitRatio   `json:"total"`
+	Demand       HitRatio   `json:"demand"`
+	Prefetch     HitRatio   `json:"prefetch"`
+	Metadata     HitRatio   `json:"metadata"`
+	MFUHits      int64      `json:"mfu_hits"`
+	MRUHits      int64      `json:"mru_hits"`
+	MFUGhostHits int64      `json:"mfu_ghost_hits"`
+	MRUGhostHits int64      `json:"mru_ghost_hits"`
+	L2           L2ARCStats `json:"l2"`
+}
+
+// ReadARCStats runs `sysctl kstat.zfs.misc.arcstats` and parses the counters.
+func ReadARCStats(ctx context.Context, cfg config.Config) (ARCStats, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.Sysctl, []string{"kstat.zfs.misc.arcstats"}, nil, cfg.Limits)
+	if err != nil {
+		return ARCStats{}, err
+	}
+	if res.ExitCode != 0 {
+		return ARCStats{}, fmt.Errorf(res.Stderr)
+	}
+	raw := parseArcstats(res.Stdout)
+	if len(raw) == 0 {
+		return ARCStats{}, fmt.Errorf("no arcstats in sysctl output")
+	}
+	return buildARCStats(raw), nil
+}
+
+// parseArcstats reads `name: value` (or `name=value` with sysctl -e) lines.
+func parseArcstats(output string) map[string]int64 {
+	raw := map[string]int64{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		sep := strings.IndexAny(line, ":=")
+		if sep <= 0 {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(line[:sep]), arcstatsPrefix)
+		val, err := strconv.ParseInt(strings.TrimSpace(line[sep+1:]), 10, 64)
+		if err != nil {
+			continue
+		}
+		raw[name] = val
+	}
+	return raw
+}
+
+func buildARCStats(raw map[string]int64) ARCStats {
+	metadataSize := raw["metadata_size"]
+	if metadataSize == 0 {
+		// Older releases only report the combined metadata figure.
+		metadataSize = raw["arc_meta_used"]
+	}
+	stats := ARCStats{
+		Size:         raw["size"],
+		Target:       raw["c"],
+		Min:          raw["c_min"],
+		Max:          raw["c_max"],
+		MFUSize:      raw["mfu_size"],
+		MRUSize:      raw["mru_size"],
+		DataSize:     raw["data_size"],
+		MetadataSize: metadataSize,
+		Total:        newHitRatio(raw["hits"], raw["misses"]),
+		Demand: newHitRatio(raw["demand_data_hits"]+raw["demand_metadata_hits"],
+			raw["demand_data_misses"]+raw["demand_metadata_misses"]),
+		Prefetch: newHitRatio(raw["prefetch_data_hits"]+raw["prefetch_metadata_hits"],
+			raw["prefetch_data_misses"]+raw["prefetch_metadata_misses"]),
+		Metadata: newHitRatio(raw["demand_metadata_hits"]+raw["prefetch_metadata_hits"],
+			raw["demand_metadata_misses"]+raw["prefetch_metadata_misses"]),
+		MFUHits:      raw["mfu_hits"],
+		MRUHits:      raw["mru_hits"],
+		MFUGhostHits: raw["mfu_ghost_hits"],
+		MRUGhostHits: raw["mru_ghost_hits"],
+	}
+	l2 := L2ARCStats{
+		Size:       raw["l2_size"],
+		AllocSize:  raw["l2_asize"],
+		HeaderSize: raw["l2_hdr_size"],
+		ReadBytes:  raw["l2_read_bytes"],
+		WriteBytes: raw["l2_write_bytes"],
+		Ratio:      newHitRatio(raw["l2_hits"], raw["l2_misses"]),
+	}
+	l2.Present = l2.Size > 0 || l2.Ratio.Hits+l2.Ratio.Misses > 0
+	if stats.Total.Misses > 0 {
+		l2.MissesServed = float64(l2.Ratio.Hits) * 100 / float64(stats.Total.Misses)
+	}
+	stats.L2 = l2
+	return stats
+}
+
+func newHitRatio(hits, misses int64) HitRatio {
+	r := HitRatio{Hits: hits, Misses: misses}
+	if total := hits + misses; total > 0 {
+		r.Percent = float64(hits) * 100 / float64(total)
+	}
+	return r
+}
@@ -0,0 +1,234 @@
+// Package zfs lists and manages FreeBSD boot environments through bectl(8).
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// BootEnvironment is one row of `bectl list -H`.
+type BootEnvironment struct {
+	Name string `json:"name"`
+	// Active is the raw flag column: N (running now), R (default on reboot), T (next
+	// boot only) or -.
+	Active     string `json:"active"`
+	Now        bool   `json:"now"`
+	NextBoot   bool   `json:"next_boot"`
+	Temporary  bool   `json:"temporary"`
+	Mountpoint string `json:"mountpoint"`
+	Space      string `json:"space"`
+	SpaceBytes int64  `json:"space_bytes"`
+	Created    string `json:"created"`
+}
+
+// ValidBootEnvName accepts a plain boot environment name (no dataset path or snapshot).
+func ValidBootEnvName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "-") && len(name) <= 200 && validToken(name)
+}
+
+// ValidBootEnvSource accepts an existing boot environment or `be@snapshot` to clone from.
+func ValidBootEnvSource(source string) bool {
+	be, snap, isSnap := strings.Cut(source, "@")
+	if isSnap && !ValidSnapshotToken(snap) {
+		return false
+	}
+	return ValidBootEnvName(be)
+}
+
+// ListBootEnvironments runs `bectl list -H`.
+func ListBootEnvironments(ctx context.Context, cfg config.Config) ([]BootEnvironment, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.Bectl, []string{"list", "-H"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	return parseBootEnvList(res.Stdout), nil
+}
+
+func parseBootEnvList(output string) []BootEnvironment {
+	out := []BootEnvironment{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 || fields[0] == "" {
+			continue
+		}
+		be := BootEnvironment{
+			Name:       fields[0],
+			Active:     fields[1],
+			Mountpoint: fields[2],
+			Space:      fields[3],
+			SpaceBytes: parseNiceNumber(fields[3]),
+			Created:    fields[4],
+		}
+		be.Now = strings.Contains(be.Active, "N")
+		be.NextBoot = strings.Contains(be.Active, "R")
+		be.Temporary = strings.Contains(be.Active, "T")
+		if be.Mountpoint == "-" {
+			be.Mountpoint = ""
+		}
+		out = append(out, be)
+	}
+	return out
+}
+
+// parseNiceNumber reads the human-readable sizes bectl prints (512K, 1.5G, 0).
+func parseNiceNumber(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-" {
+		return 0
+	}
+	multiplier := float64(1)
+	if i := strings.IndexAny(value, "BKMGTPE"); i >= 0 {
+		for n := strings.IndexByte("BKMGTPE", value[i]); n > 0; n-- {
+			multiplier *= 1024
+		}
+		value = value[:i]
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+// CreateBootEnvironment runs `bectl create [-e source] name`. An empty source clones
+// the running boot environment.
+func CreateBootEnvironment(ctx context.Context, cfg config.Config, name, source string) (execwrap.Result, error) {
+	if !ValidBootEnvName(name) {
+		return execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	args := []string{"create"}
+	if source != "" {
+		if !ValidBootEnvSource(source) {
+			return execwrap.Result{}, fmt.Errorf("invalid source")
+		}
+		args = append(args, "-e", source)
+	}
+	return execwrap.Run(ctx, cfg.Paths.Bectl, append(args, name), nil, cfg.Limits)
+}
+
+// ActivateBootEnvironment makes name the default boot environment, or with temporary
+// only for the next boot (`bectl activate -t`).
+func ActivateBootEnvironment(ctx context.Context, cfg config.Config, name string, temporary bool) (execwrap.Result, error) {
+	if !ValidBootEnvName(name) {
+		return execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	args := []string{"activate"}
+	if temporary {
+		args = append(args, "-t")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Bectl, append(args, name), nil, cfg.Limits)
+}
+
+// RenameBootEnvironment runs `bectl rename`.
+func RenameBootEnvironment(ctx context.Context, cfg config.Config, name, newName string) (execwrap.Result, error) {
+	if !ValidBootEnvName(name) || !ValidBootEnvName(newName) {
+		return execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Bectl, []string{"rename", name, newName}, nil, cfg.Limits)
+}
+
+// DestroyBootEnvironment runs `bectl destroy`, with -o also removing the origin
+// snapshot the environment was cloned from.
+func DestroyBootEnvironment(ctx context.Context, cfg config.Config, name string, origin bool) (execwrap.Result, error) {
+	if !ValidBootEnvName(name) {
+		return execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	args := []string{"destroy"}
+	if origin {
+		args = append(args, "-o")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Bectl, append(args, name), nil, cfg.Limits)
+}
+
+// MountBootEnvironment mounts name at a temporary directory chosen by bectl and
+// returns the mountpoint.
+func MountBootEnvironment(ctx context.Context, cfg config.Config, name string) (string, execwrap.Result, error) {
+	if !ValidBootEnvName(name) {
+		return "", execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.Bectl, []string{"mount", name}, nil, cfg.Limits)
+	return strings.TrimSpace(res.Stdout), res, err
+}
+
+// UnmountBootEnvironment runs `bectl umount`.
+func UnmountBootEnvironment(ctx context.Context, cfg config.Config, name string) (execwrap.Result, error) {
+	if !ValidBootEnvName(name) {
+		return execwrap.Result{}, fmt.Errorf("invalid boot environment name")
+	}
+	return execwrap.Run(ctx, cfg.Paths.Bectl, []string{"umount", name}, nil, cfg.Limits)
+}
+
+// PreUpgradeOptions controls CreatePreUpgradeBootEnvironment.
+type PreUpgradeOptions struct {
+	// Prefix names the environment through the default snapshot template
+	// (preupgrade-YYYYMMDD-HHMMSS).
+	Prefix string
+	// Keep prunes older environments with the same naming beyond this count (0 keeps all).
+	Keep int
+}
+
+// CreatePreUpgradeBootEnvironment clones the running boot environment before an
+// upgrade and prunes older ones of the same series. The running and next-boot
+// environments are never pruned.
+func CreatePreUpgradeBootEnvironment(ctx context.Context, cfg config.Config, opts PreUpgradeOptions) (string, []string, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "preupgrade"
+	}
+	naming := NameTemplate{Prefix: opts.Prefix}
+	if err := naming.Validate(); err != nil {
+		return "", nil, err
+	}
+	name := naming.Format(time.Now())
+	res, err := CreateBootEnvironment(ctx, cfg, name, "")
+	if err != nil {
+		return "", nil, err
+	}
+	if res.ExitCode != 0 {
+		return "", nil, fmt.Errorf(res.Stderr)
+	}
+	if opts.Keep <= 0 {
+		return name, nil, nil
+	}
+	envs, err := ListBootEnvironments(ctx, cfg)
+	if err != nil {
+		return name, nil, err
+	}
+	var names []string
+	protected := map[string]bool{}
+	for _, be := range envs {
+		names = append(names, be.Name)
+		if be.Now || be.NextBoot || be.Temporary {
+			protected[be.Name] = true
+		}
+	}
+	series := namesMatching(names, naming)
+	if len(series) <= opts.Keep {
+		return name, nil, nil
+	}
+	var pruned []string
+	for _, victim := range series[:len(series)-opts.Keep] {
+		if protected[victim] {
+			continue
+		}
+		res, err := DestroyBootEnvironment(ctx, cfg, victim, true)
+		if err != nil {
+			return name, pruned, err
+		}
+		if res.ExitCode != 0 {
+			return name, pruned, fmt.Errorf(res.Stderr)
+		}
+		pruned = append(pruned, victim)
+	}
+	return name, pruned, nil
+}
@@ -0,0 +1,138 @@
+// Package zfs creates, discards and rewinds to pool checkpoints.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// PoolCheckpoint is the checkpoint state of one pool. Bytes is the space the
+// checkpoint holds on to (the `checkpoint` pool property).
+type PoolCheckpoint struct {
+	Pool       string `json:"pool"`
+	Exists     bool   `json:"exists"`
+	Bytes      int64  `json:"bytes"`
+	Created    string `json:"created,omitempty"`
+	Discarding bool   `json:"discarding"`
+}
+
+// ListPoolCheckpoints reads the checkpoint property of every pool and, for pools that
+// have one, the creation time from `zpool status`.
+func ListPoolCheckpoints(ctx context.Context, cfg config.Config) ([]PoolCheckpoint, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"get", "-Hp", "-o", "name,value", "checkpoint"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	out := []PoolCheckpoint{}
+	scanner := bufio.NewScanner(strings.NewReader(res.Stdout))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		cp := PoolCheckpoint{Pool: fields[0]}
+		value := strings.TrimSpace(fields[1])
+		if value != "-" && value != "" {
+			cp.Exists = true
+			cp.Bytes = parseBytes(value)
+		}
+		if cp.Exists {
+			if status, err := PoolStatus(ctx, cfg, cp.Pool); err == nil && status.ExitCode == 0 {
+				cp.Created, cp.Discarding = parseCheckpointStatus(status.Stdout)
+			}
+		}
+		out = append(out, cp)
+	}
+	return out, nil
+}
+
+// ReadPoolCheckpoint returns the checkpoint state of a single pool.
+func ReadPoolCheckpoint(ctx context.Context, cfg config.Config, pool string) (PoolCheckpoint, error) {
+	all, err := ListPoolCheckpoints(ctx, cfg)
+	if err != nil {
+		return PoolCheckpoint{}, err
+	}
+	for _, cp := range all {
+		if cp.Pool == pool {
+			return cp, nil
+		}
+	}
+	return PoolCheckpoint{}, fmt.Errorf("pool %s not found", pool)
+}
+
+// parseCheckpointStatus reads the "checkpoint: created <date>, consumes <size>" (or
+// "checkpoint: discarding") line of `zpool status`.
+func parseCheckpointStatus(output string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		value, ok := strings.CutPrefix(line, "checkpoint:")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "discarding") {
+			return "", true
+		}
+		value = strings.TrimPrefix(value, "created ")
+		if i := strings.Index(value, ", consumes"); i >= 0 {
+			value = value[:i]
+		}
+		return value, false
+	}
+	return "", false
+}
+
+// CheckpointPool runs `zpool checkpoint`. A pool holds at most one checkpoint.
+func CheckpointPool(ctx context.Context, cfg config.Config, pool string) (execwrap.Result, error) {
+	if !ValidPoolName(pool) {
+		return execwrap.Result{}, fmt.Errorf("invalid pool name")
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZPool, []string{"checkpoint", pool}, nil, cfg.Limits)
+}
+
+// DiscardCheckpoint runs `zpool checkpoint -d`; the space is freed in the background.
+func DiscardCheckpoint(ctx context.Context, cfg config.Config, pool string) (execwrap.Result, error) {
+	if !ValidPoolName(pool) {
+		return execwrap.Result{}, fmt.Errorf("invalid pool name")
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZPool, []string{"checkpoint", "-d", pool}, nil, cfg.Limits)
+}
+
+// RewindToCheckpoint exports pool and imports it again with --rewind-to-checkpoint,
+// discarding every change made since the checkpoint. If the rewind import fails the
+// pool is imported normally so it does not stay exported.
+func RewindToCheckpoint(ctx context.Context, cfg config.Config, pool string) (execwrap.Result, error) {
+	if !ValidPoolName(pool) {
+		return execwrap.Result{}, fmt.Errorf("invalid pool name")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"export", pool}, nil, cfg.Limits)
+	if err != nil || res.ExitCode != 0 {
+		return res, err
+	}
+	res, err = execwrap.Run(ctx, cfg.Paths.ZPool, []string{"import", "--rewind-to-checkpoint", pool}, nil, cfg.Limits)
+	if err == nil && res.ExitCode == 0 {
+		return res, nil
+	}
+	failed := resultText(res, err)
+	back, backErr := ImportPool(ctx, cfg, pool)
+	if backErr != nil || back.ExitCode != 0 {
+		return execwrap.Result{ExitCode: 1, Stderr: failed + "\nre-import failed: " + resultText(back, backErr)}, nil
+	}
+	return execwrap.Result{ExitCode: 1, Stderr: failed + "\npool re-imported without rewinding"}, nil
+}
+
+func resultText(res execwrap.Result, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(res.Stderr)
+}
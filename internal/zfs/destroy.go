@@ -0,0 +1,94 @@
+// Package zfs previews and performs bulk snapshot destruction.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// DestroyPreview is the parsed result of `zfs destroy -nvp`.
+type DestroyPreview struct {
+	Spec      string   `json:"spec"`
+	Snapshots []string `json:"snapshots"`
+	Reclaim   int64    `json:"reclaim"`
+}
+
+// SnapshotSpec builds the single destroy argument for a selection within one dataset:
+// either an explicit list (`ds@a,b,c`) or an inclusive range (`ds@a%b`). An empty range
+// end means "from the oldest" or "to the newest" snapshot.
+func SnapshotSpec(dataset string, names []string, from, to string) (string, error) {
+	if !ValidDatasetName(dataset) {
+		return "", fmt.Errorf("invalid dataset name")
+	}
+	if len(names) > 0 {
+		if from != "" || to != "" {
+			return "", fmt.Errorf("use either a snapshot list or a range")
+		}
+		for _, name := range names {
+			if !ValidSnapshotToken(name) {
+				return "", fmt.Errorf("invalid snapshot name %q", name)
+			}
+		}
+		return dataset + "@" + strings.Join(names, ","), nil
+	}
+	if from == "" && to == "" {
+		return "", fmt.Errorf("snapshots or range required")
+	}
+	for _, name := range []string{from, to} {
+		if name != "" && !ValidSnapshotToken(name) {
+			return "", fmt.Errorf("invalid snapshot name %q", name)
+		}
+	}
+	return dataset + "@" + from + "%" + to, nil
+}
+
+// PreviewDestroy runs `zfs destroy -nvp` to list what spec would destroy and how many
+// bytes would be freed, without changing anything.
+func PreviewDestroy(ctx context.Context, cfg config.Config, spec string, recursive bool) (DestroyPreview, error) {
+	args := []string{"destroy", "-nvp"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, append(args, spec), nil, cfg.Limits)
+	if err != nil {
+		return DestroyPreview{}, err
+	}
+	if res.ExitCode != 0 {
+		return DestroyPreview{}, fmt.Errorf(res.Stderr)
+	}
+	preview := parseDestroyPreview(res.Stdout)
+	preview.Spec = spec
+	return preview, nil
+}
+
+func parseDestroyPreview(output string) DestroyPreview {
+	preview := DestroyPreview{Snapshots: []string{}}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "destroy":
+			preview.Snapshots = append(preview.Snapshots, fields[1])
+		case "reclaim":
+			preview.Reclaim = parseBytes(fields[1])
+		}
+	}
+	return preview
+}
+
+// DestroySnapshots destroys the whole selection with a single `zfs destroy` call.
+func DestroySnapshots(ctx context.Context, cfg config.Config, spec string, recursive bool) (execwrap.Result, error) {
+	args := []string{"destroy"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZFS, append(args, spec), nil, cfg.Limits)
+}
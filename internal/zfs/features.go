@@ -0,0 +1,220 @@
+// Package zfs parses pool feature flags and runs `zpool upgrade`.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// PoolFeature is one feature@ property. State is disabled, enabled (available but not
+// in use) or active (on-disk format changed).
+type PoolFeature struct {
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+	// ReadOnlyCompatible features still let hosts without them import the pool read-only.
+	ReadOnlyCompatible bool   `json:"read_only_compatible"`
+	Note               string `json:"note"`
+}
+
+// PoolFeatures lists a pool's features and its compatibility property.
+type PoolFeatures struct {
+	Pool          string        `json:"pool"`
+	Compatibility string        `json:"compatibility"`
+	Disabled      int           `json:"disabled"`
+	Enabled       int           `json:"enabled"`
+	Active        int           `json:"active"`
+	Features      []PoolFeature `json:"features"`
+}
+
+type featureInfo struct {
+	description string
+	readOnly    bool
+}
+
+// knownFeatures follows zpool-features(7). Unknown features are still listed, just
+// without a description.
+var knownFeatures = map[string]featureInfo{
+	"allocation_classes":    {"Separate allocation classes (special and dedup vdevs)", true},
+	"async_destroy":         {"Destroy filesystems asynchronously", true},
+	"blake3":                {"BLAKE3 checksum algorithm", false},
+	"block_cloning":         {"Block cloning via the block reference table", true},
+	"bookmark_v2":           {"Larger bookmarks (needed for encrypted bookmarks)", false},
+	"bookmark_written":      {"written#<bookmark> property", false},
+	"bookmarks":             {"zfs bookmark command", true},
+	"device_rebuild":        {"Sequential mirror/dRAID rebuilds", true},
+	"device_removal":        {"Removal of top-level vdevs", false},
+	"draid":                 {"Distributed spare RAID (dRAID) vdevs", false},
+	"edonr":                 {"Edon-R checksum algorithm", false},
+	"embedded_data":         {"Very compressible blocks stored inside block pointers", false},
+	"empty_bpobj":           {"Snapshots use less space", true},
+	"enabled_txg":           {"Records the txg at which features are enabled", true},
+	"encryption":            {"Native dataset encryption", false},
+	"extensible_dataset":    {"Enhanced dataset functionality", false},
+	"fast_dedup":            {"Fast deduplication tables", true},
+	"filesystem_limits":     {"Filesystem and snapshot count limits", true},
+	"head_errlog":           {"Per-dataset on-disk error logs", true},
+	"hole_birth":            {"Hole birth times for more precise incremental sends", false},
+	"large_blocks":          {"Record sizes above 128K", false},
+	"large_dnode":           {"Variable dnode sizes (dnodesize)", false},
+	"large_microzap":        {"Microzaps larger than 128K", false},
+	"livelist":              {"Faster clone deletion", true},
+	"log_spacemap":          {"Metaslab changes logged to a single spacemap", true},
+	"longname":              {"File names up to 1023 bytes", false},
+	"lz4_compress":          {"LZ4 compression", false},
+	"multi_vdev_crash_dump": {"Crash dumps to multi-vdev pools", false},
+	"obsolete_counts":       {"Less memory for removed devices", true},
+	"project_quota":         {"Project quotas and accounting", true},
+	"raidz_expansion":       {"Adding disks to existing RAID-Z vdevs", false},
+	"redacted_datasets":     {"Redacted datasets from redacted sends", false},
+	"redaction_bookmarks":   {"Redaction bookmarks for redacted sends", false},
+	"redaction_list_spill":  {"More redaction snapshots per zfs redact", false},
+	"resilver_defer":        {"Deferring a new resilver while one runs", true},
+	"sha512":                {"SHA-512/256 checksum algorithm", false},
+	"skein":                 {"Skein checksum algorithm", false},
+	"spacemap_histogram":    {"Space histograms in spacemaps", true},
+	"spacemap_v2":           {"More efficient spacemaps for large segments", true},
+	"userobj_accounting":    {"Per-user and per-group object accounting", true},
+	"vdev_zaps_v2":          {"Root vdev ZAP", false},
+	"zilsaxattr":            {"ZIL logging of xattr=sa attributes", true},
+	"zpool_checkpoint":      {"Pool checkpoints (zpool checkpoint)", true},
+	"zstd_compress":         {"Zstandard compression", false},
+}
+
+// compatibilityDirs hold the feature-set files accepted by the compatibility property.
+var compatibilityDirs = []string{"/etc/zfs/compatibility.d", "/usr/share/zfs/compatibility.d"}
+
+// ListPoolFeatures runs `zpool get all` for pool (all pools when empty) and returns the
+// feature@ properties grouped per pool.
+func ListPoolFeatures(ctx context.Context, cfg config.Config, pool string) ([]PoolFeatures, error) {
+	args := []string{"get", "-H", "-o", "name,property,value", "all"}
+	if pool != "" {
+		args = append(args, pool)
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, args, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	return parsePoolFeatures(res.Stdout), nil
+}
+
+func parsePoolFeatures(output string) []PoolFeatures {
+	byPool := map[string]*PoolFeatures{}
+	var order []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) < 3 {
+			continue
+		}
+		name, prop, value := parts[0], parts[1], strings.TrimSpace(parts[2])
+		entry, ok := byPool[name]
+		if !ok {
+			entry = &PoolFeatures{Pool: name, Features: []PoolFeature{}}
+			byPool[name] = entry
+			order = append(order, name)
+		}
+		if prop == "compatibility" {
+			entry.Compatibility = value
+			continue
+		}
+		if !strings.HasPrefix(prop, "feature@") {
+			continue
+		}
+		feature := newPoolFeature(strings.TrimPrefix(prop, "feature@"), value)
+		switch feature.State {
+		case "active":
+			entry.Active++
+		case "enabled":
+			entry.Enabled++
+		case "disabled":
+			entry.Disabled++
+		}
+		entry.Features = append(entry.Features, feature)
+	}
+	out := make([]PoolFeatures, 0, len(order))
+	for _, name := range order {
+		entry := byPool[name]
+		sort.Slice(entry.Features, func(i, j int) bool { return entry.Features[i].Name < entry.Features[j].Name })
+		out = append(out, *entry)
+	}
+	return out
+}
+
+func newPoolFeature(name, state string) PoolFeature {
+	info, known := knownFeatures[name]
+	f := PoolFeature{Name: name, State: state, Description: info.description, ReadOnlyCompatible: info.readOnly}
+	switch {
+	case state == "disabled":
+		f.Note = "available via zpool upgrade"
+	case state == "enabled":
+		f.Note = "enabled but unused; hosts without it can still import"
+	case !known:
+		f.Note = "active; check zpool-features(7) before importing on older hosts"
+	case info.readOnly:
+		f.Note = "active; hosts without it can import read-only"
+	default:
+		f.Note = "active; hosts without it cannot import"
+	}
+	return f
+}
+
+// UpgradePool runs `zpool upgrade <pool>`, enabling every feature the running system
+// supports (limited by the pool's compatibility property).
+func UpgradePool(ctx context.Context, cfg config.Config, pool string) (execwrap.Result, error) {
+	if !ValidPoolName(pool) {
+		return execwrap.Result{}, fmt.Errorf("invalid pool name")
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZPool, []string{"upgrade", pool}, nil, cfg.Limits)
+}
+
+// CompatibilitySets lists the feature-set files installed on this host, e.g.
+// openzfs-2.1-freebsd or grub2.
+func CompatibilitySets() []string {
+	seen := map[string]bool{}
+	sets := []string{}
+	for _, dir := range compatibilityDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || seen[name] {
+				continue
+			}
+			seen[name] = true
+			sets = append(sets, name)
+		}
+	}
+	sort.Strings(sets)
+	return sets
+}
+
+// ValidCompatibility accepts off, legacy, or a comma-separated list of installed
+// feature-set files.
+func ValidCompatibility(value string) bool {
+	if value == "off" || value == "legacy" {
+		return true
+	}
+	known := map[string]bool{}
+	for _, name := range CompatibilitySets() {
+		known[name] = true
+	}
+	for _, name := range strings.Split(value, ",") {
+		if !known[strings.TrimSpace(name)] {
+			return false
+		}
+	}
+	return value != ""
+}
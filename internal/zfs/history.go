@@ -0,0 +1,224 @@
+// Package zfs parses `zpool history -il` and follows `zpool events -f`.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// HistoryEntry is one record of `zpool history -il`. Internal entries (-i) carry a txg
+// and describe what the kernel did; the others are the commands users ran.
+type HistoryEntry struct {
+	Pool     string    `json:"pool"`
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	Internal bool      `json:"internal"`
+	Txg      int64     `json:"txg,omitempty"`
+	User     string    `json:"user,omitempty"`
+	UID      string    `json:"uid,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Zone     string    `json:"zone,omitempty"`
+	Details  []string  `json:"details,omitempty"`
+}
+
+// PoolEvent is one event from `zpool events -v`.
+type PoolEvent struct {
+	Time   string            `json:"time"`
+	Class  string            `json:"class"`
+	Pool   string            `json:"pool,omitempty"`
+	Vdev   string            `json:"vdev,omitempty"`
+	Fields map[string]string `json:"fields"`
+}
+
+// historyOutputScale raises the output cap for history, which grows with pool age.
+const historyOutputScale = 16
+
+var (
+	historyLinePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\.\d{2}:\d{2}:\d{2}) (.*)$`)
+	historyTxgPattern  = regexp.MustCompile(`^\[txg:(\d+)\]\s*`)
+	historyUserPattern = regexp.MustCompile(`\s*\[user (\d+) \(([^)]*)\) on ([^\]:]*)(?::([^\]]*))?\]$`)
+	historyHostPattern = regexp.MustCompile(`\s*\[on ([^\]:]*)(?::([^\]]*))?\]$`)
+)
+
+// PoolHistory runs `zpool history -il` for pool (all pools when empty). The bool reports
+// whether output was cut at the (raised) output limit.
+func PoolHistory(ctx context.Context, cfg config.Config, pool string) ([]HistoryEntry, bool, error) {
+	args := []string{"history", "-il"}
+	if pool != "" {
+		args = append(args, pool)
+	}
+	limits := cfg.Limits
+	limits.MaxOutputBytes *= historyOutputScale
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, args, nil, limits)
+	if err != nil {
+		return nil, false, err
+	}
+	if res.ExitCode != 0 {
+		return nil, false, fmt.Errorf(res.Stderr)
+	}
+	return parseHistory(res.Stdout, time.Local), res.Truncated, nil
+}
+
+func parseHistory(output string, loc *time.Location) []HistoryEntry {
+	entries := []HistoryEntry{}
+	pool := ""
+	var current *HistoryEntry
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "History for '") {
+			pool = strings.TrimSuffix(strings.TrimPrefix(line, "History for '"), "':")
+			current = nil
+			continue
+		}
+		match := historyLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			// ioctl records (-i) continue with indented input/output nvlists and end with
+			// the user/host suffix on its own line.
+			if current == nil || raw == line {
+				continue
+			}
+			if m := historyUserPattern.FindStringSubmatch(line); m != nil && strings.HasPrefix(line, "[") {
+				current.UID, current.User, current.Host, current.Zone = m[1], m[2], m[3], m[4]
+				continue
+			}
+			current.Details = append(current.Details, line)
+			continue
+		}
+		when, err := time.ParseInLocation("2006-01-02.15:04:05", match[1], loc)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, parseHistoryRecord(pool, when, match[2]))
+		current = &entries[len(entries)-1]
+	}
+	return entries
+}
+
+func parseHistoryRecord(pool string, when time.Time, rest string) HistoryEntry {
+	entry := HistoryEntry{Pool: pool, Time: when}
+	if m := historyTxgPattern.FindStringSubmatch(rest); m != nil {
+		entry.Internal = true
+		entry.Txg, _ = strconv.ParseInt(m[1], 10, 64)
+		rest = rest[len(m[0]):]
+	}
+	if m := historyUserPattern.FindStringSubmatchIndex(rest); m != nil {
+		entry.UID = rest[m[2]:m[3]]
+		entry.User = rest[m[4]:m[5]]
+		entry.Host = rest[m[6]:m[7]]
+		if m[8] >= 0 {
+			entry.Zone = rest[m[8]:m[9]]
+		}
+		rest = rest[:m[0]]
+	} else if m := historyHostPattern.FindStringSubmatchIndex(rest); m != nil {
+		entry.Host = rest[m[2]:m[3]]
+		if m[4] >= 0 {
+			entry.Zone = rest[m[4]:m[5]]
+		}
+		rest = rest[:m[0]]
+	}
+	if !entry.Internal && strings.HasPrefix(rest, "ioctl ") {
+		entry.Internal = true
+	}
+	entry.Command = strings.TrimSpace(rest)
+	return entry
+}
+
+// FollowEvents runs `zpool events -fv` until ctx is cancelled, calling fn for each event.
+// zpool first replays the events still in the kernel buffer, then waits for new ones.
+func FollowEvents(ctx context.Context, cfg config.Config, fn func(PoolEvent)) error {
+	cmd := execwrap.Command(ctx, cfg.Paths.ZPool, []string{"events", "-fv"})
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	errBuf := &limitedBuffer{limit: 4096}
+	cmd.Stderr = errBuf
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Stop reading as soon as the client goes away, even if zpool is slow to exit.
+	stop := context.AfterFunc(ctx, func() { stdout.Close() })
+	defer stop()
+	readEvents(stdout, fn)
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(errBuf.String()); msg != "" {
+			return fmt.Errorf(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// readEvents splits verbose event output: a "<time> <class>" header followed by indented
+// "name = value" lines and a blank line.
+func readEvents(r io.Reader, fn func(PoolEvent)) {
+	var current *PoolEvent
+	flush := func() {
+		if current != nil {
+			fn(*current)
+			current = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			flush()
+			continue
+		}
+		if raw == line && !strings.Contains(line, " = ") {
+			flush()
+			if strings.HasPrefix(line, "TIME") {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			current = &PoolEvent{
+				Time:   strings.Join(fields[:len(fields)-1], " "),
+				Class:  fields[len(fields)-1],
+				Fields: map[string]string{},
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		current.Fields[key] = value
+		switch key {
+		case "pool":
+			current.Pool = value
+		case "vdev_path":
+			current.Vdev = value
+		}
+	}
+	flush()
+}
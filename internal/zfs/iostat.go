@@ -0,0 +1,146 @@
+// Package zfs samples per-pool and per-vdev I/O statistics.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// IOStat is one pool or vdev row of `zpool iostat -Hpvl`. Rates are per second and
+// wait times are averages in milliseconds over the sampling interval.
+type IOStat struct {
+	Pool          string  `json:"pool"`
+	Name          string  `json:"name"`
+	Vdev          bool    `json:"vdev"`
+	ReadOps       float64 `json:"read_ops"`
+	WriteOps      float64 `json:"write_ops"`
+	ReadBytes     float64 `json:"read_bytes"`
+	WriteBytes    float64 `json:"write_bytes"`
+	ReadWait      float64 `json:"read_wait_ms"`
+	WriteWait     float64 `json:"write_wait_ms"`
+	DiskReadWait  float64 `json:"disk_read_wait_ms"`
+	DiskWriteWait float64 `json:"disk_write_wait_ms"`
+}
+
+// Values returns the sample as a metric map for the stats store.
+func (s IOStat) Values() map[string]float64 {
+	return map[string]float64{
+		"read_ops":           s.ReadOps,
+		"write_ops":          s.WriteOps,
+		"read_bytes":         s.ReadBytes,
+		"write_bytes":        s.WriteBytes,
+		"read_wait_ms":       s.ReadWait,
+		"write_wait_ms":      s.WriteWait,
+		"disk_read_wait_ms":  s.DiskReadWait,
+		"disk_write_wait_ms": s.DiskWriteWait,
+	}
+}
+
+// SampleIOStats runs `zpool iostat -Hpvly <seconds> 1`, which blocks for the interval and
+// reports averages over it (not since boot). Older zpool builds without -l are retried
+// without latency columns.
+func SampleIOStats(ctx context.Context, cfg config.Config, seconds int) ([]IOStat, error) {
+	if seconds <= 0 {
+		seconds = 1
+	}
+	pools, err := ListPools(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) == 0 {
+		return []IOStat{}, nil
+	}
+	names := map[string]bool{}
+	for _, pool := range pools {
+		names[pool.Name] = true
+	}
+	limits := cfg.Limits
+	limits.MaxRuntimeSeconds += int64(seconds)
+	interval := strconv.Itoa(seconds)
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"iostat", "-Hpvly", interval, "1"}, nil, limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 && strings.Contains(res.Stderr, "invalid option") {
+		res, err = execwrap.Run(ctx, cfg.Paths.ZPool, []string{"iostat", "-Hpvy", interval, "1"}, nil, limits)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	return parseIOStats(res.Stdout, names), nil
+}
+
+// parseIOStats reads scripted iostat output. Pool rows are recognised by name (and by
+// indentation when zpool prints it); every other row belongs to the last pool seen.
+func parseIOStats(output string, pools map[string]bool) []IOStat {
+	stats := []IOStat{}
+	current := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		raw := scanner.Text()
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		depth := indentDepth(raw)
+		parts := strings.Split(strings.TrimLeft(raw, " \t"), "\t")
+		if len(parts) < 7 {
+			parts = strings.Fields(raw)
+		}
+		if len(parts) < 7 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		isPool := depth == 0 && pools[name]
+		if isPool {
+			current = name
+		}
+		if current == "" {
+			continue
+		}
+		if _, ok := vdevSectionRole(name); ok && !isPool {
+			continue
+		}
+		readOps, ok := parseIOValue(parts[3])
+		if !ok {
+			continue
+		}
+		row := IOStat{Pool: current, Name: name, Vdev: !isPool, ReadOps: readOps}
+		row.WriteOps, _ = parseIOValue(parts[4])
+		row.ReadBytes, _ = parseIOValue(parts[5])
+		row.WriteBytes, _ = parseIOValue(parts[6])
+		if len(parts) >= 11 {
+			row.ReadWait = nsToMillis(parts[7])
+			row.WriteWait = nsToMillis(parts[8])
+			row.DiskReadWait = nsToMillis(parts[9])
+			row.DiskWriteWait = nsToMillis(parts[10])
+		}
+		stats = append(stats, row)
+	}
+	return stats
+}
+
+func parseIOValue(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-" {
+		return 0, false
+	}
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+func nsToMillis(value string) float64 {
+	val, _ := parseIOValue(value)
+	return val / 1e6
+}
@@ -0,0 +1,274 @@
+// Package zfs expands and parses strftime-like snapshot naming templates.
+package zfs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSnapshotTemplate reproduces the historical `<prefix>-YYYYMMDD-HHMMSS` names.
+const DefaultSnapshotTemplate = "%p-%Y%m%d-%H%M%S"
+
+// NameTemplate describes how a schedule names its snapshots. Pattern supports %Y %y %m
+// %d %j %H %M %S %s (epoch) and %%, plus %p for Prefix. Timestamps are written in local
+// time unless UTC is set.
+type NameTemplate struct {
+	Pattern string `json:"template"`
+	Prefix  string `json:"prefix"`
+	UTC     bool   `json:"utc"`
+}
+
+// SnapshotTemplatePreset is a ready-made template matching another tool's layout.
+type SnapshotTemplatePreset struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	UTC      bool   `json:"utc"`
+}
+
+// SnapshotTemplatePresets lists templates compatible with common consumers. Samba's
+// shadow_copy2 reads the prefixed GMT names with `shadow:snapprefix` and
+// `shadow:format = _GMT-%Y.%m.%d-%H.%M.%S`; sanoid and zfs-auto-snapshot put the
+// schedule label (here the prefix) in the name.
+var SnapshotTemplatePresets = []SnapshotTemplatePreset{
+	{Name: "default", Template: DefaultSnapshotTemplate},
+	{Name: "shadow_copy2", Template: "%p_GMT-%Y.%m.%d-%H.%M.%S", UTC: true},
+	{Name: "sanoid", Template: "autosnap_%Y-%m-%d_%H:%M:%S_%p"},
+	{Name: "zfs-auto-snapshot", Template: "zfs-auto-snap_%p-%Y-%m-%d-%H%M", UTC: true},
+}
+
+// templateDirectives maps each time directive to the regexp fragment that matches it.
+var templateDirectives = map[byte]string{
+	'Y': `(\d{4})`,
+	'y': `(\d{2})`,
+	'm': `(\d{2})`,
+	'd': `(\d{2})`,
+	'j': `(\d{3})`,
+	'H': `(\d{2})`,
+	'M': `(\d{2})`,
+	'S': `(\d{2})`,
+	's': `(\d+)`,
+}
+
+func (nt NameTemplate) pattern() string {
+	if nt.Pattern == "" {
+		return DefaultSnapshotTemplate
+	}
+	return nt.Pattern
+}
+
+func (nt NameTemplate) prefix() string {
+	if nt.Prefix == "" {
+		return "snapshot"
+	}
+	return nt.Prefix
+}
+
+func (nt NameTemplate) location() *time.Location {
+	if nt.UTC {
+		return time.UTC
+	}
+	return time.Local
+}
+
+// Validate checks the directives, that the template carries a date and the prefix, and
+// that the names it produces are valid snapshot tokens. Retention prunes every snapshot
+// matching the template, so without %p schedules sharing a template on one dataset
+// would prune each other's snapshots.
+func (nt NameTemplate) Validate() error {
+	if !validToken(nt.Prefix) {
+		return fmt.Errorf("invalid snapshot prefix")
+	}
+	if _, _, err := nt.compile(); err != nil {
+		return err
+	}
+	pattern := nt.pattern()
+	if !strings.Contains(pattern, "%Y") && !strings.Contains(pattern, "%y") && !strings.Contains(pattern, "%s") {
+		return fmt.Errorf("template needs a year (%%Y or %%y) or an epoch (%%s)")
+	}
+	if !strings.Contains(strings.ReplaceAll(pattern, "%%", ""), "%p") {
+		return fmt.Errorf("template needs the prefix (%%p) so schedules do not prune each other's snapshots")
+	}
+	name := nt.Format(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+	if !ValidSnapshotToken(name) || len(name) > 200 {
+		return fmt.Errorf("template produces an invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+// Format renders the snapshot name (without dataset) for t.
+func (nt NameTemplate) Format(t time.Time) string {
+	t = t.In(nt.location())
+	pattern := nt.pattern()
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'p':
+			b.WriteString(nt.prefix())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// Parse matches a snapshot name (with or without the dataset part) against the whole
+// template and returns the timestamp encoded in it.
+func (nt NameTemplate) Parse(name string) (time.Time, bool) {
+	re, order, err := nt.compile()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return nt.parseWith(re, order, name)
+}
+
+func (nt NameTemplate) parseWith(re *regexp.Regexp, order []byte, name string) (time.Time, bool) {
+	if _, short, ok := strings.Cut(name, "@"); ok {
+		name = short
+	}
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, month, day, yday, hour, minute, second := 1970, 1, 1, 0, 0, 0, 0
+	for i, directive := range order {
+		value, _ := strconv.ParseInt(m[i+1], 10, 64)
+		n := int(value)
+		switch directive {
+		case 's':
+			return time.Unix(value, 0).In(nt.location()), true
+		case 'Y':
+			year = n
+		case 'y':
+			year = 2000 + n
+		case 'm':
+			month = n
+		case 'd':
+			day = n
+		case 'j':
+			yday = n
+		case 'H':
+			hour = n
+		case 'M':
+			minute = n
+		case 'S':
+			second = n
+		}
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 60 || yday > 366 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, nt.location())
+	if yday > 0 {
+		t = time.Date(year, time.January, yday, hour, minute, second, 0, nt.location())
+	} else if t.Day() != day {
+		// time.Date normalises Feb 31 to March; such names did not come from Format.
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// compile turns the template into an anchored regexp plus the directive behind each
+// capture group.
+func (nt NameTemplate) compile() (*regexp.Regexp, []byte, error) {
+	pattern := nt.pattern()
+	var b strings.Builder
+	var order []byte
+	literal := func(s string) { b.WriteString(regexp.QuoteMeta(s)) }
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			literal(pattern[i : i+1])
+			continue
+		}
+		if i+1 == len(pattern) {
+			return nil, nil, fmt.Errorf("template ends with a lone %%")
+		}
+		i++
+		switch c := pattern[i]; c {
+		case 'p':
+			literal(nt.prefix())
+		case '%':
+			literal("%")
+		default:
+			fragment, ok := templateDirectives[c]
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported template directive %%%c", c)
+			}
+			b.WriteString(fragment)
+			order = append(order, c)
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, order, nil
+}
+
+// snapshotsMatching returns the full names of snapshots whose name matches the whole
+// template, oldest timestamp first. Names that merely share a prefix are ignored.
+func snapshotsMatching(snaps []Snapshot, nt NameTemplate) []string {
+	names := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		if strings.Contains(snap.Name, "@") {
+			names = append(names, snap.Name)
+		}
+	}
+	return namesMatching(names, nt)
+}
+
+// namesMatching filters and orders arbitrary names (snapshots, boot environments) by
+// the timestamp the template encodes in them.
+func namesMatching(names []string, nt NameTemplate) []string {
+	out := []string{}
+	re, order, err := nt.compile()
+	if err != nil {
+		return out
+	}
+	type match struct {
+		name string
+		at   time.Time
+	}
+	var matches []match
+	for _, name := range names {
+		if at, ok := nt.parseWith(re, order, name); ok {
+			matches = append(matches, match{name: name, at: at})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].at.Before(matches[j].at) })
+	for _, m := range matches {
+		out = append(out, m.name)
+	}
+	return out
+}
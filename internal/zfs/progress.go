@@ -0,0 +1,240 @@
+// Package zfs handles send size estimation, transfer metering and replication history.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// TransferProgress is a point-in-time view of bytes moved through a send pipeline.
+type TransferProgress struct {
+	Bytes      int64   `json:"bytes"`
+	Total      int64   `json:"total"`
+	Percent    float64 `json:"percent"`
+	Rate       float64 `json:"rate"`
+	ETASeconds int64   `json:"eta_seconds"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+	Done       bool    `json:"done"`
+}
+
+// ReplicationRecord is one finished replication run as stored in the history file.
+type ReplicationRecord struct {
+	Source          string    `json:"source"`
+	Target          string    `json:"target"`
+	Snapshot        string    `json:"snapshot"`
+	Base            string    `json:"base"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	Bytes           int64     `json:"bytes"`
+	Estimated       int64     `json:"estimated"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	ExitCode        int       `json:"exit_code"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// EstimateSendSize runs `zfs send -nvP` with the same arguments as the real send and
+// returns the estimated stream size in bytes.
+func EstimateSendSize(ctx context.Context, cfg config.Config, sendArgs []string) (int64, error) {
+	if len(sendArgs) == 0 || sendArgs[0] != "send" {
+		return 0, fmt.Errorf("invalid send arguments")
+	}
+	args := append([]string{"send", "-nvP"}, sendArgs[1:]...)
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, args, nil, cfg.Limits)
+	if err != nil {
+		return 0, err
+	}
+	if res.ExitCode != 0 {
+		return 0, fmt.Errorf(res.Stderr)
+	}
+	// Dry-run output lands on stdout in current OpenZFS and on stderr in older releases.
+	if size, ok := parseSendSize(res.Stdout); ok {
+		return size, nil
+	}
+	if size, ok := parseSendSize(res.Stderr); ok {
+		return size, nil
+	}
+	return 0, fmt.Errorf("no size in send estimate")
+}
+
+func parseSendSize(output string) (int64, bool) {
+	var size int64
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "size" {
+			continue
+		}
+		val, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		size = val
+		found = true
+	}
+	return size, found
+}
+
+// transferMeter counts bytes written through the send side of a pipeline. It can also
+// throttle the stream to limit bytes per second and hold it while pause reports true.
+type transferMeter struct {
+	bytes atomic.Int64
+	total int64
+	start time.Time
+
+	ctx         context.Context
+	limit       int64
+	paused      func() bool
+	resume      func(context.Context) error
+	windowStart time.Time
+	windowBytes int64
+}
+
+func newTransferMeter(total int64) *transferMeter {
+	now := time.Now()
+	return &transferMeter{total: total, start: now, windowStart: now, ctx: context.Background()}
+}
+
+func (m *transferMeter) Write(p []byte) (int, error) {
+	if m.paused != nil && m.paused() {
+		if err := m.resume(m.ctx); err != nil {
+			return 0, err
+		}
+		// Do not let the throttle make up for time spent paused.
+		m.windowStart = time.Now()
+		m.windowBytes = 0
+	}
+	m.bytes.Add(int64(len(p)))
+	if m.limit > 0 {
+		m.windowBytes += int64(len(p))
+		due := m.windowStart.Add(time.Duration(float64(m.windowBytes) / float64(m.limit) * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-m.ctx.Done():
+				timer.Stop()
+				return 0, m.ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (m *transferMeter) snapshot(done bool) TransferProgress {
+	bytes := m.bytes.Load()
+	elapsed := time.Since(m.start).Seconds()
+	p := TransferProgress{Bytes: bytes, Total: m.total, Elapsed: elapsed, Done: done}
+	if elapsed > 0 {
+		p.Rate = float64(bytes) / elapsed
+	}
+	if m.total > 0 {
+		p.Percent = float64(bytes) * 100 / float64(m.total)
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+		if p.Rate > 0 && bytes < m.total {
+			p.ETASeconds = int64(float64(m.total-bytes) / p.Rate)
+		}
+	}
+	if done {
+		p.ETASeconds = 0
+		if m.total > 0 {
+			p.Percent = 100
+		}
+	}
+	return p
+}
+
+// report calls fn once per interval until the returned stop func is called.
+func (m *transferMeter) report(fn func(TransferProgress), interval time.Duration) func() {
+	if fn == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fn(m.snapshot(false))
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-finished
+	}
+}
+
+// AppendReplicationRecord appends rec to the JSON-lines history file at path.
+func AppendReplicationRecord(path string, rec ReplicationRecord) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// ReplicationHistory returns up to limit records, newest first. A missing file is empty.
+func ReplicationHistory(path string, limit int) ([]ReplicationRecord, error) {
+	records := []ReplicationRecord{}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec ReplicationRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
@@ -0,0 +1,302 @@
+// Package zfs handles remote replication targets reached over SSH.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// RemoteTarget is a parsed `user@host:pool/ds` replication target.
+type RemoteTarget struct {
+	User    string `json:"user"`
+	Host    string `json:"host"`
+	Dataset string `json:"dataset"`
+}
+
+// SSHOptions tunes the ssh transport for one replication job.
+type SSHOptions struct {
+	Port       int
+	Cipher     string
+	Compress   bool
+	RemoteSudo bool
+	TrustNew   bool
+}
+
+// KnownHost is one entry of the managed known_hosts file.
+type KnownHost struct {
+	Host        string `json:"host"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (t RemoteTarget) String() string {
+	return fmt.Sprintf("%s@%s:%s", t.User, t.Host, t.Dataset)
+}
+
+// ParseRemoteTarget splits a `user@host:pool/ds` target. Local dataset names never match
+// because they cannot contain '@'.
+func ParseRemoteTarget(target string) (RemoteTarget, bool) {
+	target = strings.TrimSpace(target)
+	idx := strings.Index(target, ":")
+	if idx <= 0 {
+		return RemoteTarget{}, false
+	}
+	addr := target[:idx]
+	dataset := target[idx+1:]
+	if strings.Contains(addr, "/") {
+		return RemoteTarget{}, false
+	}
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || at == len(addr)-1 {
+		return RemoteTarget{}, false
+	}
+	user := addr[:at]
+	host := addr[at+1:]
+	if !validSSHWord(user) || !validSSHWord(host) || !ValidDatasetName(dataset) {
+		return RemoteTarget{}, false
+	}
+	return RemoteTarget{User: user, Host: host, Dataset: dataset}, true
+}
+
+// IsRemoteTarget reports whether target uses the `user@host:pool/ds` form.
+func IsRemoteTarget(target string) bool {
+	_, ok := ParseRemoteTarget(target)
+	return ok
+}
+
+// ValidReplicationTarget accepts a local dataset name or a `user@host:pool/ds` target.
+func ValidReplicationTarget(target string) bool {
+	if _, ok := ParseRemoteTarget(target); ok {
+		return true
+	}
+	return ValidDatasetName(target)
+}
+
+// ValidSSHCipher checks a cipher name such as aes128-gcm@openssh.com.
+func ValidSSHCipher(cipher string) bool {
+	if cipher == "" || strings.HasPrefix(cipher, "-") {
+		return false
+	}
+	for _, r := range cipher {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			continue
+		}
+		switch r {
+		case '-', '.', '@':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validSSHWord(value string) bool {
+	if value == "" || strings.HasPrefix(value, "-") {
+		return false
+	}
+	for _, r := range value {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			continue
+		}
+		switch r {
+		case '-', '_', '.':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func sshArgs(cfg config.Config, t RemoteTarget, opts SSHOptions) []string {
+	strict := "yes"
+	if opts.TrustNew {
+		strict = "accept-new"
+	}
+	args := []string{
+		"-i", cfg.Replication.KeyFile,
+		"-o", "IdentitiesOnly=yes",
+		"-o", "BatchMode=yes",
+		"-o", "UserKnownHostsFile=" + cfg.Replication.KnownHostsFile,
+		"-o", "StrictHostKeyChecking=" + strict,
+	}
+	if opts.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(opts.Port))
+	}
+	if opts.Cipher != "" {
+		args = append(args, "-c", opts.Cipher)
+	}
+	if opts.Compress {
+		args = append(args, "-C")
+	}
+	return append(args, "-l", t.User, "--", t.Host)
+}
+
+// sshCommand returns the full command line (ssh binary first) that runs zfs with args
+// on the remote host.
+func sshCommand(cfg config.Config, t RemoteTarget, opts SSHOptions, args []string) []string {
+	remote := []string{}
+	if opts.RemoteSudo {
+		remote = append(remote, "sudo", "-n")
+	}
+	remote = append(remote, cfg.Replication.RemoteZFS)
+	remote = append(remote, args...)
+	quoted := make([]string, 0, len(remote))
+	for _, arg := range remote {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	cmd := append([]string{cfg.Paths.SSH}, sshArgs(cfg, t, opts)...)
+	return append(cmd, strings.Join(quoted, " "))
+}
+
+func shellQuote(value string) string {
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@=,") == "" {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// RunRemoteZFS runs one zfs command on the remote host.
+func RunRemoteZFS(ctx context.Context, cfg config.Config, t RemoteTarget, opts SSHOptions, args []string) (execwrap.Result, error) {
+	cmd := sshCommand(cfg, t, opts, args)
+	return execwrap.RunUnprivileged(ctx, cmd[0], cmd[1:], nil, cfg.Limits)
+}
+
+// ListRemoteSnapshots lists snapshots of the target dataset on the remote host.
+func ListRemoteSnapshots(ctx context.Context, cfg config.Config, t RemoteTarget, opts SSHOptions) ([]Snapshot, error) {
+	res, err := RunRemoteZFS(ctx, cfg, t, opts, []string{"list", "-H", "-t", "snapshot", "-o", "name,creation,guid", "-s", "creation", t.Dataset})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	return parseSnapshotList(res.Stdout), nil
+}
+
+// TestRemoteTarget checks that the remote pool is reachable and visible to zfs.
+func TestRemoteTarget(ctx context.Context, cfg config.Config, t RemoteTarget, opts SSHOptions) (execwrap.Result, error) {
+	pool := strings.SplitN(t.Dataset, "/", 2)[0]
+	return RunRemoteZFS(ctx, cfg, t, opts, []string{"list", "-H", "-o", "name,used,avail", pool})
+}
+
+// SSHPublicKey returns the public half of the managed replication key.
+func SSHPublicKey(ctx context.Context, cfg config.Config) (string, error) {
+	res, err := execwrap.RunUnprivileged(ctx, cfg.Paths.SSHKeygen, []string{"-y", "-f", cfg.Replication.KeyFile}, nil, cfg.Limits)
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf(res.Stderr)
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// GenerateSSHKey creates the managed ed25519 replication key (no passphrase), owned by
+// the service user.
+func GenerateSSHKey(ctx context.Context, cfg config.Config) (execwrap.Result, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Replication.KeyFile), 0o700); err != nil {
+		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+	}
+	return execwrap.RunUnprivileged(ctx, cfg.Paths.SSHKeygen, []string{"-q", "-t", "ed25519", "-N", "", "-C", "raidraccoon-replication", "-f", cfg.Replication.KeyFile}, nil, cfg.Limits)
+}
+
+// ListKnownHosts returns fingerprints from the managed known_hosts file.
+func ListKnownHosts(ctx context.Context, cfg config.Config) ([]KnownHost, error) {
+	res, err := execwrap.RunUnprivileged(ctx, cfg.Paths.SSHKeygen, []string{"-l", "-f", cfg.Replication.KnownHostsFile}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		msg := strings.ToLower(res.Stderr + res.Stdout)
+		if strings.Contains(msg, "no such file") || strings.Contains(msg, "is not a public key file") {
+			return []KnownHost{}, nil
+		}
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	hosts := []KnownHost{}
+	scanner := bufio.NewScanner(strings.NewReader(res.Stdout))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		hosts = append(hosts, KnownHost{
+			Host:        fields[2],
+			Type:        strings.Trim(fields[len(fields)-1], "()"),
+			Fingerprint: fields[1],
+		})
+	}
+	return hosts, nil
+}
+
+// ForgetKnownHost removes host keys for host from the managed known_hosts file.
+func ForgetKnownHost(ctx context.Context, cfg config.Config, host string) (execwrap.Result, error) {
+	name := host
+	if strings.HasPrefix(host, "[") {
+		// Non-default ports are stored as [host]:port.
+		end := strings.Index(host, "]:")
+		if end < 0 || !isDigits(host[end+2:]) {
+			return execwrap.Result{}, fmt.Errorf("invalid host")
+		}
+		name = host[1:end]
+	}
+	if !validSSHWord(name) {
+		return execwrap.Result{}, fmt.Errorf("invalid host")
+	}
+	return execwrap.RunUnprivileged(ctx, cfg.Paths.SSHKeygen, []string{"-R", host, "-f", cfg.Replication.KnownHostsFile}, nil, cfg.Limits)
+}
+
+// listTargetSnapshots lists snapshots on a local or remote replication target.
+// A target dataset that does not exist yet yields an empty list.
+func listTargetSnapshots(ctx context.Context, cfg config.Config, target string, opts SSHOptions) ([]Snapshot, error) {
+	var snaps []Snapshot
+	var err error
+	if remote, ok := ParseRemoteTarget(target); ok {
+		snaps, err = ListRemoteSnapshots(ctx, cfg, remote, opts)
+	} else {
+		snaps, err = ListSnapshots(ctx, cfg, target)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return []Snapshot{}, nil
+		}
+		return nil, err
+	}
+	return snaps, nil
+}
+
+func enforceTargetRetention(ctx context.Context, cfg config.Config, target string, naming NameTemplate, retention int, opts SSHOptions) ([]string, error) {
+	remote, ok := ParseRemoteTarget(target)
+	if !ok {
+		return EnforceRetention(ctx, cfg, target, naming, retention)
+	}
+	if retention <= 0 {
+		return nil, nil
+	}
+	snaps, err := ListRemoteSnapshots(ctx, cfg, remote, opts)
+	if err != nil {
+		return nil, err
+	}
+	var destroyed []string
+	for _, name := range retentionVictims(snaps, naming, retention) {
+		res, err := RunRemoteZFS(ctx, cfg, remote, opts, []string{"destroy", name})
+		if err != nil {
+			return destroyed, err
+		}
+		if res.ExitCode != 0 {
+			return destroyed, fmt.Errorf(res.Stderr)
+		}
+		destroyed = append(destroyed, name)
+	}
+	return destroyed, nil
+}
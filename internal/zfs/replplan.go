@@ -0,0 +1,143 @@
+// Package zfs handles common-snapshot discovery for replication jobs.
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// ReplicationPlan describes how a replication run relates source and target.
+type ReplicationPlan struct {
+	Source          string   `json:"source"`
+	Target          string   `json:"target"`
+	Snapshot        string   `json:"snapshot"`
+	Base            string   `json:"base"`
+	BaseGUID        string   `json:"base_guid"`
+	Full            bool     `json:"full"`
+	TargetSnapshots int      `json:"target_snapshots"`
+	Newer           []string `json:"newer_on_target"`
+	Rollback        bool     `json:"rollback"`
+	Reseed          bool     `json:"reseed"`
+	Diverged        bool     `json:"diverged"`
+	Message         string   `json:"message"`
+}
+
+// ReplicationDivergedError reports a target that no longer shares history with the source.
+type ReplicationDivergedError struct {
+	Plan ReplicationPlan
+}
+
+func (e *ReplicationDivergedError) Error() string {
+	return e.Plan.Message
+}
+
+// CheckReplication plans a run as if a new source snapshot were about to be sent, so any
+// existing source snapshot (the newest included) can be the base, without changing
+// anything.
+func CheckReplication(ctx context.Context, cfg config.Config, source, target string, opts ReplicationOptions) (ReplicationPlan, error) {
+	sourceSnaps, err := ListSnapshots(ctx, cfg, source)
+	if err != nil {
+		return ReplicationPlan{}, err
+	}
+	if len(sourceSnaps) == 0 {
+		return ReplicationPlan{}, fmt.Errorf("source has no snapshots")
+	}
+	targetSnaps, err := listTargetSnapshots(ctx, cfg, target, opts.SSH)
+	if err != nil {
+		return ReplicationPlan{}, err
+	}
+	plan := planReplication(source, target, "", sourceSnaps, targetSnaps, opts)
+	if newest := sourceSnaps[len(sourceSnaps)-1]; !plan.Diverged && plan.Base == newest.Name {
+		plan.Message = fmt.Sprintf("target is up to date with %s", newest.Name)
+	}
+	return plan, nil
+}
+
+// planReplication finds the newest source snapshot (older than curr, or any when curr is
+// "") whose GUID exists on the target and decides whether the target must be rolled back or reseeded.
+func planReplication(source, target, curr string, sourceSnaps, targetSnaps []Snapshot, opts ReplicationOptions) ReplicationPlan {
+	plan := ReplicationPlan{Source: source, Target: target, Snapshot: curr, TargetSnapshots: len(targetSnaps), Newer: []string{}}
+
+	targetIndex := map[string]int{}
+	for i, snap := range targetSnaps {
+		if snap.GUID != "" {
+			targetIndex[snap.GUID] = i
+		}
+	}
+	currIndex := len(sourceSnaps)
+	for i, snap := range sourceSnaps {
+		if curr != "" && snap.Name == curr {
+			currIndex = i
+			break
+		}
+	}
+	common := -1
+	for i := currIndex - 1; i >= 0; i-- {
+		if idx, ok := targetIndex[sourceSnaps[i].GUID]; ok && sourceSnaps[i].GUID != "" {
+			plan.Base = sourceSnaps[i].Name
+			plan.BaseGUID = sourceSnaps[i].GUID
+			common = idx
+			break
+		}
+	}
+
+	switch {
+	case len(targetSnaps) == 0:
+		plan.Full = true
+		plan.Message = "target has no snapshots; sending full stream"
+	case common < 0:
+		plan.Full = true
+		plan.Diverged = true
+		plan.Reseed = opts.Reseed
+		if opts.Reseed {
+			plan.Message = fmt.Sprintf("no common snapshot with target (%d snapshots); target will be destroyed and reseeded", len(targetSnaps))
+		} else {
+			plan.Message = fmt.Sprintf("no common snapshot between %s and %s (target has %d snapshots); enable reseed to destroy the target and send a full stream", source, target, len(targetSnaps))
+		}
+	default:
+		for _, snap := range targetSnaps[common+1:] {
+			plan.Newer = append(plan.Newer, snap.Name)
+		}
+		if len(plan.Newer) == 0 {
+			plan.Message = fmt.Sprintf("incremental from %s", plan.Base)
+			break
+		}
+		plan.Diverged = true
+		plan.Rollback = opts.Force || opts.Reseed
+		if plan.Rollback {
+			plan.Message = fmt.Sprintf("target has %d snapshots newer than %s; they will be rolled back", len(plan.Newer), plan.Base)
+		} else {
+			plan.Message = fmt.Sprintf("target has %d snapshots newer than common snapshot %s (newest %s); enable force or reseed to roll them back", len(plan.Newer), plan.Base, plan.Newer[len(plan.Newer)-1])
+		}
+	}
+	return plan
+}
+
+// Blocked reports whether the plan cannot run without discarding target state.
+func (p ReplicationPlan) Blocked() bool {
+	if !p.Diverged {
+		return false
+	}
+	if p.Base == "" {
+		return !p.Reseed
+	}
+	return !p.Rollback
+}
+
+// destroyTarget removes a diverged local or remote target before a reseed.
+func destroyTarget(ctx context.Context, cfg config.Config, target string, opts SSHOptions) (execwrap.Result, error) {
+	if remote, ok := ParseRemoteTarget(target); ok {
+		if !strings.Contains(remote.Dataset, "/") {
+			return execwrap.Result{ExitCode: 1, Stderr: "refusing to reseed a pool root"}, fmt.Errorf("refusing to reseed a pool root")
+		}
+		return RunRemoteZFS(ctx, cfg, remote, opts, []string{"destroy", "-r", remote.Dataset})
+	}
+	if !strings.Contains(target, "/") {
+		return execwrap.Result{ExitCode: 1, Stderr: "refusing to reseed a pool root"}, fmt.Errorf("refusing to reseed a pool root")
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZFS, []string{"destroy", "-r", target}, nil, cfg.Limits)
+}
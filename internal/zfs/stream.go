@@ -0,0 +1,418 @@
+// Package zfs writes `zfs send` streams to files with a SHA-256 manifest and receives
+// them back, for offline and sneakernet backups.
+package zfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+const streamManifestVersion = 1
+
+// StreamEntry describes one stream file. GUIDs identify the snapshots independently of
+// their names, so a renamed target still matches.
+type StreamEntry struct {
+	File      string    `json:"file"`
+	Snapshot  string    `json:"snapshot"`
+	GUID      string    `json:"guid"`
+	Base      string    `json:"base,omitempty"`
+	BaseGUID  string    `json:"base_guid,omitempty"`
+	Raw       bool      `json:"raw"`
+	Recursive bool      `json:"recursive"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Created   time.Time `json:"created"`
+}
+
+// StreamManifest lists the streams of one dataset exported into a directory, in the
+// order they have to be received.
+type StreamManifest struct {
+	Version int           `json:"version"`
+	Dataset string        `json:"dataset"`
+	Host    string        `json:"host,omitempty"`
+	Streams []StreamEntry `json:"streams"`
+}
+
+// StreamExportOptions controls ExportStream.
+type StreamExportOptions struct {
+	// Snapshot is the full pool/ds@snap to send.
+	Snapshot string
+	// Base makes the stream incremental (`-I`) from an earlier snapshot of the dataset.
+	Base      string
+	Dir       string
+	Raw       bool
+	Compress  bool
+	Recursive bool
+	Progress  func(TransferProgress)
+}
+
+// StreamImportOptions controls ImportStreams.
+type StreamImportOptions struct {
+	Manifest string
+	// Target defaults to the dataset recorded in the manifest.
+	Target string
+	Force  bool
+	// VerifyOnly checks sizes and checksums without receiving anything.
+	VerifyOnly bool
+	Progress   func(TransferProgress)
+	Log        func(string)
+}
+
+// StreamManifestPath is where exports of dataset into dir are recorded.
+func StreamManifestPath(dir, dataset string) string {
+	return filepath.Join(dir, flatDataset(dataset)+".manifest.json")
+}
+
+func flatDataset(dataset string) string {
+	return strings.ReplaceAll(dataset, "/", "_")
+}
+
+// validStreamDir accepts an existing absolute directory.
+func validStreamDir(dir string) error {
+	if !filepath.IsAbs(dir) || filepath.Clean(dir) != dir {
+		return fmt.Errorf("directory must be an absolute, clean path")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// ExportStream sends a snapshot (full, or incremental from Base) into a file in Dir and
+// appends it to the dataset's manifest there.
+func ExportStream(ctx context.Context, cfg config.Config, opts StreamExportOptions) (StreamEntry, error) {
+	dataset, snap, ok := strings.Cut(opts.Snapshot, "@")
+	if !ok || !ValidDatasetName(dataset) || !ValidSnapshotName(snap) {
+		return StreamEntry{}, fmt.Errorf("invalid snapshot")
+	}
+	base := opts.Base
+	if ds, short, ok := strings.Cut(base, "@"); ok {
+		if ds != dataset {
+			return StreamEntry{}, fmt.Errorf("base must be a snapshot of %s", dataset)
+		}
+		base = short
+	}
+	if base != "" && !ValidSnapshotName(base) {
+		return StreamEntry{}, fmt.Errorf("invalid base snapshot")
+	}
+	if err := validStreamDir(opts.Dir); err != nil {
+		return StreamEntry{}, err
+	}
+	manifestPath := StreamManifestPath(opts.Dir, dataset)
+	manifest, err := ReadStreamManifest(manifestPath)
+	if os.IsNotExist(err) {
+		host, _ := os.Hostname()
+		manifest = StreamManifest{Version: streamManifestVersion, Dataset: dataset, Host: host}
+	} else if err != nil {
+		return StreamEntry{}, err
+	} else if manifest.Dataset != dataset {
+		return StreamEntry{}, fmt.Errorf("%s belongs to %s", manifestPath, manifest.Dataset)
+	}
+
+	entry := StreamEntry{Snapshot: opts.Snapshot, Raw: opts.Raw, Recursive: opts.Recursive, Created: time.Now()}
+	if entry.GUID, err = snapshotGUID(ctx, cfg, opts.Snapshot); err != nil {
+		return StreamEntry{}, err
+	}
+	sendArgs := []string{"send"}
+	if opts.Recursive {
+		sendArgs = append(sendArgs, "-R")
+	}
+	if opts.Raw {
+		sendArgs = append(sendArgs, "-w")
+	}
+	if opts.Compress {
+		sendArgs = append(sendArgs, "-c")
+	}
+	if base != "" {
+		entry.Base = dataset + "@" + base
+		if entry.BaseGUID, err = snapshotGUID(ctx, cfg, entry.Base); err != nil {
+			return StreamEntry{}, err
+		}
+		sendArgs = append(sendArgs, "-I", entry.Base)
+		entry.File = fmt.Sprintf("%s@%s--%s.incr.zstream", flatDataset(dataset), base, snap)
+	} else {
+		entry.File = fmt.Sprintf("%s@%s.full.zstream", flatDataset(dataset), snap)
+	}
+	sendArgs = append(sendArgs, opts.Snapshot)
+
+	path := filepath.Join(opts.Dir, entry.File)
+	partial := path + ".partial"
+	if _, err := os.Stat(path); err == nil {
+		return StreamEntry{}, fmt.Errorf("%s already exists", path)
+	}
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return StreamEntry{}, err
+	}
+	defer os.Remove(partial)
+	hasher := sha256.New()
+	estimate, _ := EstimateSendSize(ctx, cfg, sendArgs)
+	meter := newTransferMeter(estimate)
+	meter.ctx = ctx
+	stop := meter.report(opts.Progress, time.Second)
+	// Multi-GB streams outlast limits.max_runtime_seconds; the job or CLI context bounds them.
+	pipeCfg := cfg
+	pipeCfg.Limits = execwrap.NoRuntimeLimit(cfg.Limits)
+	res, err := runPipeline(ctx, pipeCfg, pipelineEnds{sendArgv: append([]string{cfg.Paths.ZFS}, sendArgs...), sink: io.MultiWriter(f, hasher)}, meter)
+	stop()
+	final := meter.snapshot(true)
+	if opts.Progress != nil {
+		opts.Progress(final)
+	}
+	if err == nil && res.ExitCode != 0 {
+		err = fmt.Errorf(res.Stderr)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return StreamEntry{}, err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return StreamEntry{}, err
+	}
+	entry.Size = final.Bytes
+	entry.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	manifest.Streams = append(manifest.Streams, entry)
+	if err := writeStreamManifest(manifestPath, manifest); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// ReadStreamManifest loads a manifest written by ExportStream.
+func ReadStreamManifest(path string) (StreamManifest, error) {
+	var m StreamManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if m.Version != streamManifestVersion {
+		return m, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return m, nil
+}
+
+func writeStreamManifest(path string, m StreamManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ImportStreams verifies and receives the streams of a manifest in order. Streams whose
+// snapshot the target already has (by GUID) are skipped, and an incremental stream is
+// refused unless the target holds its base. It returns the files received.
+func ImportStreams(ctx context.Context, cfg config.Config, opts StreamImportOptions) ([]string, error) {
+	logf := func(format string, args ...any) {
+		if opts.Log != nil {
+			opts.Log(fmt.Sprintf(format, args...))
+		}
+	}
+	if !filepath.IsAbs(opts.Manifest) {
+		return nil, fmt.Errorf("manifest path must be absolute")
+	}
+	manifest, err := ReadStreamManifest(opts.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	target := opts.Target
+	if target == "" {
+		target = manifest.Dataset
+	}
+	if !ValidDatasetName(target) {
+		return nil, fmt.Errorf("invalid target dataset")
+	}
+	dir := filepath.Dir(opts.Manifest)
+	have := map[string]bool{}
+	if !opts.VerifyOnly {
+		if have, err = targetSnapshotGUIDs(ctx, cfg, target); err != nil {
+			return nil, err
+		}
+	}
+	received := []string{}
+	for _, entry := range manifest.Streams {
+		// Only the base name is trusted so a manifest cannot point outside its directory.
+		path := filepath.Join(dir, filepath.Base(entry.File))
+		if have[entry.GUID] {
+			logf("skip %s: %s already has %s", entry.File, target, entry.Snapshot)
+			continue
+		}
+		if entry.BaseGUID != "" && !opts.VerifyOnly && !have[entry.BaseGUID] {
+			return received, fmt.Errorf("%s needs base %s, which %s does not have", entry.File, entry.Base, target)
+		}
+		logf("verify %s (%d bytes)", entry.File, entry.Size)
+		if err := verifyStreamFile(path, entry); err != nil {
+			return received, err
+		}
+		if opts.VerifyOnly {
+			continue
+		}
+		logf("receive %s into %s", entry.File, target)
+		if err := receiveStreamFile(ctx, cfg, path, target, entry, opts); err != nil {
+			return received, fmt.Errorf("receive %s: %w", entry.File, err)
+		}
+		have[entry.GUID] = true
+		received = append(received, entry.File)
+	}
+	return received, nil
+}
+
+func verifyStreamFile(path string, entry StreamEntry) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, f)
+	if err != nil {
+		return err
+	}
+	return checkStreamSum(entry, n, hasher.Sum(nil))
+}
+
+func checkStreamSum(entry StreamEntry, n int64, sum []byte) error {
+	if n != entry.Size {
+		return fmt.Errorf("%s: size %d does not match manifest (%d)", entry.File, n, entry.Size)
+	}
+	if hexSum := hex.EncodeToString(sum); !strings.EqualFold(hexSum, entry.SHA256) {
+		return fmt.Errorf("%s: sha256 %s does not match manifest", entry.File, hexSum)
+	}
+	return nil
+}
+
+// receiveStreamFile feeds the file to `zfs recv`, hashing the bytes as they are sent, so
+// a file that changed after verifyStreamFile (removable media) is caught. A mismatch
+// undoes the receive.
+func receiveStreamFile(ctx context.Context, cfg config.Config, path, target string, entry StreamEntry, opts StreamImportOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	recvArgv := []string{cfg.Paths.ZFS, "recv"}
+	if opts.Force {
+		recvArgv = append(recvArgv, "-F")
+	}
+	recvArgv = append(recvArgv, target)
+	meter := newTransferMeter(entry.Size)
+	meter.ctx = ctx
+	stop := meter.report(opts.Progress, time.Second)
+	pipeCfg := cfg
+	pipeCfg.Limits = execwrap.NoRuntimeLimit(cfg.Limits)
+	hasher := sha256.New()
+	res, err := runPipeline(ctx, pipeCfg, pipelineEnds{source: io.TeeReader(f, hasher), recvArgv: recvArgv}, meter)
+	stop()
+	final := meter.snapshot(true)
+	if opts.Progress != nil {
+		opts.Progress(final)
+	}
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf(res.Stderr)
+	}
+	if sumErr := checkStreamSum(entry, final.Bytes, hasher.Sum(nil)); sumErr != nil {
+		if undoErr := undoStreamReceive(ctx, cfg, target, entry); undoErr != nil {
+			return fmt.Errorf("%w; undoing the receive failed: %v", sumErr, undoErr)
+		}
+		return fmt.Errorf("%w; the received snapshot was removed", sumErr)
+	}
+	return nil
+}
+
+// undoStreamReceive discards a stream received from a file that failed verification: an
+// incremental is rolled back to its base, a full stream's dataset is destroyed.
+func undoStreamReceive(ctx context.Context, cfg config.Config, target string, entry StreamEntry) error {
+	_, snap, _ := strings.Cut(entry.Snapshot, "@")
+	_, base, _ := strings.Cut(entry.Base, "@")
+	var args []string
+	switch {
+	case entry.BaseGUID != "" && entry.Recursive:
+		// rollback does not descend; drop the snapshot everywhere, then roll back target.
+		res, err := execwrap.Run(ctx, cfg.Paths.ZFS, []string{"destroy", "-r", target + "@" + snap}, nil, cfg.Limits)
+		if err != nil {
+			return err
+		}
+		if res.ExitCode != 0 {
+			return fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+		}
+		args = []string{"rollback", "-r", target + "@" + base}
+	case entry.BaseGUID != "":
+		args = []string{"rollback", "-r", target + "@" + base}
+	case strings.Contains(target, "/"):
+		args = []string{"destroy", "-r", target}
+	default:
+		// Never destroy a pool root; drop the received snapshot instead.
+		args = []string{"destroy", "-r", target + "@" + snap}
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, args, nil, cfg.Limits)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(res.Stderr))
+	}
+	return nil
+}
+
+func snapshotGUID(ctx context.Context, cfg config.Config, snapshot string) (string, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, []string{"get", "-Hp", "-o", "value", "guid", snapshot}, nil, cfg.Limits)
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf(res.Stderr)
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// targetSnapshotGUIDs returns the GUIDs of the target's snapshots; a missing target
+// has none.
+func targetSnapshotGUIDs(ctx context.Context, cfg config.Config, target string) (map[string]bool, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, []string{"list", "-H", "-t", "snapshot", "-o", "guid", "-d", "1", target}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	guids := map[string]bool{}
+	if res.ExitCode != 0 {
+		if strings.Contains(res.Stderr, "does not exist") {
+			return guids, nil
+		}
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		if guid := strings.TrimSpace(line); guid != "" {
+			guids[guid] = true
+		}
+	}
+	return guids, nil
+}
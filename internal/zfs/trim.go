@@ -0,0 +1,256 @@
+// Package zfs runs and reports `zpool trim` and `zpool initialize`.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// VdevProgress is the trim or initialize state of one leaf vdev as printed by
+// `zpool status -t` / `-i`. State is one of none, active, suspended, completed or
+// unsupported.
+type VdevProgress struct {
+	State   string  `json:"state"`
+	Percent float64 `json:"percent"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// VdevMaintenance pairs a leaf vdev with its trim and initialize progress.
+type VdevMaintenance struct {
+	Name       string       `json:"name"`
+	Role       string       `json:"role"`
+	Health     string       `json:"health"`
+	Trim       VdevProgress `json:"trim"`
+	Initialize VdevProgress `json:"initialize"`
+}
+
+// PoolMaintenance is the trim/initialize view of a pool.
+type PoolMaintenance struct {
+	Pool     string            `json:"pool"`
+	Autotrim bool              `json:"autotrim"`
+	Devices  []VdevMaintenance `json:"devices"`
+}
+
+var (
+	progressGroupPattern   = regexp.MustCompile(`\(([^()]*)\)`)
+	progressPercentPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)%`)
+)
+
+// maintenanceActionFlags maps API actions to the flags shared by `zpool trim` and
+// `zpool initialize`.
+var maintenanceActionFlags = map[string]string{
+	"start":   "",
+	"cancel":  "-c",
+	"suspend": "-s",
+}
+
+// ValidMaintenanceAction reports whether action is start, cancel or suspend.
+func ValidMaintenanceAction(action string) bool {
+	_, ok := maintenanceActionFlags[action]
+	return ok
+}
+
+// ValidDeviceName accepts vdev names as zpool prints them (ada0, gpt/disk0,
+// gptid/<uuid>, /dev/da1p3).
+func ValidDeviceName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") || strings.Contains(name, "..") {
+		return false
+	}
+	return validToken(strings.ReplaceAll(name, "/", ""))
+}
+
+// ValidTrimRate accepts a `zpool trim -r` rate such as 100M or 1G.
+func ValidTrimRate(rate string) bool {
+	if rate == "" {
+		return false
+	}
+	digits := strings.TrimRight(rate, "KMGTkmgt")
+	return len(rate)-len(digits) <= 1 && isDigits(digits)
+}
+
+// TrimPool starts, suspends or cancels a manual TRIM of the whole pool or the listed
+// devices. rate (bytes per second per device, e.g. 100M) only applies to start.
+func TrimPool(ctx context.Context, cfg config.Config, pool, action string, devices []string, rate string) (execwrap.Result, error) {
+	args, err := maintenanceArgs("trim", pool, action, devices)
+	if err != nil {
+		return execwrap.Result{}, err
+	}
+	if action == "start" && rate != "" {
+		args = append(args[:1], append([]string{"-r", rate}, args[1:]...)...)
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZPool, args, nil, cfg.Limits)
+}
+
+// InitializePool starts, suspends or cancels `zpool initialize`, which writes a pattern
+// to all unallocated space (useful on thin-provisioned or freshly added vdevs).
+func InitializePool(ctx context.Context, cfg config.Config, pool, action string, devices []string) (execwrap.Result, error) {
+	args, err := maintenanceArgs("initialize", pool, action, devices)
+	if err != nil {
+		return execwrap.Result{}, err
+	}
+	return execwrap.Run(ctx, cfg.Paths.ZPool, args, nil, cfg.Limits)
+}
+
+func maintenanceArgs(subcommand, pool, action string, devices []string) ([]string, error) {
+	if !ValidPoolName(pool) {
+		return nil, fmt.Errorf("invalid pool name")
+	}
+	flag, ok := maintenanceActionFlags[action]
+	if !ok {
+		return nil, fmt.Errorf("action must be start, cancel or suspend")
+	}
+	args := []string{subcommand}
+	if flag != "" {
+		args = append(args, flag)
+	}
+	args = append(args, pool)
+	for _, dev := range devices {
+		if !ValidDeviceName(dev) {
+			return nil, fmt.Errorf("invalid device %q", dev)
+		}
+		args = append(args, dev)
+	}
+	return args, nil
+}
+
+// ReadPoolMaintenance combines `zpool status -it` and the autotrim property. Releases
+// without `status -i` fall back to trim progress only.
+func ReadPoolMaintenance(ctx context.Context, cfg config.Config, pool string) (PoolMaintenance, error) {
+	if !ValidPoolName(pool) {
+		return PoolMaintenance{}, fmt.Errorf("invalid pool name")
+	}
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"status", "-it", pool}, nil, cfg.Limits)
+	if err == nil && res.ExitCode != 0 && strings.Contains(res.Stderr, "invalid option") {
+		res, err = execwrap.Run(ctx, cfg.Paths.ZPool, []string{"status", "-t", pool}, nil, cfg.Limits)
+	}
+	if err != nil {
+		return PoolMaintenance{}, err
+	}
+	if res.ExitCode != 0 {
+		return PoolMaintenance{}, fmt.Errorf(res.Stderr)
+	}
+	out := PoolMaintenance{Pool: pool, Devices: parseMaintenanceStatus(res.Stdout, pool)}
+	prop, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"get", "-H", "-o", "value", "autotrim", pool}, nil, cfg.Limits)
+	if err != nil {
+		return out, err
+	}
+	if prop.ExitCode != 0 {
+		return out, fmt.Errorf(prop.Stderr)
+	}
+	out.Autotrim = strings.TrimSpace(prop.Stdout) == "on"
+	return out, nil
+}
+
+// parseMaintenanceStatus reads leaf vdev lines from the config section of `zpool status`
+// and the "(NN% trimmed, started at ...)" style annotations after the error counters.
+func parseMaintenanceStatus(output, pool string) []VdevMaintenance {
+	devices := []VdevMaintenance{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	inConfig := false
+	seenPool := false
+	role := "data"
+	roleDepth := -1
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "NAME") && strings.Contains(line, "STATE") {
+			inConfig = true
+			continue
+		}
+		if !inConfig {
+			continue
+		}
+		if strings.HasPrefix(line, "errors:") {
+			break
+		}
+		fields := strings.Fields(line)
+		depth := statusIndent(raw)
+		name := fields[0]
+		if name == pool && !seenPool {
+			seenPool = true
+			continue
+		}
+		if roleDepth >= 0 && depth <= roleDepth {
+			role = "data"
+			roleDepth = -1
+		}
+		if sectionRole, ok := vdevSectionRole(name); ok && len(fields) == 1 {
+			role = sectionRole
+			roleDepth = depth
+			continue
+		}
+		if isVdevGroup(name) {
+			continue
+		}
+		dev := VdevMaintenance{
+			Name:       name,
+			Role:       role,
+			Trim:       VdevProgress{State: "none"},
+			Initialize: VdevProgress{State: "none"},
+		}
+		if len(fields) > 1 {
+			dev.Health = fields[1]
+		}
+		for _, group := range progressGroupPattern.FindAllStringSubmatch(line, -1) {
+			applyProgress(&dev, strings.TrimSpace(group[1]))
+		}
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
+func applyProgress(dev *VdevMaintenance, text string) {
+	var target *VdevProgress
+	switch {
+	case strings.Contains(text, "trim"):
+		target = &dev.Trim
+	case strings.Contains(text, "initializ"):
+		target = &dev.Initialize
+	default:
+		return
+	}
+	target.Detail = text
+	switch {
+	case strings.Contains(text, "unsupported"):
+		target.State = "unsupported"
+	case strings.HasPrefix(text, "untrimmed"), strings.HasPrefix(text, "uninitialized"):
+		target.State = "none"
+	case strings.Contains(text, "completed"):
+		target.State = "completed"
+	case strings.Contains(text, "suspended"):
+		target.State = "suspended"
+	default:
+		target.State = "active"
+	}
+	if m := progressPercentPattern.FindStringSubmatch(text); m != nil {
+		target.Percent, _ = strconv.ParseFloat(m[1], 64)
+	}
+}
+
+// statusIndent measures the leading whitespace of a `zpool status` config line. The
+// config block is indented by one tab and nested vdevs by two spaces per level, so tabs
+// and spaces have to be weighed together.
+func statusIndent(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case '\t':
+			width += 8
+		case ' ':
+			width++
+		default:
+			return width
+		}
+	}
+	return width
+}
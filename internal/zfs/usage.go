@@ -0,0 +1,129 @@
+// Package zfs reads exact pool and dataset space usage for capacity tracking.
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"raidraccoon/internal/config"
+	"raidraccoon/internal/execwrap"
+)
+
+// PoolUsage is a pool's size and allocation in bytes.
+type PoolUsage struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Alloc int64  `json:"alloc"`
+	Free  int64  `json:"free"`
+}
+
+// DatasetUsage is a filesystem or volume's used and available bytes.
+type DatasetUsage struct {
+	Name      string `json:"name"`
+	Used      int64  `json:"used"`
+	Available int64  `json:"available"`
+}
+
+// DatasetSpace breaks a dataset's used space down by what holds it. Written is the
+// space referenced since the most recent snapshot; CompressRatio is logical/physical.
+type DatasetSpace struct {
+	Used                 int64   `json:"used"`
+	UsedBySnapshots      int64   `json:"usedbysnapshots"`
+	UsedByDataset        int64   `json:"usedbydataset"`
+	UsedByChildren       int64   `json:"usedbychildren"`
+	UsedByRefreservation int64   `json:"usedbyrefreservation"`
+	Written              int64   `json:"written"`
+	LogicalUsed          int64   `json:"logicalused"`
+	CompressRatio        float64 `json:"compressratio"`
+}
+
+// ListPoolUsage runs `zpool list -Hp` for exact byte counts.
+func ListPoolUsage(ctx context.Context, cfg config.Config) ([]PoolUsage, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.ZPool, []string{"list", "-Hp", "-o", "name,size,alloc,free"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	var pools []PoolUsage
+	for _, parts := range scanByteColumns(res.Stdout, 4) {
+		pools = append(pools, PoolUsage{Name: parts[0], Size: parseBytes(parts[1]), Alloc: parseBytes(parts[2]), Free: parseBytes(parts[3])})
+	}
+	return pools, nil
+}
+
+// ListDatasetUsage runs `zfs list -Hp` over filesystems and volumes.
+func ListDatasetUsage(ctx context.Context, cfg config.Config) ([]DatasetUsage, error) {
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, []string{"list", "-Hp", "-t", "filesystem,volume", "-o", "name,used,avail"}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	var datasets []DatasetUsage
+	for _, parts := range scanByteColumns(res.Stdout, 3) {
+		datasets = append(datasets, DatasetUsage{Name: parts[0], Used: parseBytes(parts[1]), Available: parseBytes(parts[2])})
+	}
+	return datasets, nil
+}
+
+// ListDatasetSpace runs `zfs list -Hp` with the usedby* breakdown for every filesystem
+// and volume, keyed by dataset name.
+func ListDatasetSpace(ctx context.Context, cfg config.Config) (map[string]DatasetSpace, error) {
+	cols := "name,used,usedbysnapshots,usedbydataset,usedbychildren,usedbyrefreservation,written,logicalused,compressratio"
+	res, err := execwrap.Run(ctx, cfg.Paths.ZFS, []string{"list", "-Hp", "-t", "filesystem,volume", "-o", cols}, nil, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf(res.Stderr)
+	}
+	space := map[string]DatasetSpace{}
+	for _, parts := range scanByteColumns(res.Stdout, 9) {
+		ratio, _ := strconv.ParseFloat(strings.TrimSuffix(parts[8], "x"), 64)
+		space[parts[0]] = DatasetSpace{
+			Used:                 parseBytes(parts[1]),
+			UsedBySnapshots:      parseBytes(parts[2]),
+			UsedByDataset:        parseBytes(parts[3]),
+			UsedByChildren:       parseBytes(parts[4]),
+			UsedByRefreservation: parseBytes(parts[5]),
+			Written:              parseBytes(parts[6]),
+			LogicalUsed:          parseBytes(parts[7]),
+			CompressRatio:        ratio,
+		}
+	}
+	return space, nil
+}
+
+func scanByteColumns(output string, n int) [][]string {
+	var rows [][]string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) < n {
+			parts = strings.Fields(line)
+		}
+		if len(parts) < n {
+			continue
+		}
+		rows = append(rows, parts)
+	}
+	return rows
+}
+
+func parseBytes(value string) int64 {
+	val, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return val
+}
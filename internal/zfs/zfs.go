@@ -16,6 +16,7 @@ import (
 
 	"raidraccoon/internal/config"
 	"raidraccoon/internal/execwrap"
+	"raidraccoon/internal/window"
 )
 
 type Pool struct {
@@ -35,9 +36,12 @@ type ImportablePool struct {
 
 // PoolDevice describes a vdev line from `zpool list -v` for inventory views.
 type PoolDevice struct {
-	Name  string `json:"name"`
-	Pool  string `json:"pool"`
-	Role  string `json:"role"`
+	Name string `json:"name"`
+	Pool string `json:"pool"`
+	Role string `json:"role"`
+	// Vdev is the mirror/raidz group holding the device (e.g. mirror-1); empty for
+	// single-device top-level vdevs.
+	Vdev  string `json:"vdev,omitempty"`
 	Size  string `json:"size"`
 	Alloc string `json:"alloc"`
 	Free  string `json:"free"`
@@ -61,10 +65,14 @@ type Mount struct {
 	Mounted    bool   `json:"mounted"`
 }
 
-// Snapshot is a lightweight snapshot listing entry.
+// Snapshot is a lightweight snapshot listing entry. Used is the space only this snapshot
+// holds (freed by destroying it alone); Written is what changed since the previous one.
 type Snapshot struct {
 	Name    string `json:"name"`
 	Created string `json:"created"`
+	GUID    string `json:"guid,omitempty"`
+	Used    int64  `json:"used"`
+	Written int64  `json:"written"`
 }
 
 // ListPools returns ZFS pools with basic health/space fields.
@@ -168,6 +176,8 @@ func ListPoolDevices(ctx context.Context, cfg config.Config) ([]PoolDevice, erro
 	currentPool := ""
 	currentRole := "data"
 	roleDepth := -1
+	currentVdev := ""
+	vdevDepth := -1
 	for scanner.Scan() {
 		raw := scanner.Text()
 		if strings.TrimSpace(raw) == "" {
@@ -186,8 +196,14 @@ func ListPoolDevices(ctx context.Context, cfg config.Config) ([]PoolDevice, erro
 			currentPool = name
 			currentRole = "data"
 			roleDepth = -1
+			currentVdev = ""
+			vdevDepth = -1
 			continue
 		}
+		if vdevDepth >= 0 && depth <= vdevDepth {
+			currentVdev = ""
+			vdevDepth = -1
+		}
 		if roleDepth >= 0 && depth <= roleDepth {
 			currentRole = "data"
 			roleDepth = -1
@@ -198,12 +214,15 @@ func ListPoolDevices(ctx context.Context, cfg config.Config) ([]PoolDevice, erro
 			continue
 		}
 		if isVdevGroup(name) {
+			currentVdev = name
+			vdevDepth = depth
 			continue
 		}
 		devices = append(devices, PoolDevice{
 			Name:  name,
 			Pool:  currentPool,
 			Role:  currentRole,
+			Vdev:  currentVdev,
 			Size:  size,
 			Alloc: alloc,
 			Free:  free,
@@ -273,7 +292,7 @@ func ListMounts(ctx context.Context, cfg config.Config) ([]Mount, error) {
 }
 
 func ListSnapshots(ctx context.Context, cfg config.Config, dataset string) ([]Snapshot, error) {
-	args := []string{"list", "-H", "-t", "snapshot", "-o", "name,creation", "-s", "creation"}
+	args := []string{"list", "-Hp", "-t", "snapshot", "-o", "name,creation,guid,used,written", "-s", "creation"}
 	if dataset != "" {
 		args = append(args, dataset)
 	}
@@ -284,8 +303,12 @@ func ListSnapshots(ctx context.Context, cfg config.Config, dataset string) ([]Sn
 	if res.ExitCode != 0 {
 		return nil, fmt.Errorf(res.Stderr)
 	}
+	return parseSnapshotList(res.Stdout), nil
+}
+
+func parseSnapshotList(output string) []Snapshot {
 	var snaps []Snapshot
-	scanner := bufio.NewScanner(strings.NewReader(res.Stdout))
+	scanner := bufio.NewScanner(strings.NewReader(output))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -298,9 +321,23 @@ func ListSnapshots(ctx context.Context, cfg config.Config, dataset string) ([]Sn
 		if len(parts) < 2 {
 			continue
 		}
-		snaps = append(snaps, Snapshot{Name: parts[0], Created: parts[1]})
+		snap := Snapshot{Name: parts[0], Created: parts[1]}
+		if isDigits(snap.Created) {
+			// -p prints creation as a unix timestamp; keep the familiar zfs format.
+			if sec, err := strconv.ParseInt(snap.Created, 10, 64); err == nil {
+				snap.Created = time.Unix(sec, 0).Format("Mon Jan _2 15:04 2006")
+			}
+		}
+		if len(parts) > 2 {
+			snap.GUID = parts[2]
+		}
+		if len(parts) > 4 {
+			snap.Used = parseBytes(parts[3])
+			snap.Written = parseBytes(parts[4])
+		}
+		snaps = append(snaps, snap)
 	}
-	return snaps, nil
+	return snaps
 }
 
 func CreateSnapshot(ctx context.Context, cfg config.Config, dataset, name string, recursive bool) (execwrap.Result, error) {
@@ -329,7 +366,8 @@ func UnmountDataset(ctx context.Context, cfg config.Config, dataset string) (exe
 	return execwrap.Run(ctx, cfg.Paths.ZFS, []string{"unmount", dataset}, nil, cfg.Limits)
 }
 
-func EnforceRetention(ctx context.Context, cfg config.Config, dataset, prefix string, retention int) ([]string, error) {
+// EnforceRetention destroys the oldest snapshots named by naming beyond retention.
+func EnforceRetention(ctx context.Context, cfg config.Config, dataset string, naming NameTemplate, retention int) ([]string, error) {
 	if retention <= 0 {
 		return nil, nil
 	}
@@ -337,33 +375,29 @@ func EnforceRetention(ctx context.Context, cfg config.Config, dataset, prefix st
 	if err != nil {
 		return nil, err
 	}
-	var filtered []Snapshot
-	for _, snap := range snaps {
-		parts := strings.SplitN(snap.Name, "@", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		if strings.HasPrefix(parts[1], prefix) {
-			filtered = append(filtered, snap)
-		}
-	}
-	if len(filtered) <= retention {
-		return nil, nil
-	}
 	var destroyed []string
-	for i := 0; i < len(filtered)-retention; i++ {
-		res, err := DestroySnapshot(ctx, cfg, filtered[i].Name)
+	for _, name := range retentionVictims(snaps, naming, retention) {
+		res, err := DestroySnapshot(ctx, cfg, name)
 		if err != nil {
 			return destroyed, err
 		}
 		if res.ExitCode != 0 {
 			return destroyed, fmt.Errorf(res.Stderr)
 		}
-		destroyed = append(destroyed, filtered[i].Name)
+		destroyed = append(destroyed, name)
 	}
 	return destroyed, nil
 }
 
+// retentionVictims returns the oldest template-matching snapshots beyond retention.
+func retentionVictims(snaps []Snapshot, naming NameTemplate, retention int) []string {
+	filtered := snapshotsMatching(snaps, naming)
+	if len(filtered) <= retention {
+		return nil
+	}
+	return filtered[:len(filtered)-retention]
+}
+
 // ValidateDataset performs lightweight dataset-name validation.
 // Prefix allowlists are intentionally not enforced.
 func ValidateDataset(cfg config.Config, dataset string) bool {
@@ -487,12 +521,9 @@ func ValidDatasetName(name string) bool {
 	return true
 }
 
-// BuildSnapshotName produces a timestamped snapshot token for UI/cron usage.
+// BuildSnapshotName produces a timestamped snapshot token using the default template.
 func BuildSnapshotName(prefix string, t time.Time) string {
-	if prefix == "" {
-		prefix = "snapshot"
-	}
-	return fmt.Sprintf("%s-%s", prefix, t.Format("20060102-150405"))
+	return NameTemplate{Prefix: prefix}.Format(t)
 }
 
 func ValidSnapshotName(name string) bool {
@@ -524,8 +555,109 @@ func validToken(token string) bool {
 	return true
 }
 
+// ValidPropertyName accepts native (`readonly`) and user (`com.example:tag`) property names.
+func ValidPropertyName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return false
+	}
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			continue
+		}
+		switch r {
+		case '-', '_', '.', ':':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidRecvProperty checks a `name=value` override for `zfs recv -o`. Values stay within a
+// conservative character set because they are stored in cron metadata.
+func ValidRecvProperty(kv string) bool {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || !ValidPropertyName(parts[0]) || parts[1] == "" {
+		return false
+	}
+	for _, r := range parts[1] {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			continue
+		}
+		switch r {
+		case '-', '_', '.', ':', '/', '@', '+':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SplitPropertyList splits a comma-separated list of property names or overrides.
+func SplitPropertyList(raw string) []string {
+	out := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		if value := strings.TrimSpace(part); value != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// ValidateRecvOverrides checks `recv -x` names and `recv -o` overrides.
+func ValidateRecvOverrides(exclude, props []string) error {
+	for _, name := range exclude {
+		if !ValidPropertyName(name) {
+			return fmt.Errorf("invalid excluded property: %s", name)
+		}
+	}
+	for _, kv := range props {
+		if !ValidRecvProperty(kv) {
+			return fmt.Errorf("invalid property override: %s", kv)
+		}
+	}
+	return nil
+}
+
+// ReplicationOptions carries per-job settings for ReplicateDataset.
+type ReplicationOptions struct {
+	Prefix string
+	// Template and UTC name the replication snapshots; see NameTemplate.
+	Template  string
+	UTC       bool
+	Retention int
+	Recursive bool
+	Force     bool
+	// Send flags: -w (raw), -c (compressed), -L (large blocks), -e (embedded), -p (properties).
+	Raw        bool
+	Compressed bool
+	LargeBlock bool
+	Embedded   bool
+	SendProps  bool
+	// RecvExclude is passed as `recv -x name`; RecvProps as `recv -o name=value`.
+	RecvExclude []string
+	RecvProps   []string
+	// Reseed allows discarding target state that no longer matches the source.
+	Reseed bool
+	SSH    SSHOptions
+	// BandwidthLimit caps the send stream in KiB/s (0 is unlimited).
+	BandwidthLimit int64
+	// Window restricts when the job may start and what happens when the window closes.
+	Window window.Policy
+	// Progress, when set, receives transfer updates about once per second and a final
+	// update with Done set. Tracked runs are not subject to limits.max_runtime_seconds.
+	Progress func(TransferProgress)
+}
+
 // ReplicateDataset runs a `zfs send | zfs recv` replication job, optionally enforcing retention.
-func ReplicateDataset(ctx context.Context, cfg config.Config, source, target, prefix string, retention int, recursive, force bool) (execwrap.Result, error) {
+// Targets in `user@host:pool/ds` form are received over ssh.
+func ReplicateDataset(ctx context.Context, cfg config.Config, source, target string, opts ReplicationOptions) (execwrap.Result, error) {
+	if err := opts.Window.Gate(ctx); err != nil {
+		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+	}
+	prefix := opts.Prefix
 	if prefix == "" {
 		if cfg.ZFS.SnapshotPrefix != "" {
 			prefix = cfg.ZFS.SnapshotPrefix + "-repl"
@@ -533,8 +665,9 @@ func ReplicateDataset(ctx context.Context, cfg config.Config, source, target, pr
 			prefix = "replication"
 		}
 	}
-	name := BuildSnapshotName(prefix, time.Now())
-	createRes, err := CreateSnapshot(ctx, cfg, source, name, recursive)
+	naming := NameTemplate{Pattern: opts.Template, Prefix: prefix, UTC: opts.UTC}
+	name := naming.Format(time.Now())
+	createRes, err := CreateSnapshot(ctx, cfg, source, name, opts.Recursive)
 	if err != nil || createRes.ExitCode != 0 {
 		if err != nil {
 			return createRes, err
@@ -546,12 +679,11 @@ func ReplicateDataset(ctx context.Context, cfg config.Config, source, target, pr
 	if err != nil {
 		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
 	}
-	matches := snapshotsWithPrefix(snaps, prefix)
+	matches := snapshotsMatching(snaps, naming)
 	if len(matches) == 0 {
 		return execwrap.Result{ExitCode: 1, Stderr: "no replication snapshots found"}, fmt.Errorf("no replication snapshots found")
 	}
 	curr := source + "@" + name
-	prev := ""
 	index := -1
 	for i, snap := range matches {
 		if snap == curr {
@@ -563,52 +695,127 @@ func ReplicateDataset(ctx context.Context, cfg config.Config, source, target, pr
 		index = len(matches) - 1
 		curr = matches[index]
 	}
-	if index > 0 {
-		prev = matches[index-1]
+
+	targetSnaps, err := listTargetSnapshots(ctx, cfg, target, opts.SSH)
+	if err != nil {
+		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+	}
+	plan := planReplication(source, target, curr, snaps, targetSnaps, opts)
+	record := ReplicationRecord{Source: source, Target: target, Snapshot: curr, Base: plan.Base, Start: time.Now()}
+	if plan.Blocked() {
+		record.End = time.Now()
+		record.ExitCode = 1
+		record.Error = plan.Message
+		_ = AppendReplicationRecord(cfg.Replication.HistoryFile, record)
+		return execwrap.Result{ExitCode: 1, Stderr: plan.Message}, &ReplicationDivergedError{Plan: plan}
+	}
+	if plan.Diverged && plan.Base == "" {
+		destroyRes, err := destroyTarget(ctx, cfg, target, opts.SSH)
+		if err != nil || destroyRes.ExitCode != 0 {
+			if err == nil {
+				err = fmt.Errorf(destroyRes.Stderr)
+			}
+			return destroyRes, err
+		}
 	}
 
 	sendArgs := []string{"send"}
-	if recursive {
+	if opts.Recursive {
 		sendArgs = append(sendArgs, "-R")
 	}
-	if prev != "" {
-		sendArgs = append(sendArgs, "-I", prev)
+	sendArgs = append(sendArgs, sendFlags(opts)...)
+	if plan.Base != "" {
+		sendArgs = append(sendArgs, "-I", plan.Base)
 	}
 	sendArgs = append(sendArgs, curr)
 
 	recvArgs := []string{"recv"}
-	if force {
+	if opts.Force || plan.Rollback {
 		recvArgs = append(recvArgs, "-F")
 	}
-	recvArgs = append(recvArgs, target)
+	for _, name := range opts.RecvExclude {
+		recvArgs = append(recvArgs, "-x", name)
+	}
+	for _, kv := range opts.RecvProps {
+		recvArgs = append(recvArgs, "-o", kv)
+	}
+	var recvCmd []string
+	remote, isRemote := ParseRemoteTarget(target)
+	if isRemote {
+		recvCmd = sshCommand(cfg, remote, opts.SSH, append(recvArgs, remote.Dataset))
+	} else {
+		recvCmd = append([]string{cfg.Paths.ZFS}, append(recvArgs, target)...)
+	}
+
+	// The estimate only drives progress reporting; a failed dry run is not fatal.
+	estimate, _ := EstimateSendSize(ctx, cfg, sendArgs)
+	meter := newTransferMeter(estimate)
+	meter.limit = opts.BandwidthLimit * 1024
+	pipeCtx := ctx
+	if opts.Window.Pauses() {
+		meter.paused = func() bool { return !opts.Window.Windows.Open(time.Now()) }
+		meter.resume = opts.Window.Windows.WaitOpen
+	} else if closeAt := opts.Window.Windows.NextClose(time.Now()); !closeAt.IsZero() {
+		var cancel context.CancelFunc
+		pipeCtx, cancel = context.WithDeadline(ctx, closeAt)
+		defer cancel()
+	}
+	meter.ctx = pipeCtx
+	pipeCfg := cfg
+	if meter.limit > 0 || opts.Window.Enabled() || opts.Progress != nil {
+		// Throttled or paused streams and tracked jobs (cancellable, with progress) may run
+		// for hours; the window and ctx bound them rather than MaxRuntimeSeconds.
+		pipeCfg.Limits = execwrap.NoRuntimeLimit(cfg.Limits)
+	}
+	stop := meter.report(opts.Progress, time.Second)
+	pipeRes, err := runZfsPipeline(pipeCtx, pipeCfg, sendArgs, recvCmd, isRemote, meter)
+	if pipeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		pipeRes.Stderr = strings.TrimSpace(pipeRes.Stderr + "\ncancelled: allowed time window closed")
+	}
+	stop()
+	final := meter.snapshot(true)
+	if opts.Progress != nil {
+		opts.Progress(final)
+	}
 
-	pipeRes, err := runZfsPipeline(ctx, cfg, sendArgs, recvArgs)
+	record.End = time.Now()
+	record.Bytes = final.Bytes
+	record.Estimated = estimate
+	record.DurationSeconds = record.End.Sub(record.Start).Seconds()
+	record.ExitCode = pipeRes.ExitCode
+	if err != nil || pipeRes.ExitCode != 0 {
+		record.Error = strings.TrimSpace(pipeRes.Stderr)
+	}
+	_ = AppendReplicationRecord(cfg.Replication.HistoryFile, record)
 	if err != nil || pipeRes.ExitCode != 0 {
 		return pipeRes, err
 	}
 
-	if retention > 0 {
-		_, _ = EnforceRetention(ctx, cfg, source, prefix, retention)
-		_, _ = EnforceRetention(ctx, cfg, target, prefix, retention)
+	if opts.Retention > 0 {
+		_, _ = EnforceRetention(ctx, cfg, source, naming, opts.Retention)
+		_, _ = enforceTargetRetention(ctx, cfg, target, naming, opts.Retention, opts.SSH)
 	}
 	return pipeRes, nil
 }
 
-func snapshotsWithPrefix(snaps []Snapshot, prefix string) []string {
-	out := []string{}
-	if prefix == "" {
-		return out
+func sendFlags(opts ReplicationOptions) []string {
+	var flags []string
+	if opts.Raw {
+		flags = append(flags, "-w")
 	}
-	for _, snap := range snaps {
-		parts := strings.SplitN(snap.Name, "@", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		if strings.HasPrefix(parts[1], prefix) {
-			out = append(out, snap.Name)
-		}
+	if opts.Compressed {
+		flags = append(flags, "-c")
 	}
-	return out
+	if opts.LargeBlock {
+		flags = append(flags, "-L")
+	}
+	if opts.Embedded {
+		flags = append(flags, "-e")
+	}
+	if opts.SendProps {
+		flags = append(flags, "-p")
+	}
+	return flags
 }
 
 type limitedBuffer struct {
@@ -641,44 +848,96 @@ func (l *limitedBuffer) String() string {
 	return l.buf.String()
 }
 
-func runZfsPipeline(ctx context.Context, cfg config.Config, sendArgs, recvArgs []string) (execwrap.Result, error) {
+// runZfsPipeline pipes `zfs send sendArgs` into recvArgv. recvArgv is a full command line:
+// zfs recv run via sudo, or (remote) ssh run as the service user. A non-nil meter counts
+// the bytes that pass through the pipe.
+func runZfsPipeline(ctx context.Context, cfg config.Config, sendArgs, recvArgv []string, remote bool, meter *transferMeter) (execwrap.Result, error) {
+	return runPipeline(ctx, cfg, pipelineEnds{sendArgv: append([]string{cfg.Paths.ZFS}, sendArgs...), recvArgv: recvArgv, recvAsUser: remote}, meter)
+}
+
+// pipelineEnds describes both sides of a pipeline. Each side is either a command run
+// via sudo (or as the service user, see recvAsUser) or, when its argv is nil, an in-process reader or writer (stream files).
+type pipelineEnds struct {
+	sendArgv []string
+	source   io.Reader
+	recvArgv []string
+	sink     io.Writer
+	// recvAsUser runs recvArgv as the service user (ssh to a remote target) instead of
+	// via sudo.
+	recvAsUser bool
+}
+
+func runPipeline(ctx context.Context, cfg config.Config, ends pipelineEnds, meter *transferMeter) (execwrap.Result, error) {
 	limit := cfg.Limits.MaxOutputBytes
 	if limit <= 0 {
 		limit = 1 << 20
 	}
-	execCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Limits.MaxRuntimeSeconds)*time.Second)
-	if cfg.Limits.MaxRuntimeSeconds <= 0 {
-		execCtx, cancel = context.WithTimeout(ctx, 120*time.Second)
-	}
+	execCtx, cancel := execwrap.RuntimeContext(ctx, cfg.Limits)
 	defer cancel()
 
-	sendCmd := exec.CommandContext(execCtx, "sudo", append([]string{"-n", cfg.Paths.ZFS}, sendArgs...)...)
-	recvCmd := exec.CommandContext(execCtx, "sudo", append([]string{"-n", cfg.Paths.ZFS}, recvArgs...)...)
-
 	reader, writer := io.Pipe()
-	sendCmd.Stdout = writer
-	recvCmd.Stdin = reader
-
+	var out io.Writer = writer
+	if meter != nil {
+		out = io.MultiWriter(writer, meter)
+	}
 	errBuf := &limitedBuffer{limit: limit}
-	sendCmd.Stderr = errBuf
-	recvCmd.Stderr = errBuf
 
-	if err := recvCmd.Start(); err != nil {
-		_ = writer.Close()
-		_ = reader.Close()
-		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+	// The receiving side starts first and closes the pipe when it stops, so a sender
+	// never blocks on a reader that has gone away.
+	recvDone := make(chan error, 1)
+	if ends.recvArgv != nil {
+		var recvCmd *exec.Cmd
+		if ends.recvAsUser {
+			recvCmd = execwrap.UserCommand(execCtx, ends.recvArgv[0], ends.recvArgv[1:])
+		} else {
+			recvCmd = execwrap.Command(execCtx, ends.recvArgv[0], ends.recvArgv[1:])
+		}
+		recvCmd.Stdin = reader
+		recvCmd.Stderr = errBuf
+		if err := recvCmd.Start(); err != nil {
+			_ = writer.Close()
+			_ = reader.Close()
+			return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+		}
+		go func() {
+			err := recvCmd.Wait()
+			_ = reader.Close()
+			recvDone <- err
+		}()
+	} else {
+		go func() {
+			_, err := io.Copy(ends.sink, reader)
+			_ = reader.CloseWithError(err)
+			recvDone <- err
+		}()
 	}
-	if err := sendCmd.Start(); err != nil {
-		_ = writer.Close()
-		_ = reader.Close()
-		_ = recvCmd.Process.Kill()
-		return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+
+	sendDone := make(chan error, 1)
+	if ends.sendArgv != nil {
+		sendCmd := execwrap.Command(execCtx, ends.sendArgv[0], ends.sendArgv[1:])
+		sendCmd.Stdout = out
+		sendCmd.Stderr = errBuf
+		if err := sendCmd.Start(); err != nil {
+			_ = writer.Close()
+			_ = reader.Close()
+			<-recvDone
+			return execwrap.Result{ExitCode: 1, Stderr: err.Error()}, err
+		}
+		go func() {
+			err := sendCmd.Wait()
+			_ = writer.Close()
+			sendDone <- err
+		}()
+	} else {
+		go func() {
+			_, err := io.Copy(out, ends.source)
+			_ = writer.CloseWithError(err)
+			sendDone <- err
+		}()
 	}
 
-	sendErr := sendCmd.Wait()
-	_ = writer.Close()
-	recvErr := recvCmd.Wait()
-	_ = reader.Close()
+	sendErr := <-sendDone
+	recvErr := <-recvDone
 
 	sendExit := exitCodeFromErr(sendErr)
 	recvExit := exitCodeFromErr(recvErr)
@@ -693,12 +952,24 @@ func runZfsPipeline(ctx context.Context, cfg config.Config, sendArgs, recvArgs [
 		msg := strings.TrimSpace(errBuf.String())
 		if msg == "" {
 			msg = "zfs replication failed"
+			// In-process ends (stream files) fail with plain errors rather than exit codes.
+			for _, err := range []error{sendErr, recvErr} {
+				if err != nil && !isExitError(err) {
+					msg = err.Error()
+					break
+				}
+			}
 		}
 		return execwrap.Result{ExitCode: exitCode, Stderr: msg, Truncated: errBuf.truncated}, fmt.Errorf(msg)
 	}
 	return execwrap.Result{ExitCode: exitCode, Stderr: errBuf.String(), Truncated: errBuf.truncated}, nil
 }
 
+func isExitError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
 func exitCodeFromErr(err error) int {
 	if err == nil {
 		return 0